@@ -16,6 +16,10 @@ type Account struct {
 	key          crypto.PrivateKey
 	Registration *acme.RegistrationResource `json:"registration"`
 
+	// keyFromEnv is set if the key was read from LEGO_ACCOUNT_KEY, it has
+	// no file then.
+	keyFromEnv bool
+
 	conf *Configuration
 }
 
@@ -45,6 +49,33 @@ func NewAccount(email string, conf *Configuration) *Account {
 		}
 	}
 
+	return loadAccount(email, privKey, conf)
+}
+
+// NewAccountFromEnv creates a new account for an email address whose key is
+// read from the LEGO_ACCOUNT_KEY environment variable, as PEM. No key file is
+// read or written.
+func NewAccountFromEnv(email string, conf *Configuration) *Account {
+	keyPEM := os.Getenv("LEGO_ACCOUNT_KEY")
+	if keyPEM == "" {
+		logger().Fatal("--account-key-env is set, but LEGO_ACCOUNT_KEY is empty.")
+	}
+	privKey, err := parsePrivateKey([]byte(keyPEM))
+	if err != nil {
+		logger().Fatalf("Could not load the private account key from LEGO_ACCOUNT_KEY: %v", err)
+	}
+	if err := checkFolder(conf.AccountPath(email)); err != nil {
+		logger().Fatalf("Could not check/create directory for account %s: %v", email, err)
+	}
+
+	acc := loadAccount(email, privKey, conf)
+	acc.keyFromEnv = true
+	return acc
+}
+
+// loadAccount returns the account for an email address with privKey, and
+// with the registration saved in account.json if there is one.
+func loadAccount(email string, privKey crypto.PrivateKey, conf *Configuration) *Account {
 	accountFile := path.Join(conf.AccountPath(email), "account.json")
 	if _, err := os.Stat(accountFile); os.IsNotExist(err) {
 		return &Account{Email: email, key: privKey, conf: conf}
@@ -3,7 +3,9 @@ package acme
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -11,9 +13,12 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -22,6 +27,14 @@ var (
 	Logger *log.Logger
 )
 
+const (
+	// LEDirectoryProduction is the URL of the Let's Encrypt production ACME directory.
+	LEDirectoryProduction = "https://acme-v01.api.letsencrypt.org/directory"
+	// LEDirectoryStaging is the URL of the Let's Encrypt staging ACME directory.
+	// Certificates issued by staging are not trusted by browsers.
+	LEDirectoryStaging = "https://acme-staging.api.letsencrypt.org/directory"
+)
+
 // logf writes a log entry. It uses Logger if not
 // nil, otherwise it uses the default log.Logger.
 func logf(format string, args ...interface{}) {
@@ -55,6 +68,26 @@ type Client struct {
 	keyType    KeyType
 	issuerCert []byte
 	solvers    map[Challenge]solver
+	parallel   int
+
+	deployHooks    []DeployHook
+	preferredChain string
+	ctLogs         []CTLog
+	sctLogKeys     []*ecdsa.PublicKey
+	strictLinting  bool
+	maxNames       int
+
+	// dnsDelegates, dnsFollowCNAME and propagation configure the DNS-01
+	// solver, whenever SetChallengeProvider installs one.
+	dnsDelegates   map[string]ChallengeProvider
+	dnsFollowCNAME bool
+	propagation    PropagationConfig
+
+	rateLimits       rateLimits
+	maxRateLimitWait time.Duration
+
+	authzLock  sync.Mutex
+	authzCache map[string]authorizationResource
 }
 
 // NewClient creates a new ACME client on behalf of the user. The client will depend on
@@ -62,30 +95,30 @@ type Client struct {
 // key of type keyType (see KeyType contants) will be generated when requesting a new
 // certificate if one isn't provided.
 func NewClient(caDirURL string, user User, keyType KeyType) (*Client, error) {
+	return NewClientWithHTTPClient(caDirURL, user, keyType, nil)
+}
+
+// NewClientWithHTTPClient is like NewClient but sends all requests to the CA
+// through httpClient instead of the package level HTTPClient. Clients for
+// different CAs, e.g. a private CA with its own root certificates next to a
+// public one, can then be used side by side in the same process. A nil
+// httpClient falls back to HTTPClient.
+func NewClientWithHTTPClient(caDirURL string, user User, keyType KeyType, httpClient *http.Client) (*Client, error) {
+	if httpClient == nil {
+		httpClient = &HTTPClient
+	}
+
 	privKey := user.GetPrivateKey()
 	if privKey == nil {
 		return nil, errors.New("private key was nil")
 	}
 
-	var dir directory
-	if _, err := getJSON(caDirURL, &dir); err != nil {
-		return nil, fmt.Errorf("get directory at '%s': %v", caDirURL, err)
-	}
-
-	if dir.NewRegURL == "" {
-		return nil, errors.New("directory missing new registration URL")
-	}
-	if dir.NewAuthzURL == "" {
-		return nil, errors.New("directory missing new authz URL")
-	}
-	if dir.NewCertURL == "" {
-		return nil, errors.New("directory missing new certificate URL")
-	}
-	if dir.RevokeCertURL == "" {
-		return nil, errors.New("directory missing revoke certificate URL")
+	dir, err := getDirectory(httpClient, caDirURL)
+	if err != nil {
+		return nil, err
 	}
 
-	jws := &jws{privKey: privKey, directoryURL: caDirURL}
+	jws := &jws{privKey: privKey, directoryURL: caDirURL, client: httpClient}
 
 	// REVIEW: best possibility?
 	// Add all available solvers with the right index as per ACME
@@ -94,7 +127,7 @@ func NewClient(caDirURL string, user User, keyType KeyType) (*Client, error) {
 	solvers[HTTP01] = &httpChallenge{jws: jws, validate: validate, provider: &HTTPProviderServer{}}
 	solvers[TLSSNI01] = &tlsSNIChallenge{jws: jws, validate: validate, provider: &TLSProviderServer{}}
 
-	return &Client{directory: dir, user: user, jws: jws, keyType: keyType, solvers: solvers}, nil
+	return &Client{directory: dir, user: user, jws: jws, keyType: keyType, solvers: solvers, maxRateLimitWait: DefaultMaxRateLimitWait}, nil
 }
 
 // SetChallengeProvider specifies a custom provider p that can solve the given challenge type.
@@ -105,7 +138,7 @@ func (c *Client) SetChallengeProvider(challenge Challenge, p ChallengeProvider)
 	case TLSSNI01:
 		c.solvers[challenge] = &tlsSNIChallenge{jws: c.jws, validate: validate, provider: p}
 	case DNS01:
-		c.solvers[challenge] = &dnsChallenge{jws: c.jws, validate: validate, provider: p}
+		c.solvers[challenge] = &dnsChallenge{jws: c.jws, validate: validate, provider: p, delegates: c.dnsDelegates, followCNAME: c.dnsFollowCNAME, propagation: c.propagation}
 	default:
 		return fmt.Errorf("Unknown challenge %v", challenge)
 	}
@@ -149,6 +182,82 @@ func (c *Client) SetTLSAddress(iface string) error {
 	return nil
 }
 
+// SetParallelChallenges sets the number of authorizations which are solved
+// concurrently when obtaining a certificate for multiple domains. The default
+// of 1 solves them one after another.
+//
+// NOTE: Only use this with challenge providers which are able to present
+// multiple tokens at the same time, like most DNS providers. The built-in
+// HTTP-01 and TLS-SNI-01 servers can only serve one challenge at a time.
+func (c *Client) SetParallelChallenges(n int) {
+	c.parallel = n
+}
+
+// DefaultMaxNamesPerCertificate is the number of names ObtainCertificates
+// puts into one certificate unless SetMaxNamesPerCertificate is called, the
+// limit of Let's Encrypt.
+const DefaultMaxNamesPerCertificate = 100
+
+// SetMaxNamesPerCertificate sets the maximum number of names the CA accepts
+// in one certificate, at which ObtainCertificates splits the domains. A
+// value below 1 restores DefaultMaxNamesPerCertificate.
+func (c *Client) SetMaxNamesPerCertificate(n int) {
+	c.maxNames = n
+}
+
+// SetPrivateKey replaces the account key used to sign requests to the CA.
+// key can be any crypto.Signer with an RSA or ECDSA public key, e.g. one
+// kept on a hardware token, and has to be the key the account is
+// registered with.
+func (c *Client) SetPrivateKey(key crypto.Signer) error {
+	if key == nil || keyAsJWK(key.Public()) == nil {
+		return errors.New("unsupported private key")
+	}
+
+	c.jws.privKey = key
+	return nil
+}
+
+// SetDNSChallengeDomain delegates the DNS-01 challenge of domain to provider.
+// _acme-challenge.<domain> has to be a CNAME into a zone managed by provider,
+// which gets the TXT record at the end of the CNAME chain. Other domains keep
+// using the provider set with SetChallengeProvider. The DNS-01 challenge is
+// only solved once SetChallengeProvider set a provider for it.
+func (c *Client) SetDNSChallengeDomain(domain string, provider ChallengeProvider) error {
+	if provider == nil {
+		return fmt.Errorf("No DNS provider given for %s", domain)
+	}
+
+	if c.dnsDelegates == nil {
+		c.dnsDelegates = make(map[string]ChallengeProvider)
+	}
+	c.dnsDelegates[domain] = provider
+	if chlng, ok := c.solvers[DNS01]; ok {
+		chlng.(*dnsChallenge).delegates = c.dnsDelegates
+	}
+	return nil
+}
+
+// SetDNS01FollowCNAME makes the DNS-01 solver follow the CNAME records on
+// _acme-challenge.<domain> and present the challenge at the end of the chain,
+// so the provider creates the TXT record where the CA will look for it.
+func (c *Client) SetDNS01FollowCNAME(follow bool) {
+	c.dnsFollowCNAME = follow
+	if chlng, ok := c.solvers[DNS01]; ok {
+		chlng.(*dnsChallenge).followCNAME = follow
+	}
+}
+
+// SetPropagationConfig sets the timeout and poll interval of the DNS record
+// propagation check for all DNS providers, including the ones implementing
+// ChallengeProviderTimeout. Zero fields keep the values of the provider.
+func (c *Client) SetPropagationConfig(cfg PropagationConfig) {
+	c.propagation = cfg
+	if chlng, ok := c.solvers[DNS01]; ok {
+		chlng.(*dnsChallenge).propagation = cfg
+	}
+}
+
 // ExcludeChallenges explicitly removes challenges from the pool for solving.
 func (c *Client) ExcludeChallenges(challenges []Challenge) {
 	// Loop through all challenges and delete the requested one if found.
@@ -177,8 +286,8 @@ func (c *Client) Register() (*RegistrationResource, error) {
 	var regURI string
 	hdr, err := postJSON(c.jws, c.directory.NewRegURL, regMsg, &serverReg)
 	if err != nil {
-		remoteErr, ok := err.(RemoteError)
-		if ok && remoteErr.StatusCode == 409 {
+		problem, ok := err.(ProblemDetails)
+		if ok && problem.Status == http.StatusConflict {
 			regURI = hdr.Get("Location")
 			regMsg = registrationMessage{
 				Resource: "reg",
@@ -274,6 +383,83 @@ func (c *Client) QueryRegistration() (*RegistrationResource, error) {
 	return reg, nil
 }
 
+// UpdateAccountContacts replaces the contact details of the client's
+// registration with the given email addresses. Addresses without the
+// "mailto:" scheme are prefixed with it. An empty list removes all contacts.
+func (c *Client) UpdateAccountContacts(emails []string) error {
+	if c == nil || c.user == nil {
+		return errors.New("acme: cannot update the registration of a nil client or user")
+	}
+
+	contacts := make([]string, 0, len(emails))
+	for _, email := range emails {
+		if !strings.HasPrefix(email, "mailto:") {
+			email = "mailto:" + email
+		}
+		if !strings.Contains(strings.TrimPrefix(email, "mailto:"), "@") {
+			return fmt.Errorf("acme: invalid contact email address %q", email)
+		}
+		contacts = append(contacts, email)
+	}
+
+	reg := c.user.GetRegistration()
+	logf("[INFO] acme: Updating contacts of account %s", reg.URI)
+
+	regMsg := registrationMessage{
+		Resource: "reg",
+		Contact:  contacts,
+	}
+
+	var serverReg Registration
+	if _, err := postJSON(c.jws, reg.URI, regMsg, &serverReg); err != nil {
+		return err
+	}
+
+	reg.Body.Contact = serverReg.Contact
+	return nil
+}
+
+// RolloverKey replaces the key of the client's registration with newKey. The
+// CA receives a request signed by the current key, carrying a second one
+// signed by newKey, so both keys vouch for the change. Afterwards the client
+// signs all requests with newKey.
+func (c *Client) RolloverKey(newKey crypto.Signer) error {
+	if c == nil || c.user == nil {
+		return errors.New("acme: cannot roll over the key of a nil client or user")
+	}
+	if c.directory.KeyChangeURL == "" {
+		return errors.New("acme: the CA does not support account key rollover")
+	}
+	if newKey == nil || keyAsJWK(newKey.Public()) == nil {
+		return errors.New("unsupported private key")
+	}
+
+	reg := c.user.GetRegistration()
+	logf("[INFO] acme: Rolling over the key of account %s", reg.URI)
+
+	keyChangeMsg, err := json.Marshal(keyChangeMessage{
+		Resource: "key-change",
+		Account:  reg.URI,
+		NewKey:   keyAsJWK(newKey.Public()),
+	})
+	if err != nil {
+		return errors.New("Failed to marshal network message...")
+	}
+
+	j := &jws{privKey: newKey, directoryURL: c.jws.directoryURL, client: c.jws.client}
+	inner, err := j.signContent(keyChangeMsg)
+	if err != nil {
+		return fmt.Errorf("acme: could not sign the key change with the new key: %v", err)
+	}
+
+	if _, err := postJSON(c.jws, c.directory.KeyChangeURL, json.RawMessage(inner), nil); err != nil {
+		return err
+	}
+
+	c.jws.privKey = newKey
+	return nil
+}
+
 // AgreeToTOS updates the Client registration and sends the agreement to
 // the server.
 func (c *Client) AgreeToTOS() error {
@@ -285,6 +471,61 @@ func (c *Client) AgreeToTOS() error {
 	return err
 }
 
+// Authorize solves a challenge for domain ahead of requesting a certificate,
+// which helps with domains whose challenges take long to complete. The valid
+// authorization is cached until it expires, so certificates requested for
+// domain in the meantime do not need to solve another challenge.
+func (c *Client) Authorize(domain string) (*Authorization, error) {
+	authzs, failures := c.getChallenges([]string{domain})
+	if err, ok := failures[domain]; ok {
+		return nil, err
+	}
+
+	if errs := c.solveChallenges(authzs); len(errs) > 0 {
+		return nil, errs[domain]
+	}
+
+	// The expiry changes once the authorization becomes valid.
+	authz := authzs[0]
+	var body authorization
+	if _, err := getJSON(c.jws.httpClient(), authz.AuthURL, &body); err == nil {
+		authz.Body = body
+	} else {
+		logf("[WARNING][%s] acme: Could not refresh authorization: %v", domain, err)
+		authz.Body.Status = "valid"
+	}
+	c.cacheAuthorization(authz)
+
+	return &Authorization{Domain: domain, URI: authz.AuthURL, Expires: authz.Body.Expires}, nil
+}
+
+func (c *Client) cacheAuthorization(authz authorizationResource) {
+	c.authzLock.Lock()
+	defer c.authzLock.Unlock()
+
+	if c.authzCache == nil {
+		c.authzCache = make(map[string]authorizationResource)
+	}
+	c.authzCache[authz.Domain] = authz
+}
+
+// cachedAuthorization returns the cached authorization for domain as long
+// as it is still valid.
+func (c *Client) cachedAuthorization(domain string) (authorizationResource, bool) {
+	c.authzLock.Lock()
+	defer c.authzLock.Unlock()
+
+	authz, ok := c.authzCache[domain]
+	if !ok {
+		return authorizationResource{}, false
+	}
+	if authz.Body.Status != "valid" || !time.Now().Before(authz.Body.Expires) {
+		delete(c.authzCache, domain)
+		return authorizationResource{}, false
+	}
+	return authz, true
+}
+
 // ObtainCertificateForCSR tries to obtain a certificate matching the CSR passed into it.
 // The domains are inferred from the CommonName and SubjectAltNames, if any. The private key
 // for this CSR is not required.
@@ -292,11 +533,17 @@ func (c *Client) AgreeToTOS() error {
 // your issued certificate as a bundle.
 // This function will never return a partial certificate. If one domain in the list fails,
 // the whole certificate will fail.
+// ACME only validates dns identifiers, so a CSR asking for email, URI or IP
+// address names, e.g. a SPIFFE ID, fails before anything is sent to the CA.
 func (c *Client) ObtainCertificateForCSR(csr x509.CertificateRequest, bundle bool) (CertificateResource, map[string]error) {
 	// figure out what domains it concerns
 	// start with the common name
 	domains := []string{csr.Subject.CommonName}
 
+	if err := checkCSRNames(csr); err != nil {
+		return CertificateResource{}, map[string]error{domains[0]: err}
+	}
+
 	// loop over the SubjectAltName DNS names
 DNSNames:
 	for _, sanName := range csr.DNSNames {
@@ -341,19 +588,115 @@ DNSNames:
 	// Add the CSR to the certificate so that it can be used for renewals.
 	cert.CSR = pemEncode(&csr)
 
+	if err == nil {
+		if err := c.checkCertificate(cert); err != nil {
+			for _, chln := range challenges {
+				failures[chln.Domain] = err
+			}
+			return cert, failures
+		}
+		c.submitToCTLogs(&cert)
+		c.runDeployHooks(cert)
+	}
 	return cert, failures
 }
 
+// checkCertificate lints a newly issued certificate and verifies its SCTs
+// before it is returned.
+func (c *Client) checkCertificate(cert CertificateResource) error {
+	if err := c.lintCertificate(cert); err != nil {
+		return err
+	}
+	return c.verifyCertificateSCTs(cert)
+}
+
+// NormalizeDomain returns domain the way the names of certificates are
+// stored: lower cased and without surrounding space or a trailing dot.
+func NormalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// normalizeDomains lower cases domains, strips trailing dots and removes
+// empty names, duplicates and the names covered by a wildcard of domains,
+// e.g. sub.example.com next to *.example.com. The order of the remaining
+// names is kept. It is an error if no name remains.
+func normalizeDomains(domains []string) ([]string, error) {
+	wildcards := make(map[string]bool)
+	for _, domain := range domains {
+		domain = NormalizeDomain(domain)
+		if strings.HasPrefix(domain, "*.") {
+			wildcards[domain[2:]] = true
+		}
+	}
+
+	var normalized, removed []string
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		name := NormalizeDomain(domain)
+		if name == "" || seen[name] {
+			removed = append(removed, fmt.Sprintf("%q", domain))
+			continue
+		}
+		if i := strings.Index(name, "."); i > 0 && !strings.HasPrefix(name, "*.") && wildcards[name[i+1:]] {
+			removed = append(removed, fmt.Sprintf("%q (covered by *.%s)", domain, name[i+1:]))
+			continue
+		}
+
+		seen[name] = true
+		normalized = append(normalized, name)
+	}
+
+	if len(removed) > 0 {
+		logf("[INFO][%s] acme: Removed the names %s", strings.Join(normalized, ", "), strings.Join(removed, ", "))
+	}
+	if len(normalized) == 0 {
+		return nil, errors.New("acme: No domains left to obtain a certificate for")
+	}
+	return normalized, nil
+}
+
+// checkCSRNames returns an error if csr has subject alternative names other
+// than DNS names, which the CA has no identifier type to authorize.
+func checkCSRNames(csr x509.CertificateRequest) error {
+	var names []string
+	names = append(names, csr.EmailAddresses...)
+	for _, uri := range csr.URIs {
+		names = append(names, uri.String())
+	}
+	for _, ip := range csr.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("acme: CSR contains names other than DNS names, which ACME cannot authorize: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
 // ObtainCertificate tries to obtain a single certificate using all domains passed into it.
 // The first domain in domains is used for the CommonName field of the certificate, all other
-// domains are added using the Subject Alternate Names extension. A new private key is generated
+// domains are added using the Subject Alternate Names extension. The domains are lower cased,
+// and duplicates as well as names covered by one of the wildcards are dropped. A new private key is generated
 // for every invocation of this function. If you do not want that you can supply your own private key
 // in the privKey parameter. If this parameter is non-nil it will be used instead of generating a new one.
+// privKey may be any crypto.Signer, e.g. a key on a hardware token; the returned
+// CertificateResource then carries no PrivateKey.
 // If bundle is true, the []byte contains both the issuer certificate and
 // your issued certificate as a bundle.
 // This function will never return a partial certificate. If one domain in the list fails,
 // the whole certificate will fail.
 func (c *Client) ObtainCertificate(domains []string, bundle bool, privKey crypto.PrivateKey) (CertificateResource, map[string]error) {
+	return c.obtainCertificate(domains, bundle, privKey, pkix.Name{})
+}
+
+// obtainCertificate implements ObtainCertificate, requesting the certificate
+// with subject. The CommonName of subject is always the first domain.
+func (c *Client) obtainCertificate(domains []string, bundle bool, privKey crypto.PrivateKey, subject pkix.Name) (CertificateResource, map[string]error) {
+	names, err := normalizeDomains(domains)
+	if err != nil {
+		return CertificateResource{}, map[string]error{strings.Join(domains, ", "): err}
+	}
+	domains = names
+
 	if bundle {
 		logf("[INFO][%s] acme: Obtaining bundled SAN certificate", strings.Join(domains, ", "))
 	} else {
@@ -374,18 +717,145 @@ func (c *Client) ObtainCertificate(domains []string, bundle bool, privKey crypto
 
 	logf("[INFO][%s] acme: Validations succeeded; requesting certificates", strings.Join(domains, ", "))
 
-	cert, err := c.requestCertificate(challenges, bundle, privKey)
+	cert, err := c.requestCertificate(challenges, bundle, privKey, subject)
 	if err != nil {
 		for _, chln := range challenges {
 			failures[chln.Domain] = err
 		}
 	}
 
+	if err == nil {
+		if err := c.checkCertificate(cert); err != nil {
+			for _, chln := range challenges {
+				failures[chln.Domain] = err
+			}
+			return cert, failures
+		}
+		c.submitToCTLogs(&cert)
+		c.runDeployHooks(cert)
+	}
 	return cert, failures
 }
 
+// ObtainCertificates is like ObtainCertificate but splits domains into as
+// few certificates as the CA allows, see SetMaxNamesPerCertificate, e.g. 250
+// domains into three certificates of 100, 100 and 50 names. The first domain
+// of each certificate is its CommonName and all of them share privKey if it
+// is given. A certificate failing does not keep the others from being
+// returned; the failures hold the domains of the failed ones.
+func (c *Client) ObtainCertificates(domains []string, bundle bool, privKey crypto.PrivateKey) ([]CertificateResource, map[string]error) {
+	names, err := normalizeDomains(domains)
+	if err != nil {
+		return nil, map[string]error{strings.Join(domains, ", "): err}
+	}
+
+	maxNames := c.maxNames
+	if maxNames < 1 {
+		maxNames = DefaultMaxNamesPerCertificate
+	}
+	if len(names) > maxNames {
+		logf("[INFO] acme: Splitting %d domains into certificates of at most %d names", len(names), maxNames)
+	}
+
+	var certs []CertificateResource
+	failures := make(map[string]error)
+	for start := 0; start < len(names); start += maxNames {
+		end := start + maxNames
+		if end > len(names) {
+			end = len(names)
+		}
+
+		cert, chunkFailures := c.ObtainCertificate(names[start:end], bundle, privKey)
+		if len(chunkFailures) > 0 {
+			for domain, err := range chunkFailures {
+				failures[domain] = err
+			}
+			continue
+		}
+		certs = append(certs, cert)
+	}
+	return certs, failures
+}
+
+// Revocation reason codes as defined in RFC 5280, section 5.3.1. Code 7 is
+// not used.
+const (
+	RevocationReasonUnspecified          = 0
+	RevocationReasonKeyCompromise        = 1
+	RevocationReasonCACompromise         = 2
+	RevocationReasonAffiliationChanged   = 3
+	RevocationReasonSuperseded           = 4
+	RevocationReasonCessationOfOperation = 5
+	RevocationReasonCertificateHold      = 6
+	RevocationReasonRemoveFromCRL        = 8
+	RevocationReasonPrivilegeWithdrawn   = 9
+	RevocationReasonAACompromise         = 10
+)
+
+// revocationReasons maps the RFC 5280 names of the revocation reasons to
+// their codes.
+var revocationReasons = map[string]int{
+	"unspecified":          RevocationReasonUnspecified,
+	"keyCompromise":        RevocationReasonKeyCompromise,
+	"cACompromise":         RevocationReasonCACompromise,
+	"affiliationChanged":   RevocationReasonAffiliationChanged,
+	"superseded":           RevocationReasonSuperseded,
+	"cessationOfOperation": RevocationReasonCessationOfOperation,
+	"certificateHold":      RevocationReasonCertificateHold,
+	"removeFromCRL":        RevocationReasonRemoveFromCRL,
+	"privilegeWithdrawn":   RevocationReasonPrivilegeWithdrawn,
+	"aACompromise":         RevocationReasonAACompromise,
+}
+
+// ParseRevocationReason returns the code of a revocation reason given by its
+// RFC 5280 name, e.g. "keyCompromise", compared case insensitively, or by its
+// code.
+func ParseRevocationReason(reason string) (int, error) {
+	if code, err := strconv.Atoi(reason); err == nil {
+		for _, known := range revocationReasons {
+			if code == known {
+				return code, nil
+			}
+		}
+		return 0, fmt.Errorf("Invalid revocation reason %d", code)
+	}
+
+	for name, code := range revocationReasons {
+		if strings.EqualFold(name, reason) {
+			return code, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown revocation reason %q", reason)
+}
+
 // RevokeCertificate takes a PEM encoded certificate or bundle and tries to revoke it at the CA.
 func (c *Client) RevokeCertificate(certificate []byte) error {
+	return c.RevokeCertificateWithReason(certificate, RevocationReasonUnspecified)
+}
+
+// RevokeCertificateWithReason revokes a PEM encoded certificate or bundle
+// giving the CA one of the RevocationReason codes.
+func (c *Client) RevokeCertificateWithReason(certificate []byte, reason int) error {
+	return c.revokeCertificate(c.jws, certificate, reason)
+}
+
+// RevokeCertificateWithKey revokes a PEM encoded certificate or bundle by
+// signing the request with the certificate's own private key instead of the
+// account key, e.g. when the account key is lost.
+func (c *Client) RevokeCertificateWithKey(certificate []byte, reason int, certKey crypto.PrivateKey) error {
+	if certKey == nil {
+		return errors.New("private key was nil")
+	}
+
+	j := &jws{privKey: certKey, directoryURL: c.jws.directoryURL, client: c.jws.client}
+	return c.revokeCertificate(j, certificate, reason)
+}
+
+func (c *Client) revokeCertificate(j *jws, certificate []byte, reason int) error {
+	if reason < RevocationReasonUnspecified || reason > RevocationReasonAACompromise || reason == 7 {
+		return fmt.Errorf("Invalid revocation reason %d", reason)
+	}
+
 	certificates, err := parsePEMBundle(certificate)
 	if err != nil {
 		return err
@@ -398,7 +868,7 @@ func (c *Client) RevokeCertificate(certificate []byte) error {
 
 	encodedCert := base64.URLEncoding.EncodeToString(x509Cert.Raw)
 
-	_, err = postJSON(c.jws, c.directory.RevokeCertURL, revokeCertMessage{Resource: "revoke-cert", Certificate: encodedCert}, nil)
+	_, err = postJSON(j, c.directory.RevokeCertURL, revokeCertMessage{Resource: "revoke-cert", Certificate: encodedCert, Reason: reason}, nil)
 	return err
 }
 
@@ -436,7 +906,7 @@ func (c *Client) RenewCertificate(cert CertificateResource, bundle bool) (Certif
 			return CertificateResource{}, err
 		}
 		newCert, failures := c.ObtainCertificateForCSR(*csr, bundle)
-		return newCert, failures[cert.Domain]
+		return newCert, renewalError(cert.Domain, failures)
 	}
 
 	var privKey crypto.PrivateKey
@@ -447,53 +917,152 @@ func (c *Client) RenewCertificate(cert CertificateResource, bundle bool) (Certif
 		}
 	}
 
-	var domains []string
-	var failures map[string]error
-	// check for SAN certificate
-	if len(x509Cert.DNSNames) > 1 {
-		domains = append(domains, x509Cert.Subject.CommonName)
-		for _, sanDomain := range x509Cert.DNSNames {
-			if sanDomain == x509Cert.Subject.CommonName {
-				continue
-			}
-			domains = append(domains, sanDomain)
+	newCert, failures := c.ObtainCertificate(certificateDomains(x509Cert), bundle, privKey)
+	return newCert, renewalError(cert.Domain, failures)
+}
+
+// RenewWithExistingSubject renews a certificate like RenewCertificate, but
+// requests the new one with the Organization, OrganizationalUnit, Country,
+// Province and Locality of the existing certificate instead of an empty
+// subject, so e.g. the fields of an OV or EV certificate need not be given
+// again on every renewal. A certificate based off a CSR is renewed with that
+// CSR, which already carries its subject.
+func (c *Client) RenewWithExistingSubject(cert CertificateResource, bundle bool) (CertificateResource, error) {
+	if len(cert.CSR) > 0 {
+		return c.RenewCertificate(cert, bundle)
+	}
+
+	certificates, err := parsePEMBundle(cert.Certificate)
+	if err != nil {
+		return CertificateResource{}, err
+	}
+
+	x509Cert := certificates[0]
+	if x509Cert.IsCA {
+		return CertificateResource{}, fmt.Errorf("[%s] Certificate bundle starts with a CA certificate", cert.Domain)
+	}
+
+	timeLeft := x509Cert.NotAfter.Sub(time.Now().UTC())
+	logf("[INFO][%s] acme: Trying renewal with the existing subject and %d hours remaining", cert.Domain, int(timeLeft.Hours()))
+
+	var privKey crypto.PrivateKey
+	if cert.PrivateKey != nil {
+		privKey, err = parsePEMPrivateKey(cert.PrivateKey)
+		if err != nil {
+			return CertificateResource{}, err
 		}
-	} else {
-		domains = append(domains, x509Cert.Subject.CommonName)
 	}
 
-	newCert, failures := c.ObtainCertificate(domains, bundle, privKey)
-	return newCert, failures[cert.Domain]
+	subject := pkix.Name{
+		Organization:       x509Cert.Subject.Organization,
+		OrganizationalUnit: x509Cert.Subject.OrganizationalUnit,
+		Country:            x509Cert.Subject.Country,
+		Province:           x509Cert.Subject.Province,
+		Locality:           x509Cert.Subject.Locality,
+	}
+
+	newCert, failures := c.obtainCertificate(certificateDomains(x509Cert), bundle, privKey, subject)
+	return newCert, renewalError(cert.Domain, failures)
+}
+
+// renewalError returns the failure of domain, or if there is none, the first
+// other failure of a renewal, so a renewal failing only for another name of
+// the certificate is not taken for a success.
+func renewalError(domain string, failures map[string]error) error {
+	if err, ok := failures[NormalizeDomain(domain)]; ok {
+		return err
+	}
+
+	var names []string
+	for name := range failures {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return failures[names[0]]
+}
+
+// certificateDomains returns the CommonName of cert followed by its other
+// DNS names.
+func certificateDomains(cert *x509.Certificate) []string {
+	domains := []string{cert.Subject.CommonName}
+	for _, sanDomain := range cert.DNSNames {
+		if sanDomain == cert.Subject.CommonName {
+			continue
+		}
+		domains = append(domains, sanDomain)
+	}
+	return domains
 }
 
 // Looks through the challenge combinations to find a solvable match.
-// Then solves the challenges in series and returns.
+// Then solves the challenges, up to c.parallel domains at a time, and returns.
 func (c *Client) solveChallenges(challenges []authorizationResource) map[string]error {
+	parallel := c.parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var wg sync.WaitGroup
+	errc := make(chan domainError, len(challenges))
+	sem := make(chan struct{}, parallel)
+
 	// loop through the resources, basically through the domains.
-	failures := make(map[string]error)
 	for _, authz := range challenges {
 		if authz.Body.Status == "valid" {
 			// Boulder might recycle recent validated authz (see issue #267)
 			logf("[INFO][%s] acme: Authorization already valid; skipping challenge", authz.Domain)
 			continue
 		}
-		// no solvers - no solving
-		if solvers := c.chooseSolvers(authz.Body, authz.Domain); solvers != nil {
-			for i, solver := range solvers {
-				// TODO: do not immediately fail if one domain fails to validate.
-				err := solver.Solve(authz.Body.Challenges[i], authz.Domain)
-				if err != nil {
-					failures[authz.Domain] = err
-				}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(authz authorizationResource) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := c.solveChallenge(authz); err != nil {
+				errc <- domainError{Domain: authz.Domain, Error: err}
 			}
-		} else {
-			failures[authz.Domain] = fmt.Errorf("[%s] acme: Could not determine solvers", authz.Domain)
-		}
+		}(authz)
+	}
+
+	wg.Wait()
+	close(errc)
+
+	failures := make(map[string]error)
+	for err := range errc {
+		failures[err.Domain] = err.Error
 	}
 
 	return failures
 }
 
+// solveChallenge runs all solvers of a solvable combination for a single
+// authorization.
+func (c *Client) solveChallenge(authz authorizationResource) error {
+	// no solvers - no solving
+	solvers := c.chooseSolvers(authz.Body, authz.Domain)
+	if solvers == nil {
+		return fmt.Errorf("[%s] acme: Could not determine solvers", authz.Domain)
+	}
+
+	var failure error
+	for i, solver := range solvers {
+		// TODO: do not immediately fail if one domain fails to validate.
+		err := solver.Solve(authz.Body.Challenges[i], authz.Domain)
+		if err != nil {
+			failure = err
+		}
+	}
+
+	return failure
+}
+
 // Checks all combinations from the server and returns an array of
 // solvers which should get executed in series.
 func (c *Client) chooseSolvers(auth authorization, domain string) map[int]solver {
@@ -519,11 +1088,27 @@ func (c *Client) chooseSolvers(auth authorization, domain string) map[int]solver
 func (c *Client) getChallenges(domains []string) ([]authorizationResource, map[string]error) {
 	resc, errc := make(chan authorizationResource), make(chan domainError)
 
+	responses := make(map[string]authorizationResource)
+	var pending []string
 	for _, domain := range domains {
+		if authz, ok := c.cachedAuthorization(domain); ok {
+			logf("[INFO][%s] acme: Using cached authorization", domain)
+			responses[domain] = authz
+			continue
+		}
+		pending = append(pending, domain)
+	}
+
+	for _, domain := range pending {
 		go func(domain string) {
 			authMsg := authorization{Resource: "new-authz", Identifier: identifier{Type: "dns", Value: domain}}
 			var authz authorization
-			hdr, err := postJSON(c.jws, c.user.GetRegistration().NewAuthzURL, authMsg, &authz)
+			var hdr http.Header
+			err := c.withRateLimit(domain, func() error {
+				var err error
+				hdr, err = postJSON(c.jws, c.user.GetRegistration().NewAuthzURL, authMsg, &authz)
+				return err
+			})
 			if err != nil {
 				errc <- domainError{Domain: domain, Error: err}
 				return
@@ -531,7 +1116,7 @@ func (c *Client) getChallenges(domains []string) ([]authorizationResource, map[s
 
 			links := parseLinks(hdr["Link"])
 			if links["next"] == "" {
-				logf("[ERROR][%s] acme: Server did not provide next link to proceed", domain)
+				errc <- domainError{Domain: domain, Error: errors.New("acme: Server did not provide next link to proceed")}
 				return
 			}
 
@@ -539,9 +1124,8 @@ func (c *Client) getChallenges(domains []string) ([]authorizationResource, map[s
 		}(domain)
 	}
 
-	responses := make(map[string]authorizationResource)
 	failures := make(map[string]error)
-	for i := 0; i < len(domains); i++ {
+	for i := 0; i < len(pending); i++ {
 		select {
 		case res := <-resc:
 			responses[res.Domain] = res
@@ -563,7 +1147,7 @@ func (c *Client) getChallenges(domains []string) ([]authorizationResource, map[s
 	return challenges, failures
 }
 
-func (c *Client) requestCertificate(authz []authorizationResource, bundle bool, privKey crypto.PrivateKey) (CertificateResource, error) {
+func (c *Client) requestCertificate(authz []authorizationResource, bundle bool, privKey crypto.PrivateKey, subject pkix.Name) (CertificateResource, error) {
 	if len(authz) == 0 {
 		return CertificateResource{}, errors.New("Passed no authorizations to requestCertificate!")
 	}
@@ -583,8 +1167,8 @@ func (c *Client) requestCertificate(authz []authorizationResource, bundle bool,
 		san = append(san, auth.Domain)
 	}
 
-	// TODO: should the CSR be customizable?
-	csr, err := generateCsr(privKey, commonName.Domain, san)
+	subject.CommonName = commonName.Domain
+	csr, err := generateCsrWithSubject(privKey, subject, san)
 	if err != nil {
 		return CertificateResource{}, err
 	}
@@ -606,7 +1190,16 @@ func (c *Client) requestCertificateForCsr(authz []authorizationResource, bundle
 		return CertificateResource{}, err
 	}
 
-	resp, err := c.jws.post(commonName.NewCertURL, jsonBytes)
+	var resp *http.Response
+	err = c.withRateLimit(commonName.Domain, func() error {
+		var err error
+		resp, err = c.jws.post(commonName.NewCertURL, jsonBytes)
+		if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+			defer resp.Body.Close()
+			return handleHTTPError(resp)
+		}
+		return err
+	})
 	if err != nil {
 		return CertificateResource{}, err
 	}
@@ -652,6 +1245,11 @@ func (c *Client) requestCertificateForCsr(authz []authorizationResource, bundle
 				}
 
 				cerRes.Certificate = issuedCert
+				if bundle {
+					cerRes.AlternativeChains = c.getAlternativeChains(commonName.Domain, resp.Header["Link"])
+					c.selectPreferredChain(&cerRes)
+				}
+
 				logf("[INFO][%s] Server responded with a certificate.", commonName.Domain)
 				return cerRes, nil
 			}
@@ -672,7 +1270,7 @@ func (c *Client) requestCertificateForCsr(authz []authorizationResource, bundle
 			return CertificateResource{}, handleHTTPError(resp)
 		}
 
-		resp, err = httpGet(cerRes.CertURL)
+		resp, err = httpGet(c.jws.httpClient(), cerRes.CertURL)
 		if err != nil {
 			return CertificateResource{}, err
 		}
@@ -687,24 +1285,106 @@ func (c *Client) getIssuerCertificate(url string) ([]byte, error) {
 		return c.issuerCert, nil
 	}
 
-	resp, err := httpGet(url)
+	issuerBytes, _, err := c.getDERCertificate(url)
 	if err != nil {
 		return nil, err
 	}
+
+	c.issuerCert = issuerBytes
+	return issuerBytes, err
+}
+
+// getDERCertificate requests a single DER encoded certificate and returns
+// it along with the links of the response.
+func (c *Client) getDERCertificate(url string) ([]byte, map[string]string, error) {
+	resp, err := httpGet(c.jws.httpClient(), url)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer resp.Body.Close()
 
-	issuerBytes, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	certBytes, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	_, err = x509.ParseCertificate(issuerBytes)
+	_, err = x509.ParseCertificate(certBytes)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	c.issuerCert = issuerBytes
-	return issuerBytes, err
+	return certBytes, parseLinks(resp.Header["Link"]), nil
+}
+
+// getAlternativeChains downloads the chains linked as rel="alternate" from
+// a certificate response. Every alternative is the issued certificate with
+// its own "up" link, bundled the same way as the default chain. Chains that
+// cannot be fetched are skipped.
+func (c *Client) getAlternativeChains(domain string, links []string) [][]byte {
+	var chains [][]byte
+	for _, url := range linksWithRel(links, "alternate") {
+		cert, certLinks, err := c.getDERCertificate(url)
+		if err != nil {
+			logf("[WARNING][%s] acme: Could not fetch alternative chain %s: %v", domain, url, err)
+			continue
+		}
+
+		chain := pemEncode(derCertificateBytes(cert))
+		if up, ok := certLinks["up"]; ok {
+			issuer, _, err := c.getDERCertificate(up)
+			if err != nil {
+				logf("[WARNING][%s] acme: Could not fetch issuer of alternative chain %s: %v", domain, url, err)
+				continue
+			}
+			chain = append(chain, pemEncode(derCertificateBytes(issuer))...)
+		}
+		chains = append(chains, chain)
+	}
+	return chains
+}
+
+// SetPreferredChain makes the client return the chain matching match as
+// Certificate if the CA offers alternative chains for bundled certificates.
+// match is the hex encoded SHA-256 fingerprint of a certificate in the chain
+// or the common name of the root certificate the chain leads to. The other
+// chains stay available in AlternativeChains.
+func (c *Client) SetPreferredChain(match string) {
+	c.preferredChain = match
+}
+
+// selectPreferredChain swaps the preferred alternative chain into
+// cert.Certificate if the default chain does not match.
+func (c *Client) selectPreferredChain(cert *CertificateResource) {
+	if c.preferredChain == "" || chainMatches(cert.Certificate, c.preferredChain) {
+		return
+	}
+
+	for i, chain := range cert.AlternativeChains {
+		if chainMatches(chain, c.preferredChain) {
+			cert.AlternativeChains[i], cert.Certificate = cert.Certificate, chain
+			return
+		}
+	}
+	logf("[INFO][%s] acme: No chain matches %s; using the default chain", cert.Domain, c.preferredChain)
+}
+
+// linksWithRel returns the targets of all links with the relation rel.
+// Unlike parseLinks it keeps every link of a relation.
+func linksWithRel(links []string, rel string) []string {
+	var targets []string
+	for _, link := range links {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 {
+			continue
+		}
+		for _, param := range parts[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && kv[0] == "rel" && strings.Trim(kv[1], `"`) == rel {
+				targets = append(targets, strings.Trim(strings.TrimSpace(parts[0]), "<>"))
+			}
+		}
+	}
+	return targets
 }
 
 func parseLinks(links []string) map[string]string {
@@ -759,7 +1439,7 @@ func validate(j *jws, domain, uri string, chlng challenge) error {
 		}
 		time.Sleep(time.Duration(ra) * time.Second)
 
-		hdr, err = getJSON(uri, &challengeResponse)
+		hdr, err = getJSON(j.httpClient(), uri, &challengeResponse)
 		if err != nil {
 			return err
 		}
@@ -2,14 +2,27 @@ package acme
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/xenolf/lego/acme/testserver"
+	"gopkg.in/square/go-jose.v1"
 )
 
 func TestNewClient(t *testing.T) {
@@ -168,6 +181,66 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func TestSolveChallengesParallel(t *testing.T) {
+	domains := []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com", "fail.example.com"}
+
+	var challenges []authorizationResource
+	for _, domain := range domains {
+		challenges = append(challenges, authorizationResource{
+			Domain: domain,
+			Body: authorization{
+				Challenges:   []challenge{{Type: "mock-01"}},
+				Combinations: [][]int{{0}},
+			},
+		})
+	}
+
+	for _, parallel := range []int{0, 1, 3} {
+		mock := &concurrencySolver{}
+		client := &Client{solvers: map[Challenge]solver{"mock-01": mock}}
+		client.SetParallelChallenges(parallel)
+
+		failures := client.solveChallenges(challenges)
+		if len(failures) != 1 || failures["fail.example.com"] == nil {
+			t.Errorf("[%d] Expected exactly one failure for fail.example.com, got %v", parallel, failures)
+		}
+
+		want := parallel
+		if want < 1 {
+			want = 1
+		}
+		if mock.max != want {
+			t.Errorf("[%d] Expected %d challenges to be solved concurrently, got %d", parallel, want, mock.max)
+		}
+	}
+}
+
+// concurrencySolver records the maximum number of concurrent Solve calls.
+type concurrencySolver struct {
+	sync.Mutex
+	current, max int
+}
+
+func (s *concurrencySolver) Solve(chlng challenge, domain string) error {
+	s.Lock()
+	s.current++
+	if s.current > s.max {
+		s.max = s.current
+	}
+	s.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+
+	s.Lock()
+	s.current--
+	s.Unlock()
+
+	if strings.HasPrefix(domain, "fail.") {
+		return errors.New("solve failed")
+	}
+	return nil
+}
+
 // writeJSONResponse marshals the body as JSON and writes it to the response.
 func writeJSONResponse(w http.ResponseWriter, body interface{}) {
 	bs, err := json.Marshal(body)
@@ -187,6 +260,679 @@ func stubValidate(j *jws, domain, uri string, chlng challenge) error {
 	return nil
 }
 
+func TestUpdateAccountContacts(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+
+	var received registrationMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+		if r.Method != "POST" {
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		sig, err := jose.ParseSigned(string(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payload, err := sig.Verify(&privKey.PublicKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.Unmarshal(payload, &received)
+		writeJSONResponse(w, map[string][]string{"contact": received.Contact})
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL},
+		privatekey: privKey,
+	}
+	client := &Client{user: user, jws: &jws{privKey: privKey, directoryURL: ts.URL}}
+
+	if err := client.UpdateAccountContacts([]string{"new@example.com", "mailto:other@example.com"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{"mailto:new@example.com", "mailto:other@example.com"}
+	if received.Resource != "reg" || !reflect.DeepEqual(received.Contact, expected) {
+		t.Errorf("Expected a reg update with contacts %v, got %+v", expected, received)
+	}
+	if !reflect.DeepEqual(user.regres.Body.Contact, expected) {
+		t.Errorf("Expected the registration contacts to be %v, got %v", expected, user.regres.Body.Contact)
+	}
+
+	if err := client.UpdateAccountContacts([]string{"mailto:"}); err == nil {
+		t.Error("Expected an error for an invalid email address")
+	}
+}
+
+func TestClientWithTestServer(t *testing.T) {
+	ts := testserver.New()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{email: "test@test.com", regres: new(RegistrationResource), privatekey: key}
+
+	client, err := NewClient(ts.DirectoryURL(), user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	client.SetChallengeProvider(HTTP01, &noopProvider{})
+	client.ExcludeChallenges([]Challenge{TLSSNI01, DNS01})
+
+	reg, err := client.Register()
+	if err != nil {
+		t.Fatalf("Could not register: %v", err)
+	}
+	*user.regres = *reg
+
+	domains := []string{"example.com", "www.example.com"}
+	cert, failures := client.ObtainCertificate(domains, true, nil)
+	if len(failures) > 0 {
+		t.Fatalf("Expected no failures, got %v", failures)
+	}
+
+	certs, err := parsePEMBundle(cert.Certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("Expected a bundle of 2 certificates, got %d", len(certs))
+	}
+	if err := certs[0].CheckSignatureFrom(ts.CACertificate()); err != nil {
+		t.Errorf("Expected the certificate to be signed by the test CA: %v", err)
+	}
+	if !reflect.DeepEqual(certs[0].DNSNames, domains) {
+		t.Errorf("Expected the certificate for %v, got %v", domains, certs[0].DNSNames)
+	}
+
+	if err := client.RevokeCertificate(cert.Certificate); err != nil {
+		t.Fatalf("Could not revoke certificate: %v", err)
+	}
+	if !ts.IsRevoked(certs[0].Raw) {
+		t.Error("Expected the certificate to be revoked")
+	}
+
+	ts.SetValidDomains([]string{"example.com"})
+	_, failures = client.ObtainCertificate(domains, false, nil)
+	if _, ok := failures["www.example.com"]; !ok || len(failures) != 1 {
+		t.Errorf("Expected validation of www.example.com to fail, got %v", failures)
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	for _, domain := range []string{"Example.COM", "example.com.", " example.com ", "EXAMPLE.com."} {
+		if normalized := NormalizeDomain(domain); normalized != "example.com" {
+			t.Errorf("%q: expected example.com, got %q", domain, normalized)
+		}
+
+		// The certificate of domain is stored under the normalized name.
+		names, err := normalizeDomains([]string{domain, "www.example.com"})
+		if err != nil || names[0] != NormalizeDomain(domain) {
+			t.Errorf("%q: expected the certificate domain %q, got %v (%v)", domain, NormalizeDomain(domain), names, err)
+		}
+	}
+	if normalized := NormalizeDomain("*.Example.com"); normalized != "*.example.com" {
+		t.Errorf("Expected wildcards to be kept, got %q", normalized)
+	}
+}
+
+func TestNormalizeDomains(t *testing.T) {
+	for _, test := range []struct {
+		domains  []string
+		expected []string
+	}{
+		{[]string{"example.com", "www.example.com"}, []string{"example.com", "www.example.com"}},
+		{[]string{"Example.COM", "example.com.", " example.com", "www.example.com"}, []string{"example.com", "www.example.com"}},
+		{[]string{"sub.example.com", "*.example.com", "example.com", "a.b.example.com", ""}, []string{"*.example.com", "example.com", "a.b.example.com"}},
+	} {
+		normalized, err := normalizeDomains(test.domains)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.domains, err)
+		}
+		if !reflect.DeepEqual(normalized, test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.domains, test.expected, normalized)
+		}
+	}
+
+	if _, err := normalizeDomains([]string{"", " ."}); err == nil {
+		t.Error("Expected an error when no domain remains")
+	}
+}
+
+func TestCheckCSRNames(t *testing.T) {
+	spiffeID, _ := url.Parse("spiffe://example.com/workload")
+	for _, test := range []struct {
+		csr      x509.CertificateRequest
+		expected string
+	}{
+		{x509.CertificateRequest{Subject: pkix.Name{CommonName: "example.com"}, DNSNames: []string{"www.example.com"}}, ""},
+		{x509.CertificateRequest{URIs: []*url.URL{spiffeID}}, "acme: CSR contains names other than DNS names, which ACME cannot authorize: spiffe://example.com/workload"},
+		{x509.CertificateRequest{EmailAddresses: []string{"admin@example.com"}, IPAddresses: []net.IP{net.ParseIP("192.0.2.1")}},
+			"acme: CSR contains names other than DNS names, which ACME cannot authorize: admin@example.com, 192.0.2.1"},
+	} {
+		err := checkCSRNames(test.csr)
+		if test.expected == "" && err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		if test.expected != "" && (err == nil || err.Error() != test.expected) {
+			t.Errorf("Expected the error %q, got %v", test.expected, err)
+		}
+	}
+}
+
+func TestObtainCertificates(t *testing.T) {
+	ts := testserver.New()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{email: "test@test.com", regres: new(RegistrationResource), privatekey: key}
+
+	client, err := NewClient(ts.DirectoryURL(), user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	client.SetChallengeProvider(HTTP01, &noopProvider{})
+	client.ExcludeChallenges([]Challenge{TLSSNI01, DNS01})
+	client.SetMaxNamesPerCertificate(2)
+
+	reg, err := client.Register()
+	if err != nil {
+		t.Fatalf("Could not register: %v", err)
+	}
+	*user.regres = *reg
+
+	domains := []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com", "e.example.com"}
+	certs, failures := client.ObtainCertificates(domains, false, nil)
+	if len(failures) > 0 {
+		t.Fatalf("Expected no failures, got %v", failures)
+	}
+	expected := [][]string{domains[0:2], domains[2:4], domains[4:5]}
+	if len(certs) != len(expected) {
+		t.Fatalf("Expected %d certificates, got %d", len(expected), len(certs))
+	}
+	for i, cert := range certs {
+		x509Certs, err := parsePEMBundle(cert.Certificate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(x509Certs[0].DNSNames, expected[i]) {
+			t.Errorf("Expected certificate %d for %v, got %v", i, expected[i], x509Certs[0].DNSNames)
+		}
+	}
+
+	ts.SetValidDomains([]string{"a.example.com", "b.example.com", "d.example.com", "e.example.com"})
+	certs, failures = client.ObtainCertificates(domains, false, nil)
+	if _, ok := failures["c.example.com"]; !ok || len(failures) != 1 {
+		t.Errorf("Expected validation of c.example.com to fail, got %v", failures)
+	}
+	if len(certs) != 2 || certs[0].Domain != "a.example.com" || certs[1].Domain != "e.example.com" {
+		t.Errorf("Expected the certificates of the other chunks, got %d", len(certs))
+	}
+}
+
+func TestRenewWithExistingSubject(t *testing.T) {
+	ts := testserver.New()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{email: "test@test.com", regres: new(RegistrationResource), privatekey: key}
+
+	client, err := NewClient(ts.DirectoryURL(), user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	client.SetChallengeProvider(HTTP01, &noopProvider{})
+	client.ExcludeChallenges([]Challenge{TLSSNI01, DNS01})
+
+	reg, err := client.Register()
+	if err != nil {
+		t.Fatalf("Could not register: %v", err)
+	}
+	*user.regres = *reg
+
+	subject := pkix.Name{
+		Organization:       []string{"Example Inc."},
+		OrganizationalUnit: []string{"Operations"},
+		Country:            []string{"DE"},
+		Province:           []string{"Berlin"},
+		Locality:           []string{"Berlin"},
+	}
+	domains := []string{"example.com", "www.example.com"}
+	cert, failures := client.obtainCertificate(domains, false, nil, subject)
+	if len(failures) > 0 {
+		t.Fatalf("Expected no failures, got %v", failures)
+	}
+
+	renewed, err := client.RenewWithExistingSubject(cert, false)
+	if err != nil {
+		t.Fatalf("Could not renew: %v", err)
+	}
+	certs, err := parsePEMBundle(renewed.Certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := certs[0].Subject
+	if got.CommonName != "example.com" || !reflect.DeepEqual(got.Organization, subject.Organization) ||
+		!reflect.DeepEqual(got.OrganizationalUnit, subject.OrganizationalUnit) || !reflect.DeepEqual(got.Country, subject.Country) ||
+		!reflect.DeepEqual(got.Province, subject.Province) || !reflect.DeepEqual(got.Locality, subject.Locality) {
+		t.Errorf("Expected the renewed certificate to keep the subject %+v, got %+v", subject, got)
+	}
+	if !reflect.DeepEqual(certs[0].DNSNames, domains) {
+		t.Errorf("Expected the certificate for %v, got %v", domains, certs[0].DNSNames)
+	}
+
+	renewed, err = client.RenewCertificate(cert, false)
+	if err != nil {
+		t.Fatalf("Could not renew: %v", err)
+	}
+	certs, err = parsePEMBundle(renewed.Certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs[0].Subject.Organization) > 0 {
+		t.Errorf("Expected RenewCertificate to request an empty subject, got %+v", certs[0].Subject)
+	}
+
+	// The domain of a resource need not be normalized, and a failing
+	// alternative name fails the renewal as well.
+	cert.Domain = "Example.com."
+	ts.SetValidDomains([]string{"example.com"})
+	if _, err := client.RenewCertificate(cert, false); err == nil {
+		t.Error("Expected RenewCertificate to fail for www.example.com")
+	}
+	if _, err := client.RenewWithExistingSubject(cert, false); err == nil {
+		t.Error("Expected RenewWithExistingSubject to fail for www.example.com")
+	}
+	ts.SetValidDomains([]string{"www.example.com"})
+	if _, err := client.RenewCertificate(cert, false); err == nil {
+		t.Error("Expected RenewCertificate to fail for Example.com.")
+	}
+}
+
+func TestRevokeCertificateWithReason(t *testing.T) {
+	ts := testserver.New()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{email: "test@test.com", regres: new(RegistrationResource), privatekey: key}
+
+	client, err := NewClient(ts.DirectoryURL(), user, EC256)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	client.SetChallengeProvider(HTTP01, &noopProvider{})
+	client.ExcludeChallenges([]Challenge{TLSSNI01, DNS01})
+
+	reg, err := client.Register()
+	if err != nil {
+		t.Fatalf("Could not register: %v", err)
+	}
+	*user.regres = *reg
+
+	var certs [][]byte
+	for i := 0; i < 2; i++ {
+		cert, failures := client.ObtainCertificate([]string{"example.com"}, false, nil)
+		if len(failures) > 0 {
+			t.Fatalf("Expected no failures, got %v", failures)
+		}
+		certs = append(certs, cert.Certificate)
+
+		if i == 1 {
+			certKey, err := parsePEMPrivateKey(cert.PrivateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := client.RevokeCertificateWithKey(cert.Certificate, RevocationReasonKeyCompromise, certKey); err != nil {
+				t.Fatalf("Could not revoke with the certificate key: %v", err)
+			}
+		}
+	}
+
+	if err := client.RevokeCertificateWithReason(certs[0], 7); err == nil {
+		t.Error("Expected an error for the unused reason code 7")
+	}
+	if err := client.RevokeCertificateWithReason(certs[0], RevocationReasonSuperseded); err != nil {
+		t.Fatalf("Could not revoke certificate: %v", err)
+	}
+
+	for i, expected := range []int{RevocationReasonSuperseded, RevocationReasonKeyCompromise} {
+		x509Certs, err := parsePEMBundle(certs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason, ok := ts.RevocationReason(x509Certs[0].Raw); !ok || reason != expected {
+			t.Errorf("Expected certificate %d to be revoked with reason %d, got %d (revoked: %v)", i, expected, reason, ok)
+		}
+	}
+}
+
+func TestPreferredChain(t *testing.T) {
+	ts := testserver.New()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{email: "test@test.com", regres: new(RegistrationResource), privatekey: key}
+
+	client, err := NewClient(ts.DirectoryURL(), user, EC256)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	client.SetChallengeProvider(HTTP01, &noopProvider{})
+	client.ExcludeChallenges([]Challenge{TLSSNI01, DNS01})
+
+	reg, err := client.Register()
+	if err != nil {
+		t.Fatalf("Could not register: %v", err)
+	}
+	*user.regres = *reg
+
+	for _, test := range []struct {
+		preferred string
+		root      *x509.Certificate
+	}{
+		{"", ts.CACertificate()},
+		{"lego test cross root", ts.CrossRootCertificate()},
+		{"no such root", ts.CACertificate()},
+	} {
+		client.SetPreferredChain(test.preferred)
+		cert, failures := client.ObtainCertificate([]string{"example.com"}, true, nil)
+		if len(failures) > 0 {
+			t.Fatalf("Expected no failures, got %v", failures)
+		}
+		if len(cert.AlternativeChains) != 1 {
+			t.Fatalf("Expected one alternative chain, got %d", len(cert.AlternativeChains))
+		}
+
+		certs, err := parsePEMBundle(cert.Certificate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := certs[len(certs)-1].CheckSignatureFrom(test.root); err != nil {
+			t.Errorf("Expected the chain preferring %q to lead to %s: %v", test.preferred, test.root.Subject.CommonName, err)
+		}
+	}
+}
+
+func TestCryptoSignerKeys(t *testing.T) {
+	ts := testserver.New()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{email: "test@test.com", regres: new(RegistrationResource), privatekey: key}
+
+	client, err := NewClient(ts.DirectoryURL(), user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	client.SetChallengeProvider(HTTP01, &noopProvider{})
+	client.ExcludeChallenges([]Challenge{TLSSNI01, DNS01})
+
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	if err := client.SetPrivateKey(opaqueSigner{accountKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := client.Register()
+	if err != nil {
+		t.Fatalf("Could not register with an opaque account key: %v", err)
+	}
+	*user.regres = *reg
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	cert, failures := client.ObtainCertificate([]string{"example.com"}, false, opaqueSigner{certKey})
+	if len(failures) > 0 {
+		t.Fatalf("Expected no failures, got %v", failures)
+	}
+	if cert.PrivateKey != nil {
+		t.Error("Expected no private key for an opaque certificate key")
+	}
+
+	certs, err := parsePEMBundle(cert.Certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(certs[0].PublicKey, certKey.Public()) {
+		t.Error("Expected the certificate to be issued for the opaque key")
+	}
+}
+
+// opaqueSigner hides the key behind crypto.Signer like a hardware token does.
+type opaqueSigner struct {
+	crypto.Signer
+}
+
+func TestAuthorize(t *testing.T) {
+	ts := testserver.New()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{email: "test@test.com", regres: new(RegistrationResource), privatekey: key}
+
+	client, err := NewClient(ts.DirectoryURL(), user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	client.SetChallengeProvider(HTTP01, &noopProvider{})
+	client.ExcludeChallenges([]Challenge{TLSSNI01, DNS01})
+
+	reg, err := client.Register()
+	if err != nil {
+		t.Fatalf("Could not register: %v", err)
+	}
+	*user.regres = *reg
+
+	authz, err := client.Authorize("example.com")
+	if err != nil {
+		t.Fatalf("Could not authorize: %v", err)
+	}
+	if authz.Domain != "example.com" || authz.URI == "" || !authz.Expires.After(time.Now()) {
+		t.Errorf("Expected a valid authorization for example.com, got %+v", authz)
+	}
+
+	// No challenge passes anymore, so issuance has to rely on the cached authorization.
+	ts.SetValidDomains([]string{})
+
+	if _, failures := client.ObtainCertificate([]string{"example.com"}, false, nil); len(failures) > 0 {
+		t.Errorf("Expected the cached authorization to be used, got %v", failures)
+	}
+	if _, failures := client.ObtainCertificate([]string{"example.com", "www.example.com"}, false, nil); failures["www.example.com"] == nil {
+		t.Error("Expected www.example.com to need a new authorization")
+	}
+}
+
+func TestNewClientWithHTTPClient(t *testing.T) {
+	first, second := testserver.New(), testserver.New()
+	defer first.Close()
+	defer second.Close()
+
+	var clients []*Client
+	var transports []*countingTransport
+	for _, ts := range []*testserver.TestServer{first, second} {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal("Could not generate test key:", err)
+		}
+		user := mockUser{email: "test@test.com", regres: new(RegistrationResource), privatekey: key}
+
+		transport := &countingTransport{}
+		client, err := NewClientWithHTTPClient(ts.DirectoryURL(), user, RSA2048, &http.Client{Transport: transport})
+		if err != nil {
+			t.Fatalf("Could not create client: %v", err)
+		}
+
+		reg, err := client.Register()
+		if err != nil {
+			t.Fatalf("Could not register: %v", err)
+		}
+		*user.regres = *reg
+
+		clients = append(clients, client)
+		transports = append(transports, transport)
+	}
+
+	if clients[0].user.GetRegistration().URI == clients[1].user.GetRegistration().URI {
+		t.Error("Expected each client to register with its own CA")
+	}
+	for i, transport := range transports {
+		if transport.count() == 0 {
+			t.Errorf("Expected client %d to use its own HTTP client", i)
+		}
+	}
+}
+
+func TestSetDNSChallengeDomain(t *testing.T) {
+	ts := testserver.New()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{email: "test@test.com", regres: new(RegistrationResource), privatekey: key}
+
+	client, err := NewClient(ts.DirectoryURL(), user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	if err := client.SetDNSChallengeDomain("example.com", nil); err == nil {
+		t.Error("Expected an error for a missing provider")
+	}
+
+	delegate := &noopProvider{}
+	if err := client.SetDNSChallengeDomain("example.com", delegate); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.solvers[DNS01]; ok {
+		t.Error("Expected no dns-01 solver without a provider")
+	}
+	client.SetChallengeProvider(DNS01, &noopProvider{})
+
+	dnsSolver, ok := client.solvers[DNS01].(*dnsChallenge)
+	if !ok {
+		t.Fatal("Expected dns-01 solver to be dnsChallenge type")
+	}
+	if dnsSolver.delegates["example.com"] != delegate {
+		t.Error("Expected the delegation to survive SetChallengeProvider")
+	}
+
+	other := &noopProvider{}
+	if err := client.SetDNSChallengeDomain("example.org", other); err != nil {
+		t.Fatal(err)
+	}
+	if dnsSolver.delegates["example.org"] != other {
+		t.Error("Expected a delegation to apply to the existing dns-01 solver")
+	}
+
+	if fqdn, _, _ := DNS01Record("_acme-challenge.example.com.acme.example.net.", "keyAuth"); fqdn != "_acme-challenge.example.com.acme.example.net." {
+		t.Errorf("Expected the record to be created at the delegation target, got %s", fqdn)
+	}
+	if fqdn, _, _ := DNS01Record("example.com", "keyAuth"); fqdn != "_acme-challenge.example.com." {
+		t.Errorf("Expected the record of an undelegated domain, got %s", fqdn)
+	}
+}
+
+func TestSetPropagationConfig(t *testing.T) {
+	ts := testserver.New()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{email: "test@test.com", regres: new(RegistrationResource), privatekey: key}
+
+	client, err := NewClient(ts.DirectoryURL(), user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	client.SetPropagationConfig(PropagationConfig{Timeout: 5 * time.Minute})
+	if _, ok := client.solvers[DNS01]; ok {
+		t.Error("Expected no dns-01 solver without a provider")
+	}
+	client.SetChallengeProvider(DNS01, &timeoutProvider{})
+
+	dnsSolver, ok := client.solvers[DNS01].(*dnsChallenge)
+	if !ok {
+		t.Fatal("Expected dns-01 solver to be dnsChallenge type")
+	}
+
+	for _, test := range []struct {
+		provider          ChallengeProvider
+		timeout, interval time.Duration
+	}{
+		{&noopProvider{}, 5 * time.Minute, 2 * time.Second},
+		{&timeoutProvider{}, 5 * time.Minute, 10 * time.Second},
+	} {
+		timeout, interval := dnsSolver.propagationTimeout(test.provider)
+		if timeout != test.timeout || interval != test.interval {
+			t.Errorf("%T: expected %s/%s, got %s/%s", test.provider, test.timeout, test.interval, timeout, interval)
+		}
+	}
+}
+
+type countingTransport struct {
+	mu       sync.Mutex
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests++
+	c.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (c *countingTransport) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests
+}
+
+type timeoutProvider struct{ noopProvider }
+
+func (*timeoutProvider) Timeout() (timeout, interval time.Duration) {
+	return 20 * time.Minute, 10 * time.Second
+}
+
+type noopProvider struct{}
+
+func (*noopProvider) Present(domain, token, keyAuth string) error { return nil }
+func (*noopProvider) CleanUp(domain, token, keyAuth string) error { return nil }
+
 type mockUser struct {
 	email      string
 	regres     *RegistrationResource
@@ -196,3 +942,71 @@ type mockUser struct {
 func (u mockUser) GetEmail() string                       { return u.email }
 func (u mockUser) GetRegistration() *RegistrationResource { return u.regres }
 func (u mockUser) GetPrivateKey() crypto.PrivateKey       { return u.privatekey }
+
+func TestParseRevocationReason(t *testing.T) {
+	for reason, expected := range map[string]int{
+		"keyCompromise": RevocationReasonKeyCompromise,
+		"KEYCOMPROMISE": RevocationReasonKeyCompromise,
+		"superseded":    RevocationReasonSuperseded,
+		"aACompromise":  RevocationReasonAACompromise,
+		"4":             RevocationReasonSuperseded,
+		"0":             RevocationReasonUnspecified,
+	} {
+		if code, err := ParseRevocationReason(reason); err != nil || code != expected {
+			t.Errorf("Expected %q to be reason %d, got %d (%v)", reason, expected, code, err)
+		}
+	}
+
+	for _, reason := range []string{"7", "11", "-1", "stolen", ""} {
+		if _, err := ParseRevocationReason(reason); err == nil {
+			t.Errorf("Expected %q to be rejected", reason)
+		}
+	}
+}
+
+func TestRolloverKey(t *testing.T) {
+	ts := testserver.New()
+	defer ts.Close()
+
+	oldKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{email: "test@test.com", regres: new(RegistrationResource), privatekey: oldKey}
+
+	client, err := NewClient(ts.DirectoryURL(), user, EC256)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	reg, err := client.Register()
+	if err != nil {
+		t.Fatalf("Could not register: %v", err)
+	}
+	*user.regres = *reg
+
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	if err := client.RolloverKey(newKey); err != nil {
+		t.Fatalf("Could not roll over the account key: %v", err)
+	}
+	if client.jws.privKey != newKey {
+		t.Error("Expected the client to sign with the new key")
+	}
+
+	if _, err := client.QueryRegistration(); err != nil {
+		t.Errorf("Could not query the registration with the new key: %v", err)
+	}
+
+	oldClient, err := NewClient(ts.DirectoryURL(), user, EC256)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	if _, err := oldClient.QueryRegistration(); err == nil {
+		t.Error("Expected the old key to be rejected after the rollover")
+	}
+	if err := oldClient.RolloverKey(newKey); err == nil {
+		t.Error("Expected the rollover with a replaced key to fail")
+	}
+}
@@ -7,9 +7,13 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -21,6 +25,7 @@ import (
 	"time"
 
 	"golang.org/x/crypto/ocsp"
+	"software.sslmate.com/src/go-pkcs12"
 )
 
 // KeyType represents the key algo as well as the key size or curve to use.
@@ -74,7 +79,7 @@ func GetOCSPForCert(bundle []byte) ([]byte, *ocsp.Response, error) {
 			return nil, nil, errors.New("no issuing certificate URL")
 		}
 
-		resp, err := httpGet(issuedCert.IssuingCertificateURL[0])
+		resp, err := httpGet(&HTTPClient, issuedCert.IssuingCertificateURL[0])
 		if err != nil {
 			return nil, nil, err
 		}
@@ -103,7 +108,7 @@ func GetOCSPForCert(bundle []byte) ([]byte, *ocsp.Response, error) {
 	}
 
 	reader := bytes.NewReader(ocspReq)
-	req, err := httpPost(issuedCert.OCSPServer[0], "application/ocsp-request", reader)
+	req, err := httpPost(&HTTPClient, issuedCert.OCSPServer[0], "application/ocsp-request", reader)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -120,11 +125,8 @@ func GetOCSPForCert(bundle []byte) ([]byte, *ocsp.Response, error) {
 
 func getKeyAuthorization(token string, key interface{}) (string, error) {
 	var publicKey crypto.PublicKey
-	switch k := key.(type) {
-	case *ecdsa.PrivateKey:
-		publicKey = k.Public()
-	case *rsa.PrivateKey:
-		publicKey = k.Public()
+	if signer, ok := key.(crypto.Signer); ok {
+		publicKey = signer.Public()
 	}
 
 	// Generate the Key Authorization for the challenge
@@ -175,6 +177,252 @@ func parsePEMBundle(bundle []byte) ([]*x509.Certificate, error) {
 	return certificates, nil
 }
 
+// ToPKCS12 takes a PEM encoded cert or cert bundle and the matching private key
+// and returns them as a password protected PKCS#12 (PFX) archive. The first
+// certificate in the bundle has to be the issued certificate, any following
+// certificates are added to the archive as CA certificates.
+func ToPKCS12(cert []byte, key crypto.PrivateKey, password string) ([]byte, error) {
+	certificates, err := parsePEMBundle(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkcs12.Encode(rand.Reader, key, certificates[0], certificates[1:], password)
+}
+
+// BuildChain takes a PEM encoded leaf certificate and a set of PEM encoded
+// intermediate (and optionally root) certificates in any order and returns
+// a PEM bundle ordered leaf -> intermediates -> root. Every certificate in
+// the returned bundle is verified to be signed by the certificate following it.
+// It is an error if one of the passed certificates is not part of the chain.
+func BuildChain(leaf []byte, intermediates [][]byte) ([]byte, error) {
+	leafCerts, err := parsePEMBundle(leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	var pool []*x509.Certificate
+	for _, intermediate := range intermediates {
+		certs, err := parsePEMBundle(intermediate)
+		if err != nil {
+			return nil, err
+		}
+		pool = append(pool, certs...)
+	}
+
+	chain := []*x509.Certificate{leafCerts[0]}
+	for len(pool) > 0 {
+		current := chain[len(chain)-1]
+		if isSelfSigned(current) {
+			break
+		}
+
+		found := -1
+		for i, candidate := range pool {
+			if current.CheckSignatureFrom(candidate) == nil {
+				found = i
+				break
+			}
+		}
+		if found == -1 {
+			break
+		}
+
+		chain = append(chain, pool[found])
+		pool = append(pool[:found], pool[found+1:]...)
+	}
+
+	if len(pool) > 0 {
+		return nil, fmt.Errorf("Certificate %q is not part of the chain of %q", pool[0].Subject.CommonName, chain[0].Subject.CommonName)
+	}
+
+	var bundle []byte
+	for _, cert := range chain {
+		bundle = append(bundle, pemEncode(derCertificateBytes(cert.Raw))...)
+	}
+
+	return bundle, nil
+}
+
+// SplitChain parses a PEM encoded certificate bundle and returns the
+// certificates in the order they appear in the bundle.
+func SplitChain(bundle []byte) ([]*x509.Certificate, error) {
+	return parsePEMBundle(bundle)
+}
+
+// CertificatePublicKeyPins returns the HTTP Public Key Pinning (RFC 7469)
+// pins of the public key of cert, followed by the pins of backupKeys: the
+// base64 encoded SHA-256 hashes of their DER encoded SubjectPublicKeyInfo.
+// Browsers require at least one backup pin. Backup keys of types x509
+// cannot marshal are skipped.
+func CertificatePublicKeyPins(cert *x509.Certificate, backupKeys ...crypto.PublicKey) []string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	pins := []string{base64.StdEncoding.EncodeToString(sum[:])}
+
+	for _, key := range backupKeys {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(der)
+		pins = append(pins, base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	return pins
+}
+
+// GenerateTLSA returns the data of a DANE TLSA record (RFC 6698) for cert
+// in presentation format, e.g. "3 1 1 <hex>". The selector chooses the full
+// certificate (0) or its SubjectPublicKeyInfo (1), the matching type the
+// exact data (0), its SHA-256 (1) or SHA-512 hash (2). The certificate usages
+// 0 and 2 expect cert to be a CA certificate.
+func GenerateTLSA(cert *x509.Certificate, usage, selector, matchingType int) (string, error) {
+	if usage < 0 || usage > 3 {
+		return "", fmt.Errorf("Invalid TLSA certificate usage %d, expected 0 to 3", usage)
+	}
+
+	var data []byte
+	switch selector {
+	case 0:
+		data = cert.Raw
+	case 1:
+		data = cert.RawSubjectPublicKeyInfo
+	default:
+		return "", fmt.Errorf("Invalid TLSA selector %d, expected 0 or 1", selector)
+	}
+
+	switch matchingType {
+	case 0:
+	case 1:
+		sum := sha256.Sum256(data)
+		data = sum[:]
+	case 2:
+		sum := sha512.Sum512(data)
+		data = sum[:]
+	default:
+		return "", fmt.Errorf("Invalid TLSA matching type %d, expected 0 to 2", matchingType)
+	}
+
+	return fmt.Sprintf("%d %d %d %s", usage, selector, matchingType, hex.EncodeToString(data)), nil
+}
+
+// dhParams is the DHParameter structure of PKCS #3, as read and written by
+// OpenSSL.
+type dhParams struct {
+	P *big.Int
+	G int
+}
+
+// GenerateDHParams returns PEM encoded Diffie-Hellman parameters like
+// `openssl dhparam` writes them: a random safe prime p of bits bits, i.e. one
+// for which (p-1)/2 is prime as well, and the generator 2. Generating 2048
+// bits or more can take minutes.
+func GenerateDHParams(bits int) ([]byte, error) {
+	if bits < 512 {
+		return nil, fmt.Errorf("Invalid DH parameter size %d, expected at least 512 bits", bits)
+	}
+
+	p, err := generateSafePrime(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := asn1.Marshal(dhParams{P: p, G: 2})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "DH PARAMETERS", Bytes: der}), nil
+}
+
+// smallPrimes are the odd primes below 2048 but 3, used to sieve the
+// candidates of generateSafePrime.
+var smallPrimes = func() []uint64 {
+	var primes []uint64
+	composite := make([]bool, 2048)
+	for i := 2; i < len(composite); i++ {
+		if composite[i] {
+			continue
+		}
+		if i > 3 {
+			primes = append(primes, uint64(i))
+		}
+		for j := i * i; j < len(composite); j += i {
+			composite[j] = true
+		}
+	}
+	return primes
+}()
+
+// generateSafePrime returns a prime p of bits bits for which q = (p-1)/2 is
+// prime and p = 11 (mod 24), which OpenSSL requires of primes for the
+// generator 2. It searches upwards from a random q = 5 (mod 12) in steps of
+// 12, sieving out q and p with small factors before testing them.
+func generateSafePrime(rnd io.Reader, bits int) (*big.Int, error) {
+	const window = 1 << 14
+	twelve := big.NewInt(12)
+	buf := make([]byte, (bits+6)/8)
+
+	for {
+		if _, err := io.ReadFull(rnd, buf); err != nil {
+			return nil, err
+		}
+		q := new(big.Int).SetBytes(buf)
+		q.Rsh(q, uint(len(buf)*8-(bits-1)))
+		q.SetBit(q, bits-2, 1)
+		q.Sub(q, new(big.Int).Mod(q, twelve))
+		q.Add(q, big.NewInt(5))
+
+		residues := make([]uint64, len(smallPrimes))
+		for i, sp := range smallPrimes {
+			residues[i] = new(big.Int).Mod(q, new(big.Int).SetUint64(sp)).Uint64()
+		}
+
+	candidates:
+		for delta := uint64(0); delta < window*12; delta += 12 {
+			for i, sp := range smallPrimes {
+				r := (residues[i] + delta) % sp
+				if r == 0 || (2*r+1)%sp == 0 {
+					continue candidates
+				}
+			}
+
+			candidate := new(big.Int).Add(q, new(big.Int).SetUint64(delta))
+			p := new(big.Int).Lsh(candidate, 1)
+			p.SetBit(p, 0, 1)
+			if p.BitLen() != bits {
+				break
+			}
+			if candidate.ProbablyPrime(1) && p.ProbablyPrime(1) && candidate.ProbablyPrime(20) && p.ProbablyPrime(20) {
+				return p, nil
+			}
+		}
+	}
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// chainMatches reports whether one of the certificates of the PEM bundle
+// chain has the hex encoded SHA-256 fingerprint match, or whether the chain
+// leads to a root with the common name match.
+func chainMatches(chain []byte, match string) bool {
+	certificates, err := parsePEMBundle(chain)
+	if err != nil {
+		return false
+	}
+
+	fingerprint := strings.ToLower(strings.Replace(match, ":", "", -1))
+	for _, cert := range certificates {
+		sum := sha256.Sum256(cert.Raw)
+		if hex.EncodeToString(sum[:]) == fingerprint {
+			return true
+		}
+	}
+
+	top := certificates[len(certificates)-1]
+	return top.Issuer.CommonName == match
+}
+
 func parsePEMPrivateKey(key []byte) (crypto.PrivateKey, error) {
 	keyBlock, _ := pem.Decode(key)
 
@@ -207,10 +455,12 @@ func generatePrivateKey(keyType KeyType) (crypto.PrivateKey, error) {
 }
 
 func generateCsr(privateKey crypto.PrivateKey, domain string, san []string) ([]byte, error) {
+	return generateCsrWithSubject(privateKey, pkix.Name{CommonName: domain}, san)
+}
+
+func generateCsrWithSubject(privateKey crypto.PrivateKey, subject pkix.Name, san []string) ([]byte, error) {
 	template := x509.CertificateRequest{
-		Subject: pkix.Name{
-			CommonName: domain,
-		},
+		Subject: subject,
 	}
 
 	if len(san) > 0 {
@@ -234,6 +484,9 @@ func pemEncode(data interface{}) []byte {
 		break
 	case derCertificateBytes:
 		pemBlock = &pem.Block{Type: "CERTIFICATE", Bytes: []byte(data.(derCertificateBytes))}
+	default:
+		// Keys only reachable through crypto.Signer cannot be exported.
+		return nil
 	}
 
 	return pem.EncodeToMemory(pemBlock)
@@ -4,8 +4,18 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
 	"testing"
 	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
 )
 
 func TestGeneratePrivateKey(t *testing.T) {
@@ -84,6 +94,223 @@ func TestPEMCertExpiration(t *testing.T) {
 	}
 }
 
+func TestToPKCS12(t *testing.T) {
+	privKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+
+	certBytes, err := generateDerCert(privKey, time.Time{}, "test.com")
+	if err != nil {
+		t.Fatal("Error generating cert:", err)
+	}
+	pemCert := pemEncode(derCertificateBytes(certBytes))
+
+	pfx, err := ToPKCS12(pemCert, privKey, "secret")
+	if err != nil {
+		t.Fatal("Error encoding PKCS#12:", err)
+	}
+
+	key, cert, err := pkcs12.Decode(pfx, "secret")
+	if err != nil {
+		t.Fatal("Error decoding PKCS#12:", err)
+	}
+	if !bytes.Equal(cert.Raw, certBytes) {
+		t.Error("Expected decoded certificate to match the encoded one")
+	}
+	if decoded, ok := key.(*rsa.PrivateKey); !ok || decoded.N.Cmp(privKey.N) != 0 {
+		t.Error("Expected decoded private key to match the encoded one")
+	}
+
+	if _, err := ToPKCS12([]byte("garbage"), privKey, "secret"); err == nil {
+		t.Error("Expected ToPKCS12 to return an error for garbage input")
+	}
+}
+
+func TestCertificatePublicKeyPins(t *testing.T) {
+	privKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+	backupKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+	certBytes, err := generateDerCert(privKey, time.Time{}, "test.com")
+	if err != nil {
+		t.Fatal("Error generating cert:", err)
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pins := CertificatePublicKeyPins(cert, &backupKey.PublicKey, "not a key")
+	if len(pins) != 2 {
+		t.Fatalf("Expected a pin for the certificate and one for the backup key, got %v", pins)
+	}
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	if expected := base64.StdEncoding.EncodeToString(sum[:]); pins[0] != expected {
+		t.Errorf("Expected the pin of the certificate to be %s, got %s", expected, pins[0])
+	}
+	if backupPins := CertificatePublicKeyPins(cert, &privKey.PublicKey); backupPins[1] != pins[0] {
+		t.Errorf("Expected the pin of the certificate key as a backup key to be %s, got %s", pins[0], backupPins[1])
+	}
+	if pins[1] == pins[0] {
+		t.Error("Expected the backup key to have its own pin")
+	}
+}
+
+func TestGenerateTLSA(t *testing.T) {
+	privKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+	certBytes, err := generateDerCert(privKey, time.Time{}, "test.com")
+	if err != nil {
+		t.Fatal("Error generating cert:", err)
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	for _, test := range []struct {
+		usage, selector, matchingType int
+		expected                      string
+	}{
+		{3, 1, 1, "3 1 1 " + hex.EncodeToString(sum[:])},
+		{3, 0, 0, "3 0 0 " + hex.EncodeToString(cert.Raw)},
+	} {
+		record, err := GenerateTLSA(cert, test.usage, test.selector, test.matchingType)
+		if err != nil {
+			t.Errorf("Expected no error for %d %d %d, got %v", test.usage, test.selector, test.matchingType, err)
+		} else if record != test.expected {
+			t.Errorf("Expected the record %s, got %s", test.expected, record)
+		}
+	}
+
+	if record, err := GenerateTLSA(cert, 2, 1, 2); err != nil || len(record) != len("2 1 2 ")+128 {
+		t.Errorf("Expected a SHA-512 record, got %q (%v)", record, err)
+	}
+	for _, params := range [][3]int{{4, 1, 1}, {3, 2, 1}, {3, 1, 3}} {
+		if _, err := GenerateTLSA(cert, params[0], params[1], params[2]); err == nil {
+			t.Errorf("Expected an error for the parameters %v", params)
+		}
+	}
+}
+
+func TestGenerateDHParams(t *testing.T) {
+	data, err := GenerateDHParams(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "DH PARAMETERS" {
+		t.Fatalf("Expected a DH PARAMETERS block, got %q", data)
+	}
+	var params dhParams
+	if rest, err := asn1.Unmarshal(block.Bytes, &params); err != nil || len(rest) > 0 {
+		t.Fatalf("Could not parse the DH parameters: %v", err)
+	}
+
+	if params.G != 2 {
+		t.Errorf("Expected the generator 2, got %d", params.G)
+	}
+	if params.P.BitLen() != 512 {
+		t.Errorf("Expected a 512 bit prime, got %d bits", params.P.BitLen())
+	}
+	q := new(big.Int).Rsh(params.P, 1)
+	if !params.P.ProbablyPrime(20) || !q.ProbablyPrime(20) {
+		t.Errorf("Expected a safe prime, got %s", params.P)
+	}
+	if mod := new(big.Int).Mod(params.P, big.NewInt(24)).Int64(); mod != 11 {
+		t.Errorf("Expected p = 11 (mod 24), got %d", mod)
+	}
+
+	if _, err := GenerateDHParams(256); err == nil {
+		t.Error("Expected an error for too few bits")
+	}
+}
+
+func TestBuildAndSplitChain(t *testing.T) {
+	root, rootKey := generateTestCert(t, "Test Root", true, nil, nil)
+	intermediate, intermediateKey := generateTestCert(t, "Test Intermediate", true, root, rootKey)
+	leaf, _ := generateTestCert(t, "test.com", false, intermediate, intermediateKey)
+
+	leafPEM := pemEncode(derCertificateBytes(leaf.Raw))
+	intermediatePEM := pemEncode(derCertificateBytes(intermediate.Raw))
+	rootPEM := pemEncode(derCertificateBytes(root.Raw))
+
+	// Pass the certificates in the wrong order on purpose.
+	bundle, err := BuildChain(leafPEM, [][]byte{rootPEM, intermediatePEM})
+	if err != nil {
+		t.Fatal("Error building chain:", err)
+	}
+
+	expected := append(append(append([]byte{}, leafPEM...), intermediatePEM...), rootPEM...)
+	if !bytes.Equal(bundle, expected) {
+		t.Error("Expected chain to be ordered leaf, intermediate, root")
+	}
+
+	certs, err := SplitChain(bundle)
+	if err != nil {
+		t.Fatal("Error splitting chain:", err)
+	}
+	if len(certs) != 3 {
+		t.Fatalf("Expected 3 certificates, got %d", len(certs))
+	}
+	for i, want := range []string{"test.com", "Test Intermediate", "Test Root"} {
+		if got := certs[i].Subject.CommonName; got != want {
+			t.Errorf("Expected certificate %d to be %q, got %q", i, want, got)
+		}
+	}
+
+	// A certificate which did not sign anything in the chain is an error.
+	other, _ := generateTestCert(t, "Other Root", true, nil, nil)
+	otherPEM := pemEncode(derCertificateBytes(other.Raw))
+	if _, err := BuildChain(leafPEM, [][]byte{intermediatePEM, otherPEM}); err == nil {
+		t.Error("Expected BuildChain to fail for a certificate outside of the chain")
+	}
+}
+
+// generateTestCert creates a certificate signed by parent. If parent is nil
+// the certificate is self-signed.
+func generateTestCert(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal("Error generating cert:", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("Error parsing cert:", err)
+	}
+
+	return cert, key
+}
+
 type MockRandReader struct {
 	b *bytes.Buffer
 }
@@ -0,0 +1,374 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+// oidSCTList is the X.509 extension holding the embedded SCTs of a
+// certificate, RFC 6962 section 3.3.
+var oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// The LogEntryType of the data an SCT signs, RFC 6962 section 3.1.
+const (
+	x509Entry    = 0
+	precertEntry = 1
+)
+
+// CTLog is a Certificate Transparency log implementing the RFC 6962 API.
+type CTLog struct {
+	// URL is the base URL of the log, the part before /ct/v1/, e.g.
+	// https://ct.googleapis.com/logs/argon2018.
+	URL string
+}
+
+// addChainResponse is the JSON answer of a log to add-chain, RFC 6962
+// section 4.1.
+type addChainResponse struct {
+	Version    uint8  `json:"sct_version"`
+	ID         string `json:"id"`
+	Timestamp  uint64 `json:"timestamp"`
+	Extensions string `json:"extensions"`
+	Signature  string `json:"signature"`
+}
+
+// SetCTLogs makes the client submit every certificate it obtains to logs.
+// The Signed Certificate Timestamps returned by the logs are stored in the
+// SCTs of the CertificateResource, ready to be served in the TLS extension,
+// e.g. through tls.Certificate.SignedCertificateTimestamps. The CA signed
+// the certificate already, so the SCTs cannot be embedded into it.
+func (c *Client) SetCTLogs(logs []CTLog) {
+	c.ctLogs = logs
+}
+
+// submitToCTLogs submits the chain of cert to all configured logs and stores
+// the SCTs. Logs rejecting the chain are skipped with a warning.
+func (c *Client) submitToCTLogs(cert *CertificateResource) {
+	if len(c.ctLogs) == 0 {
+		return
+	}
+
+	chain, err := parsePEMBundle(cert.Certificate)
+	if err != nil {
+		logf("[WARNING][%s] acme: Could not parse the certificate for CT submission: %v", cert.Domain, err)
+		return
+	}
+
+	ders := make([][]byte, 0, len(chain)+1)
+	for _, crt := range chain {
+		ders = append(ders, crt.Raw)
+	}
+	if len(ders) == 1 && c.issuerCert != nil {
+		// logs need the issuer to verify the certificate
+		ders = append(ders, c.issuerCert)
+	}
+
+	for _, ctLog := range c.ctLogs {
+		sct, err := submitToCTLog(c.jws.httpClient(), ctLog, ders)
+		if err != nil {
+			logf("[WARNING][%s] acme: Could not submit the certificate to CT log %s: %v", cert.Domain, ctLog.URL, err)
+			continue
+		}
+		cert.SCTs = append(cert.SCTs, sct)
+	}
+	logf("[INFO][%s] acme: Received %d of %d SCTs from CT logs", cert.Domain, len(cert.SCTs), len(c.ctLogs))
+}
+
+// submitToCTLog posts chain to the add-chain endpoint of ctLog and returns the
+// SCT serialized as in RFC 6962 section 3.2.
+func submitToCTLog(client *http.Client, ctLog CTLog, chain [][]byte) ([]byte, error) {
+	req := struct {
+		Chain []string `json:"chain"`
+	}{}
+	for _, der := range chain {
+		req.Chain = append(req.Chain, base64.StdEncoding.EncodeToString(der))
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimSuffix(ctLog.URL, "/") + "/ct/v1/add-chain"
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var sct addChainResponse
+	if err := json.NewDecoder(limitReader(resp.Body, 1024*1024)).Decode(&sct); err != nil {
+		return nil, err
+	}
+	return sct.serialize()
+}
+
+// serialize encodes the SCT as the SignedCertificateTimestamp structure of
+// RFC 6962 section 3.2.
+func (s addChainResponse) serialize() ([]byte, error) {
+	id, err := base64.StdEncoding.DecodeString(s.ID)
+	if err != nil || len(id) != 32 {
+		return nil, fmt.Errorf("invalid log ID %q", s.ID)
+	}
+	extensions, err := base64.StdEncoding.DecodeString(s.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extensions: %v", err)
+	}
+	// The signature already is a DigitallySigned structure.
+	signature, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil || len(signature) < 4 {
+		return nil, fmt.Errorf("invalid signature %q", s.Signature)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(s.Version)
+	buf.Write(id)
+	binary.Write(&buf, binary.BigEndian, s.Timestamp)
+	binary.Write(&buf, binary.BigEndian, uint16(len(extensions)))
+	buf.Write(extensions)
+	buf.Write(signature)
+	return buf.Bytes(), nil
+}
+
+// VerifyCertificateSCTs makes the client verify the SCTs embedded into every
+// certificate it obtains against the public keys of the CT logs which issued
+// them. Obtaining a certificate fails if it embeds no SCT signed by one of
+// logKeys or an SCT with an invalid signature; SCTs of other logs are skipped
+// with a warning. The SCTs sign the key of the issuer, so certificates
+// should be obtained as a bundle.
+func (c *Client) VerifyCertificateSCTs(logKeys []*ecdsa.PublicKey) {
+	c.sctLogKeys = logKeys
+}
+
+// verifyCertificateSCTs verifies the embedded SCTs of cert if
+// VerifyCertificateSCTs was called.
+func (c *Client) verifyCertificateSCTs(cert CertificateResource) error {
+	if len(c.sctLogKeys) == 0 {
+		return nil
+	}
+
+	chain, err := parsePEMBundle(cert.Certificate)
+	if err != nil {
+		return err
+	}
+	var issuer *x509.Certificate
+	if len(chain) > 1 {
+		issuer = chain[1]
+	} else if c.issuerCert != nil {
+		if issuer, err = x509.ParseCertificate(c.issuerCert); err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("[%s] acme: Cannot verify the SCTs without the issuer certificate; obtain a bundle", cert.Domain)
+	}
+
+	scts, err := embeddedSCTs(chain[0])
+	if err != nil {
+		return fmt.Errorf("[%s] acme: %v", cert.Domain, err)
+	}
+
+	verified := 0
+	for _, sct := range scts {
+		key := findLogKey(c.sctLogKeys, sct)
+		if key == nil {
+			logf("[WARNING][%s] acme: Skipping the SCT of unknown CT log %x", cert.Domain, sct[1:33])
+			continue
+		}
+		if err := VerifyEmbeddedSCT(chain[0], issuer, sct, key); err != nil {
+			return fmt.Errorf("[%s] acme: %v", cert.Domain, err)
+		}
+		verified++
+	}
+	if verified == 0 {
+		return fmt.Errorf("[%s] acme: The certificate embeds no SCT of a known CT log, got %d SCTs", cert.Domain, len(scts))
+	}
+
+	logf("[INFO][%s] acme: Verified %d of %d embedded SCTs", cert.Domain, verified, len(scts))
+	return nil
+}
+
+// findLogKey returns the key of logKeys whose log ID matches sct, or nil.
+func findLogKey(logKeys []*ecdsa.PublicKey, sct []byte) *ecdsa.PublicKey {
+	if len(sct) < 33 {
+		return nil
+	}
+	for _, key := range logKeys {
+		if id, err := logID(key); err == nil && bytes.Equal(id, sct[1:33]) {
+			return key
+		}
+	}
+	return nil
+}
+
+// VerifySCT verifies the signature of a stapled SCT, delivered in the TLS
+// extension or an OCSP response and serialized as in RFC 6962 section 3.2,
+// over cert with the public key of the CT log which issued it.
+func VerifySCT(cert *x509.Certificate, sct []byte, logPublicKey *ecdsa.PublicKey) error {
+	entry := []byte{0, x509Entry}
+	return verifySCT(appendUint24(entry, cert.Raw), sct, logPublicKey)
+}
+
+// VerifyEmbeddedSCT verifies the signature of an SCT embedded into cert, as
+// returned by its SCT list extension, with the public key of the CT log
+// which issued it. The SCT was issued for the precertificate, which is
+// identified by the key of the issuer of cert.
+func VerifyEmbeddedSCT(cert, issuer *x509.Certificate, sct []byte, logPublicKey *ecdsa.PublicKey) error {
+	tbs, err := removeSCTList(cert.RawTBSCertificate)
+	if err != nil {
+		return err
+	}
+
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	entry := append([]byte{0, precertEntry}, issuerKeyHash[:]...)
+	return verifySCT(appendUint24(entry, tbs), sct, logPublicKey)
+}
+
+// verifySCT checks the signature of sct over entry, the encoded LogEntryType
+// and signed entry of RFC 6962 section 3.2.
+func verifySCT(entry, sct []byte, logPublicKey *ecdsa.PublicKey) error {
+	// version, log ID, timestamp and extensions length
+	if len(sct) < 1+32+8+2 {
+		return errors.New("Invalid SCT: too short")
+	}
+	if sct[0] != 0 {
+		return fmt.Errorf("Invalid SCT: unsupported version %d", sct[0])
+	}
+	id, err := logID(logPublicKey)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(id, sct[1:33]) {
+		return fmt.Errorf("Invalid SCT: issued by CT log %x, not by the log of the given key %x", sct[1:33], id)
+	}
+	timestamp := sct[33:41]
+	extensionsEnd := 43 + int(binary.BigEndian.Uint16(sct[41:43]))
+	if len(sct) < extensionsEnd+4 {
+		return errors.New("Invalid SCT: truncated extensions or signature")
+	}
+	extensions := sct[41:extensionsEnd]
+
+	// DigitallySigned of RFC 5246 section 4.7
+	hashAlgorithm, signatureAlgorithm := sct[extensionsEnd], sct[extensionsEnd+1]
+	signature := sct[extensionsEnd+4:]
+	if len(signature) != int(binary.BigEndian.Uint16(sct[extensionsEnd+2:extensionsEnd+4])) {
+		return errors.New("Invalid SCT: truncated signature")
+	}
+	if hashAlgorithm != 4 || signatureAlgorithm != 3 {
+		return fmt.Errorf("Invalid SCT: unsupported signature algorithm %d/%d, expected ECDSA with SHA-256", hashAlgorithm, signatureAlgorithm)
+	}
+	var ecdsaSignature struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(signature, &ecdsaSignature); err != nil || len(rest) > 0 {
+		return errors.New("Invalid SCT: malformed signature")
+	}
+
+	// version and signature type certificate_timestamp
+	signed := []byte{0, 0}
+	signed = append(signed, timestamp...)
+	signed = append(signed, entry...)
+	signed = append(signed, extensions...)
+	digest := sha256.Sum256(signed)
+	if !ecdsa.Verify(logPublicKey, digest[:], ecdsaSignature.R, ecdsaSignature.S) {
+		return fmt.Errorf("Invalid SCT: the signature of CT log %x does not match the certificate", id)
+	}
+	return nil
+}
+
+// logID returns the ID of the CT log with key, the SHA-256 hash of its
+// SubjectPublicKeyInfo.
+func logID(key *ecdsa.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(der)
+	return id[:], nil
+}
+
+// embeddedSCTs returns the serialized SCTs of the SCT list extension of cert.
+func embeddedSCTs(cert *x509.Certificate) ([][]byte, error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSCTList) {
+			continue
+		}
+
+		var list []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &list); err != nil || len(rest) > 0 || len(list) < 2 {
+			return nil, errors.New("Malformed SCT list extension")
+		}
+		list = list[2:]
+
+		var scts [][]byte
+		for len(list) > 0 {
+			if len(list) < 2 {
+				return nil, errors.New("Malformed SCT list extension")
+			}
+			n := int(binary.BigEndian.Uint16(list))
+			// version, log ID, timestamp and extensions length
+			if len(list) < 2+n || n < 1+32+8+2 {
+				return nil, errors.New("Malformed SCT list extension")
+			}
+			scts = append(scts, list[2:2+n])
+			list = list[2+n:]
+		}
+		return scts, nil
+	}
+	return nil, errors.New("The certificate has no embedded SCTs")
+}
+
+// tbsCertificate is the TBSCertificate of RFC 5280 section 4.1, parsed just
+// far enough to edit its extensions.
+type tbsCertificate struct {
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm asn1.RawValue
+	Issuer             asn1.RawValue
+	Validity           asn1.RawValue
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+	IssuerUniqueID     asn1.BitString   `asn1:"optional,tag:1"`
+	SubjectUniqueID    asn1.BitString   `asn1:"optional,tag:2"`
+	Extensions         []pkix.Extension `asn1:"optional,explicit,tag:3"`
+}
+
+// removeSCTList returns the DER encoded tbs without its SCT list extension,
+// which is the TBSCertificate of the precertificate the SCTs were issued
+// for.
+func removeSCTList(tbs []byte) ([]byte, error) {
+	var cert tbsCertificate
+	if rest, err := asn1.Unmarshal(tbs, &cert); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("Malformed TBSCertificate: %v", err)
+	}
+
+	extensions := cert.Extensions[:0]
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSCTList) {
+			extensions = append(extensions, ext)
+		}
+	}
+	cert.Extensions = extensions
+	return asn1.Marshal(cert)
+}
+
+// appendUint24 appends data prefixed with its 24 bit length to b.
+func appendUint24(b, data []byte) []byte {
+	b = append(b, byte(len(data)>>16), byte(len(data)>>8), byte(len(data)))
+	return append(b, data...)
+}
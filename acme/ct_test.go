@@ -0,0 +1,286 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSubmitToCTLogs(t *testing.T) {
+	logID := bytes.Repeat([]byte{0xab}, 32)
+	signature := []byte{4, 3, 0, 2, 0xde, 0xad}
+
+	var chain []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/log/ct/v1/add-chain" || r.Method != "POST" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Chain []string `json:"chain"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		chain = req.Chain
+
+		json.NewEncoder(w).Encode(addChainResponse{
+			ID:        base64.StdEncoding.EncodeToString(logID),
+			Timestamp: 1500000000000,
+			Signature: base64.StdEncoding.EncodeToString(signature),
+		})
+	}))
+	defer ts.Close()
+
+	key, err := generatePrivateKey(RSA2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := generateDerCert(key.(*rsa.PrivateKey), time.Now().Add(time.Hour), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := generateDerCert(key.(*rsa.PrivateKey), time.Now().Add(time.Hour), "issuer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{
+		jws:        &jws{},
+		issuerCert: issuer,
+		ctLogs:     []CTLog{{URL: ts.URL + "/log/"}, {URL: ts.URL + "/missing"}},
+	}
+	cert := CertificateResource{Domain: "example.com", Certificate: pemEncode(derCertificateBytes(leaf))}
+	client.submitToCTLogs(&cert)
+
+	if len(chain) != 2 || chain[0] != base64.StdEncoding.EncodeToString(leaf) || chain[1] != base64.StdEncoding.EncodeToString(issuer) {
+		t.Errorf("Expected the leaf and issuer to be submitted, got %d certificates", len(chain))
+	}
+	if len(cert.SCTs) != 1 {
+		t.Fatalf("Expected one SCT, the second log does not exist; got %d", len(cert.SCTs))
+	}
+
+	var expected bytes.Buffer
+	expected.WriteByte(0)
+	expected.Write(logID)
+	binary.Write(&expected, binary.BigEndian, uint64(1500000000000))
+	expected.Write([]byte{0, 0})
+	expected.Write(signature)
+	if !bytes.Equal(cert.SCTs[0], expected.Bytes()) {
+		t.Errorf("Unexpected SCT encoding\n got %x\nwant %x", cert.SCTs[0], expected.Bytes())
+	}
+}
+
+// signSCT returns an SCT of logKey over entry, the encoded LogEntryType and
+// signed entry.
+func signSCT(t *testing.T, logKey *ecdsa.PrivateKey, entry []byte) []byte {
+	id, err := logID(&logKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := make([]byte, 8)
+	binary.BigEndian.PutUint64(timestamp, 1500000000000)
+
+	signed := append([]byte{0, 0}, timestamp...)
+	signed = append(signed, entry...)
+	signed = append(signed, 0, 0)
+	digest := sha256.Sum256(signed)
+	r, s, err := ecdsa.Sign(rand.Reader, logKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sct := append([]byte{0}, id...)
+	sct = append(sct, timestamp...)
+	sct = append(sct, 0, 0, 4, 3, byte(len(signature)>>8), byte(len(signature)))
+	return append(sct, signature...)
+}
+
+// issueWithSCTs returns a certificate for example.com issued by a test CA
+// and its issuer, embedding an SCT of each of logKeys.
+func issueWithSCTs(t *testing.T, logKeys ...*ecdsa.PrivateKey) (*x509.Certificate, *x509.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	// The certificate without the SCTs stands in for the precertificate.
+	preDER, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pre, err := x509.ParseCertificate(preDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuerKeyHash := sha256.Sum256(ca.RawSubjectPublicKeyInfo)
+	entry := appendUint24(append([]byte{0, precertEntry}, issuerKeyHash[:]...), pre.RawTBSCertificate)
+	var list []byte
+	for _, logKey := range logKeys {
+		sct := signSCT(t, logKey, entry)
+		list = append(list, byte(len(sct)>>8), byte(len(sct)))
+		list = append(list, sct...)
+	}
+	value, err := asn1.Marshal(append([]byte{byte(len(list) >> 8), byte(len(list))}, list...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.ExtraExtensions = []pkix.Extension{{Id: oidSCTList, Value: value}}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, ca
+}
+
+func TestVerifySCT(t *testing.T) {
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := issueWithSCTs(t)
+
+	sct := signSCT(t, logKey, appendUint24([]byte{0, x509Entry}, cert.Raw))
+	if err := VerifySCT(cert, sct, &logKey.PublicKey); err != nil {
+		t.Errorf("Expected the SCT to verify, got %v", err)
+	}
+	if err := VerifySCT(cert, sct, &otherKey.PublicKey); err == nil {
+		t.Error("Expected an error for the key of another log")
+	}
+
+	tampered := append([]byte{}, sct...)
+	tampered[40]++
+	if err := VerifySCT(cert, tampered, &logKey.PublicKey); err == nil {
+		t.Error("Expected an error for a changed timestamp")
+	}
+	if err := VerifySCT(cert, sct[:50], &logKey.PublicKey); err == nil {
+		t.Error("Expected an error for a truncated SCT")
+	}
+}
+
+func TestVerifyEmbeddedSCT(t *testing.T) {
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, issuer := issueWithSCTs(t, logKey)
+
+	scts, err := embeddedSCTs(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scts) != 1 {
+		t.Fatalf("Expected one embedded SCT, got %d", len(scts))
+	}
+	if err := VerifyEmbeddedSCT(cert, issuer, scts[0], &logKey.PublicKey); err != nil {
+		t.Errorf("Expected the embedded SCT to verify, got %v", err)
+	}
+	if err := VerifyEmbeddedSCT(cert, cert, scts[0], &logKey.PublicKey); err == nil {
+		t.Error("Expected an error for the wrong issuer")
+	}
+	if err := VerifySCT(cert, scts[0], &logKey.PublicKey); err == nil {
+		t.Error("Expected an error verifying an embedded SCT as a stapled one")
+	}
+}
+
+func TestVerifyCertificateSCTs(t *testing.T) {
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{}
+	client.VerifyCertificateSCTs([]*ecdsa.PublicKey{&logKey.PublicKey})
+
+	cert, issuer := issueWithSCTs(t, unknownKey, logKey)
+	bundle := append(pemEncode(derCertificateBytes(cert.Raw)), pemEncode(derCertificateBytes(issuer.Raw))...)
+	if err := client.verifyCertificateSCTs(CertificateResource{Domain: "example.com", Certificate: bundle}); err != nil {
+		t.Errorf("Expected the SCTs to verify, got %v", err)
+	}
+
+	single := pemEncode(derCertificateBytes(cert.Raw))
+	if err := client.verifyCertificateSCTs(CertificateResource{Domain: "example.com", Certificate: single}); err == nil {
+		t.Error("Expected an error without the issuer")
+	}
+
+	cert, issuer = issueWithSCTs(t, unknownKey)
+	bundle = append(pemEncode(derCertificateBytes(cert.Raw)), pemEncode(derCertificateBytes(issuer.Raw))...)
+	if err := client.verifyCertificateSCTs(CertificateResource{Domain: "example.com", Certificate: bundle}); err == nil {
+		t.Error("Expected an error without the SCT of a known log")
+	}
+}
+
+func TestEmbeddedSCTsShortEntry(t *testing.T) {
+	// An SCT list holding one SCT of 10 bytes.
+	list := append([]byte{0, 12, 0, 10}, make([]byte, 10)...)
+	value, err := asn1.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &x509.Certificate{Extensions: []pkix.Extension{{Id: oidSCTList, Value: value}}}
+
+	if _, err := embeddedSCTs(cert); err == nil || err.Error() != "Malformed SCT list extension" {
+		t.Errorf("Expected a malformed SCT list, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DeployHook is called with the domain and the certificate after a
+// certificate was issued or renewed, e.g. to reload the servers using it.
+type DeployHook func(domain string, cert *CertificateResource) error
+
+// DeployInfo describes an issued certificate to deploy hooks outside of the
+// process.
+type DeployInfo struct {
+	Domain   string    `json:"domain"`
+	Domains  []string  `json:"domains"`
+	Serial   string    `json:"serial"`
+	NotAfter time.Time `json:"notAfter"`
+	CertURL  string    `json:"certUrl"`
+}
+
+// NewDeployInfo extracts the DeployInfo from a certificate resource.
+func NewDeployInfo(cert *CertificateResource) (*DeployInfo, error) {
+	certificates, err := parsePEMBundle(cert.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	x509Cert := certificates[0]
+	return &DeployInfo{
+		Domain:   cert.Domain,
+		Domains:  x509Cert.DNSNames,
+		Serial:   fmt.Sprintf("%x", x509Cert.SerialNumber),
+		NotAfter: x509Cert.NotAfter,
+		CertURL:  cert.CertURL,
+	}, nil
+}
+
+// AddDeployHook registers a hook to call after every certificate this
+// client obtains or renews. Hooks run in the order they were added; a
+// failing hook is logged and does not stop the others.
+func (c *Client) AddDeployHook(hook DeployHook) {
+	c.deployHooks = append(c.deployHooks, hook)
+}
+
+// runDeployHooks calls all registered deploy hooks for cert.
+func (c *Client) runDeployHooks(cert CertificateResource) {
+	for _, hook := range c.deployHooks {
+		if err := hook(cert.Domain, &cert); err != nil {
+			logf("[WARNING][%s] acme: Deploy hook failed: %v", cert.Domain, err)
+		}
+	}
+}
+
+// CommandDeployHook returns a hook running command through sh. The
+// certificate is described in the LEGO_CERT_DOMAIN, LEGO_CERT_DOMAINS
+// (comma separated), LEGO_CERT_SERIAL and LEGO_CERT_NOT_AFTER (RFC 3339)
+// environment variables.
+func CommandDeployHook(command string) DeployHook {
+	return func(domain string, cert *CertificateResource) error {
+		info, err := NewDeployInfo(cert)
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Env = append(os.Environ(),
+			"LEGO_CERT_DOMAIN="+info.Domain,
+			"LEGO_CERT_DOMAINS="+strings.Join(info.Domains, ","),
+			"LEGO_CERT_SERIAL="+info.Serial,
+			"LEGO_CERT_NOT_AFTER="+info.NotAfter.Format(time.RFC3339),
+		)
+
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("deploy command failed: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+}
+
+// WebhookDeployHook returns a hook posting the DeployInfo of the certificate
+// as JSON to url.
+func WebhookDeployHook(url string) DeployHook {
+	return func(domain string, cert *CertificateResource) error {
+		info, err := NewDeployInfo(cert)
+		if err != nil {
+			return err
+		}
+
+		body, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+
+		resp, err := httpPost(&HTTPClient, url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook %s returned HTTP %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
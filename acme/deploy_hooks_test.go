@@ -0,0 +1,101 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testCertificateResource(t *testing.T) CertificateResource {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	certPEM, err := generatePemCert(key, "test.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CertificateResource{Domain: "test.com", CertURL: "http://ca/cert/1", Certificate: certPEM}
+}
+
+func TestRunDeployHooks(t *testing.T) {
+	client := &Client{}
+
+	var called []string
+	client.AddDeployHook(func(domain string, cert *CertificateResource) error {
+		called = append(called, "first")
+		return errors.New("reload failed")
+	})
+	client.AddDeployHook(func(domain string, cert *CertificateResource) error {
+		called = append(called, "second:"+domain)
+		return nil
+	})
+
+	client.runDeployHooks(testCertificateResource(t))
+
+	if expected := []string{"first", "second:test.com"}; !reflect.DeepEqual(called, expected) {
+		t.Errorf("Expected hooks %v to run, got %v", expected, called)
+	}
+}
+
+func TestCommandDeployHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-deploy-hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := path.Join(dir, "out")
+	cert := testCertificateResource(t)
+	hook := CommandDeployHook(`echo "$LEGO_CERT_DOMAINS $LEGO_CERT_SERIAL" > ` + out)
+	if err := hook(cert.Domain, &cert); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := NewDeployInfo(&cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "test.com " + info.Serial; strings.TrimSpace(string(output)) != expected {
+		t.Errorf("Expected the command to see %q, got %q", expected, output)
+	}
+
+	if err := CommandDeployHook("exit 3")(cert.Domain, &cert); err == nil {
+		t.Error("Expected an error for a failing command")
+	}
+}
+
+func TestWebhookDeployHook(t *testing.T) {
+	var received DeployInfo
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	cert := testCertificateResource(t)
+	if err := WebhookDeployHook(ts.URL)(cert.Domain, &cert); err != nil {
+		t.Fatal(err)
+	}
+
+	if received.Domain != "test.com" || !reflect.DeepEqual(received.Domains, []string{"test.com"}) {
+		t.Errorf("Expected the webhook to receive test.com, got %+v", received)
+	}
+	if received.NotAfter.IsZero() || received.Serial == "" {
+		t.Errorf("Expected the expiry and serial in the payload, got %+v", received)
+	}
+}
@@ -0,0 +1,156 @@
+package acme
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// DirectoryCacheTTL is the time a directory fetched by NewClient is used
+	// for later clients of the same CA without fetching it again. Once it is
+	// older, the cached directory is still used, but refreshed in the
+	// background. Zero disables the cache.
+	DirectoryCacheTTL time.Duration
+
+	// DirectoryCacheFile is an optional file to keep the cached directories
+	// in, so they outlive the process.
+	DirectoryCacheFile string
+)
+
+// cachedDirectory is a directory with the time it was fetched.
+type cachedDirectory struct {
+	Directory directory `json:"directory"`
+	Fetched   time.Time `json:"fetched"`
+}
+
+// directoryCache holds the cached directories by their URL.
+var directoryCache = struct {
+	sync.Mutex
+	entries    map[string]cachedDirectory
+	loaded     string
+	refreshing map[string]bool
+}{entries: map[string]cachedDirectory{}, refreshing: map[string]bool{}}
+
+// getDirectory returns the directory of caDirURL, from the cache if enabled.
+func getDirectory(httpClient *http.Client, caDirURL string) (directory, error) {
+	if DirectoryCacheTTL <= 0 {
+		return fetchDirectory(httpClient, caDirURL)
+	}
+
+	directoryCache.Lock()
+	loadDirectoryCache()
+	entry, ok := directoryCache.entries[caDirURL]
+	stale := ok && time.Since(entry.Fetched) >= DirectoryCacheTTL
+	if stale && !directoryCache.refreshing[caDirURL] {
+		directoryCache.refreshing[caDirURL] = true
+		go refreshDirectory(httpClient, caDirURL)
+	}
+	directoryCache.Unlock()
+	if ok {
+		return entry.Directory, nil
+	}
+
+	dir, err := fetchDirectory(httpClient, caDirURL)
+	if err != nil {
+		return directory{}, err
+	}
+	cacheDirectory(caDirURL, dir)
+	return dir, nil
+}
+
+// refreshDirectory fetches the directory of caDirURL to replace its stale
+// cache entry.
+func refreshDirectory(httpClient *http.Client, caDirURL string) {
+	dir, err := fetchDirectory(httpClient, caDirURL)
+
+	directoryCache.Lock()
+	delete(directoryCache.refreshing, caDirURL)
+	directoryCache.Unlock()
+
+	if err != nil {
+		logf("[WARNING] acme: Could not refresh the cached directory: %v", err)
+		return
+	}
+	cacheDirectory(caDirURL, dir)
+}
+
+// cacheDirectory stores dir as the directory of caDirURL and writes the
+// cache to DirectoryCacheFile if set.
+func cacheDirectory(caDirURL string, dir directory) {
+	directoryCache.Lock()
+	defer directoryCache.Unlock()
+
+	directoryCache.entries[caDirURL] = cachedDirectory{Directory: dir, Fetched: time.Now()}
+	if DirectoryCacheFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(directoryCache.entries, "", "\t")
+	if err == nil {
+		err = ioutil.WriteFile(DirectoryCacheFile, data, 0600)
+	}
+	if err != nil {
+		logf("[WARNING] acme: Could not save the directory cache %s: %v", DirectoryCacheFile, err)
+	}
+}
+
+// loadDirectoryCache reads DirectoryCacheFile into the cache once. The cache
+// has to be locked. A missing or broken file starts an empty cache.
+func loadDirectoryCache() {
+	if DirectoryCacheFile == "" || directoryCache.loaded == DirectoryCacheFile {
+		return
+	}
+	directoryCache.loaded = DirectoryCacheFile
+
+	data, err := ioutil.ReadFile(DirectoryCacheFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logf("[WARNING] acme: Could not read the directory cache %s: %v", DirectoryCacheFile, err)
+		}
+		return
+	}
+	var entries map[string]cachedDirectory
+	if err := json.Unmarshal(data, &entries); err != nil {
+		logf("[WARNING] acme: Ignoring the invalid directory cache %s: %v", DirectoryCacheFile, err)
+		return
+	}
+	for url, entry := range entries {
+		if validateDirectory(entry.Directory) == nil {
+			directoryCache.entries[url] = entry
+		}
+	}
+}
+
+// fetchDirectory gets the directory at caDirURL from the CA.
+func fetchDirectory(httpClient *http.Client, caDirURL string) (directory, error) {
+	var dir directory
+	if _, err := getJSON(httpClient, caDirURL, &dir); err != nil {
+		return directory{}, fmt.Errorf("get directory at '%s': %v", caDirURL, err)
+	}
+	if err := validateDirectory(dir); err != nil {
+		return directory{}, err
+	}
+	return dir, nil
+}
+
+// validateDirectory returns an error if dir lacks a URL the client needs.
+func validateDirectory(dir directory) error {
+	if dir.NewRegURL == "" {
+		return errors.New("directory missing new registration URL")
+	}
+	if dir.NewAuthzURL == "" {
+		return errors.New("directory missing new authz URL")
+	}
+	if dir.NewCertURL == "" {
+		return errors.New("directory missing new certificate URL")
+	}
+	if dir.RevokeCertURL == "" {
+		return errors.New("directory missing revoke certificate URL")
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package acme
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetDirectoryCache empties the directory cache and restores its
+// configuration.
+func resetDirectoryCache() {
+	DirectoryCacheTTL, DirectoryCacheFile = 0, ""
+	directoryCache.Lock()
+	directoryCache.entries = map[string]cachedDirectory{}
+	directoryCache.loaded = ""
+	directoryCache.Unlock()
+}
+
+func TestDirectoryCache(t *testing.T) {
+	defer resetDirectoryCache()
+
+	var mu sync.Mutex
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		json.NewEncoder(w).Encode(directory{
+			NewAuthzURL:   "https://ca.example.com/new-authz",
+			NewCertURL:    "https://ca.example.com/new-cert",
+			NewRegURL:     "https://ca.example.com/new-reg",
+			RevokeCertURL: "https://ca.example.com/revoke-cert",
+		})
+	}))
+	defer ts.Close()
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+
+	dir, err := ioutil.TempDir("", "lego-directory-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Disabled, every client fetches the directory.
+	for i := 0; i < 2; i++ {
+		if _, err := getDirectory(&HTTPClient, ts.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count() != 2 {
+		t.Errorf("Expected 2 requests without the cache, got %d", count())
+	}
+
+	DirectoryCacheTTL = time.Hour
+	DirectoryCacheFile = filepath.Join(dir, "directories.json")
+	for i := 0; i < 2; i++ {
+		d, err := getDirectory(&HTTPClient, ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.NewRegURL != "https://ca.example.com/new-reg" {
+			t.Errorf("Unexpected directory %+v", d)
+		}
+	}
+	if count() != 3 {
+		t.Errorf("Expected the directory to be fetched once more, got %d requests", count())
+	}
+
+	// A new process reads the cache file.
+	directoryCache.Lock()
+	directoryCache.entries = map[string]cachedDirectory{}
+	directoryCache.loaded = ""
+	directoryCache.Unlock()
+	if _, err := getDirectory(&HTTPClient, ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if count() != 3 {
+		t.Errorf("Expected the directory to be read from the cache file, got %d requests", count())
+	}
+
+	// A stale directory is used while it is refreshed in the background.
+	directoryCache.Lock()
+	entry := directoryCache.entries[ts.URL]
+	entry.Fetched = time.Now().Add(-2 * time.Hour)
+	directoryCache.entries[ts.URL] = entry
+	directoryCache.Unlock()
+	if _, err := getDirectory(&HTTPClient, ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		directoryCache.Lock()
+		fresh := time.Since(directoryCache.entries[ts.URL].Fetched) < time.Hour
+		directoryCache.Unlock()
+		if fresh {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count() != 4 {
+		t.Errorf("Expected the stale directory to be refreshed, got %d requests", count())
+	}
+}
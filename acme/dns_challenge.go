@@ -8,6 +8,7 @@ import (
 	"log"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/miekg/dns"
@@ -20,7 +21,36 @@ var (
 	// PreCheckDNS checks DNS propagation before notifying ACME that
 	// the DNS challenge is ready.
 	PreCheckDNS preCheckDNSFunc = checkDNSPropagation
-	fqdnToZone                  = map[string]string{}
+)
+
+// ZoneCacheTTL is how long FindZoneByFqdn remembers the zone of a name.
+var ZoneCacheTTL = 5 * time.Minute
+
+var (
+	// zoneCache maps every name looked at while searching for a zone apex
+	// to that zone, so lookups for other names in the same zone stop at
+	// the first cached label.
+	zoneCache     = map[zoneCacheKey]zoneCacheEntry{}
+	zoneCacheLock sync.Mutex
+)
+
+// zoneCacheKey is a name together with the nameservers asked for its zone,
+// which may differ for the same name, e.g. with SetDomainNameservers.
+type zoneCacheKey struct {
+	name        string
+	nameservers string
+}
+
+type zoneCacheEntry struct {
+	zone    string
+	expires time.Time
+}
+
+var (
+	// zoneDelays records the observed propagation delay per zone so
+	// subsequent challenges can skip checks which are bound to fail.
+	zoneDelays     = map[string]time.Duration{}
+	zoneDelaysLock sync.Mutex
 )
 
 var RecursiveNameservers = []string{
@@ -28,10 +58,60 @@ var RecursiveNameservers = []string{
 	"google-public-dns-b.google.com:53",
 }
 
+var (
+	// domainNameservers holds the recursive nameservers overriding the
+	// ones passed to DNS queries for names within a domain.
+	domainNameservers     = map[string][]string{}
+	domainNameserversLock sync.Mutex
+)
+
+// SetDomainNameservers makes recursive DNS queries for names within domain,
+// including FindZoneByFqdn and the propagation check, use nameservers
+// instead of RecursiveNameservers. This supports split-horizon setups where
+// internal zones are not resolvable by public resolvers. The most specific
+// domain wins; an empty list removes the override.
+func SetDomainNameservers(domain string, nameservers []string) {
+	domainNameserversLock.Lock()
+	defer domainNameserversLock.Unlock()
+
+	domain = strings.ToLower(ToFqdn(domain))
+	if len(nameservers) == 0 {
+		delete(domainNameservers, domain)
+		return
+	}
+	domainNameservers[domain] = nameservers
+}
+
+// nameserversFor returns the nameservers configured for the most specific
+// domain containing fqdn, or fallback if there are none.
+func nameserversFor(fqdn string, fallback []string) []string {
+	domainNameserversLock.Lock()
+	defer domainNameserversLock.Unlock()
+
+	if len(domainNameservers) == 0 {
+		return fallback
+	}
+
+	name := strings.ToLower(ToFqdn(fqdn))
+	for _, index := range dns.Split(name) {
+		if nameservers, ok := domainNameservers[name[index:]]; ok {
+			return nameservers
+		}
+	}
+	return fallback
+}
+
 // DNSTimeout is used to override the default DNS timeout of 10 seconds.
 var DNSTimeout = 10 * time.Second
 
-// DNS01Record returns a DNS record which will fulfill the `dns-01` challenge
+// MaxCNAMEDepth is the maximum length of a CNAME chain FollowCNAME resolves.
+var MaxCNAMEDepth = 10
+
+// DNS01Record returns a DNS record which will fulfill the `dns-01` challenge.
+// A domain given as an fqdn, with a trailing dot, is the name of the record
+// itself. The DNS-01 solver presents delegated challenges, and all of them
+// after Client.SetDNS01FollowCNAME, that way, so the provider creates the TXT
+// record at the end of their CNAME chain.
 func DNS01Record(domain, keyAuth string) (fqdn string, value string, ttl int) {
 	keyAuthShaBytes := sha256.Sum256([]byte(keyAuth))
 	// base64URL encoding without padding
@@ -39,20 +119,92 @@ func DNS01Record(domain, keyAuth string) (fqdn string, value string, ttl int) {
 	value = strings.TrimRight(keyAuthSha, "=")
 	ttl = 120
 	fqdn = fmt.Sprintf("_acme-challenge.%s.", domain)
+
+	if strings.HasSuffix(domain, ".") {
+		fqdn = domain
+	}
 	return
 }
 
+// FollowCNAME resolves the chain of CNAME records starting at fqdn and
+// returns the canonical name at its end, which is fqdn itself if it is not
+// an alias. Chains longer than MaxCNAMEDepth are rejected.
+func FollowCNAME(fqdn string, nameservers []string) (string, error) {
+	seen := map[string]bool{}
+	for i := 0; i <= MaxCNAMEDepth; i++ {
+		if seen[fqdn] {
+			return "", fmt.Errorf("CNAME loop at %s", fqdn)
+		}
+		seen[fqdn] = true
+
+		r, err := dnsQuery(fqdn, dns.TypeCNAME, nameservers, true)
+		if err != nil {
+			return "", err
+		}
+
+		var target string
+		if r.Rcode == dns.RcodeSuccess {
+			for _, rr := range r.Answer {
+				if cn, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cn.Hdr.Name, fqdn) {
+					target = cn.Target
+					break
+				}
+			}
+		}
+		if target == "" {
+			return fqdn, nil
+		}
+		fqdn = target
+	}
+
+	return "", fmt.Errorf("CNAME chain of more than %d records", MaxCNAMEDepth)
+}
+
 // dnsChallenge implements the dns-01 challenge according to ACME 7.5
 type dnsChallenge struct {
 	jws      *jws
 	validate validateFunc
 	provider ChallengeProvider
+
+	// delegates holds the providers of domains whose challenge record is
+	// a CNAME into a zone managed elsewhere.
+	delegates map[string]ChallengeProvider
+
+	// followCNAME presents every challenge at the end of the CNAME chain of
+	// its challenge record.
+	followCNAME bool
+
+	// propagation overrides the timeouts of the providers when set.
+	propagation PropagationConfig
 }
 
 func (s *dnsChallenge) Solve(chlng challenge, domain string) error {
+	name := providerName(s.providerFor(domain))
+	recordDNSChallengeAttempt(name)
+
+	err := s.solve(chlng, domain)
+	recordDNSChallenge(name, err)
+	return err
+}
+
+// providerFor returns the provider solving the challenge of domain.
+func (s *dnsChallenge) providerFor(domain string) ChallengeProvider {
+	if delegate, ok := s.delegates[domain]; ok {
+		return delegate
+	}
+	return s.provider
+}
+
+func (s *dnsChallenge) solve(chlng challenge, domain string) error {
 	logf("[INFO][%s] acme: Trying to solve DNS-01", domain)
 
-	if s.provider == nil {
+	provider := s.providerFor(domain)
+	record, err := s.recordDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	if provider == nil {
 		return errors.New("No DNS Provider configured")
 	}
 
@@ -62,27 +214,37 @@ func (s *dnsChallenge) Solve(chlng challenge, domain string) error {
 		return err
 	}
 
-	err = s.provider.Present(domain, chlng.Token, keyAuth)
+	err = provider.Present(record, chlng.Token, keyAuth)
 	if err != nil {
 		return fmt.Errorf("Error presenting token: %s", err)
 	}
 	defer func() {
-		err := s.provider.CleanUp(domain, chlng.Token, keyAuth)
+		err := provider.CleanUp(record, chlng.Token, keyAuth)
 		if err != nil {
 			log.Printf("Error cleaning up %s: %v ", domain, err)
 		}
 	}()
 
-	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	fqdn, value, _ := DNS01Record(record, keyAuth)
 
 	logf("[INFO][%s] Checking DNS record propagation...", domain)
 
-	var timeout, interval time.Duration
-	switch provider := s.provider.(type) {
-	case ChallengeProviderTimeout:
-		timeout, interval = provider.Timeout()
-	default:
-		timeout, interval = 60*time.Second, 2*time.Second
+	timeout, interval := s.propagationTimeout(provider)
+
+	zone, err := FindZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		// Without a zone there is nothing to learn from, just poll.
+		zone = ""
+	}
+
+	if err := checkDNSSEC(domain, zone, provider); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if wait := initialPropagationWait(zone, timeout); wait > 0 {
+		logf("[INFO][%s] Waiting %s for zone %s to propagate", domain, wait, zone)
+		time.Sleep(wait)
 	}
 
 	err = WaitFor(timeout, interval, func() (bool, error) {
@@ -91,14 +253,211 @@ func (s *dnsChallenge) Solve(chlng challenge, domain string) error {
 	if err != nil {
 		return err
 	}
+	recordPropagationDelay(zone, time.Since(start))
+	recordPropagationWait(providerName(provider), time.Since(start))
 
 	return s.validate(s.jws, domain, chlng.URI, challenge{Resource: "challenge", Type: chlng.Type, Token: chlng.Token, KeyAuthorization: keyAuth})
 }
 
+// recordDomain returns the domain the challenge of domain is presented for.
+// That is domain itself, or for a delegated domain and with followCNAME the
+// fqdn at the end of the CNAME chain of its challenge record, which
+// DNS01Record then returns as the record name. The chain is resolved once
+// per challenge.
+func (s *dnsChallenge) recordDomain(domain string) (string, error) {
+	_, delegated := s.delegates[domain]
+	if !delegated && !s.followCNAME {
+		return domain, nil
+	}
+
+	name := fmt.Sprintf("_acme-challenge.%s.", domain)
+	target, err := FollowCNAME(name, RecursiveNameservers)
+	switch {
+	case delegated && err != nil:
+		return "", fmt.Errorf("Could not resolve the challenge delegation of %s: %v", domain, err)
+	case delegated && target == name:
+		return "", fmt.Errorf("%s is delegated but %s is not a CNAME", domain, name)
+	case delegated:
+		logf("[INFO][%s] acme: Challenge record is delegated to %s", domain, target)
+	case err != nil:
+		logf("[WARNING][%s] acme: Could not follow CNAME of %s: %v", domain, name, err)
+		return domain, nil
+	case target == name:
+		return domain, nil
+	default:
+		logf("[INFO][%s] acme: Challenge record is a CNAME to %s", domain, target)
+	}
+	return target, nil
+}
+
+// propagationTimeout returns the timeout and poll interval of the
+// propagation check for provider. Values of the PropagationConfig take
+// precedence over the ones of the provider.
+func (s *dnsChallenge) propagationTimeout(provider ChallengeProvider) (timeout, interval time.Duration) {
+	switch provider := provider.(type) {
+	case ChallengeProviderTimeout:
+		timeout, interval = provider.Timeout()
+	default:
+		timeout, interval = DefaultPropagationTimeout, DefaultPollingInterval
+	}
+
+	if s.propagation.Timeout > 0 {
+		timeout = s.propagation.Timeout
+	}
+	if s.propagation.PollInterval > 0 {
+		interval = s.propagation.PollInterval
+	}
+	return timeout, interval
+}
+
+// checkDNSSEC looks for DNSKEY records in zone. If the zone is signed, the
+// provider is asked to re-sign it when it implements ChallengeProviderDNSSEC
+// and to pass the change on when it implements
+// ChallengeProviderDNSSECRollover. Otherwise a warning is logged as
+// validating resolvers may reject the new record until the zone is re-signed.
+func checkDNSSEC(domain, zone string, provider ChallengeProvider) error {
+	if zone == "" {
+		return nil
+	}
+
+	signed, err := zoneIsSigned(zone, RecursiveNameservers)
+	if err != nil {
+		logf("[WARNING][%s] acme: Could not query the DNSKEY records of %s: %v", domain, zone, err)
+		return nil
+	}
+	if !signed {
+		return nil
+	}
+
+	resigner, canResign := provider.(ChallengeProviderDNSSEC)
+	notifier, canNotify := provider.(ChallengeProviderDNSSECRollover)
+	if !canResign && !canNotify {
+		logf("[WARNING][%s] acme: Zone %s is DNSSEC signed, the challenge record may fail validation until the zone is re-signed", domain, zone)
+		return nil
+	}
+
+	if canResign {
+		logf("[INFO][%s] acme: Re-signing DNSSEC zone %s", domain, zone)
+		if err := resigner.ResignZone(zone); err != nil {
+			return fmt.Errorf("Error re-signing zone %s: %v", zone, err)
+		}
+	}
+	if canNotify {
+		logf("[INFO][%s] acme: Notifying DNSSEC rollover of zone %s", domain, zone)
+		if err := notifier.NotifyDNSSECRollover(zone); err != nil {
+			return fmt.Errorf("Error notifying DNSSEC rollover of zone %s: %v", zone, err)
+		}
+	}
+	return nil
+}
+
+// zoneIsSigned reports whether zone publishes DNSKEY records.
+func zoneIsSigned(zone string, nameservers []string) (bool, error) {
+	r, err := dnsQuery(zone, dns.TypeDNSKEY, nameservers, true)
+	if err != nil {
+		return false, err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return false, nil
+	}
+
+	for _, rr := range r.Answer {
+		if _, ok := rr.(*dns.DNSKEY); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PropagationDelays returns a copy of the DNS propagation delays observed
+// per zone. The result can be persisted and handed to SetPropagationDelays
+// on the next run.
+func PropagationDelays() map[string]time.Duration {
+	zoneDelaysLock.Lock()
+	defer zoneDelaysLock.Unlock()
+
+	delays := make(map[string]time.Duration, len(zoneDelays))
+	for zone, delay := range zoneDelays {
+		delays[zone] = delay
+	}
+	return delays
+}
+
+// SetPropagationDelays seeds the per zone propagation delays, usually with
+// values recorded during a previous run. Solving a DNS-01 challenge in a
+// known zone waits for half of the last observed delay before the first
+// propagation check.
+func SetPropagationDelays(delays map[string]time.Duration) {
+	zoneDelaysLock.Lock()
+	defer zoneDelaysLock.Unlock()
+
+	for zone, delay := range delays {
+		zoneDelays[zone] = delay
+	}
+}
+
+// initialPropagationWait returns how long to wait before polling for the
+// propagation of a record in zone. Only half of the last observed delay is
+// used so the estimate can shrink again when a zone gets faster.
+func initialPropagationWait(zone string, timeout time.Duration) time.Duration {
+	if zone == "" {
+		return 0
+	}
+
+	zoneDelaysLock.Lock()
+	wait := zoneDelays[zone] / 2
+	zoneDelaysLock.Unlock()
+
+	if wait > timeout/2 {
+		wait = timeout / 2
+	}
+	return wait
+}
+
+// recordPropagationDelay stores the delay it took for a record in zone to propagate.
+func recordPropagationDelay(zone string, delay time.Duration) {
+	if zone == "" {
+		return
+	}
+
+	zoneDelaysLock.Lock()
+	zoneDelays[zone] = delay
+	zoneDelaysLock.Unlock()
+}
+
+// WaitForPropagation polls every pollInterval until the TXT record fqdn with
+// value is served by all authoritative nameservers of its zone, or timeout
+// passes. The zone and its nameservers are looked up through nameservers,
+// RecursiveNameservers if empty. This is the check run while solving a
+// DNS-01 challenge, for use with records created by other means.
+func WaitForPropagation(fqdn, value string, nameservers []string, timeout, pollInterval time.Duration) error {
+	if len(nameservers) == 0 {
+		nameservers = RecursiveNameservers
+	}
+	fqdn = ToFqdn(fqdn)
+
+	return WaitFor(timeout, pollInterval, func() (bool, error) {
+		return checkPropagation(fqdn, value, nameservers)
+	})
+}
+
 // checkDNSPropagation checks if the expected TXT record has been propagated to all authoritative nameservers.
 func checkDNSPropagation(fqdn, value string) (bool, error) {
+	return checkPropagation(fqdn, value, RecursiveNameservers)
+}
+
+// checkPropagation is checkDNSPropagation resolving the zone through the
+// given recursive nameservers.
+func checkPropagation(fqdn, value string, nameservers []string) (bool, error) {
+	switch dnsResolverMode {
+	case DNSResolverSystem:
+		return checkSystemPropagation(fqdn, value)
+	case DNSResolverDoH, DNSResolverDoT:
+		return checkRecursivePropagation(fqdn, value)
+	}
+
 	// Initial attempt to resolve at the recursive NS
-	r, err := dnsQuery(fqdn, dns.TypeTXT, RecursiveNameservers, true)
+	r, err := dnsQuery(fqdn, dns.TypeTXT, nameservers, true)
 	if err != nil {
 		return false, err
 	}
@@ -114,7 +473,7 @@ func checkDNSPropagation(fqdn, value string) (bool, error) {
 		}
 	}
 
-	authoritativeNss, err := lookupNameservers(fqdn)
+	authoritativeNss, err := authoritativeNameservers(fqdn, nameservers)
 	if err != nil {
 		return false, err
 	}
@@ -161,8 +520,22 @@ func dnsQuery(fqdn string, rtype uint16, nameservers []string, recursive bool) (
 
 	if !recursive {
 		m.RecursionDesired = false
+	} else {
+		nameservers = nameserversFor(fqdn, nameservers)
 	}
 
+	switch dnsResolverMode {
+	case DNSResolverDoH:
+		return exchangeDoH(m)
+	case DNSResolverDoT:
+		return exchangeDoT(m)
+	}
+	return exchangeRaw(m, nameservers)
+}
+
+// exchangeRaw sends m straight to the given nameservers over UDP, falling
+// back to TCP for truncated answers.
+func exchangeRaw(m *dns.Msg, nameservers []string) (in *dns.Msg, err error) {
 	// Will retry the request based on the number of servers (n+1)
 	for i := 1; i <= len(nameservers)+1; i++ {
 		ns := nameservers[i%len(nameservers)]
@@ -184,14 +557,58 @@ func dnsQuery(fqdn string, rtype uint16, nameservers []string, recursive bool) (
 
 // lookupNameservers returns the authoritative nameservers for the given fqdn.
 func lookupNameservers(fqdn string) ([]string, error) {
+	return authoritativeNameservers(fqdn, RecursiveNameservers)
+}
+
+// nameserverAddr returns the address queries for the authoritative
+// nameserver ns are sent to. It is overridden during tests.
+var nameserverAddr = func(ns string) string {
+	return net.JoinHostPort(ns, "53")
+}
+
+// CheckNameservers returns the authoritative nameservers of the zone of
+// domain, after checking that each of them answers authoritatively for the
+// zone. The nameservers are asked directly even if DNS queries go to a
+// DNS-over-HTTPS or DNS-over-TLS resolver otherwise, as a recursive
+// resolver never answers authoritatively.
+func CheckNameservers(domain string) ([]string, error) {
+	nameservers, err := lookupNameservers(ToFqdn(domain))
+	if err != nil {
+		return nil, err
+	}
+	zone, err := FindZoneByFqdn(ToFqdn(domain), RecursiveNameservers)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ns := range nameservers {
+		m := new(dns.Msg)
+		m.SetQuestion(zone, dns.TypeSOA)
+		m.SetEdns0(4096, false)
+		m.RecursionDesired = false
+
+		r, err := exchangeRaw(m, []string{nameserverAddr(ns)})
+		if err != nil {
+			return nil, fmt.Errorf("NS %s did not answer: %v", ns, err)
+		}
+		if r.Rcode != dns.RcodeSuccess || !r.Authoritative {
+			return nil, fmt.Errorf("NS %s is not authoritative for %s (%s)", ns, zone, dns.RcodeToString[r.Rcode])
+		}
+	}
+	return nameservers, nil
+}
+
+// authoritativeNameservers returns the authoritative nameservers for the
+// given fqdn, asking the given recursive nameservers.
+func authoritativeNameservers(fqdn string, nameservers []string) ([]string, error) {
 	var authoritativeNss []string
 
-	zone, err := FindZoneByFqdn(fqdn, RecursiveNameservers)
+	zone, err := FindZoneByFqdn(fqdn, nameservers)
 	if err != nil {
 		return nil, fmt.Errorf("Could not determine the zone: %v", err)
 	}
 
-	r, err := dnsQuery(zone, dns.TypeNS, RecursiveNameservers, true)
+	r, err := dnsQuery(zone, dns.TypeNS, nameservers, true)
 	if err != nil {
 		return nil, err
 	}
@@ -210,12 +627,29 @@ func lookupNameservers(fqdn string) ([]string, error) {
 
 // FindZoneByFqdn determines the zone apex for the given fqdn by recursing up the
 // domain labels until the nameserver returns a SOA record in the answer section.
+// Nameservers set for the domain of fqdn with SetDomainNameservers are used
+// instead of the given ones.
+//
+// Results are cached for ZoneCacheTTL per set of nameservers, for fqdn and
+// every name between it and the apex.
 func FindZoneByFqdn(fqdn string, nameservers []string) (string, error) {
+	nameservers = nameserversFor(fqdn, nameservers)
+
 	// Do we have it cached?
-	if zone, ok := fqdnToZone[fqdn]; ok {
+	if zone, ok := cachedZone(fqdn, nameservers); ok {
 		return zone, nil
 	}
 
+	if dnsResolverMode == DNSResolverSystem {
+		zone, err := findZoneBySystem(fqdn)
+		if err != nil {
+			return "", err
+		}
+		cacheZone(zone, nameservers, fqdn)
+		return zone, nil
+	}
+
+	var visited []string
 	labelIndexes := dns.Split(fqdn)
 	for _, index := range labelIndexes {
 		domain := fqdn[index:]
@@ -224,6 +658,12 @@ func FindZoneByFqdn(fqdn string, nameservers []string) (string, error) {
 			break
 		}
 
+		if zone, ok := cachedZone(domain, nameservers); ok {
+			cacheZone(zone, nameservers, visited...)
+			return zone, nil
+		}
+		visited = append(visited, domain)
+
 		in, err := dnsQuery(domain, dns.TypeSOA, nameservers, true)
 		if err != nil {
 			return "", err
@@ -240,7 +680,7 @@ func FindZoneByFqdn(fqdn string, nameservers []string) (string, error) {
 			for _, ans := range in.Answer {
 				if soa, ok := ans.(*dns.SOA); ok {
 					zone := soa.Hdr.Name
-					fqdnToZone[fqdn] = zone
+					cacheZone(zone, nameservers, visited...)
 					return zone, nil
 				}
 			}
@@ -250,6 +690,37 @@ func FindZoneByFqdn(fqdn string, nameservers []string) (string, error) {
 	return "", fmt.Errorf("Could not find the start of authority")
 }
 
+// cachedZone returns the cached zone of name found through nameservers if it
+// has not expired.
+func cachedZone(name string, nameservers []string) (string, bool) {
+	zoneCacheLock.Lock()
+	defer zoneCacheLock.Unlock()
+
+	key := zoneCacheKey{name: name, nameservers: strings.Join(nameservers, ",")}
+	entry, ok := zoneCache[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(entry.expires) {
+		delete(zoneCache, key)
+		return "", false
+	}
+	return entry.zone, true
+}
+
+// cacheZone remembers zone as the zone of names found through nameservers
+// for ZoneCacheTTL.
+func cacheZone(zone string, nameservers []string, names ...string) {
+	zoneCacheLock.Lock()
+	defer zoneCacheLock.Unlock()
+
+	expires := time.Now().Add(ZoneCacheTTL)
+	for _, name := range names {
+		key := zoneCacheKey{name: name, nameservers: strings.Join(nameservers, ",")}
+		zoneCache[key] = zoneCacheEntry{zone: zone, expires: expires}
+	}
+}
+
 func isTLD(domain string) bool {
 	publicsuffix, _ := publicsuffix.PublicSuffix(UnFqdn(domain))
 	if publicsuffix == UnFqdn(domain) {
@@ -258,9 +729,18 @@ func isTLD(domain string) bool {
 	return false
 }
 
-// ClearFqdnCache clears the cache of fqdn to zone mappings. Primarily used in testing.
+// ClearZoneCache clears the cache of name to zone mappings. Primarily used in testing.
+func ClearZoneCache() {
+	zoneCacheLock.Lock()
+	zoneCache = map[zoneCacheKey]zoneCacheEntry{}
+	zoneCacheLock.Unlock()
+}
+
+// ClearFqdnCache clears the cache of fqdn to zone mappings.
+//
+// Deprecated: use ClearZoneCache.
 func ClearFqdnCache() {
-	fqdnToZone = map[string]string{}
+	ClearZoneCache()
 }
 
 // ToFqdn converts the name into a fqdn appending a trailing dot.
@@ -4,14 +4,19 @@ import (
 	"bufio"
 	"crypto/rand"
 	"crypto/rsa"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/miekg/dns"
 )
 
 var lookupNameserversTestsOK = []struct {
@@ -113,6 +118,235 @@ func TestDNSValidServerResponse(t *testing.T) {
 	}
 }
 
+func TestPropagationDelays(t *testing.T) {
+	defer func() { zoneDelays = map[string]time.Duration{} }()
+
+	if wait := initialPropagationWait("example.com.", time.Minute); wait != 0 {
+		t.Errorf("Expected no initial wait for an unknown zone, got %s", wait)
+	}
+
+	SetPropagationDelays(map[string]time.Duration{"example.com.": 20 * time.Second})
+	if wait := initialPropagationWait("example.com.", time.Minute); wait != 10*time.Second {
+		t.Errorf("Expected an initial wait of 10s, got %s", wait)
+	}
+	if wait := initialPropagationWait("example.com.", 10*time.Second); wait != 5*time.Second {
+		t.Errorf("Expected the initial wait to be capped at 5s, got %s", wait)
+	}
+
+	recordPropagationDelay("example.org.", 4*time.Second)
+	recordPropagationDelay("", time.Hour)
+
+	delays := PropagationDelays()
+	expected := map[string]time.Duration{"example.com.": 20 * time.Second, "example.org.": 4 * time.Second}
+	if !reflect.DeepEqual(delays, expected) {
+		t.Errorf("Expected delays %v, got %v", expected, delays)
+	}
+}
+
+func TestFollowCNAME(t *testing.T) {
+	aliases := map[string]string{
+		"_acme-challenge.example.com.": "_acme-challenge.example.net.",
+		"_acme-challenge.example.net.": "challenges.example.org.",
+		"_acme-challenge.loop.com.":    "_acme-challenge.loop.net.",
+		"_acme-challenge.loop.net.":    "_acme-challenge.loop.com.",
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		name := req.Question[0].Name
+		if target, ok := aliases[name]; ok {
+			resp.Answer = append(resp.Answer, &dns.CNAME{
+				Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+				Target: target,
+			})
+		}
+		w.WriteMsg(resp)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	nameservers := []string{pc.LocalAddr().String()}
+
+	target, err := FollowCNAME("_acme-challenge.example.com.", nameservers)
+	if err != nil || target != "challenges.example.org." {
+		t.Errorf("Expected the chain to end at challenges.example.org., got %q (%v)", target, err)
+	}
+
+	target, err = FollowCNAME("_acme-challenge.plain.com.", nameservers)
+	if err != nil || target != "_acme-challenge.plain.com." {
+		t.Errorf("Expected a name without CNAME to be returned as is, got %q (%v)", target, err)
+	}
+
+	if _, err := FollowCNAME("_acme-challenge.loop.com.", nameservers); err == nil {
+		t.Error("Expected an error for a CNAME loop")
+	}
+
+	defer func(depth int) { MaxCNAMEDepth = depth }(MaxCNAMEDepth)
+	MaxCNAMEDepth = 1
+	if _, err := FollowCNAME("_acme-challenge.example.com.", nameservers); err == nil {
+		t.Error("Expected an error for a chain longer than MaxCNAMEDepth")
+	}
+}
+
+func TestDNSChallengeRecordDomain(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		if name := req.Question[0].Name; name == "_acme-challenge.example.com." {
+			resp.Answer = append(resp.Answer, &dns.CNAME{
+				Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+				Target: "example.com.acme.example.net.",
+			})
+		}
+		w.WriteMsg(resp)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	defer func(nameservers []string) { RecursiveNameservers = nameservers }(RecursiveNameservers)
+	RecursiveNameservers = []string{pc.LocalAddr().String()}
+
+	delegate := &metricsTestProvider{}
+	solver := &dnsChallenge{delegates: map[string]ChallengeProvider{"example.com": delegate, "plain.com": delegate}}
+	other := &dnsChallenge{}
+
+	record, err := solver.recordDomain("example.com")
+	if err != nil || record != "example.com.acme.example.net." {
+		t.Errorf("Expected the delegated challenge to be presented at the CNAME target, got %q (%v)", record, err)
+	}
+	if fqdn, _, _ := DNS01Record(record, "keyAuth"); fqdn != "example.com.acme.example.net." {
+		t.Errorf("Expected the record at the CNAME target, got %s", fqdn)
+	}
+	if _, err := solver.recordDomain("plain.com"); err == nil {
+		t.Error("Expected an error for a delegated domain without CNAME")
+	}
+
+	// The delegation of one solver does not leak into another one.
+	if record, err := other.recordDomain("example.com"); err != nil || record != "example.com" {
+		t.Errorf("Expected an undelegated challenge to be presented for the domain, got %q (%v)", record, err)
+	}
+
+	other.followCNAME = true
+	if record, err := other.recordDomain("example.com"); err != nil || record != "example.com.acme.example.net." {
+		t.Errorf("Expected the challenge to be presented at the CNAME target, got %q (%v)", record, err)
+	}
+	if record, err := other.recordDomain("plain.com"); err != nil || record != "plain.com" {
+		t.Errorf("Expected a challenge without CNAME to be presented for the domain, got %q (%v)", record, err)
+	}
+}
+
+type resigningProvider struct {
+	metricsTestProvider
+	resigned []string
+}
+
+func (p *resigningProvider) ResignZone(zone string) error {
+	p.resigned = append(p.resigned, zone)
+	return nil
+}
+
+type rolloverProvider struct {
+	resigningProvider
+	notified []string
+}
+
+func (p *rolloverProvider) NotifyDNSSECRollover(zone string) error {
+	p.notified = append(p.notified, zone)
+	return nil
+}
+
+func TestCheckDNSSEC(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		if q := req.Question[0]; q.Name == "signed.com." && q.Qtype == dns.TypeDNSKEY {
+			resp.Answer = append(resp.Answer, &dns.DNSKEY{
+				Hdr:       dns.RR_Header{Name: q.Name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 300},
+				Flags:     257,
+				Protocol:  3,
+				Algorithm: dns.RSASHA256,
+				PublicKey: "AwEAAQ==",
+			})
+		}
+		w.WriteMsg(resp)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	defer func(nameservers []string) { RecursiveNameservers = nameservers }(RecursiveNameservers)
+	RecursiveNameservers = []string{pc.LocalAddr().String()}
+
+	if signed, err := zoneIsSigned("signed.com.", RecursiveNameservers); err != nil || !signed {
+		t.Errorf("Expected signed.com. to be signed, got %v (%v)", signed, err)
+	}
+	if signed, err := zoneIsSigned("plain.com.", RecursiveNameservers); err != nil || signed {
+		t.Errorf("Expected plain.com. not to be signed, got %v (%v)", signed, err)
+	}
+
+	provider := &resigningProvider{}
+	for _, zone := range []string{"signed.com.", "plain.com.", ""} {
+		if err := checkDNSSEC("example.com", zone, provider); err != nil {
+			t.Errorf("Unexpected error checking %q: %v", zone, err)
+		}
+	}
+	if !reflect.DeepEqual(provider.resigned, []string{"signed.com."}) {
+		t.Errorf("Expected only signed.com. to be re-signed, got %v", provider.resigned)
+	}
+
+	rollover := &rolloverProvider{}
+	for _, zone := range []string{"signed.com.", "plain.com."} {
+		if err := checkDNSSEC("example.com", zone, rollover); err != nil {
+			t.Errorf("Unexpected error checking %q: %v", zone, err)
+		}
+	}
+	if !reflect.DeepEqual(rollover.resigned, []string{"signed.com."}) || !reflect.DeepEqual(rollover.notified, []string{"signed.com."}) {
+		t.Errorf("Expected signed.com. to be re-signed and notified, got %v and %v", rollover.resigned, rollover.notified)
+	}
+}
+
+func TestSetDomainNameservers(t *testing.T) {
+	defer func() {
+		SetDomainNameservers("corp.example.com", nil)
+		SetDomainNameservers("internal.corp.example.com.", nil)
+	}()
+	SetDomainNameservers("corp.example.com", []string{"192.168.1.1:53"})
+	SetDomainNameservers("internal.corp.example.com.", []string{"10.0.0.1:53"})
+
+	fallback := []string{"8.8.8.8:53"}
+	for _, test := range []struct {
+		fqdn     string
+		expected []string
+	}{
+		{"_acme-challenge.www.corp.example.com.", []string{"192.168.1.1:53"}},
+		{"corp.example.com.", []string{"192.168.1.1:53"}},
+		{"_acme-challenge.HOST.Internal.corp.example.com.", []string{"10.0.0.1:53"}},
+		{"_acme-challenge.example.com.", fallback},
+		{"_acme-challenge.notcorp.example.com.", fallback},
+	} {
+		if nameservers := nameserversFor(test.fqdn, fallback); !reflect.DeepEqual(nameservers, test.expected) {
+			t.Errorf("Expected %s to use %v, got %v", test.fqdn, test.expected, nameservers)
+		}
+	}
+
+	SetDomainNameservers("corp.example.com", nil)
+	if nameservers := nameserversFor("www.corp.example.com.", fallback); !reflect.DeepEqual(nameservers, fallback) {
+		t.Errorf("Expected the override to be removed, got %v", nameservers)
+	}
+}
+
 func TestPreCheckDNS(t *testing.T) {
 	ok, err := PreCheckDNS("acme-staging.api.letsencrypt.org", "fe01=")
 	if err != nil || !ok {
@@ -162,6 +396,141 @@ func TestFindZoneByFqdn(t *testing.T) {
 	}
 }
 
+func TestZoneCache(t *testing.T) {
+	var queries int
+	var queriesLock sync.Mutex
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		queriesLock.Lock()
+		queries++
+		queriesLock.Unlock()
+
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		if req.Question[0].Name == "example.com." {
+			resp.Answer = append(resp.Answer, &dns.SOA{
+				Hdr:  dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+				Ns:   "ns.example.com.",
+				Mbox: "hostmaster.example.com.",
+			})
+		}
+		w.WriteMsg(resp)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	count := func() int {
+		queriesLock.Lock()
+		defer queriesLock.Unlock()
+		return queries
+	}
+
+	ClearZoneCache()
+	defer ClearZoneCache()
+	nameservers := []string{pc.LocalAddr().String()}
+
+	for i := 0; i < 100; i++ {
+		fqdn := fmt.Sprintf("_acme-challenge.host%d.example.com.", i)
+		for j := 0; j < 3; j++ {
+			zone, err := FindZoneByFqdn(fqdn, nameservers)
+			if err != nil || zone != "example.com." {
+				t.Fatalf("Expected zone example.com. for %s, got %q (%v)", fqdn, zone, err)
+			}
+		}
+	}
+	if n := count(); n != 201 {
+		t.Errorf("Expected 201 SOA queries, got %d", n)
+	}
+
+	defer func(ttl time.Duration) { ZoneCacheTTL = ttl }(ZoneCacheTTL)
+	ZoneCacheTTL = -time.Second
+	ClearZoneCache()
+	before := count()
+	for j := 0; j < 2; j++ {
+		FindZoneByFqdn("_acme-challenge.host0.example.com.", nameservers)
+	}
+	if n := count() - before; n != 6 {
+		t.Errorf("Expected expired entries to be looked up again, got %d queries", n)
+	}
+}
+
+func TestZoneCacheNameservers(t *testing.T) {
+	// Each server answers with a different apex for the same name, like an
+	// internal view of a zone next to the public one.
+	serve := func(apex string) (string, func()) {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			resp := new(dns.Msg)
+			resp.SetReply(req)
+			if req.Question[0].Name == apex {
+				resp.Answer = append(resp.Answer, &dns.SOA{
+					Hdr:  dns.RR_Header{Name: apex, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+					Ns:   "ns." + apex,
+					Mbox: "hostmaster." + apex,
+				})
+			}
+			w.WriteMsg(resp)
+		})}
+		go server.ActivateAndServe()
+		return pc.LocalAddr().String(), func() { server.Shutdown() }
+	}
+	public, shutdownPublic := serve("example.com.")
+	defer shutdownPublic()
+	internal, shutdownInternal := serve("internal.example.com.")
+	defer shutdownInternal()
+
+	ClearZoneCache()
+	defer ClearZoneCache()
+
+	fqdn := "_acme-challenge.internal.example.com."
+	if zone, err := FindZoneByFqdn(fqdn, []string{public}); err != nil || zone != "example.com." {
+		t.Fatalf("Expected zone example.com., got %q (%v)", zone, err)
+	}
+	if zone, err := FindZoneByFqdn(fqdn, []string{internal}); err != nil || zone != "internal.example.com." {
+		t.Errorf("Expected the zone of other nameservers not to come from the cache, got %q (%v)", zone, err)
+	}
+}
+
+func TestWaitForPropagationTimeout(t *testing.T) {
+	var queried []string
+	var queriedLock sync.Mutex
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		queriedLock.Lock()
+		queried = append(queried, req.Question[0].Name)
+		queriedLock.Unlock()
+
+		resp := new(dns.Msg)
+		resp.SetRcode(req, dns.RcodeServerFailure)
+		w.WriteMsg(resp)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	ClearZoneCache()
+	defer ClearZoneCache()
+
+	err = WaitForPropagation("_acme-challenge.example.com", "value", []string{pc.LocalAddr().String()}, 100*time.Millisecond, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "Time limit exceeded") {
+		t.Errorf("Expected the wait to time out, got %v", err)
+	}
+
+	queriedLock.Lock()
+	defer queriedLock.Unlock()
+	if len(queried) == 0 || queried[0] != "_acme-challenge.example.com." {
+		t.Errorf("Expected the given nameservers to be asked for the record, got %v", queried)
+	}
+}
+
 func TestCheckAuthoritativeNss(t *testing.T) {
 	for _, tt := range checkAuthoritativeNssTests {
 		ok, _ := checkAuthoritativeNss(tt.fqdn, tt.value, tt.ns)
@@ -0,0 +1,75 @@
+package acme
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// knownNameservers maps the nameserver hostnames of DNS hosts to the name of
+// the lego DNS provider managing their zones. The first matching pattern wins.
+var knownNameservers = []struct {
+	pattern  *regexp.Regexp
+	provider string
+}{
+	{regexp.MustCompile(`\.auroradns\.(eu|info|org|xyz)\.$`), "auroradns"},
+	{regexp.MustCompile(`\.ns\.cloudflare\.com\.$`), "cloudflare"},
+	{regexp.MustCompile(`\.digitalocean\.com\.$`), "digitalocean"},
+	{regexp.MustCompile(`\.dnsimple\.com\.$`), "dnsimple"},
+	{regexp.MustCompile(`\.dnsmadeeasy\.com\.$`), "dnsmadeeasy"},
+	{regexp.MustCompile(`\.dreamhost\.com\.$`), "dreamhost"},
+	{regexp.MustCompile(`\.dynect\.net\.$`), "dyn"},
+	{regexp.MustCompile(`\.gandi\.net\.$`), "gandi"},
+	{regexp.MustCompile(`^ns-cloud-[a-e][1-4]\.googledomains\.com\.$`), "gcloud"},
+	{regexp.MustCompile(`\.domaincontrol\.com\.$`), "godaddy"},
+	{regexp.MustCompile(`^ns[1-5]\.he\.net\.$`), "hedns"},
+	{regexp.MustCompile(`\.hover\.com\.$`), "hover"},
+	{regexp.MustCompile(`\.linode\.com\.$`), "linode"},
+	{regexp.MustCompile(`\.mythic-beasts\.com\.$`), "mythicbeasts"},
+	{regexp.MustCompile(`\.namebrightdns\.com\.$`), "namebright"},
+	{regexp.MustCompile(`\.registrar-servers\.com\.$`), "namecheap"},
+	{regexp.MustCompile(`\.nsone\.net\.$`), "ns1"},
+	{regexp.MustCompile(`\.ovh\.net\.$`), "ovh"},
+	{regexp.MustCompile(`\.awsdns-\d+\.(com|net|org|co\.uk)\.$`), "route53"},
+	{regexp.MustCompile(`\.vultr\.com\.$`), "vultr"},
+}
+
+// DetectProvider returns the name of the lego DNS provider for the DNS host
+// serving domain, derived from the NS records of its zone. It fails if the
+// nameservers are unknown or belong to several DNS hosts.
+func DetectProvider(domain string) (string, error) {
+	nameservers, err := lookupNameservers(ToFqdn(domain))
+	if err != nil {
+		return "", err
+	}
+
+	var providers []string
+	seen := map[string]bool{}
+	for _, ns := range nameservers {
+		provider := nameserverProvider(ns)
+		if provider != "" && !seen[provider] {
+			seen[provider] = true
+			providers = append(providers, provider)
+		}
+	}
+
+	switch len(providers) {
+	case 0:
+		return "", fmt.Errorf("No known DNS provider for the nameservers of %s: %s", domain, strings.Join(nameservers, ", "))
+	case 1:
+		return providers[0], nil
+	}
+	return "", fmt.Errorf("The nameservers of %s belong to several DNS providers: %s", domain, strings.Join(providers, ", "))
+}
+
+// nameserverProvider returns the provider of nameserver ns, or "" if it is
+// unknown.
+func nameserverProvider(ns string) string {
+	ns = ToFqdn(strings.ToLower(ns))
+	for _, known := range knownNameservers {
+		if known.pattern.MatchString(ns) {
+			return known.provider
+		}
+	}
+	return ""
+}
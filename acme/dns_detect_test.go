@@ -0,0 +1,77 @@
+package acme
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestNameserverProvider(t *testing.T) {
+	for ns, expected := range map[string]string{
+		"kate.ns.cloudflare.com":        "cloudflare",
+		"NS-1234.AWSDNS-12.CO.UK.":      "route53",
+		"ns-cloud-b2.googledomains.com": "gcloud",
+		"ns1.he.net.":                   "hedns",
+		"ns1.example.com.":              "",
+		"ns.cloudflare.com.evil.net.":   "",
+	} {
+		if provider := nameserverProvider(ns); provider != expected {
+			t.Errorf("Expected %s to be served by %q, got %q", ns, expected, provider)
+		}
+	}
+}
+
+func TestDetectProvider(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		q := req.Question[0]
+		zone := q.Name[strings.Index(q.Name, ".")+1:]
+		if strings.Count(q.Name, ".") == 2 {
+			zone = q.Name
+		}
+		switch {
+		case q.Qtype == dns.TypeSOA && q.Name == zone:
+			resp.Answer = append(resp.Answer, &dns.SOA{
+				Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+				Ns:  "ns1." + zone, Mbox: "hostmaster." + zone, Serial: 1,
+			})
+		case q.Qtype == dns.TypeNS:
+			nameservers := map[string][]string{
+				"cloudflare.test.": {"kate.ns.cloudflare.com.", "walt.ns.cloudflare.com."},
+				"mixed.test.":      {"kate.ns.cloudflare.com.", "ns-1.awsdns-01.org."},
+				"unknown.test.":    {"ns1.unknown.test."},
+			}[zone]
+			for _, ns := range nameservers {
+				resp.Answer = append(resp.Answer, &dns.NS{
+					Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+					Ns:  ns,
+				})
+			}
+		}
+		w.WriteMsg(resp)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	defer func(nameservers []string) { RecursiveNameservers = nameservers }(RecursiveNameservers)
+	RecursiveNameservers = []string{pc.LocalAddr().String()}
+	ClearZoneCache()
+	defer ClearZoneCache()
+
+	if provider, err := DetectProvider("www.cloudflare.test"); err != nil || provider != "cloudflare" {
+		t.Errorf("Expected cloudflare, got %q (%v)", provider, err)
+	}
+	if _, err := DetectProvider("mixed.test"); err == nil || !strings.Contains(err.Error(), "cloudflare, route53") {
+		t.Errorf("Expected an error naming both providers, got %v", err)
+	}
+	if _, err := DetectProvider("unknown.test"); err == nil || !strings.Contains(err.Error(), "ns1.unknown.test.") {
+		t.Errorf("Expected an error naming the unknown nameserver, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSResolverMode selects how the DNS lookups of the DNS-01 challenge are
+// performed.
+type DNSResolverMode string
+
+const (
+	// DNSResolverRaw sends DNS queries straight to RecursiveNameservers and
+	// the authoritative nameservers of the zone, over UDP with a TCP fallback.
+	DNSResolverRaw DNSResolverMode = "raw"
+
+	// DNSResolverSystem uses the resolver of the operating system. This
+	// works where outgoing DNS traffic is blocked, but the authoritative
+	// nameservers cannot be asked directly: a record counts as propagated
+	// as soon as the system resolver returns it.
+	DNSResolverSystem DNSResolverMode = "system"
+
+	// DNSResolverDoH sends all DNS queries to a DNS-over-HTTPS resolver
+	// (RFC 8484) configured with SetDoHResolver. Just like with the system
+	// resolver, the authoritative nameservers are not asked directly.
+	DNSResolverDoH DNSResolverMode = "doh"
+
+	// DNSResolverDoT sends all DNS queries to a DNS-over-TLS resolver
+	// (RFC 7858) configured with SetDoTResolver. Just like with the system
+	// resolver, the authoritative nameservers are not asked directly.
+	DNSResolverDoT DNSResolverMode = "dot"
+)
+
+var (
+	dnsResolverMode = DNSResolverRaw
+	dohEndpoint     string
+	dotAddress      string
+	dotPin          string
+)
+
+// SetDNSResolverMode changes how DNS lookups are performed. The default is
+// DNSResolverRaw.
+func SetDNSResolverMode(mode DNSResolverMode) error {
+	switch mode {
+	case DNSResolverRaw, DNSResolverSystem:
+		dnsResolverMode = mode
+		return nil
+	case DNSResolverDoH:
+		if dohEndpoint == "" {
+			return fmt.Errorf("No DNS-over-HTTPS endpoint configured, use SetDoHResolver")
+		}
+		dnsResolverMode = mode
+		return nil
+	case DNSResolverDoT:
+		if dotAddress == "" {
+			return fmt.Errorf("No DNS-over-TLS resolver configured, use SetDoTResolver")
+		}
+		dnsResolverMode = mode
+		return nil
+	default:
+		return fmt.Errorf("Unknown DNS resolver mode: %s", mode)
+	}
+}
+
+// SetDoHResolver sends all DNS queries to the DNS-over-HTTPS resolver at
+// endpoint, e.g. https://cloudflare-dns.com/dns-query.
+func SetDoHResolver(endpoint string) error {
+	if !strings.HasPrefix(endpoint, "https://") && !strings.HasPrefix(endpoint, "http://") {
+		return fmt.Errorf("Invalid DNS-over-HTTPS endpoint: %s", endpoint)
+	}
+
+	dohEndpoint = endpoint
+	dnsResolverMode = DNSResolverDoH
+	return nil
+}
+
+// SetDoTResolver sends all DNS queries to the DNS-over-TLS resolver at addr,
+// e.g. 9.9.9.9:853. Port 853 is used if addr has none. If pin is empty the
+// certificate of the resolver is verified against the system roots. Otherwise
+// pin is the base64 encoded SHA-256 hash of the resolver's SubjectPublicKeyInfo
+// as described in RFC 7858, and the connection is only used if one of the
+// certificates presented by the resolver matches it.
+func SetDoTResolver(addr, pin string) error {
+	// A bare IPv6 address would be split at its last colon.
+	if net.ParseIP(addr) != nil {
+		addr = net.JoinHostPort(addr, "853")
+	} else if _, _, err := net.SplitHostPort(addr); err != nil {
+		if !strings.Contains(err.Error(), "missing port") {
+			return fmt.Errorf("Invalid DNS-over-TLS resolver %s: %v", addr, err)
+		}
+		addr = net.JoinHostPort(addr, "853")
+	}
+
+	if pin != "" {
+		if raw, err := base64.StdEncoding.DecodeString(pin); err != nil || len(raw) != sha256.Size {
+			return fmt.Errorf("Invalid DNS-over-TLS pin %q: expected a base64 encoded SHA-256 hash", pin)
+		}
+	}
+
+	dotAddress = addr
+	dotPin = pin
+	dnsResolverMode = DNSResolverDoT
+	return nil
+}
+
+// exchangeDoT sends m to the DNS-over-TLS resolver over a new TLS connection.
+func exchangeDoT(m *dns.Msg) (*dns.Msg, error) {
+	host, _, err := net.SplitHostPort(dotAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	// With a pin the certificate is checked against it below instead.
+	config := &tls.Config{ServerName: host, InsecureSkipVerify: dotPin != ""}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: DNSTimeout}, "tcp", dotAddress, config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if dotPin != "" && !matchesSPKIPin(conn.ConnectionState().PeerCertificates, dotPin) {
+		return nil, fmt.Errorf("DNS-over-TLS resolver %s does not match the configured pin", dotAddress)
+	}
+
+	conn.SetDeadline(time.Now().Add(DNSTimeout))
+	co := &dns.Conn{Conn: conn}
+	if err := co.WriteMsg(m); err != nil {
+		return nil, err
+	}
+	return co.ReadMsg()
+}
+
+// matchesSPKIPin reports whether one of certs has the base64 encoded SHA-256
+// hash of its SubjectPublicKeyInfo equal to pin.
+func matchesSPKIPin(certs []*x509.Certificate, pin string) bool {
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if base64.StdEncoding.EncodeToString(sum[:]) == pin {
+			return true
+		}
+	}
+	return false
+}
+
+// exchangeDoH sends m to the DNS-over-HTTPS endpoint in wire format.
+func exchangeDoH(m *dns.Msg) (*dns.Msg, error) {
+	// RFC 8484 recommends an ID of 0 to make responses cacheable.
+	m.Id = 0
+	packed, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", dohEndpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	req.Header.Set("User-Agent", userAgent())
+
+	client := http.Client{Transport: HTTPClient.Transport, Timeout: DNSTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS resolver %s returned HTTP %d", dohEndpoint, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(limitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(dns.Msg)
+	if err := r.Unpack(body); err != nil {
+		return nil, fmt.Errorf("Invalid DNS-over-HTTPS response from %s: %v", dohEndpoint, err)
+	}
+	return r, nil
+}
+
+// checkRecursivePropagation checks if the configured recursive resolver
+// returns the expected TXT record. It is used when the authoritative
+// nameservers cannot be queried directly.
+func checkRecursivePropagation(fqdn, value string) (bool, error) {
+	r, err := dnsQuery(fqdn, dns.TypeTXT, RecursiveNameservers, true)
+	if err != nil {
+		return false, err
+	}
+
+	if r.Rcode != dns.RcodeSuccess {
+		return false, fmt.Errorf("Resolver returned %s for %s", dns.RcodeToString[r.Rcode], fqdn)
+	}
+
+	for _, rr := range r.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && strings.Join(txt.Txt, "") == value {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("Resolver did not return the expected TXT record for %s", fqdn)
+}
+
+// checkSystemPropagation checks if the system resolver returns the expected TXT record.
+func checkSystemPropagation(fqdn, value string) (bool, error) {
+	txts, err := net.LookupTXT(fqdn)
+	if err != nil {
+		return false, err
+	}
+
+	for _, txt := range txts {
+		if txt == value {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("The system resolver did not return the expected TXT record for %s", fqdn)
+}
+
+// findZoneBySystem determines the zone apex for the given fqdn by recursing
+// up the domain labels until the system resolver returns NS records for one.
+func findZoneBySystem(fqdn string) (string, error) {
+	for _, index := range dns.Split(fqdn) {
+		domain := fqdn[index:]
+		// Give up if we have reached the TLD
+		if isTLD(domain) {
+			break
+		}
+
+		nss, err := net.LookupNS(domain)
+		if err != nil {
+			if dnsErr, ok := err.(*net.DNSError); ok && !dnsErr.Temporary() {
+				continue
+			}
+			return "", err
+		}
+		if len(nss) > 0 {
+			return strings.ToLower(ToFqdn(domain)), nil
+		}
+	}
+
+	return "", fmt.Errorf("Could not find the zone of %s", fqdn)
+}
@@ -0,0 +1,267 @@
+package acme
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSetDNSResolverMode(t *testing.T) {
+	defer func() { dnsResolverMode = DNSResolverRaw }()
+
+	if err := SetDNSResolverMode(DNSResolverSystem); err != nil {
+		t.Fatalf("Expected the system mode to be accepted, got %v", err)
+	}
+	if dnsResolverMode != DNSResolverSystem {
+		t.Errorf("Expected mode %s, got %s", DNSResolverSystem, dnsResolverMode)
+	}
+
+	if err := SetDNSResolverMode("carrier-pigeon"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+	if dnsResolverMode != DNSResolverSystem {
+		t.Errorf("Expected an unknown mode to leave %s in place, got %s", DNSResolverSystem, dnsResolverMode)
+	}
+}
+
+func TestFindZoneBySystem(t *testing.T) {
+	if _, err := findZoneBySystem("com."); err == nil {
+		t.Error("Expected no zone to be found below a TLD")
+	}
+}
+
+func TestDoHResolver(t *testing.T) {
+	defer func() {
+		dnsResolverMode = DNSResolverRaw
+		dohEndpoint = ""
+	}()
+
+	var contentType string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ := ioutil.ReadAll(r.Body)
+
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.Answer = append(resp.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120},
+			Txt: []string{"fe01="},
+		})
+		packed, _ := resp.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	}))
+	defer ts.Close()
+
+	if err := SetDoHResolver("dns.example.com"); err == nil {
+		t.Error("Expected an error for an endpoint without scheme")
+	}
+	if err := SetDoHResolver(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := checkDNSPropagation("_acme-challenge.example.com.", "fe01=")
+	if err != nil || !ok {
+		t.Errorf("Expected the record to be found through DoH, got %v", err)
+	}
+	if contentType != "application/dns-message" {
+		t.Errorf("Expected a application/dns-message request, got %q", contentType)
+	}
+
+	if ok, _ := checkDNSPropagation("_acme-challenge.example.com.", "other"); ok {
+		t.Error("Expected a different TXT value not to match")
+	}
+}
+
+func TestDoTResolver(t *testing.T) {
+	defer func() {
+		dnsResolverMode = DNSResolverRaw
+		dotAddress, dotPin = "", ""
+	}()
+
+	// Borrow the certificate of a TLS test server for the DoT listener.
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: ts.TLS.Certificates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			co := &dns.Conn{Conn: conn}
+			if req, err := co.ReadMsg(); err == nil {
+				resp := new(dns.Msg)
+				resp.SetReply(req)
+				resp.Answer = append(resp.Answer, &dns.TXT{
+					Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120},
+					Txt: []string{"fe01="},
+				})
+				co.WriteMsg(resp)
+			}
+			co.Close()
+		}
+	}()
+
+	leaf, err := x509.ParseCertificate(ts.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+
+	if err := SetDoTResolver(ln.Addr().String(), "not-a-pin"); err == nil {
+		t.Error("Expected an error for an invalid pin")
+	}
+
+	if err := SetDoTResolver(ln.Addr().String(), pin); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := checkDNSPropagation("_acme-challenge.example.com.", "fe01=")
+	if err != nil || !ok {
+		t.Errorf("Expected the record to be found through DoT, got %v", err)
+	}
+
+	otherSum := sha256.Sum256([]byte("other key"))
+	if err := SetDoTResolver(ln.Addr().String(), base64.StdEncoding.EncodeToString(otherSum[:])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkDNSPropagation("_acme-challenge.example.com.", "fe01="); err == nil {
+		t.Error("Expected the connection to be refused for a pin mismatch")
+	}
+
+	// Without a pin the self-signed certificate is not trusted.
+	if err := SetDoTResolver(ln.Addr().String(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkDNSPropagation("_acme-challenge.example.com.", "fe01="); err == nil {
+		t.Error("Expected certificate verification to fail without a pin")
+	}
+}
+
+func TestSetDoTResolverAddress(t *testing.T) {
+	defer func() {
+		dnsResolverMode = DNSResolverRaw
+		dotAddress, dotPin = "", ""
+	}()
+
+	for addr, expected := range map[string]string{
+		"192.0.2.1":          "192.0.2.1:853",
+		"192.0.2.1:8853":     "192.0.2.1:8853",
+		"dns.example.com":    "dns.example.com:853",
+		"2001:db8::1":        "[2001:db8::1]:853",
+		"[2001:db8::1]:8853": "[2001:db8::1]:8853",
+	} {
+		if err := SetDoTResolver(addr, ""); err != nil {
+			t.Errorf("Expected %s to be accepted, got %v", addr, err)
+		} else if dotAddress != expected {
+			t.Errorf("Expected %s to be used for %s, got %s", expected, addr, dotAddress)
+		}
+	}
+}
+
+func TestCheckNameserversDoH(t *testing.T) {
+	defer func(addr func(string) string) {
+		dnsResolverMode = DNSResolverRaw
+		dohEndpoint = ""
+		nameserverAddr = addr
+		ClearZoneCache()
+	}(nameserverAddr)
+	ClearZoneCache()
+
+	soa := func(req *dns.Msg) *dns.Msg {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		switch req.Question[0].Qtype {
+		case dns.TypeSOA:
+			resp.Answer = append(resp.Answer, &dns.SOA{
+				Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+				Ns:  "ns1.example.com.", Mbox: "hostmaster.example.com.", Serial: 1,
+			})
+		case dns.TypeNS:
+			resp.Answer = append(resp.Answer, &dns.NS{
+				Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+				Ns:  "ns1.example.com.",
+			})
+		}
+		return resp
+	}
+
+	// The DoH resolver answers recursively, never authoritatively.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		packed, _ := soa(req).Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	}))
+	defer ts.Close()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu    sync.Mutex
+		asked []string
+	)
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		mu.Lock()
+		asked = append(asked, req.Question[0].Name)
+		mu.Unlock()
+		resp := soa(req)
+		resp.Authoritative = true
+		w.WriteMsg(resp)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	nameserverAddr = func(ns string) string {
+		if ns != "ns1.example.com." {
+			t.Errorf("Unexpected nameserver %s", ns)
+		}
+		return pc.LocalAddr().String()
+	}
+
+	if err := SetDoHResolver(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	nameservers, err := CheckNameservers("www.example.com")
+	if err != nil {
+		t.Fatalf("Expected the nameservers to pass the check, got %v", err)
+	}
+	if !reflect.DeepEqual(nameservers, []string{"ns1.example.com."}) {
+		t.Errorf("Expected ns1.example.com., got %v", nameservers)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(asked, []string{"example.com."}) {
+		t.Errorf("Expected the nameserver to be asked for the SOA of example.com. directly, got %v", asked)
+	}
+}
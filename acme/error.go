@@ -12,22 +12,39 @@ const (
 	tosAgreementError = "Must agree to subscriber agreement before any further actions"
 )
 
-// RemoteError is the base type for all errors specific to the ACME protocol.
-type RemoteError struct {
-	StatusCode int    `json:"status,omitempty"`
-	Type       string `json:"type"`
-	Detail     string `json:"detail"`
+// ProblemDetails is the base type for all errors specific to the ACME
+// protocol. It holds the problem document returned by the server; the
+// subproblems, if any, describe the errors for individual identifiers.
+//
+// Errors returned by the client for ACME API responses are ProblemDetails or
+// wrap one (TOSError, RateLimitError, challenge errors); use a type assertion, or errors.As
+// on Go 1.13+, to inspect the problem type. ProblemDetails replaces
+// RemoteError, which remains as an alias on Go 1.9+.
+type ProblemDetails struct {
+	Type        string           `json:"type"`
+	Detail      string           `json:"detail"`
+	Status      int              `json:"status,omitempty"`
+	Subproblems []ProblemDetails `json:"subproblems,omitempty"`
 }
 
-func (e RemoteError) Error() string {
-	return fmt.Sprintf("acme: Error %d - %s - %s", e.StatusCode, e.Type, e.Detail)
+func (p ProblemDetails) Error() string {
+	msg := fmt.Sprintf("acme: Error %d - %s - %s", p.Status, p.Type, p.Detail)
+	for _, sub := range p.Subproblems {
+		msg += fmt.Sprintf("\n\t%s - %s", sub.Type, sub.Detail)
+	}
+	return msg
 }
 
 // TOSError represents the error which is returned if the user needs to
 // accept the TOS.
 // TODO: include the new TOS url if we can somehow obtain it.
 type TOSError struct {
-	RemoteError
+	ProblemDetails
+}
+
+// Unwrap returns the problem document of the error.
+func (e TOSError) Unwrap() error {
+	return e.ProblemDetails
 }
 
 type domainError struct {
@@ -36,7 +53,7 @@ type domainError struct {
 }
 
 type challengeError struct {
-	RemoteError
+	ProblemDetails
 	records []validationRecord
 }
 
@@ -48,11 +65,15 @@ func (c challengeError) Error() string {
 			validation.Hostname, validation.Port, strings.Join(validation.ResolvedAddresses, "\n\t\t"), validation.UsedAddress)
 	}
 
-	return fmt.Sprintf("%s\nError Detail:\n%s", c.RemoteError.Error(), errStr)
+	return fmt.Sprintf("%s\nError Detail:\n%s", c.ProblemDetails.Error(), errStr)
+}
+
+func (c challengeError) Unwrap() error {
+	return c.ProblemDetails
 }
 
 func handleHTTPError(resp *http.Response) error {
-	var errorDetail RemoteError
+	var errorDetail ProblemDetails
 
 	contenType := resp.Header.Get("Content-Type")
 	// try to decode the content as JSON
@@ -71,12 +92,15 @@ func handleHTTPError(resp *http.Response) error {
 		errorDetail.Detail = string(detailBytes)
 	}
 
-	errorDetail.StatusCode = resp.StatusCode
+	errorDetail.Status = resp.StatusCode
 
 	// Check for errors we handle specifically
-	if errorDetail.StatusCode == http.StatusForbidden && errorDetail.Detail == tosAgreementError {
+	if errorDetail.Status == http.StatusForbidden && errorDetail.Detail == tosAgreementError {
 		return TOSError{errorDetail}
 	}
+	if errorDetail.Status == http.StatusTooManyRequests {
+		return RateLimitError{ProblemDetails: errorDetail, RetryAfter: retryAfter(resp.Header)}
+	}
 
 	return errorDetail
 }
@@ -0,0 +1,11 @@
+//go:build go1.9
+// +build go1.9
+
+package acme
+
+// RemoteError is the former name of ProblemDetails, kept so type assertions
+// on it keep working. Its StatusCode field is now called Status. Go before
+// 1.9 has no type aliases, so there callers have to use ProblemDetails.
+//
+// Deprecated: use ProblemDetails instead.
+type RemoteError = ProblemDetails
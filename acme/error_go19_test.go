@@ -0,0 +1,25 @@
+//go:build go1.9
+// +build go1.9
+
+package acme
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleHTTPErrorRemoteError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"type": "urn:acme:error:malformed", "detail": "Registration key is already in use"}`))
+	}))
+	defer ts.Close()
+
+	_, err := getJSON(&HTTPClient, ts.URL, nil)
+	remoteErr, ok := err.(RemoteError)
+	if !ok || remoteErr.Status != http.StatusConflict {
+		t.Fatalf("Expected a RemoteError, got %T: %v", err, err)
+	}
+}
@@ -0,0 +1,75 @@
+package acme
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleHTTPErrorProblemDetails(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{
+			"type": "urn:acme:error:malformed",
+			"detail": "Some of the identifiers requested were rejected",
+			"status": 400,
+			"subproblems": [
+				{"type": "urn:acme:error:rejectedIdentifier", "detail": "This CA will not issue for \"example.net\""},
+				{"type": "urn:acme:error:malformed", "detail": "Invalid underscore in DNS name \"_example.org\""}
+			]
+		}`))
+	}))
+	defer ts.Close()
+
+	_, err := getJSON(&HTTPClient, ts.URL, nil)
+	problem, ok := err.(ProblemDetails)
+	if !ok {
+		t.Fatalf("Expected a ProblemDetails error, got %T: %v", err, err)
+	}
+
+	if problem.Type != "urn:acme:error:malformed" || problem.Status != http.StatusBadRequest {
+		t.Errorf("Unexpected problem %+v", problem)
+	}
+	if len(problem.Subproblems) != 2 || problem.Subproblems[0].Type != "urn:acme:error:rejectedIdentifier" {
+		t.Errorf("Unexpected subproblems %+v", problem.Subproblems)
+	}
+}
+
+func TestHandleHTTPErrorTOS(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"type": "urn:acme:error:unauthorized", "detail": "` + tosAgreementError + `"}`))
+	}))
+	defer ts.Close()
+
+	_, err := getJSON(&HTTPClient, ts.URL, nil)
+	tosErr, ok := err.(TOSError)
+	if !ok {
+		t.Fatalf("Expected a TOSError, got %T: %v", err, err)
+	}
+	if problem, ok := tosErr.Unwrap().(ProblemDetails); !ok || problem.Status != http.StatusForbidden {
+		t.Errorf("Expected the TOSError to wrap the problem document, got %+v", tosErr.Unwrap())
+	}
+}
+
+func TestHandleHTTPErrorRateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"type": "urn:acme:error:rateLimited", "detail": "Error creating new cert :: too many certificates already issued for: example.com"}`))
+	}))
+	defer ts.Close()
+
+	_, err := getJSON(&HTTPClient, ts.URL, nil)
+	limitErr, ok := err.(RateLimitError)
+	if !ok {
+		t.Fatalf("Expected a RateLimitError, got %T: %v", err, err)
+	}
+	if limitErr.RetryAfter != 2*time.Minute || limitErr.Type != "urn:acme:error:rateLimited" {
+		t.Errorf("Unexpected rate limit error %+v", limitErr)
+	}
+}
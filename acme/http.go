@@ -1,10 +1,15 @@
 package acme
 
 import (
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"runtime"
 	"strings"
@@ -26,9 +31,62 @@ const (
 	ourUserAgent = "xenolf-acme"
 )
 
+// SetCABundle configures HTTPClient to verify the TLS certificate of the ACME
+// server against the PEM encoded certificates in the file at pemPath instead of
+// the system roots. Use this for private ACME CAs with custom root certificates.
+func SetCABundle(pemPath string) error {
+	pemBytes, err := ioutil.ReadFile(pemPath)
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return fmt.Errorf("No certificates found in CA bundle %s", pemPath)
+	}
+
+	SetServerCertificates(pool)
+	return nil
+}
+
+// SetServerCertificates configures HTTPClient to verify the TLS certificate of
+// the ACME server against the certificates in pool instead of the system roots.
+func SetServerCertificates(pool *x509.CertPool) {
+	transportTLSConfig().RootCAs = pool
+}
+
+// SetInsecureSkipVerify disables the verification of the TLS certificate of the
+// ACME server. This is meant for testing against local CAs only and makes every
+// request vulnerable to man-in-the-middle attacks.
+//
+// Deprecated: configure the root certificates of the CA with SetServerCertificates
+// or SetCABundle instead.
+func SetInsecureSkipVerify(skip bool) {
+	if skip {
+		logf("[WARNING] acme: TLS certificate verification of the ACME server is DISABLED. Never use this outside of testing!")
+	}
+	transportTLSConfig().InsecureSkipVerify = skip
+}
+
+// transportTLSConfig returns the TLS configuration used by HTTPClient. A
+// transport of our own, with the timeouts of http.DefaultTransport, is
+// installed first so http.DefaultTransport, which is shared with the rest of
+// the program, is never modified.
+func transportTLSConfig() *tls.Config {
+	transport, ok := HTTPClient.Transport.(*http.Transport)
+	if !ok || transport == http.DefaultTransport {
+		transport = newDefaultTransport()
+		HTTPClient.Transport = transport
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	return transport.TLSClientConfig
+}
+
 // httpHead performs a HEAD request with a proper User-Agent string.
 // The response body (resp.Body) is already closed when this function returns.
-func httpHead(url string) (resp *http.Response, err error) {
+func httpHead(client *http.Client, url string) (resp *http.Response, err error) {
 	req, err := http.NewRequest("HEAD", url, nil)
 	if err != nil {
 		return nil, err
@@ -36,7 +94,7 @@ func httpHead(url string) (resp *http.Response, err error) {
 
 	req.Header.Set("User-Agent", userAgent())
 
-	resp, err = HTTPClient.Do(req)
+	resp, err = doRequest(client, req)
 	if err != nil {
 		return resp, err
 	}
@@ -46,7 +104,7 @@ func httpHead(url string) (resp *http.Response, err error) {
 
 // httpPost performs a POST request with a proper User-Agent string.
 // Callers should close resp.Body when done reading from it.
-func httpPost(url string, bodyType string, body io.Reader) (resp *http.Response, err error) {
+func httpPost(client *http.Client, url string, bodyType string, body io.Reader) (resp *http.Response, err error) {
 	req, err := http.NewRequest("POST", url, body)
 	if err != nil {
 		return nil, err
@@ -54,25 +112,69 @@ func httpPost(url string, bodyType string, body io.Reader) (resp *http.Response,
 	req.Header.Set("Content-Type", bodyType)
 	req.Header.Set("User-Agent", userAgent())
 
-	return HTTPClient.Do(req)
+	return doRequest(client, req)
 }
 
 // httpGet performs a GET request with a proper User-Agent string.
 // Callers should close resp.Body when done reading from it.
-func httpGet(url string) (resp *http.Response, err error) {
+func httpGet(client *http.Client, url string) (resp *http.Response, err error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("User-Agent", userAgent())
 
-	return HTTPClient.Do(req)
+	return doRequest(client, req)
+}
+
+// doRequest sends req asking for a compressed response and decompresses the
+// body. Setting Accept-Encoding ourselves turns off the transparent gzip
+// support of http.Transport, so this also covers custom transports.
+func doRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+
+	resp, err := client.Do(req)
+	if err != nil || req.Method == "HEAD" {
+		return resp, err
+	}
+
+	var body io.Reader
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip":
+		body, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		body, err = zlib.NewReader(resp.Body)
+	default:
+		return resp, nil
+	}
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to decompress the response of %q: %v", req.URL, err)
+	}
+
+	resp.Body = decompressedBody{body, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// decompressedBody reads the decompressed response and closes the original
+// body.
+type decompressedBody struct {
+	io.Reader
+	body io.Closer
+}
+
+func (d decompressedBody) Close() error {
+	return d.body.Close()
 }
 
 // getJSON performs an HTTP GET request and parses the response body
 // as JSON, into the provided respBody object.
-func getJSON(uri string, respBody interface{}) (http.Header, error) {
-	resp, err := httpGet(uri)
+func getJSON(client *http.Client, uri string, respBody interface{}) (http.Header, error) {
+	resp, err := httpGet(client, uri)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get %q: %v", uri, err)
 	}
@@ -14,7 +14,7 @@ func TestHTTPChallenge(t *testing.T) {
 	clientChallenge := challenge{Type: HTTP01, Token: "http1"}
 	mockValidate := func(_ *jws, _, _ string, chlng challenge) error {
 		uri := "http://localhost:23457/.well-known/acme-challenge/" + chlng.Token
-		resp, err := httpGet(uri)
+		resp, err := httpGet(&HTTPClient, uri)
 		if err != nil {
 			return err
 		}
@@ -1,8 +1,15 @@
 package acme
 
 import (
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 )
@@ -15,7 +22,7 @@ func TestHTTPHeadUserAgent(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	_, err := httpHead(ts.URL)
+	_, err := httpHead(&HTTPClient, ts.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -36,7 +43,7 @@ func TestHTTPGetUserAgent(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	res, err := httpGet(ts.URL)
+	res, err := httpGet(&HTTPClient, ts.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -58,7 +65,7 @@ func TestHTTPPostUserAgent(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	res, err := httpPost(ts.URL, "text/plain", strings.NewReader("falalalala"))
+	res, err := httpPost(&HTTPClient, ts.URL, "text/plain", strings.NewReader("falalalala"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -72,6 +79,67 @@ func TestHTTPPostUserAgent(t *testing.T) {
 	}
 }
 
+func TestSetCABundle(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	defer func(transport http.RoundTripper) { HTTPClient.Transport = transport }(HTTPClient.Transport)
+
+	bundle, err := ioutil.TempFile("", "lego-ca-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(bundle.Name())
+
+	pem.Encode(bundle, &pem.Block{Type: "CERTIFICATE", Bytes: ts.TLS.Certificates[0].Certificate[0]})
+	bundle.Close()
+
+	if _, err := httpGet(&HTTPClient, ts.URL); err == nil {
+		t.Fatal("Expected request to fail without the CA bundle")
+	}
+
+	if err := SetCABundle(bundle.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := httpGet(&HTTPClient, ts.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed with the CA bundle, got %v", err)
+	}
+	res.Body.Close()
+
+	if err := SetCABundle(os.DevNull); err == nil {
+		t.Error("Expected an error for an empty CA bundle")
+	}
+}
+
+func TestSetInsecureSkipVerify(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	defer func(transport http.RoundTripper) { HTTPClient.Transport = transport }(HTTPClient.Transport)
+
+	SetServerCertificates(x509.NewCertPool())
+	if _, err := httpGet(&HTTPClient, ts.URL); err == nil {
+		t.Fatal("Expected request to fail with an empty certificate pool")
+	}
+
+	SetInsecureSkipVerify(true)
+	res, err := httpGet(&HTTPClient, ts.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed without verification, got %v", err)
+	}
+	res.Body.Close()
+
+	if cfg := http.DefaultTransport.(*http.Transport).TLSClientConfig; cfg != nil && cfg.InsecureSkipVerify {
+		t.Error("Expected http.DefaultTransport to be left untouched")
+	}
+
+	if transport := HTTPClient.Transport.(*http.Transport); transport.TLSHandshakeTimeout == 0 || transport.ExpectContinueTimeout == 0 {
+		t.Error("Expected the transport to keep the timeouts of http.DefaultTransport")
+	}
+}
+
 func TestUserAgent(t *testing.T) {
 	ua := userAgent()
 
@@ -98,3 +166,80 @@ func TestUserAgent(t *testing.T) {
 		t.Errorf("Expected custom UA to contain %s, got '%s'", UserAgent, ua)
 	}
 }
+
+func TestPostJSONRetriesBadNonce(t *testing.T) {
+	var posts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "nonce")
+		if r.Method != "POST" {
+			return
+		}
+		posts++
+		if posts <= 2 || r.URL.Path == "/always-bad" {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"type": "urn:acme:error:badNonce", "detail": "JWS has invalid anti-replay nonce"}`))
+			return
+		}
+		w.Write([]byte(`{"status": "valid"}`))
+	}))
+	defer ts.Close()
+
+	key, err := generatePrivateKey(EC256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := &jws{directoryURL: ts.URL, privKey: key}
+
+	var chlng challenge
+	if _, err := postJSON(j, ts.URL, struct{}{}, &chlng); err != nil {
+		t.Fatalf("Expected the request to succeed after two badNonce errors, got %v", err)
+	}
+	if posts != 3 || chlng.Status != "valid" {
+		t.Errorf("Expected 3 posts and a valid response, got %d posts and %+v", posts, chlng)
+	}
+
+	posts = 0
+	_, err = postJSON(j, ts.URL+"/always-bad", struct{}{}, nil)
+	if problem, ok := err.(ProblemDetails); !ok || problem.Type != "urn:acme:error:badNonce" {
+		t.Errorf("Expected the badNonce problem after giving up, got %v", err)
+	}
+	if posts != maxBadNonceRetries+1 {
+		t.Errorf("Expected %d posts, got %d", maxBadNonceRetries+1, posts)
+	}
+}
+
+func TestGetJSONDecompresses(t *testing.T) {
+	for _, encoding := range []string{"gzip", "deflate", ""} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				t.Errorf("Expected the request to accept gzip, got %q", r.Header.Get("Accept-Encoding"))
+			}
+
+			var out io.WriteCloser
+			switch encoding {
+			case "gzip":
+				out = gzip.NewWriter(w)
+			case "deflate":
+				out = zlib.NewWriter(w)
+			default:
+				w.Write([]byte(`{"new-reg": "https://example.com/reg"}`))
+				return
+			}
+			w.Header().Set("Content-Encoding", encoding)
+			out.Write([]byte(`{"new-reg": "https://example.com/reg"}`))
+			out.Close()
+		}))
+
+		var dir directory
+		_, err := getJSON(&HTTPClient, ts.URL, &dir)
+		ts.Close()
+		if err != nil {
+			t.Errorf("Content-Encoding %q: %v", encoding, err)
+			continue
+		}
+		if dir.NewRegURL != "https://example.com/reg" {
+			t.Errorf("Content-Encoding %q: unexpected directory %+v", encoding, dir)
+		}
+	}
+}
@@ -5,9 +5,18 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"net/http"
+	"strings"
 	"sync"
 
 	"gopkg.in/square/go-jose.v1"
@@ -16,10 +25,20 @@ import (
 type jws struct {
 	directoryURL string
 	privKey      crypto.PrivateKey
+	client       *http.Client
 	nonces       []string
 	sync.Mutex
 }
 
+// httpClient returns the HTTP client used to talk to the CA, which defaults
+// to the package level HTTPClient.
+func (j *jws) httpClient() *http.Client {
+	if j.client == nil {
+		return &HTTPClient
+	}
+	return j.client
+}
+
 func keyAsJWK(key interface{}) *jose.JsonWebKey {
 	switch k := key.(type) {
 	case *ecdsa.PublicKey:
@@ -32,24 +51,59 @@ func keyAsJWK(key interface{}) *jose.JsonWebKey {
 	}
 }
 
-// Posts a JWS signed message to the specified URL
+// maxBadNonceRetries is how often a request rejected with badNonce is signed
+// again with a fresh nonce before the error is passed to the caller.
+const maxBadNonceRetries = 3
+
+// Posts a JWS signed message to the specified URL. Requests the server
+// rejects because of a bad nonce are retried with a fresh one.
 func (j *jws) post(url string, content []byte) (*http.Response, error) {
-	signedContent, err := j.signContent(content)
-	if err != nil {
-		return nil, err
+	for retries := 0; ; retries++ {
+		signedContent, err := j.signContent(content)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := httpPost(j.httpClient(), url, "application/jose+json", bytes.NewBuffer([]byte(signedContent)))
+		if err != nil {
+			return nil, err
+		}
+
+		// The error response carries a fresh nonce, which the next try uses.
+		j.getNonceFromResponse(resp)
+
+		if retries == maxBadNonceRetries || !isBadNonce(resp) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		logf("[INFO] acme: Server rejected the nonce of the request to %s, retrying", url)
 	}
+}
 
-	resp, err := httpPost(url, "application/jose+json", bytes.NewBuffer([]byte(signedContent.FullSerialize())))
-	if err != nil {
-		return nil, err
+// isBadNonce reports whether resp is a badNonce problem. The body is read
+// and replaced, so the response can still be handled as usual.
+func isBadNonce(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusBadRequest {
+		return false
 	}
 
-	j.getNonceFromResponse(resp)
+	body, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
 
-	return resp, err
+	var problem ProblemDetails
+	if json.Unmarshal(body, &problem) != nil {
+		return false
+	}
+	// urn:acme:error:badNonce in ACME v1, urn:ietf:params:acme:error:badNonce in RFC 8555
+	return strings.HasSuffix(problem.Type, ":error:badNonce")
 }
 
-func (j *jws) signContent(content []byte) (*jose.JsonWebSignature, error) {
+// signContent returns the JWS of content in full serialization.
+func (j *jws) signContent(content []byte) (string, error) {
 
 	var alg jose.SignatureAlgorithm
 	switch k := j.privKey.(type) {
@@ -61,19 +115,107 @@ func (j *jws) signContent(content []byte) (*jose.JsonWebSignature, error) {
 		} else if k.Curve == elliptic.P384() {
 			alg = jose.ES384
 		}
+	case crypto.Signer:
+		return j.signOpaque(k, content)
 	}
 
 	signer, err := jose.NewSigner(alg, j.privKey)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	signer.SetNonceSource(j)
 
 	signed, err := signer.Sign(content)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	return signed.FullSerialize(), nil
+}
+
+// signOpaque signs content with a key that is only reachable through
+// crypto.Signer, like a key kept on a hardware token. go-jose needs the key
+// material itself, so the JWS is assembled here.
+func (j *jws) signOpaque(signer crypto.Signer, content []byte) (string, error) {
+	var alg string
+	var size int
+	var hash crypto.Hash
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		alg, hash = "RS256", crypto.SHA256
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			alg, hash = "ES256", crypto.SHA256
+		case elliptic.P384():
+			alg, hash = "ES384", crypto.SHA384
+		default:
+			return "", fmt.Errorf("Unsupported curve %s", pub.Curve.Params().Name)
+		}
+		size = (pub.Curve.Params().BitSize + 7) / 8
+	default:
+		return "", fmt.Errorf("Unsupported key type %T", pub)
+	}
+
+	jwk, err := keyAsJWK(signer.Public()).MarshalJSON()
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := j.Nonce()
+	if err != nil {
+		return "", err
+	}
+
+	protected, err := json.Marshal(struct {
+		Alg   string          `json:"alg"`
+		JWK   json.RawMessage `json:"jwk"`
+		Nonce string          `json:"nonce"`
+	}{alg, jwk, nonce})
+	if err != nil {
+		return "", err
 	}
-	return signed, nil
+
+	input := base64.RawURLEncoding.EncodeToString(protected) + "." + base64.RawURLEncoding.EncodeToString(content)
+
+	var digest []byte
+	if hash == crypto.SHA384 {
+		sum := sha512.Sum384([]byte(input))
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(input))
+		digest = sum[:]
+	}
+
+	sig, err := signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return "", err
+	}
+
+	// crypto.Signer returns ASN.1 encoded ECDSA signatures, JWS wants R || S.
+	if size > 0 {
+		var esig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &esig); err != nil {
+			return "", err
+		}
+		sig = make([]byte, 2*size)
+		rBytes, sBytes := esig.R.Bytes(), esig.S.Bytes()
+		copy(sig[size-len(rBytes):size], rBytes)
+		copy(sig[2*size-len(sBytes):], sBytes)
+	}
+
+	serialized, err := json.Marshal(struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+		Signature string `json:"signature"`
+	}{
+		Protected: base64.RawURLEncoding.EncodeToString(protected),
+		Payload:   base64.RawURLEncoding.EncodeToString(content),
+		Signature: base64.RawURLEncoding.EncodeToString(sig),
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(serialized), nil
 }
 
 func (j *jws) getNonceFromResponse(resp *http.Response) error {
@@ -89,7 +231,7 @@ func (j *jws) getNonceFromResponse(resp *http.Response) error {
 }
 
 func (j *jws) getNonce() error {
-	resp, err := httpHead(j.directoryURL)
+	resp, err := httpHead(j.httpClient(), j.directoryURL)
 	if err != nil {
 		return err
 	}
@@ -98,18 +240,23 @@ func (j *jws) getNonce() error {
 }
 
 func (j *jws) Nonce() (string, error) {
-	nonce := ""
-	if len(j.nonces) == 0 {
+	j.Lock()
+	empty := len(j.nonces) == 0
+	j.Unlock()
+
+	if empty {
 		err := j.getNonce()
 		if err != nil {
-			return nonce, err
+			return "", err
 		}
 	}
+
+	j.Lock()
+	defer j.Unlock()
 	if len(j.nonces) == 0 {
 		return "", fmt.Errorf("Can't get nonce")
 	}
-	j.Lock()
-	defer j.Unlock()
-	nonce, j.nonces = j.nonces[len(j.nonces)-1], j.nonces[:len(j.nonces)-1]
+	nonce := j.nonces[len(j.nonces)-1]
+	j.nonces = j.nonces[:len(j.nonces)-1]
 	return nonce, nil
 }
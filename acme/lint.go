@@ -0,0 +1,55 @@
+package acme
+
+import (
+	"fmt"
+	"strings"
+)
+
+// certificateLinter checks the DER encoded leaf certificate of domain, logs
+// its findings and returns the names of the checks which found an error. It
+// is nil unless lego is built with the lego_zlint tag, which adds zlint.
+var certificateLinter func(domain string, der []byte) ([]string, error)
+
+// LintingSupported reports whether issued certificates are linted, which
+// needs a build with the lego_zlint tag.
+func LintingSupported() bool {
+	return certificateLinter != nil
+}
+
+// SetStrictLinting makes obtaining a certificate fail if zlint finds an
+// error in it, so a misissued certificate is not deployed. Without it the
+// findings are only logged. Strict linting fails every certificate if
+// LintingSupported is false.
+func (c *Client) SetStrictLinting(strict bool) {
+	c.strictLinting = strict
+}
+
+// lintCertificate checks the leaf of cert. It returns an error for the
+// errors found, or if the certificate could not be linted at all, only if
+// strict linting is enabled; otherwise they are logged.
+func (c *Client) lintCertificate(cert CertificateResource) error {
+	if certificateLinter == nil {
+		if c.strictLinting {
+			return fmt.Errorf("[%s] acme: Strict linting needs lego built with the lego_zlint tag", cert.Domain)
+		}
+		return nil
+	}
+
+	var failed []string
+	chain, err := parsePEMBundle(cert.Certificate)
+	if err == nil {
+		failed, err = certificateLinter(cert.Domain, chain[0].Raw)
+	}
+	if err != nil {
+		if c.strictLinting {
+			return err
+		}
+		logf("[WARNING][%s] acme: Could not lint the certificate: %v", cert.Domain, err)
+		return nil
+	}
+
+	if c.strictLinting && len(failed) > 0 {
+		return fmt.Errorf("[%s] acme: The certificate fails %d zlint checks: %s", cert.Domain, len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
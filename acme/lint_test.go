@@ -0,0 +1,36 @@
+package acme
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLintCertificateErrors(t *testing.T) {
+	defer func(linter func(string, []byte) ([]string, error)) { certificateLinter = linter }(certificateLinter)
+
+	cert := CertificateResource{Domain: "example.com", Certificate: []byte("no certificate")}
+	client := &Client{}
+
+	certificateLinter = nil
+	if err := client.lintCertificate(cert); err != nil {
+		t.Errorf("Expected no error without a linter, got %v", err)
+	}
+	client.SetStrictLinting(true)
+	if err := client.lintCertificate(cert); err == nil || !strings.Contains(err.Error(), "lego_zlint") {
+		t.Errorf("Expected strict linting to fail without a linter, got %v", err)
+	}
+
+	// A certificate which cannot be linted is only logged unless linting
+	// is strict.
+	certificateLinter = func(domain string, der []byte) ([]string, error) {
+		return nil, errors.New("unparsable")
+	}
+	if err := client.lintCertificate(cert); err == nil {
+		t.Error("Expected strict linting to fail for an unparsable certificate")
+	}
+	client.SetStrictLinting(false)
+	if err := client.lintCertificate(cert); err != nil {
+		t.Errorf("Expected the error to be logged only, got %v", err)
+	}
+}
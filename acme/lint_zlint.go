@@ -0,0 +1,80 @@
+//go:build lego_zlint
+// +build lego_zlint
+
+package acme
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	zx509 "github.com/zmap/zcrypto/x509"
+	"github.com/zmap/zlint/v3"
+	"github.com/zmap/zlint/v3/lint"
+)
+
+var (
+	lintRegistryOnce sync.Once
+	lintRegistry     lint.Registry
+	lintRegistryErr  error
+)
+
+func init() {
+	certificateLinter = zlintCertificate
+}
+
+// certificateLints returns the zlint lints of the profiles new certificates
+// are checked against: RFC 5280, the CA/Browser Forum Baseline Requirements
+// and the root store policies of Mozilla and Apple.
+func certificateLints() (lint.Registry, error) {
+	lintRegistryOnce.Do(func() {
+		lintRegistry, lintRegistryErr = lint.GlobalRegistry().Filter(lint.FilterOptions{
+			IncludeSources: lint.SourceList{
+				lint.RFC5280,
+				lint.CABFBaselineRequirements,
+				lint.MozillaRootStorePolicy,
+				lint.AppleRootStorePolicy,
+			},
+		})
+	})
+	return lintRegistry, lintRegistryErr
+}
+
+// zlintCertificate checks the DER encoded leaf certificate of domain with
+// zlint, logs every warning and error found and returns the names of the
+// lints which found an error.
+func zlintCertificate(domain string, der []byte) ([]string, error) {
+	leaf, err := zx509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] acme: Could not parse the certificate for linting: %v", domain, err)
+	}
+	registry, err := certificateLints()
+	if err != nil {
+		return nil, err
+	}
+
+	results := zlint.LintCertificateEx(leaf, registry)
+	names := make([]string, 0, len(results.Results))
+	for name := range results.Results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var failed []string
+	for _, name := range names {
+		result := results.Results[name]
+		if result.Status < lint.Warn {
+			continue
+		}
+		if result.Status >= lint.Error {
+			failed = append(failed, name)
+		}
+
+		if result.Details != "" {
+			logf("[WARNING][%s] acme: zlint %s %s: %s", domain, result.Status, name, result.Details)
+		} else {
+			logf("[WARNING][%s] acme: zlint %s %s", domain, result.Status, name)
+		}
+	}
+	return failed, nil
+}
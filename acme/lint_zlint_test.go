@@ -0,0 +1,50 @@
+//go:build lego_zlint
+// +build lego_zlint
+
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLintCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The common name is missing from the DNS names, an error of the
+	// Baseline Requirements.
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		Issuer:       pkix.Name{CommonName: "Test CA"},
+		DNSNames:     []string{"www.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := CertificateResource{Domain: "example.com", Certificate: pemEncode(derCertificateBytes(der))}
+
+	client := &Client{}
+	if err := client.lintCertificate(cert); err != nil {
+		t.Errorf("Expected the findings to be logged only, got %v", err)
+	}
+
+	client.SetStrictLinting(true)
+	err = client.lintCertificate(cert)
+	if err == nil || !strings.Contains(err.Error(), "e_subject_common_name_not_exactly_from_san") {
+		t.Errorf("Expected an error naming e_subject_common_name_not_exactly_from_san, got %v", err)
+	}
+}
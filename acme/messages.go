@@ -11,6 +11,15 @@ type directory struct {
 	NewCertURL    string `json:"new-cert"`
 	NewRegURL     string `json:"new-reg"`
 	RevokeCertURL string `json:"revoke-cert"`
+	KeyChangeURL  string `json:"key-change"`
+}
+
+// keyChangeMessage is the payload of the inner JWS of a key rollover, signed
+// by the new account key.
+type keyChangeMessage struct {
+	Resource string           `json:"resource"`
+	Account  string           `json:"account"`
+	NewKey   *jose.JsonWebKey `json:"newKey"`
 }
 
 type registrationMessage struct {
@@ -40,6 +49,14 @@ type RegistrationResource struct {
 	TosURL      string       `json:"terms_of_service,omitempty"`
 }
 
+// Authorization is a valid authorization of the account for a domain,
+// as returned by Client.Authorize.
+type Authorization struct {
+	Domain  string
+	URI     string
+	Expires time.Time
+}
+
 type authorizationResource struct {
 	Body       authorization
 	Domain     string
@@ -78,7 +95,7 @@ type challenge struct {
 	KeyAuthorization  string             `json:"keyAuthorization,omitempty"`
 	TLS               bool               `json:"tls,omitempty"`
 	Iterations        int                `json:"n,omitempty"`
-	Error             RemoteError        `json:"error,omitempty"`
+	Error             ProblemDetails     `json:"error,omitempty"`
 	ValidationRecords []validationRecord `json:"validationRecord,omitempty"`
 }
 
@@ -91,6 +108,7 @@ type csrMessage struct {
 type revokeCertMessage struct {
 	Resource    string `json:"resource"`
 	Certificate string `json:"certificate"`
+	Reason      int    `json:"reason,omitempty"`
 }
 
 // CertificateResource represents a CA issued certificate.
@@ -106,4 +124,12 @@ type CertificateResource struct {
 	PrivateKey    []byte `json:"-"`
 	Certificate   []byte `json:"-"`
 	CSR           []byte `json:"-"`
+
+	// AlternativeChains holds the PEM bundles of other chains the CA offers
+	// for Certificate. It is only filled for bundled certificates.
+	AlternativeChains [][]byte `json:"-"`
+
+	// SCTs holds the serialized Signed Certificate Timestamps received from
+	// the CT logs set with SetCTLogs.
+	SCTs [][]byte `json:"-"`
 }
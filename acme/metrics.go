@@ -0,0 +1,151 @@
+package acme
+
+import (
+	"expvar"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsRecorder receives the outcome of DNS-01 challenges, labelled with
+// the name of the DNS provider solving them.
+type metricsRecorder interface {
+	dnsChallengeAttempted(provider string)
+	dnsChallengeSucceeded(provider string)
+	dnsChallengeFailed(provider string)
+	propagationWait(provider string, wait time.Duration)
+}
+
+// metricsRecorders holds every enabled metrics backend. The expvar backend
+// is always present; building with the lego_prometheus tag adds Prometheus.
+var metricsRecorders = []metricsRecorder{newExpvarMetrics()}
+
+// propagationBuckets are the upper bounds in seconds of the propagation wait
+// histogram buckets.
+var propagationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600}
+
+// recordDNSChallengeAttempt counts a DNS-01 challenge about to be solved.
+func recordDNSChallengeAttempt(provider string) {
+	for _, m := range metricsRecorders {
+		m.dnsChallengeAttempted(provider)
+	}
+}
+
+// recordPropagationWait records how long a DNS-01 record took to propagate.
+func recordPropagationWait(provider string, wait time.Duration) {
+	for _, m := range metricsRecorders {
+		m.propagationWait(provider, wait)
+	}
+}
+
+// recordDNSChallenge passes the result of solving a DNS-01 challenge to all
+// metrics backends.
+func recordDNSChallenge(provider string, err error) {
+	for _, m := range metricsRecorders {
+		if err != nil {
+			m.dnsChallengeFailed(provider)
+		} else {
+			m.dnsChallengeSucceeded(provider)
+		}
+	}
+}
+
+// providerName returns the label of a DNS provider in metrics, the name of
+// the package implementing it.
+func providerName(provider ChallengeProvider) string {
+	if provider == nil {
+		return "none"
+	}
+	if _, ok := provider.(*DNSProviderManual); ok {
+		return "manual"
+	}
+
+	t := reflect.TypeOf(provider)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.PkgPath() == "" {
+		return strings.ToLower(t.Name())
+	}
+	return path.Base(t.PkgPath())
+}
+
+// expvarMetrics publishes the challenge metrics as the expvar "lego_dns01":
+// {"attempted": {provider: n}, "succeeded": ..., "failed": ...,
+// "propagation_wait_seconds": {provider: histogram}}.
+type expvarMetrics struct {
+	attempted *expvar.Map
+	succeeded *expvar.Map
+	failed    *expvar.Map
+	waits     *expvar.Map
+	waitsLock sync.Mutex
+}
+
+func newExpvarMetrics() *expvarMetrics {
+	m := &expvarMetrics{
+		attempted: new(expvar.Map).Init(),
+		succeeded: new(expvar.Map).Init(),
+		failed:    new(expvar.Map).Init(),
+		waits:     new(expvar.Map).Init(),
+	}
+
+	root := expvar.NewMap("lego_dns01")
+	root.Set("attempted", m.attempted)
+	root.Set("succeeded", m.succeeded)
+	root.Set("failed", m.failed)
+	root.Set("propagation_wait_seconds", m.waits)
+	return m
+}
+
+func (m *expvarMetrics) dnsChallengeAttempted(provider string) { m.attempted.Add(provider, 1) }
+func (m *expvarMetrics) dnsChallengeSucceeded(provider string) { m.succeeded.Add(provider, 1) }
+func (m *expvarMetrics) dnsChallengeFailed(provider string)    { m.failed.Add(provider, 1) }
+
+func (m *expvarMetrics) propagationWait(provider string, wait time.Duration) {
+	m.waitsLock.Lock()
+	h, ok := m.waits.Get(provider).(*histogram)
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(propagationBuckets))}
+		m.waits.Set(provider, h)
+	}
+	m.waitsLock.Unlock()
+
+	h.observe(wait.Seconds())
+}
+
+// histogram is a cumulative histogram over propagationBuckets implementing
+// expvar.Var.
+type histogram struct {
+	sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	h.Lock()
+	defer h.Unlock()
+
+	for i, bound := range propagationBuckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// String returns the histogram as JSON.
+func (h *histogram) String() string {
+	h.Lock()
+	defer h.Unlock()
+
+	buckets := make([]string, len(propagationBuckets))
+	for i, bound := range propagationBuckets {
+		buckets[i] = fmt.Sprintf("%q: %d", fmt.Sprint(bound), h.counts[i])
+	}
+	return fmt.Sprintf(`{"buckets": {%s}, "count": %d, "sum": %g}`, strings.Join(buckets, ", "), h.count, h.sum)
+}
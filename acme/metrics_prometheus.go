@@ -0,0 +1,52 @@
+//go:build lego_prometheus
+// +build lego_prometheus
+
+package acme
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// prometheusMetrics registers the challenge metrics with the default
+// Prometheus registry.
+type prometheusMetrics struct {
+	challenges *prometheus.CounterVec
+	waits      *prometheus.HistogramVec
+}
+
+func init() {
+	m := &prometheusMetrics{
+		challenges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "lego",
+			Name:      "dns01_challenges_total",
+			Help:      "DNS-01 challenges by provider and result (attempted, succeeded, failed).",
+		}, []string{"provider", "result"}),
+		waits: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "lego",
+			Name:      "dns01_propagation_wait_seconds",
+			Help:      "Time until a DNS-01 record was visible on all authoritative nameservers.",
+			Buckets:   propagationBuckets,
+		}, []string{"provider"}),
+	}
+	prometheus.MustRegister(m.challenges, m.waits)
+
+	metricsRecorders = append(metricsRecorders, m)
+}
+
+func (m *prometheusMetrics) dnsChallengeAttempted(provider string) {
+	m.challenges.WithLabelValues(provider, "attempted").Inc()
+}
+
+func (m *prometheusMetrics) dnsChallengeSucceeded(provider string) {
+	m.challenges.WithLabelValues(provider, "succeeded").Inc()
+}
+
+func (m *prometheusMetrics) dnsChallengeFailed(provider string) {
+	m.challenges.WithLabelValues(provider, "failed").Inc()
+}
+
+func (m *prometheusMetrics) propagationWait(provider string, wait time.Duration) {
+	m.waits.WithLabelValues(provider).Observe(wait.Seconds())
+}
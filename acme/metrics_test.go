@@ -0,0 +1,63 @@
+package acme
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"testing"
+	"time"
+)
+
+type metricsTestProvider struct{}
+
+func (metricsTestProvider) Present(domain, token, keyAuth string) error { return nil }
+func (metricsTestProvider) CleanUp(domain, token, keyAuth string) error { return nil }
+
+func TestProviderName(t *testing.T) {
+	manual, _ := NewDNSProviderManual()
+
+	for _, test := range []struct {
+		provider ChallengeProvider
+		expected string
+	}{
+		{nil, "none"},
+		{manual, "manual"},
+		{&metricsTestProvider{}, "acme"},
+		{&HTTPProviderServer{}, "acme"},
+	} {
+		if name := providerName(test.provider); name != test.expected {
+			t.Errorf("Expected %T to be named %q, got %q", test.provider, test.expected, name)
+		}
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	recordDNSChallengeAttempt("metrics-test")
+	recordDNSChallengeAttempt("metrics-test")
+	recordDNSChallenge("metrics-test", nil)
+	recordDNSChallenge("metrics-test", errors.New("challenge failed"))
+	recordPropagationWait("metrics-test", 7*time.Second)
+
+	var published struct {
+		Attempted map[string]int `json:"attempted"`
+		Succeeded map[string]int `json:"succeeded"`
+		Failed    map[string]int `json:"failed"`
+		Waits     map[string]struct {
+			Buckets map[string]int `json:"buckets"`
+			Count   int            `json:"count"`
+			Sum     float64        `json:"sum"`
+		} `json:"propagation_wait_seconds"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get("lego_dns01").String()), &published); err != nil {
+		t.Fatalf("Could not parse the published metrics: %v", err)
+	}
+
+	if published.Attempted["metrics-test"] != 2 || published.Succeeded["metrics-test"] != 1 || published.Failed["metrics-test"] != 1 {
+		t.Errorf("Unexpected challenge counters %+v", published)
+	}
+
+	wait := published.Waits["metrics-test"]
+	if wait.Count != 1 || wait.Sum != 7 || wait.Buckets["5"] != 0 || wait.Buckets["10"] != 1 {
+		t.Errorf("Unexpected propagation wait histogram %+v", wait)
+	}
+}
@@ -19,10 +19,45 @@ type ChallengeProvider interface {
 // of the Timeout method will be used when appropriate by the acme
 // package. The interval value is the time between checks.
 //
-// The default values used for timeout and interval are 60 seconds and
-// 2 seconds respectively. These are used when no Timeout method is
-// defined for the ChallengeProvider.
+// The default values used for timeout and interval are
+// DefaultPropagationTimeout and DefaultPollingInterval. These are used when
+// no Timeout method is defined for the ChallengeProvider.
 type ChallengeProviderTimeout interface {
 	ChallengeProvider
 	Timeout() (timeout, interval time.Duration)
 }
+
+// The timeout and interval of the DNS propagation check for providers
+// without a Timeout method.
+const (
+	DefaultPropagationTimeout = 60 * time.Second
+	DefaultPollingInterval    = 2 * time.Second
+)
+
+// PropagationConfig sets how long the DNS-01 challenge waits for the TXT
+// record to show up on the authoritative nameservers, and how often it
+// checks. Zero values keep the defaults of the provider, see
+// ChallengeProviderTimeout.
+type PropagationConfig struct {
+	Timeout      time.Duration
+	PollInterval time.Duration
+}
+
+// ChallengeProviderDNSSEC is implemented by DNS providers managing the
+// signatures of DNSSEC signed zones. When the zone of a challenge record
+// has DNSKEY records, ResignZone is called after Present so the new TXT
+// record is signed before the propagation check starts.
+type ChallengeProviderDNSSEC interface {
+	ChallengeProvider
+	ResignZone(zone string) error
+}
+
+// ChallengeProviderDNSSECRollover is implemented by DNS providers which have
+// to pass on changed signatures of a DNSSEC signed zone, e.g. by notifying
+// the secondaries or updating DS records upstream. NotifyDNSSECRollover is
+// called after the TXT record was added to a signed zone, and after
+// ResignZone when the provider implements ChallengeProviderDNSSEC as well.
+type ChallengeProviderDNSSECRollover interface {
+	ChallengeProvider
+	NotifyDNSSECRollover(zone string) error
+}
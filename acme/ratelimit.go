@@ -0,0 +1,140 @@
+package acme
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitDocs explains the rate limits of Let's Encrypt.
+const rateLimitDocs = "https://letsencrypt.org/docs/rate-limits/"
+
+// DefaultMaxRateLimitWait is the longest rate limit backoff a client waits
+// out before retrying a request unless SetMaxRateLimitWait is called.
+const DefaultMaxRateLimitWait = 5 * time.Minute
+
+// maxRateLimitRetries is how often a rate limited request is retried before
+// its RateLimitError is returned.
+const maxRateLimitRetries = 3
+
+var (
+	// defaultRateLimitBackoff is the backoff of a rate limited request
+	// whose response has no Retry-After header, and the shortest backoff
+	// waited out before retrying one.
+	defaultRateLimitBackoff = time.Minute
+	// timeNow returns the current time and rateLimitSleep waits out a
+	// backoff. They are overridden during tests.
+	timeNow        = time.Now
+	rateLimitSleep = time.Sleep
+)
+
+// RateLimitError is returned for requests the CA rejected with status 429
+// because a rate limit was hit, e.g. too many certificates or failed
+// validations for a domain.
+type RateLimitError struct {
+	ProblemDetails
+	// RetryAfter is the time after which the CA accepts the request again.
+	RetryAfter time.Duration
+}
+
+// Unwrap returns the problem document of the error.
+func (e RateLimitError) Unwrap() error {
+	return e.ProblemDetails
+}
+
+func (e RateLimitError) Error() string {
+	return fmt.Sprintf("%s (retry after %s, see %s)", e.ProblemDetails.Error(), e.RetryAfter, rateLimitDocs)
+}
+
+// retryAfter returns the backoff of the Retry-After header of a response, in
+// seconds or as an HTTP date, or defaultRateLimitBackoff.
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if backoff := date.Sub(timeNow()); backoff > 0 {
+			return backoff
+		}
+		return 0
+	}
+	return defaultRateLimitBackoff
+}
+
+// rateLimits tracks the domains the CA rate limited until their backoff
+// expires.
+type rateLimits struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// backoff returns the time left until domain may be requested again.
+func (r *rateLimits) backoff(domain string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until, ok := r.until[domain]
+	if !ok {
+		return 0
+	}
+	left := until.Sub(timeNow())
+	if left <= 0 {
+		delete(r.until, domain)
+		return 0
+	}
+	return left
+}
+
+// limit records that domain may not be requested for backoff.
+func (r *rateLimits) limit(domain string, backoff time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.until == nil {
+		r.until = make(map[string]time.Time)
+	}
+	r.until[domain] = timeNow().Add(backoff)
+}
+
+// SetMaxRateLimitWait sets the longest rate limit backoff the client waits
+// out before retrying a request for a domain. Requests with a longer backoff
+// fail with a RateLimitError, and later requests for the domain fail without
+// asking the CA until the backoff expired. Zero makes every rate limited
+// request fail.
+func (c *Client) SetMaxRateLimitWait(wait time.Duration) {
+	c.maxRateLimitWait = wait
+}
+
+// withRateLimit runs request for domain once its rate limit backoff, if any,
+// expired, waiting for at most the maximum rate limit wait. It retries the
+// request up to maxRateLimitRetries times as long as the CA rate limits it
+// with such a backoff, waiting at least defaultRateLimitBackoff in between.
+func (c *Client) withRateLimit(domain string, request func() error) error {
+	for retries := 0; ; retries++ {
+		if backoff := c.rateLimits.backoff(domain); backoff > 0 {
+			if backoff > c.maxRateLimitWait {
+				return fmt.Errorf("[%s] acme: Rate limited by the CA for another %s, see %s", domain, backoff/time.Second*time.Second, rateLimitDocs)
+			}
+			logf("[INFO][%s] acme: Waiting %s for the rate limit to expire", domain, backoff/time.Second*time.Second)
+			rateLimitSleep(backoff)
+		}
+
+		err := request()
+		limitErr, ok := err.(RateLimitError)
+		if !ok {
+			return err
+		}
+
+		if limitErr.RetryAfter < defaultRateLimitBackoff {
+			limitErr.RetryAfter = defaultRateLimitBackoff
+		}
+		c.rateLimits.limit(domain, limitErr.RetryAfter)
+		logf("[WARNING][%s] acme: Rate limit hit, the CA accepts requests again after %s: %s. See %s", domain, limitErr.RetryAfter, limitErr.Detail, rateLimitDocs)
+		if limitErr.RetryAfter > c.maxRateLimitWait || retries == maxRateLimitRetries {
+			return limitErr
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package acme
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"30", 30 * time.Second},
+		{"", defaultRateLimitBackoff},
+		{"soon", defaultRateLimitBackoff},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0},
+	} {
+		header := http.Header{}
+		header.Set("Retry-After", test.value)
+		if backoff := retryAfter(header); backoff != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.value, test.expected, backoff)
+		}
+	}
+
+	header := http.Header{}
+	header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if backoff := retryAfter(header); backoff < 59*time.Minute || backoff > time.Hour {
+		t.Errorf("Expected a backoff of about an hour, got %s", backoff)
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	now := time.Now()
+	var waits []time.Duration
+	defer func() { timeNow, rateLimitSleep = time.Now, time.Sleep }()
+	timeNow = func() time.Time { return now }
+	rateLimitSleep = func(d time.Duration) {
+		waits = append(waits, d)
+		now = now.Add(d)
+	}
+
+	client := &Client{}
+	client.SetMaxRateLimitWait(2 * time.Minute)
+
+	// A short backoff is waited out and the request retried.
+	requests := 0
+	err := client.withRateLimit("example.com", func() error {
+		requests++
+		if requests == 1 {
+			return RateLimitError{ProblemDetails: ProblemDetails{Status: http.StatusTooManyRequests}, RetryAfter: 90 * time.Second}
+		}
+		return nil
+	})
+	if err != nil || requests != 2 {
+		t.Errorf("Expected the request to succeed on the second try, got %v after %d requests", err, requests)
+	}
+	if len(waits) != 1 || waits[0] != 90*time.Second {
+		t.Errorf("Expected to wait 90s once, got %v", waits)
+	}
+
+	// A backoff shorter than the default one is extended, and a request
+	// which stays rate limited is only retried a few times.
+	waits = nil
+	requests = 0
+	err = client.withRateLimit("example.org", func() error {
+		requests++
+		return RateLimitError{ProblemDetails: ProblemDetails{Status: http.StatusTooManyRequests}}
+	})
+	if _, ok := err.(RateLimitError); !ok || requests != maxRateLimitRetries+1 {
+		t.Errorf("Expected a RateLimitError after %d requests, got %v after %d", maxRateLimitRetries+1, err, requests)
+	}
+	if len(waits) != maxRateLimitRetries || waits[0] != defaultRateLimitBackoff {
+		t.Errorf("Expected to wait %s %d times, got %v", defaultRateLimitBackoff, maxRateLimitRetries, waits)
+	}
+	waits = nil
+
+	// A long backoff fails, and so do later requests for the domain.
+	requests = 0
+	err = client.withRateLimit("example.com", func() error {
+		requests++
+		return RateLimitError{ProblemDetails: ProblemDetails{Status: http.StatusTooManyRequests}, RetryAfter: time.Hour}
+	})
+	if _, ok := err.(RateLimitError); !ok || requests != 1 {
+		t.Errorf("Expected a RateLimitError after one request, got %v after %d", err, requests)
+	}
+
+	err = client.withRateLimit("example.com", func() error {
+		requests++
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "Rate limited") || requests != 1 {
+		t.Errorf("Expected the request to fail without asking the CA, got %v after %d requests", err, requests)
+	}
+
+	if err := client.withRateLimit("www.example.com", func() error { return nil }); err != nil {
+		t.Errorf("Expected other domains not to be limited, got %v", err)
+	}
+	if len(waits) != 0 {
+		t.Errorf("Expected no further waits, got %v", waits)
+	}
+}
@@ -0,0 +1,863 @@
+// Package testserver implements an in-memory ACME server for tests.
+//
+// It speaks the same protocol as Boulder (directory, nonces, new-reg, reg,
+// new-authz, challenge, new-cert, revoke-cert and key-change) but never contacts the
+// client to validate a challenge. Whether a challenge passes is controlled
+// with SetValidDomains instead, so the whole flow can run without network
+// access or an external CA process.
+package testserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/square/go-jose.v1"
+)
+
+// TestServer is an ACME CA listening on a local httptest.Server.
+type TestServer struct {
+	server *httptest.Server
+
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+
+	// crossRoot cross-signs the CA, crossCert is the CA certificate issued
+	// by it. Together they make up the alternative chain of every certificate.
+	crossRoot *x509.Certificate
+	crossCert *x509.Certificate
+
+	mu            sync.Mutex
+	validDomains  map[string]bool
+	nonces        map[string]bool
+	registrations map[string]*registration
+	authzs        map[int]*authz
+	certs         map[string]*issuedCert
+	lastID        int
+}
+
+type registration struct {
+	ID        int             `json:"id"`
+	Key       jose.JsonWebKey `json:"key"`
+	Contact   []string        `json:"contact"`
+	Agreement string          `json:"agreement,omitempty"`
+	deleted   bool
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+type challenge struct {
+	Type   string   `json:"type"`
+	Status string   `json:"status"`
+	URI    string   `json:"uri"`
+	Token  string   `json:"token"`
+	Error  *problem `json:"error,omitempty"`
+}
+
+type authz struct {
+	Identifier   identifier   `json:"identifier"`
+	Status       string       `json:"status"`
+	Expires      time.Time    `json:"expires"`
+	Challenges   []*challenge `json:"challenges"`
+	Combinations [][]int      `json:"combinations"`
+	regID        int
+}
+
+type issuedCert struct {
+	der     []byte
+	revoked bool
+	reason  int
+}
+
+// New starts and returns a new TestServer. Every domain validates until
+// SetValidDomains is called. The caller should call Close when finished.
+func New() *TestServer {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("testserver: failed to generate CA key: %v", err))
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "lego test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		panic(fmt.Sprintf("testserver: failed to create CA certificate: %v", err))
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		panic(fmt.Sprintf("testserver: failed to parse CA certificate: %v", err))
+	}
+
+	crossKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("testserver: failed to generate cross root key: %v", err))
+	}
+	crossTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "lego test cross root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	crossRoot := mustCreateCertificate(crossTemplate, crossTemplate, &crossKey.PublicKey, crossKey)
+	template.SerialNumber = big.NewInt(3)
+	crossCert := mustCreateCertificate(template, crossRoot, &caKey.PublicKey, crossKey)
+
+	s := &TestServer{
+		caKey:         caKey,
+		caCert:        caCert,
+		crossRoot:     crossRoot,
+		crossCert:     crossCert,
+		nonces:        map[string]bool{},
+		registrations: map[string]*registration{},
+		authzs:        map[int]*authz{},
+		certs:         map[string]*issuedCert{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", s.handleDirectory)
+	mux.HandleFunc("/new-reg", s.handleNewReg)
+	mux.HandleFunc("/reg/", s.handleReg)
+	mux.HandleFunc("/new-authz", s.handleNewAuthz)
+	mux.HandleFunc("/authz/", s.handleAuthz)
+	mux.HandleFunc("/challenge/", s.handleChallenge)
+	mux.HandleFunc("/new-cert", s.handleNewCert)
+	mux.HandleFunc("/cert/", s.handleCert)
+	mux.HandleFunc("/issuer", s.handleIssuer)
+	mux.HandleFunc("/issuer/cross", s.handleCrossIssuer)
+	mux.HandleFunc("/revoke-cert", s.handleRevokeCert)
+	mux.HandleFunc("/key-change", s.handleKeyChange)
+	mux.HandleFunc("/terms", func(w http.ResponseWriter, r *http.Request) {})
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", s.newNonce())
+		if r.Method == "HEAD" {
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+// Close shuts down the server.
+func (s *TestServer) Close() {
+	s.server.Close()
+}
+
+// DirectoryURL returns the URL of the ACME directory to pass to acme.NewClient.
+func (s *TestServer) DirectoryURL() string {
+	return s.server.URL + "/directory"
+}
+
+// CACertificate returns the certificate of the CA signing all issued certificates.
+func (s *TestServer) CACertificate() *x509.Certificate {
+	return s.caCert
+}
+
+// CrossRootCertificate returns the root certificate of the alternative chain
+// offered for every issued certificate, which cross-signs the CA.
+func (s *TestServer) CrossRootCertificate() *x509.Certificate {
+	return s.crossRoot
+}
+
+// SetValidDomains restricts the domains whose challenges pass to the given
+// list. Challenges for any other domain are marked invalid. Passing nil lets
+// every domain validate again.
+func (s *TestServer) SetValidDomains(domains []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if domains == nil {
+		s.validDomains = nil
+		return
+	}
+
+	s.validDomains = make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		s.validDomains[domain] = true
+	}
+}
+
+// IsRevoked reports whether the certificate with the given DER encoding was
+// issued and subsequently revoked by this server.
+func (s *TestServer) IsRevoked(der []byte) bool {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issued, ok := s.certs[cert.SerialNumber.Text(16)]
+	return ok && issued.revoked
+}
+
+// RevocationReason returns the reason code the certificate with the given
+// DER encoding was revoked with. ok is false if it was not revoked.
+func (s *TestServer) RevocationReason(der []byte) (reason int, ok bool) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return 0, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issued, found := s.certs[cert.SerialNumber.Text(16)]
+	if !found || !issued.revoked {
+		return 0, false
+	}
+	return issued.reason, true
+}
+
+func (s *TestServer) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"new-reg":     s.server.URL + "/new-reg",
+		"new-authz":   s.server.URL + "/new-authz",
+		"new-cert":    s.server.URL + "/new-cert",
+		"revoke-cert": s.server.URL + "/revoke-cert",
+		"key-change":  s.server.URL + "/key-change",
+	})
+}
+
+func (s *TestServer) handleNewReg(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		Contact []string `json:"contact"`
+	}
+	key, ok := s.readJWS(w, r, &msg)
+	if !ok {
+		return
+	}
+
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if reg, ok := s.registrations[string(thumbprint)]; ok && !reg.deleted {
+		w.Header().Set("Location", s.regURL(reg.ID))
+		writeProblem(w, http.StatusConflict, "malformed", "Registration key is already in use")
+		return
+	}
+
+	s.lastID++
+	reg := &registration{ID: s.lastID, Key: *key, Contact: msg.Contact}
+	s.registrations[string(thumbprint)] = reg
+
+	w.Header().Set("Location", s.regURL(reg.ID))
+	s.writeRegistration(w, http.StatusCreated, reg)
+}
+
+func (s *TestServer) handleReg(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		Contact   []string `json:"contact"`
+		Agreement string   `json:"agreement"`
+		Delete    bool     `json:"delete"`
+	}
+	key, ok := s.readJWS(w, r, &msg)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reg, ok := s.registrationFor(w, key)
+	if !ok {
+		return
+	}
+	if r.URL.Path != "/reg/"+strconv.Itoa(reg.ID) {
+		writeProblem(w, http.StatusForbidden, "unauthorized", "Request signed by the wrong account key")
+		return
+	}
+
+	if msg.Contact != nil {
+		reg.Contact = msg.Contact
+	}
+	if msg.Agreement != "" {
+		reg.Agreement = msg.Agreement
+	}
+	if msg.Delete {
+		reg.deleted = true
+	}
+
+	s.writeRegistration(w, http.StatusAccepted, reg)
+}
+
+func (s *TestServer) handleNewAuthz(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		Identifier identifier `json:"identifier"`
+	}
+	key, ok := s.readJWS(w, r, &msg)
+	if !ok {
+		return
+	}
+	if msg.Identifier.Type != "dns" || msg.Identifier.Value == "" {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Invalid identifier")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reg, ok := s.registrationFor(w, key)
+	if !ok {
+		return
+	}
+
+	s.lastID++
+	id := s.lastID
+	a := &authz{
+		Identifier:   msg.Identifier,
+		Status:       "pending",
+		Expires:      time.Now().Add(24 * time.Hour),
+		Combinations: [][]int{{0}, {1}, {2}},
+		regID:        reg.ID,
+	}
+	for i, typ := range []string{"http-01", "tls-sni-01", "dns-01"} {
+		a.Challenges = append(a.Challenges, &challenge{
+			Type:   typ,
+			Status: "pending",
+			URI:    fmt.Sprintf("%s/challenge/%d/%d", s.server.URL, id, i),
+			Token:  randomToken(),
+		})
+	}
+	s.authzs[id] = a
+
+	w.Header().Set("Location", fmt.Sprintf("%s/authz/%d", s.server.URL, id))
+	w.Header().Add("Link", fmt.Sprintf(`<%s/new-cert>;rel="next"`, s.server.URL))
+	writeJSON(w, http.StatusCreated, a)
+}
+
+func (s *TestServer) handleAuthz(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/authz/"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.authzs[id]
+	if err != nil || !ok {
+		writeProblem(w, http.StatusNotFound, "malformed", "No such authorization")
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
+
+func (s *TestServer) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/challenge/"), "/")
+	if len(parts) != 2 {
+		writeProblem(w, http.StatusNotFound, "malformed", "No such challenge")
+		return
+	}
+	id, err1 := strconv.Atoi(parts[0])
+	idx, err2 := strconv.Atoi(parts[1])
+
+	if r.Method != "POST" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		chlng, ok := s.challenge(id, idx)
+		if err1 != nil || err2 != nil || !ok {
+			writeProblem(w, http.StatusNotFound, "malformed", "No such challenge")
+			return
+		}
+		writeJSON(w, http.StatusOK, chlng)
+		return
+	}
+
+	var msg struct {
+		KeyAuthorization string `json:"keyAuthorization"`
+	}
+	key, ok := s.readJWS(w, r, &msg)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reg, ok := s.registrationFor(w, key)
+	if !ok {
+		return
+	}
+	chlng, ok := s.challenge(id, idx)
+	if err1 != nil || err2 != nil || !ok || s.authzs[id].regID != reg.ID {
+		writeProblem(w, http.StatusNotFound, "malformed", "No such challenge")
+		return
+	}
+
+	a := s.authzs[id]
+	if s.validDomains == nil || s.validDomains[a.Identifier.Value] {
+		chlng.Status = "valid"
+	} else {
+		chlng.Status = "invalid"
+		chlng.Error = &problem{
+			Type:   "urn:acme:error:unauthorized",
+			Detail: fmt.Sprintf("Validation of %s rejected by the test server", a.Identifier.Value),
+		}
+	}
+	a.Status = chlng.Status
+
+	writeJSON(w, http.StatusAccepted, chlng)
+}
+
+func (s *TestServer) handleNewCert(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		Csr string `json:"csr"`
+	}
+	key, ok := s.readJWS(w, r, &msg)
+	if !ok {
+		return
+	}
+
+	csrBytes, err := base64.URLEncoding.DecodeString(padBase64(msg.Csr))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Invalid CSR encoding")
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", fmt.Sprintf("Invalid CSR: %v", err))
+		return
+	}
+
+	names := csr.DNSNames
+	if csr.Subject.CommonName != "" {
+		names = append([]string{csr.Subject.CommonName}, names...)
+	}
+	names = dedupe(names)
+	if len(names) == 0 {
+		writeProblem(w, http.StatusBadRequest, "malformed", "CSR contains no names")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reg, ok := s.registrationFor(w, key)
+	if !ok {
+		return
+	}
+	for _, name := range names {
+		if !s.isAuthorized(reg.ID, name) {
+			writeProblem(w, http.StatusForbidden, "unauthorized", fmt.Sprintf("Account is not authorized for %s", name))
+			return
+		}
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", err.Error())
+		return
+	}
+	// Like an OV CA, keep the organization fields the CSR asks for.
+	subject := pkix.Name{
+		CommonName:         names[0],
+		Organization:       csr.Subject.Organization,
+		OrganizationalUnit: csr.Subject.OrganizationalUnit,
+		Country:            csr.Subject.Country,
+		Province:           csr.Subject.Province,
+		Locality:           csr.Subject.Locality,
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.caCert, csr.PublicKey, s.caKey)
+	if err != nil {
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", err.Error())
+		return
+	}
+	s.certs[serial.Text(16)] = &issuedCert{der: der}
+
+	w.Header().Set("Location", s.server.URL+"/cert/"+serial.Text(16))
+	w.Header().Add("Link", fmt.Sprintf(`<%s/issuer>;rel="up"`, s.server.URL))
+	w.Header().Add("Link", fmt.Sprintf(`<%s/cert/%s/alternate>;rel="alternate"`, s.server.URL, serial.Text(16)))
+	w.Header().Set("Content-Type", "application/pkix-cert")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(der)
+}
+
+func (s *TestServer) handleCert(w http.ResponseWriter, r *http.Request) {
+	serial := strings.TrimPrefix(r.URL.Path, "/cert/")
+	alternate := strings.HasSuffix(serial, "/alternate")
+	serial = strings.TrimSuffix(serial, "/alternate")
+
+	s.mu.Lock()
+	issued, ok := s.certs[serial]
+	s.mu.Unlock()
+
+	if !ok {
+		writeProblem(w, http.StatusNotFound, "malformed", "No such certificate")
+		return
+	}
+
+	if alternate {
+		w.Header().Add("Link", fmt.Sprintf(`<%s/issuer/cross>;rel="up"`, s.server.URL))
+	} else {
+		w.Header().Add("Link", fmt.Sprintf(`<%s/issuer>;rel="up"`, s.server.URL))
+		w.Header().Add("Link", fmt.Sprintf(`<%s/cert/%s/alternate>;rel="alternate"`, s.server.URL, serial))
+	}
+	w.Header().Set("Content-Type", "application/pkix-cert")
+	w.Write(issued.der)
+}
+
+func (s *TestServer) handleIssuer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/pkix-cert")
+	w.Write(s.caCert.Raw)
+}
+
+func (s *TestServer) handleCrossIssuer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/pkix-cert")
+	w.Write(s.crossCert.Raw)
+}
+
+func (s *TestServer) handleRevokeCert(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		Certificate string `json:"certificate"`
+		Reason      int    `json:"reason"`
+	}
+	key, ok := s.readJWS(w, r, &msg)
+	if !ok {
+		return
+	}
+
+	der, err := base64.URLEncoding.DecodeString(padBase64(msg.Certificate))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Invalid certificate encoding")
+		return
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", fmt.Sprintf("Invalid certificate: %v", err))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The key of the certificate itself may revoke it without a registration.
+	if spki, err := x509.MarshalPKIXPublicKey(key.Key); err != nil || string(spki) != string(cert.RawSubjectPublicKeyInfo) {
+		if _, ok := s.registrationFor(w, key); !ok {
+			return
+		}
+	}
+
+	issued, ok := s.certs[cert.SerialNumber.Text(16)]
+	if !ok {
+		writeProblem(w, http.StatusNotFound, "malformed", "Certificate was not issued by this server")
+		return
+	}
+	if issued.revoked {
+		writeProblem(w, http.StatusConflict, "malformed", "Certificate already revoked")
+		return
+	}
+	issued.revoked = true
+	issued.reason = msg.Reason
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *TestServer) handleKeyChange(w http.ResponseWriter, r *http.Request) {
+	var inner json.RawMessage
+	oldKey, ok := s.readJWS(w, r, &inner)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Protected string `json:"protected"`
+	}
+	if err := json.Unmarshal(inner, &body); err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Payload is not a JWS")
+		return
+	}
+	protected, err := base64.URLEncoding.DecodeString(padBase64(body.Protected))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Invalid protected header of the inner JWS")
+		return
+	}
+	var header struct {
+		JWK *jose.JsonWebKey `json:"jwk"`
+	}
+	if err := json.Unmarshal(protected, &header); err != nil || header.JWK == nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Inner JWS carries no JWK")
+		return
+	}
+	newKey := header.JWK
+
+	sig, err := jose.ParseSigned(string(inner))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	payload, err := sig.Verify(newKey.Key)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Inner JWS verification error")
+		return
+	}
+	var msg struct {
+		Account string          `json:"account"`
+		NewKey  jose.JsonWebKey `json:"newKey"`
+	}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Inner payload did not parse as JSON")
+		return
+	}
+
+	newThumbprint, err := newKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	if msgThumbprint, err := msg.NewKey.Thumbprint(crypto.SHA256); err != nil || string(msgThumbprint) != string(newThumbprint) {
+		writeProblem(w, http.StatusBadRequest, "malformed", "New key does not match the key signing the inner JWS")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reg, ok := s.registrationFor(w, oldKey)
+	if !ok {
+		return
+	}
+	if msg.Account != s.regURL(reg.ID) {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Account does not match the registration of the old key")
+		return
+	}
+	if other, ok := s.registrations[string(newThumbprint)]; ok && !other.deleted {
+		w.Header().Set("Location", s.regURL(other.ID))
+		writeProblem(w, http.StatusConflict, "malformed", "New key is already in use")
+		return
+	}
+
+	oldThumbprint, _ := oldKey.Thumbprint(crypto.SHA256)
+	delete(s.registrations, string(oldThumbprint))
+	reg.Key = *newKey
+	s.registrations[string(newThumbprint)] = reg
+
+	s.writeRegistration(w, http.StatusOK, reg)
+}
+
+// readJWS verifies the JWS in the request body against the key embedded in
+// its protected header, checks the nonce and decodes the payload into v.
+// It writes an error response and returns false if any of that fails.
+func (s *TestServer) readJWS(w http.ResponseWriter, r *http.Request, v interface{}) (*jose.JsonWebKey, bool) {
+	if r.Method != "POST" {
+		writeProblem(w, http.StatusMethodNotAllowed, "malformed", "Method not allowed")
+		return nil, false
+	}
+
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Unable to read request body")
+		return nil, false
+	}
+
+	var body struct {
+		Protected string `json:"protected"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Request is not a JWS")
+		return nil, false
+	}
+
+	protected, err := base64.URLEncoding.DecodeString(padBase64(body.Protected))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Invalid protected header")
+		return nil, false
+	}
+	var header struct {
+		JWK   *jose.JsonWebKey `json:"jwk"`
+		Nonce string           `json:"nonce"`
+	}
+	if err := json.Unmarshal(protected, &header); err != nil || header.JWK == nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Protected header carries no JWK")
+		return nil, false
+	}
+
+	if !s.useNonce(header.Nonce) {
+		writeProblem(w, http.StatusBadRequest, "badNonce", "JWS has an invalid anti-replay nonce")
+		return nil, false
+	}
+
+	sig, err := jose.ParseSigned(string(raw))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", err.Error())
+		return nil, false
+	}
+	payload, err := sig.Verify(header.JWK.Key)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "JWS verification error")
+		return nil, false
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Request payload did not parse as JSON")
+		return nil, false
+	}
+	return header.JWK, true
+}
+
+// registrationFor returns the active registration for key. The caller must hold s.mu.
+func (s *TestServer) registrationFor(w http.ResponseWriter, key *jose.JsonWebKey) (*registration, bool) {
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err == nil {
+		if reg, ok := s.registrations[string(thumbprint)]; ok && !reg.deleted {
+			return reg, true
+		}
+	}
+
+	writeProblem(w, http.StatusForbidden, "unauthorized", "No registration exists matching provided key")
+	return nil, false
+}
+
+// challenge returns the challenge at index idx of authorization id. The caller must hold s.mu.
+func (s *TestServer) challenge(id, idx int) (*challenge, bool) {
+	a, ok := s.authzs[id]
+	if !ok || idx < 0 || idx >= len(a.Challenges) {
+		return nil, false
+	}
+	return a.Challenges[idx], true
+}
+
+// isAuthorized reports whether the registration holds a valid authorization
+// for domain. The caller must hold s.mu.
+func (s *TestServer) isAuthorized(regID int, domain string) bool {
+	for _, a := range s.authzs {
+		if a.regID == regID && a.Identifier.Value == domain && a.Status == "valid" && a.Expires.After(time.Now()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TestServer) regURL(id int) string {
+	return fmt.Sprintf("%s/reg/%d", s.server.URL, id)
+}
+
+func (s *TestServer) writeRegistration(w http.ResponseWriter, status int, reg *registration) {
+	w.Header().Add("Link", fmt.Sprintf(`<%s/new-authz>;rel="next"`, s.server.URL))
+	w.Header().Add("Link", fmt.Sprintf(`<%s/terms>;rel="terms-of-service"`, s.server.URL))
+	writeJSON(w, status, reg)
+}
+
+func (s *TestServer) newNonce() string {
+	nonce := randomToken()
+
+	s.mu.Lock()
+	s.nonces[nonce] = true
+	s.mu.Unlock()
+
+	return nonce
+}
+
+func (s *TestServer) useNonce(nonce string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.nonces[nonce] {
+		return false
+	}
+	delete(s.nonces, nonce)
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeProblem(w http.ResponseWriter, status int, typ, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem{Type: "urn:acme:error:" + typ, Detail: detail})
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("testserver: failed to read random bytes: %v", err))
+	}
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(b), "=")
+}
+
+// padBase64 restores the padding stripped from base64url encoded values.
+func padBase64(s string) string {
+	if m := len(s) % 4; m != 0 {
+		s += strings.Repeat("=", 4-m)
+	}
+	return s
+}
+
+func dedupe(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	var unique []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+// mustCreateCertificate creates and parses a certificate, panicking on
+// failure like the rest of the CA setup in New.
+func mustCreateCertificate(template, parent *x509.Certificate, pub interface{}, priv crypto.Signer) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+	if err != nil {
+		panic(fmt.Sprintf("testserver: failed to create certificate: %v", err))
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(fmt.Sprintf("testserver: failed to parse certificate: %v", err))
+	}
+	return cert
+}
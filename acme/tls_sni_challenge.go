@@ -20,6 +20,7 @@ func (t *tlsSNIChallenge) Solve(chlng challenge, domain string) error {
 	// Currently we implement this challenge to track boulder, not the current spec!
 
 	logf("[INFO][%s] acme: Trying to solve TLS-SNI-01", domain)
+	logf("[WARNING][%s] acme: TLS-SNI-01 is deprecated and no longer offered by most CAs, prefer HTTP-01 or DNS-01", domain)
 
 	// Generate the Key Authorization for the challenge
 	keyAuth, err := getKeyAuthorization(chlng.Token, t.jws.privKey)
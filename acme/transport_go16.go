@@ -0,0 +1,24 @@
+//go:build !go1.7
+// +build !go1.7
+
+package acme
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// newDefaultTransport returns a transport configured like
+// http.DefaultTransport.
+func newDefaultTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// certFileTypes are the extensions of the files saveCertRes may write for
+// a domain, as named in certInfo.Files.
+var certFileTypes = []struct {
+	name string
+	ext  string
+}{
+	{"certificate", ".crt"},
+	{"privateKey", ".key"},
+	{"pem", ".pem"},
+	{"pfx", ".pfx"},
+	{"meta", ".json"},
+	{"scts", ".sct"},
+}
+
+// certInfo describes a stored certificate in the --json output.
+type certInfo struct {
+	Domain    string            `json:"domain"`
+	SANs      []string          `json:"sans"`
+	Issuer    string            `json:"issuer"`
+	NotBefore time.Time         `json:"notBefore"`
+	NotAfter  time.Time         `json:"notAfter"`
+	Serial    string            `json:"serial"`
+	KeyType   string            `json:"keyType"`
+	Files     map[string]string `json:"files"`
+}
+
+// newCertInfo describes the certificate of domain stored in certPath.
+func newCertInfo(domain, certPath string) (*certInfo, error) {
+	cert, err := loadCertificate(path.Join(certPath, domain+".crt"))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &certInfo{
+		Domain:    domain,
+		SANs:      append([]string{}, cert.DNSNames...),
+		Issuer:    cert.Issuer.CommonName,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		Serial:    fmt.Sprintf("%x", cert.SerialNumber),
+		KeyType:   keyTypeName(cert.PublicKey),
+		Files:     map[string]string{},
+	}
+	for _, fileType := range certFileTypes {
+		file := path.Join(certPath, domain+fileType.ext)
+		if _, err := os.Stat(file); err == nil {
+			info.Files[fileType.name] = file
+		}
+	}
+	return info, nil
+}
+
+// keyTypeName returns the --key-type name of key, e.g. rsa2048 or ec256.
+func keyTypeName(key interface{}) string {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("rsa%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ec%d", key.Curve.Params().BitSize)
+	}
+	return "unknown"
+}
+
+// daysLeft returns the number of whole days until the certificate expires.
+func (i *certInfo) daysLeft() int {
+	return int(i.NotAfter.Sub(time.Now()).Hours() / 24.0)
+}
+
+// loadCertificate parses the first certificate of the PEM bundle in file.
+func loadCertificate(file string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s holds no PEM encoded certificate", file)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// printJSON writes v as indented JSON to stdout.
+func printJSON(v interface{}) {
+	jsonBytes, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		logger().Fatalf("Unable to marshal JSON output\n\t%s", err.Error())
+	}
+	fmt.Println(string(jsonBytes))
+}
+
+// byExpiry sorts certificates by their expiry, soonest first.
+type byExpiry []*certInfo
+
+func (s byExpiry) Len() int           { return len(s) }
+func (s byExpiry) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byExpiry) Less(i, j int) bool { return s[i].NotAfter.Before(s[j].NotAfter) }
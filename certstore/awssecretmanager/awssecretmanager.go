@@ -0,0 +1,259 @@
+// Package awssecretmanager implements a certstore.Storage keeping
+// certificates in AWS Secrets Manager.
+package awssecretmanager
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/certstore"
+)
+
+// defaultPrefix starts the names of the secrets unless LEGO_AWS_SECRET_PREFIX
+// is set.
+const defaultPrefix = "lego/"
+
+// secretValue is the JSON stored in the secret of a domain.
+type secretValue struct {
+	// Certificate is the PEM encoded certificate of the domain, Chain the
+	// PEM encoded issuer certificates following it in the bundle.
+	Certificate string `json:"certificate"`
+	Chain       string `json:"chain,omitempty"`
+	PrivateKey  string `json:"privateKey,omitempty"`
+	// Meta holds the metadata lego writes to the .json file.
+	Meta json.RawMessage `json:"meta"`
+}
+
+// Storage is an implementation of the certstore.Storage interface that
+// keeps a certificate in the secret <prefix><domain>, as JSON with the
+// fields certificate, chain, privateKey and meta. The wildcard label of a
+// domain is stored as "_", which no certificate can contain.
+type Storage struct {
+	client   *secretsmanager.SecretsManager
+	prefix   string
+	kmsKeyID string
+
+	rotationLambdaARN string
+	rotationDays      int64
+}
+
+// NewStorage returns a Storage configured from the environment.
+//
+// AWS Credentials and the region are detected like for the route53
+// provider, from the environment (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_REGION, [AWS_SESSION_TOKEN]), the shared credentials file or an EC2
+// IAM role.
+//
+// LEGO_AWS_KMS_KEY_ID names the KMS key encrypting new secrets, by default
+// the aws/secretsmanager key of the account. LEGO_AWS_SECRET_PREFIX replaces
+// the prefix of the secret names, "lego/". If LEGO_AWS_ROTATION_LAMBDA_ARN is
+// set, the secrets are rotated by that Lambda function every
+// LEGO_AWS_ROTATION_DAYS days, 60 by default.
+func NewStorage() (*Storage, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewStorageWithClient(secretsmanager.New(sess), os.Getenv("LEGO_AWS_KMS_KEY_ID"))
+	if prefix := os.Getenv("LEGO_AWS_SECRET_PREFIX"); prefix != "" {
+		s.prefix = prefix
+	}
+
+	if lambdaARN := os.Getenv("LEGO_AWS_ROTATION_LAMBDA_ARN"); lambdaARN != "" {
+		days := int64(60)
+		if value := os.Getenv("LEGO_AWS_ROTATION_DAYS"); value != "" {
+			days, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || days < 1 {
+				return nil, fmt.Errorf("LEGO_AWS_ROTATION_DAYS must be a positive number of days, got %q", value)
+			}
+		}
+		s.SetRotation(lambdaARN, days)
+	}
+	return s, nil
+}
+
+// NewStorageWithClient returns a Storage keeping the secrets through client,
+// encrypting new ones with the KMS key kmsKeyID, or with the default key of
+// the account if it is empty.
+func NewStorageWithClient(client *secretsmanager.SecretsManager, kmsKeyID string) *Storage {
+	return &Storage{client: client, prefix: defaultPrefix, kmsKeyID: kmsKeyID}
+}
+
+// SetRotation makes Save schedule the rotation of the secrets by the Lambda
+// function lambdaARN every days days, e.g. one running lego renew. An empty
+// lambdaARN leaves the rotation of the secrets unchanged.
+func (s *Storage) SetRotation(lambdaARN string, days int64) {
+	s.rotationLambdaARN = lambdaARN
+	s.rotationDays = days
+}
+
+// secretName returns the name of the secret of domain.
+func (s *Storage) secretName(domain string) string {
+	return s.prefix + strings.Replace(strings.ToLower(domain), "*", "_", -1)
+}
+
+// Save stores res as a new version of the secret of its domain, creating
+// the secret encrypted with the KMS key if it does not exist.
+func (s *Storage) Save(res acme.CertificateResource) error {
+	meta, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	value := secretValue{PrivateKey: string(res.PrivateKey), Meta: meta}
+	value.Certificate, value.Chain = splitBundle(res.Certificate)
+	secretString, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	name := s.secretName(res.Domain)
+	_, err = s.client.PutSecretValue(&secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(name),
+		SecretString: aws.String(string(secretString)),
+	})
+	if isNotFound(err) {
+		input := &secretsmanager.CreateSecretInput{
+			Name:         aws.String(name),
+			Description:  aws.String("Certificate of " + res.Domain + " obtained by lego"),
+			SecretString: aws.String(string(secretString)),
+			Tags:         []*secretsmanager.Tag{{Key: aws.String("managed-by"), Value: aws.String("lego")}},
+		}
+		if s.kmsKeyID != "" {
+			input.KmsKeyId = aws.String(s.kmsKeyID)
+		}
+		_, err = s.client.CreateSecret(input)
+	}
+	if err != nil {
+		return fmt.Errorf("AWS Secrets Manager could not save %s: %v", name, err)
+	}
+
+	return s.scheduleRotation(name)
+}
+
+// scheduleRotation sets the rotation of the secret name to the one set with
+// SetRotation, unless it is already set. The secret is not rotated right
+// away, it holds a fresh certificate.
+func (s *Storage) scheduleRotation(name string) error {
+	if s.rotationLambdaARN == "" {
+		return nil
+	}
+
+	secret, err := s.client.DescribeSecret(&secretsmanager.DescribeSecretInput{SecretId: aws.String(name)})
+	if err != nil {
+		return fmt.Errorf("AWS Secrets Manager could not describe %s: %v", name, err)
+	}
+	if aws.BoolValue(secret.RotationEnabled) && aws.StringValue(secret.RotationLambdaARN) == s.rotationLambdaARN &&
+		secret.RotationRules != nil && aws.Int64Value(secret.RotationRules.AutomaticallyAfterDays) == s.rotationDays {
+		return nil
+	}
+
+	_, err = s.client.RotateSecret(&secretsmanager.RotateSecretInput{
+		SecretId:          aws.String(name),
+		RotationLambdaARN: aws.String(s.rotationLambdaARN),
+		RotationRules:     &secretsmanager.RotationRulesType{AutomaticallyAfterDays: aws.Int64(s.rotationDays)},
+		RotateImmediately: aws.Bool(false),
+	})
+	if err != nil {
+		return fmt.Errorf("AWS Secrets Manager could not schedule the rotation of %s: %v", name, err)
+	}
+	return nil
+}
+
+// Load reads the current version of the secret of domain.
+func (s *Storage) Load(domain string) (acme.CertificateResource, error) {
+	name := s.secretName(domain)
+	out, err := s.client.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String(name)})
+	if isNotFound(err) {
+		return acme.CertificateResource{}, certstore.ErrNotFound
+	}
+	if err != nil {
+		return acme.CertificateResource{}, fmt.Errorf("AWS Secrets Manager could not load %s: %v", name, err)
+	}
+
+	var value secretValue
+	if err := json.Unmarshal([]byte(aws.StringValue(out.SecretString)), &value); err != nil {
+		return acme.CertificateResource{}, fmt.Errorf("AWS Secrets Manager secret %s holds invalid JSON: %v", name, err)
+	}
+	if value.Certificate == "" {
+		return acme.CertificateResource{}, fmt.Errorf("AWS Secrets Manager secret %s holds no certificate", name)
+	}
+
+	var res acme.CertificateResource
+	if len(value.Meta) > 0 {
+		if err := json.Unmarshal(value.Meta, &res); err != nil {
+			return acme.CertificateResource{}, fmt.Errorf("AWS Secrets Manager secret %s holds invalid metadata: %v", name, err)
+		}
+	}
+	res.Domain = domain
+	res.Certificate = []byte(value.Certificate + value.Chain)
+	if value.PrivateKey != "" {
+		res.PrivateKey = []byte(value.PrivateKey)
+	}
+	return res, nil
+}
+
+// List returns the domains of the secrets whose names start with the
+// prefix.
+func (s *Storage) List() ([]string, error) {
+	var domains []string
+	err := s.client.ListSecretsPages(&secretsmanager.ListSecretsInput{
+		Filters: []*secretsmanager.Filter{{Key: aws.String(secretsmanager.FilterNameStringTypeName), Values: []*string{aws.String(s.prefix)}}},
+	}, func(page *secretsmanager.ListSecretsOutput, lastPage bool) bool {
+		for _, secret := range page.SecretList {
+			name := aws.StringValue(secret.Name)
+			if !strings.HasPrefix(name, s.prefix) {
+				continue
+			}
+			domain := strings.TrimPrefix(name, s.prefix)
+			if strings.HasPrefix(domain, "_.") {
+				domain = "*" + domain[1:]
+			}
+			domains = append(domains, domain)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("AWS Secrets Manager could not list the secrets: %v", err)
+	}
+	return domains, nil
+}
+
+// Delete deletes the secret of domain right away, without the recovery
+// window, so a new certificate can be saved for the domain at once.
+func (s *Storage) Delete(domain string) error {
+	name := s.secretName(domain)
+	_, err := s.client.DeleteSecret(&secretsmanager.DeleteSecretInput{
+		SecretId:                   aws.String(name),
+		ForceDeleteWithoutRecovery: aws.Bool(true),
+	})
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("AWS Secrets Manager could not delete %s: %v", name, err)
+	}
+	return nil
+}
+
+// splitBundle splits a PEM bundle into the first certificate and the chain
+// following it.
+func splitBundle(bundle []byte) (certificate, chain string) {
+	block, rest := pem.Decode(bundle)
+	if block == nil {
+		return string(bundle), ""
+	}
+	return string(bundle[:len(bundle)-len(rest)]), string(rest)
+}
+
+func isNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException
+}
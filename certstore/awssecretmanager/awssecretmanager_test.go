@@ -0,0 +1,180 @@
+package awssecretmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/certstore/storagetest"
+)
+
+type fakeSecret struct {
+	KmsKeyID          string
+	SecretString      string
+	RotationLambdaARN string
+	RotationDays      int64
+}
+
+// fakeSecretsManager keeps secrets in memory and records the calls made to
+// it.
+type fakeSecretsManager struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	secrets map[string]*fakeSecret
+	calls   []string
+}
+
+func (f *fakeSecretsManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var req struct {
+		Name                       string
+		SecretId                   string
+		SecretString               string
+		KmsKeyId                   string
+		RotationLambdaARN          string
+		RotationRules              struct{ AutomaticallyAfterDays int64 }
+		ForceDeleteWithoutRecovery bool
+		Filters                    []struct {
+			Key    string
+			Values []string
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "secretsmanager.")
+	f.calls = append(f.calls, target)
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+
+	secret, ok := f.secrets[req.SecretId]
+	if !ok && target != "CreateSecret" && target != "ListSecrets" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type": "ResourceNotFoundException", "message": "Secrets Manager can't find the specified secret."}`))
+		return
+	}
+
+	var resp interface{}
+	switch target {
+	case "CreateSecret":
+		f.secrets[req.Name] = &fakeSecret{KmsKeyID: req.KmsKeyId, SecretString: req.SecretString}
+		resp = map[string]string{"Name": req.Name}
+	case "PutSecretValue":
+		secret.SecretString = req.SecretString
+		resp = map[string]string{"Name": req.SecretId}
+	case "GetSecretValue":
+		resp = map[string]string{"Name": req.SecretId, "SecretString": secret.SecretString}
+	case "DescribeSecret":
+		resp = map[string]interface{}{
+			"Name":              req.SecretId,
+			"RotationEnabled":   secret.RotationLambdaARN != "",
+			"RotationLambdaARN": secret.RotationLambdaARN,
+			"RotationRules":     map[string]int64{"AutomaticallyAfterDays": secret.RotationDays},
+		}
+	case "RotateSecret":
+		secret.RotationLambdaARN = req.RotationLambdaARN
+		secret.RotationDays = req.RotationRules.AutomaticallyAfterDays
+		resp = map[string]string{"Name": req.SecretId}
+	case "DeleteSecret":
+		assert.True(f.t, req.ForceDeleteWithoutRecovery)
+		delete(f.secrets, req.SecretId)
+		resp = map[string]string{"Name": req.SecretId}
+	case "ListSecrets":
+		var list []map[string]string
+		for name := range f.secrets {
+			if len(req.Filters) == 1 && req.Filters[0].Key == "name" && strings.HasPrefix(name, req.Filters[0].Values[0]) {
+				list = append(list, map[string]string{"Name": name})
+			}
+		}
+		resp = map[string]interface{}{"SecretList": list}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// newTestStorage returns a Storage encrypting with the KMS key lego-key and
+// talking to a fakeSecretsManager.
+func newTestStorage(t *testing.T) (*Storage, *fakeSecretsManager, func()) {
+	fake := &fakeSecretsManager{t: t, secrets: map[string]*fakeSecret{}}
+	server := httptest.NewServer(fake)
+
+	config := &aws.Config{
+		Credentials: credentials.NewStaticCredentials("abc", "123", " "),
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	}
+	return NewStorageWithClient(secretsmanager.New(session.New(config)), "lego-key"), fake, server.Close
+}
+
+func TestStorage(t *testing.T) {
+	storage, _, stop := newTestStorage(t)
+	defer stop()
+
+	storagetest.Run(t, storage)
+}
+
+func TestSaveSplitsChain(t *testing.T) {
+	storage, fake, stop := newTestStorage(t)
+	defer stop()
+
+	res := storagetest.CertificateResource(t, "*.example.com", time.Now().Add(24*time.Hour))
+	issuer := storagetest.CertificateResource(t, "Test CA", time.Now().Add(48*time.Hour))
+	leaf := res.Certificate
+	res.Certificate = append(append([]byte{}, leaf...), issuer.Certificate...)
+	require.NoError(t, storage.Save(res))
+
+	require.Contains(t, fake.secrets, "lego/_.example.com")
+	secret := fake.secrets["lego/_.example.com"]
+	assert.Equal(t, "lego-key", secret.KmsKeyID)
+
+	var value secretValue
+	require.NoError(t, json.Unmarshal([]byte(secret.SecretString), &value))
+	assert.Equal(t, string(leaf), value.Certificate)
+	assert.Equal(t, string(issuer.Certificate), value.Chain)
+	assert.Equal(t, string(res.PrivateKey), value.PrivateKey)
+
+	domains, err := storage.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*.example.com"}, domains)
+
+	loaded, err := storage.Load("*.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, res.Certificate, loaded.Certificate)
+}
+
+func TestSaveSchedulesRotation(t *testing.T) {
+	storage, fake, stop := newTestStorage(t)
+	defer stop()
+
+	lambdaARN := "arn:aws:lambda:us-east-1:123456789012:function:lego-renew"
+	storage.SetRotation(lambdaARN, 30)
+
+	res := storagetest.CertificateResource(t, "example.com", time.Now().Add(24*time.Hour))
+	require.NoError(t, storage.Save(res))
+	require.NoError(t, storage.Save(res))
+
+	secret := fake.secrets["lego/example.com"]
+	assert.Equal(t, lambdaARN, secret.RotationLambdaARN)
+	assert.EqualValues(t, 30, secret.RotationDays)
+	assert.Equal(t, []string{
+		"PutSecretValue", "CreateSecret", "DescribeSecret", "RotateSecret",
+		"PutSecretValue", "DescribeSecret",
+	}, fake.calls)
+}
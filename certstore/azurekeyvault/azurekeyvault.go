@@ -0,0 +1,312 @@
+//go:build lego_azurekeyvault
+// +build lego_azurekeyvault
+
+// Package azurekeyvault implements a certstore.Storage keeping certificates
+// as Azure Key Vault certificate objects, which App Service, Application
+// Gateway or Front Door can then use directly.
+//
+// It is only built with the lego_azurekeyvault tag, see package certstore.
+package azurekeyvault
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azcertificates"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/certstore"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// pfxContentType is the content type of the secret backing a certificate
+// imported as PKCS#12.
+const pfxContentType = "application/x-pkcs12"
+
+// maxNameLength is the longest name Key Vault accepts for an object.
+const maxNameLength = 127
+
+// The tags of a certificate object holding the metadata of the certificate.
+// Object names cannot hold dots, so the domain is kept as well.
+const (
+	domainTag        = "lego-domain"
+	certURLTag       = "lego-cert-url"
+	certStableURLTag = "lego-cert-stable-url"
+	accountRefTag    = "lego-account-ref"
+)
+
+var (
+	// pollInterval is the time between two attempts to import a
+	// certificate whose object is being recovered. It is overridden during
+	// tests.
+	pollInterval = 2 * time.Second
+	// pollTimeout is the time Save waits for the recovery of a deleted
+	// certificate object.
+	pollTimeout = 2 * time.Minute
+)
+
+// Storage is an implementation of the certstore.Storage interface that
+// keeps the certificate of a domain in the certificate object
+// lego-<domain>-<hash>, whose dots become dashes and whose wildcard is
+// spelled out. The hash of the domain tells apart e.g. my-site.com and
+// my.site.com, which would otherwise share an object.
+//
+// Key Vault only accepts certificates together with their private key, so
+// certificates obtained for a CSR cannot be saved. The private key is read
+// back from the secret Key Vault keeps for every certificate object, which
+// needs the Get permission on secrets besides the Get, List, Import,
+// Delete and Recover permissions on certificates.
+type Storage struct {
+	certificates *azcertificates.Client
+	secrets      *azsecrets.Client
+}
+
+// NewStorage returns a Storage using the vault at AZURE_KEYVAULT_URL, e.g.
+// https://lego.vault.azure.net/. It authenticates as the service principal
+// AZURE_CLIENT_ID of the tenant AZURE_TENANT_ID with AZURE_CLIENT_SECRET, or
+// without AZURE_CLIENT_SECRET as the managed identity of the machine, the
+// user-assigned one AZURE_CLIENT_ID if it is set.
+func NewStorage() (*Storage, error) {
+	vaultURL := os.Getenv("AZURE_KEYVAULT_URL")
+	if vaultURL == "" {
+		return nil, fmt.Errorf("Azure Key Vault credentials missing: AZURE_KEYVAULT_URL")
+	}
+
+	var credential azcore.TokenCredential
+	var err error
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	if clientSecret := os.Getenv("AZURE_CLIENT_SECRET"); clientSecret != "" {
+		credential, err = azidentity.NewClientSecretCredential(os.Getenv("AZURE_TENANT_ID"), clientID, clientSecret, nil)
+	} else {
+		options := &azidentity.ManagedIdentityCredentialOptions{}
+		if clientID != "" {
+			options.ID = azidentity.ClientID(clientID)
+		}
+		credential, err = azidentity.NewManagedIdentityCredential(options)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Azure Key Vault credentials could not be created: %v", err)
+	}
+
+	certificates, err := azcertificates.NewClient(vaultURL, credential, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Azure Key Vault client could not be created: %v", err)
+	}
+	secrets, err := azsecrets.NewClient(vaultURL, credential, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Azure Key Vault client could not be created: %v", err)
+	}
+	return NewStorageWithClients(certificates, secrets), nil
+}
+
+// NewStorageWithClients returns a Storage using the certificates and secrets
+// clients of the same vault.
+func NewStorageWithClients(certificates *azcertificates.Client, secrets *azsecrets.Client) *Storage {
+	return &Storage{certificates: certificates, secrets: secrets}
+}
+
+// certificateName returns the name of the certificate object of domain. A
+// readable part too long for Key Vault is cut off, the hash keeps the name
+// unique.
+func certificateName(domain string) string {
+	domain = strings.ToLower(domain)
+	sum := sha256.Sum256([]byte(domain))
+	suffix := "-" + hex.EncodeToString(sum[:8])
+
+	readable := "lego-" + strings.Replace(strings.Replace(domain, "*", "wildcard", -1), ".", "-", -1)
+	if len(readable) > maxNameLength-len(suffix) {
+		readable = readable[:maxNameLength-len(suffix)]
+	}
+	return readable + suffix
+}
+
+// Save imports res as a new version of the certificate object of its
+// domain. A deleted object is recovered first.
+func (s *Storage) Save(res acme.CertificateResource) error {
+	if res.PrivateKey == nil {
+		return fmt.Errorf("Azure Key Vault cannot store the certificate of %s without its private key", res.Domain)
+	}
+	key, err := parsePrivateKey(res.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("Azure Key Vault could not read the private key of %s: %v", res.Domain, err)
+	}
+	pfx, err := acme.ToPKCS12(res.Certificate, key, "")
+	if err != nil {
+		return fmt.Errorf("Azure Key Vault could not convert the certificate of %s to PKCS#12: %v", res.Domain, err)
+	}
+
+	value, password, contentType := base64.StdEncoding.EncodeToString(pfx), "", pfxContentType
+	params := azcertificates.ImportCertificateParameters{
+		Base64EncodedCertificate: &value,
+		Password:                 &password,
+		CertificatePolicy: &azcertificates.CertificatePolicy{
+			SecretProperties: &azcertificates.SecretProperties{ContentType: &contentType},
+		},
+		Tags: map[string]*string{
+			domainTag:        &res.Domain,
+			certURLTag:       &res.CertURL,
+			certStableURLTag: &res.CertStableURL,
+			accountRefTag:    &res.AccountRef,
+		},
+	}
+
+	ctx := context.Background()
+	name := certificateName(res.Domain)
+	for start := time.Now(); ; time.Sleep(pollInterval) {
+		_, err = s.certificates.ImportCertificate(ctx, name, params, nil)
+		if !hasStatus(err, http.StatusConflict) || time.Since(start) > pollTimeout {
+			break
+		}
+
+		// The object is deleted but recoverable, or still being deleted
+		// or recovered.
+		_, err = s.certificates.RecoverDeletedCertificate(ctx, name, nil)
+		if err != nil && !hasStatus(err, http.StatusNotFound) && !hasStatus(err, http.StatusConflict) {
+			return fmt.Errorf("Azure Key Vault could not recover %s: %v", name, err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Azure Key Vault could not import %s: %v", name, err)
+	}
+	return nil
+}
+
+// Load reads the latest version of the certificate object of domain and its
+// private key. An object whose domain tag names another domain is rejected.
+func (s *Storage) Load(domain string) (acme.CertificateResource, error) {
+	ctx := context.Background()
+	name := certificateName(domain)
+
+	cert, err := s.certificates.GetCertificate(ctx, name, "", nil)
+	if hasStatus(err, http.StatusNotFound) {
+		return acme.CertificateResource{}, certstore.ErrNotFound
+	}
+	if err != nil {
+		return acme.CertificateResource{}, fmt.Errorf("Azure Key Vault could not get %s: %v", name, err)
+	}
+	if owner := tag(cert.Tags, domainTag); !strings.EqualFold(owner, domain) {
+		return acme.CertificateResource{}, fmt.Errorf("Azure Key Vault certificate %s belongs to %q, not %s", name, owner, domain)
+	}
+	if cert.SID == nil {
+		return acme.CertificateResource{}, fmt.Errorf("Azure Key Vault certificate %s has no secret", name)
+	}
+
+	secret, err := s.secrets.GetSecret(ctx, name, cert.SID.Version(), nil)
+	if err != nil {
+		return acme.CertificateResource{}, fmt.Errorf("Azure Key Vault could not get the secret of %s: %v", name, err)
+	}
+	if secret.ContentType == nil || *secret.ContentType != pfxContentType || secret.Value == nil {
+		return acme.CertificateResource{}, fmt.Errorf("Azure Key Vault secret of %s does not hold a PKCS#12 archive", name)
+	}
+	pfx, err := base64.StdEncoding.DecodeString(*secret.Value)
+	if err != nil {
+		return acme.CertificateResource{}, fmt.Errorf("Azure Key Vault secret of %s is not base64 encoded: %v", name, err)
+	}
+	key, leaf, chain, err := pkcs12.DecodeChain(pfx, "")
+	if err != nil {
+		return acme.CertificateResource{}, fmt.Errorf("Azure Key Vault secret of %s holds an invalid PKCS#12 archive: %v", name, err)
+	}
+
+	res := acme.CertificateResource{
+		Domain:        domain,
+		CertURL:       tag(cert.Tags, certURLTag),
+		CertStableURL: tag(cert.Tags, certStableURLTag),
+		AccountRef:    tag(cert.Tags, accountRefTag),
+	}
+	for _, c := range append([]*x509.Certificate{leaf}, chain...) {
+		res.Certificate = append(res.Certificate, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	if res.PrivateKey, err = encodePrivateKey(key); err != nil {
+		return acme.CertificateResource{}, fmt.Errorf("Azure Key Vault secret of %s holds an unsupported private key: %v", name, err)
+	}
+	return res, nil
+}
+
+// List returns the domains of the certificate objects tagged by Save.
+func (s *Storage) List() ([]string, error) {
+	var domains []string
+	pager := s.certificates.NewListCertificatePropertiesPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("Azure Key Vault could not list the certificates: %v", err)
+		}
+
+		for _, cert := range page.Value {
+			domain := tag(cert.Tags, domainTag)
+			if domain != "" && cert.ID != nil && cert.ID.Name() == certificateName(domain) {
+				domains = append(domains, domain)
+			}
+		}
+	}
+	return domains, nil
+}
+
+// Delete deletes the certificate object of domain. It remains recoverable
+// for the retention period of the vault.
+func (s *Storage) Delete(domain string) error {
+	name := certificateName(domain)
+	_, err := s.certificates.DeleteCertificate(context.Background(), name, nil)
+	if err != nil && !hasStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("Azure Key Vault could not delete %s: %v", name, err)
+	}
+	return nil
+}
+
+func tag(tags map[string]*string, name string) string {
+	if value := tags[name]; value != nil {
+		return *value
+	}
+	return ""
+}
+
+func hasStatus(err error, statusCode int) bool {
+	respErr, ok := err.(*azcore.ResponseError)
+	return ok && respErr.StatusCode == statusCode
+}
+
+func parsePrivateKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+}
+
+// encodePrivateKey encodes key in the PEM format lego writes keys in.
+func encodePrivateKey(key interface{}) ([]byte, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), nil
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	default:
+		return nil, fmt.Errorf("%T", key)
+	}
+}
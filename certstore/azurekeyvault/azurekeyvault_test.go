@@ -0,0 +1,260 @@
+//go:build lego_azurekeyvault
+// +build lego_azurekeyvault
+
+package azurekeyvault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azcertificates"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/certstore"
+	"github.com/xenolf/lego/certstore/storagetest"
+)
+
+type fakeCredential struct{}
+
+func (fakeCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+type fakeVersion struct {
+	Value       string
+	ContentType string
+	Tags        map[string]string
+}
+
+type fakeCertificate struct {
+	Versions []fakeVersion
+	Deleted  bool
+}
+
+// fakeKeyVault serves the certificates and secrets API of a vault, keeping
+// the imported certificates in memory. Deleted certificates stay until they
+// are recovered, like in a vault with soft-delete.
+type fakeKeyVault struct {
+	mu           sync.Mutex
+	url          string
+	certificates map[string]*fakeCertificate
+}
+
+func (f *fakeKeyVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.Header().Set("WWW-Authenticate", `Bearer authorization="https://login.microsoftonline.com/tenant", resource="https://vault.azure.net"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var cert *fakeCertificate
+	if len(parts) > 1 {
+		cert = f.certificates[parts[1]]
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "certificates":
+		var list []map[string]interface{}
+		for name, cert := range f.certificates {
+			if !cert.Deleted {
+				list = append(list, f.certificate(name, len(cert.Versions), cert.Versions[len(cert.Versions)-1]))
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": list})
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "certificates" && parts[2] == "import":
+		var req struct {
+			Value  string
+			Pwd    *string
+			Policy struct {
+				SecretProps struct{ ContentType string } `json:"secret_props"`
+			}
+			Tags map[string]string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Pwd == nil {
+			http.Error(w, `{"error": {"code": "BadParameter"}}`, http.StatusBadRequest)
+			return
+		}
+		if cert != nil && cert.Deleted {
+			http.Error(w, `{"error": {"code": "Conflict", "message": "Certificate is currently in a deleted but recoverable state."}}`, http.StatusConflict)
+			return
+		}
+		if cert == nil {
+			cert = &fakeCertificate{}
+			f.certificates[parts[1]] = cert
+		}
+		version := fakeVersion{Value: req.Value, ContentType: req.Policy.SecretProps.ContentType, Tags: req.Tags}
+		cert.Versions = append(cert.Versions, version)
+		json.NewEncoder(w).Encode(f.certificate(parts[1], len(cert.Versions), version))
+	case r.Method == http.MethodGet && len(parts) >= 2 && parts[0] == "certificates" && cert != nil && !cert.Deleted:
+		json.NewEncoder(w).Encode(f.certificate(parts[1], len(cert.Versions), cert.Versions[len(cert.Versions)-1]))
+	case r.Method == http.MethodDelete && len(parts) == 2 && parts[0] == "certificates" && cert != nil && !cert.Deleted:
+		cert.Deleted = true
+		json.NewEncoder(w).Encode(map[string]string{"id": f.url + "/certificates/" + parts[1]})
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "deletedcertificates" && cert != nil && cert.Deleted:
+		cert.Deleted = false
+		json.NewEncoder(w).Encode(f.certificate(parts[1], len(cert.Versions), cert.Versions[len(cert.Versions)-1]))
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "secrets" && cert != nil && !cert.Deleted:
+		var n int
+		fmt.Sscanf(parts[2], "v%d", &n)
+		if n < 1 || n > len(cert.Versions) {
+			http.Error(w, `{"error": {"code": "SecretNotFound"}}`, http.StatusNotFound)
+			return
+		}
+		version := cert.Versions[n-1]
+		json.NewEncoder(w).Encode(map[string]string{
+			"id":          fmt.Sprintf("%s/secrets/%s/v%d", f.url, parts[1], n),
+			"value":       version.Value,
+			"contentType": version.ContentType,
+		})
+	default:
+		http.Error(w, `{"error": {"code": "CertificateNotFound"}}`, http.StatusNotFound)
+	}
+}
+
+func (f *fakeKeyVault) certificate(name string, n int, version fakeVersion) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   fmt.Sprintf("%s/certificates/%s/v%d", f.url, name, n),
+		"sid":  fmt.Sprintf("%s/secrets/%s/v%d", f.url, name, n),
+		"tags": version.Tags,
+	}
+}
+
+// newTestStorage returns a Storage talking to a fakeKeyVault.
+func newTestStorage(t *testing.T) (*Storage, *fakeKeyVault, func()) {
+	fake := &fakeKeyVault{certificates: map[string]*fakeCertificate{}}
+	server := httptest.NewTLSServer(fake)
+	fake.url = server.URL
+
+	clientOptions := azcore.ClientOptions{Transport: server.Client()}
+	certificates, err := azcertificates.NewClient(server.URL, fakeCredential{}, &azcertificates.ClientOptions{
+		ClientOptions:                        clientOptions,
+		DisableChallengeResourceVerification: true,
+	})
+	require.NoError(t, err)
+	secrets, err := azsecrets.NewClient(server.URL, fakeCredential{}, &azsecrets.ClientOptions{
+		ClientOptions:                        clientOptions,
+		DisableChallengeResourceVerification: true,
+	})
+	require.NoError(t, err)
+
+	return NewStorageWithClients(certificates, secrets), fake, server.Close
+}
+
+func TestStorage(t *testing.T) {
+	storage, fake, stop := newTestStorage(t)
+	defer stop()
+
+	first := storagetest.CertificateResource(t, "example.com", time.Now().Add(24*time.Hour))
+	issuer := storagetest.CertificateResource(t, "Test CA", time.Now().Add(48*time.Hour))
+	first.Certificate = append(first.Certificate, issuer.Certificate...)
+	second := storagetest.CertificateResource(t, "*.example.org", time.Now().Add(48*time.Hour))
+
+	_, err := storage.Load("example.com")
+	assert.Equal(t, certstore.ErrNotFound, err)
+
+	require.NoError(t, storage.Save(first))
+	require.NoError(t, storage.Save(second))
+	require.Contains(t, fake.certificates, certificateName("*.example.org"))
+
+	loaded, err := storage.Load("example.com")
+	require.NoError(t, err)
+	assert.Equal(t, first, loaded)
+
+	domains, err := storage.List()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"example.com", "*.example.org"}, domains)
+
+	require.NoError(t, storage.Delete("example.com"))
+	_, err = storage.Load("example.com")
+	assert.Equal(t, certstore.ErrNotFound, err)
+	require.NoError(t, storage.Delete("example.com"))
+
+	domains, err = storage.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*.example.org"}, domains)
+}
+
+func TestSaveRecoversDeletedCertificate(t *testing.T) {
+	storage, fake, stop := newTestStorage(t)
+	defer stop()
+
+	savedInterval := pollInterval
+	defer func() { pollInterval = savedInterval }()
+	pollInterval = time.Millisecond
+
+	res := storagetest.CertificateResource(t, "example.com", time.Now().Add(24*time.Hour))
+	require.NoError(t, storage.Save(res))
+	require.NoError(t, storage.Delete("example.com"))
+
+	replaced := storagetest.CertificateResource(t, "example.com", time.Now().Add(72*time.Hour))
+	require.NoError(t, storage.Save(replaced))
+	assert.Len(t, fake.certificates[certificateName("example.com")].Versions, 2)
+
+	loaded, err := storage.Load("example.com")
+	require.NoError(t, err)
+	assert.Equal(t, replaced, loaded)
+}
+
+func TestSaveWithoutPrivateKey(t *testing.T) {
+	storage, fake, stop := newTestStorage(t)
+	defer stop()
+
+	res := storagetest.CertificateResource(t, "example.com", time.Now().Add(24*time.Hour))
+	res.PrivateKey = nil
+	assert.EqualError(t, storage.Save(res), "Azure Key Vault cannot store the certificate of example.com without its private key")
+	assert.Empty(t, fake.certificates)
+}
+
+func TestCertificateName(t *testing.T) {
+	assert.Regexp(t, "^lego-wildcard-example-org-[0-9a-f]{16}$", certificateName("*.example.org"))
+	assert.Equal(t, certificateName("example.com"), certificateName("Example.com"))
+	assert.NotEqual(t, certificateName("my-site.com"), certificateName("my.site.com"))
+	assert.NotEqual(t, certificateName("wildcard.example.org"), certificateName("*.example.org"))
+
+	long := strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + ".example.com"
+	assert.Len(t, certificateName(long), maxNameLength)
+	assert.NotEqual(t, certificateName(long), certificateName(long+"."))
+}
+
+func TestSimilarDomains(t *testing.T) {
+	storage, fake, stop := newTestStorage(t)
+	defer stop()
+
+	dashed := storagetest.CertificateResource(t, "my-site.com", time.Now().Add(24*time.Hour))
+	dotted := storagetest.CertificateResource(t, "my.site.com", time.Now().Add(48*time.Hour))
+	require.NoError(t, storage.Save(dashed))
+	require.NoError(t, storage.Save(dotted))
+	assert.Len(t, fake.certificates, 2)
+
+	loaded, err := storage.Load("my-site.com")
+	require.NoError(t, err)
+	assert.Equal(t, dashed, loaded)
+	loaded, err = storage.Load("my.site.com")
+	require.NoError(t, err)
+	assert.Equal(t, dotted, loaded)
+
+	domains, err := storage.List()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"my-site.com", "my.site.com"}, domains)
+
+	// An object of another domain is not returned as the certificate of
+	// the requested one.
+	fake.certificates[certificateName("my.site.com")] = fake.certificates[certificateName("my-site.com")]
+	_, err = storage.Load("my.site.com")
+	assert.EqualError(t, err, `Azure Key Vault certificate `+certificateName("my.site.com")+` belongs to "my-site.com", not my.site.com`)
+}
@@ -0,0 +1,100 @@
+package certstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+)
+
+// timeNow returns the current time. It is overridden during tests.
+var timeNow = time.Now
+
+type cacheEntry struct {
+	res     acme.CertificateResource
+	err     error
+	expires time.Time
+}
+
+// CachingStorage wraps a Storage and keeps the results of Load in memory for
+// CacheTTL, so e.g. the GetCertificate callback of a TLS server does not ask
+// the backend on every handshake. A missing certificate is cached as well,
+// other errors are not.
+//
+// Save and Delete invalidate the entry of their domain. Changes made to the
+// backend by others, e.g. another machine renewing the certificate, are seen
+// once the entry expired or was invalidated with Invalidate.
+//
+// The loaded resources are shared between the callers of Load and must not
+// be modified.
+type CachingStorage struct {
+	// CacheTTL is the time a loaded certificate is served from memory. A
+	// CacheTTL of zero disables the cache.
+	CacheTTL time.Duration
+
+	storage Storage
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// invalidations counts the calls of Invalidate, so Load does not cache
+	// a certificate which was replaced while it was loading.
+	invalidations uint64
+}
+
+// NewCachingStorage returns a CachingStorage caching the certificates loaded
+// from storage for ttl.
+func NewCachingStorage(storage Storage, ttl time.Duration) *CachingStorage {
+	return &CachingStorage{CacheTTL: ttl, storage: storage, entries: map[string]cacheEntry{}}
+}
+
+// Save stores res in the wrapped storage and invalidates the cached
+// certificate of its domain.
+func (s *CachingStorage) Save(res acme.CertificateResource) error {
+	defer s.Invalidate(res.Domain)
+	return s.storage.Save(res)
+}
+
+// Load returns the cached certificate of domain, loading it from the
+// wrapped storage if it is not cached or its entry expired.
+func (s *CachingStorage) Load(domain string) (acme.CertificateResource, error) {
+	now := timeNow()
+
+	s.mu.Lock()
+	entry, ok := s.entries[domain]
+	invalidations := s.invalidations
+	s.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.res, entry.err
+	}
+
+	res, err := s.storage.Load(domain)
+	if s.CacheTTL > 0 && (err == nil || err == ErrNotFound) {
+		s.mu.Lock()
+		if s.invalidations == invalidations {
+			s.entries[domain] = cacheEntry{res: res, err: err, expires: now.Add(s.CacheTTL)}
+		}
+		s.mu.Unlock()
+	}
+	return res, err
+}
+
+// List returns the domains of the wrapped storage. It is not cached.
+func (s *CachingStorage) List() ([]string, error) {
+	return s.storage.List()
+}
+
+// Delete removes the certificate of domain from the wrapped storage and
+// invalidates its cached certificate.
+func (s *CachingStorage) Delete(domain string) error {
+	defer s.Invalidate(domain)
+	return s.storage.Delete(domain)
+}
+
+// Invalidate drops the cached certificate of domain, so the next Load reads
+// it from the wrapped storage.
+func (s *CachingStorage) Invalidate(domain string) {
+	s.mu.Lock()
+	delete(s.entries, domain)
+	s.invalidations++
+	s.mu.Unlock()
+}
@@ -0,0 +1,117 @@
+package certstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+// memoryStorage keeps certificates in a map and counts the calls of Load.
+type memoryStorage struct {
+	resources map[string]acme.CertificateResource
+	loads     int
+	err       error
+}
+
+func (m *memoryStorage) Save(res acme.CertificateResource) error {
+	m.resources[res.Domain] = res
+	return nil
+}
+
+func (m *memoryStorage) Load(domain string) (acme.CertificateResource, error) {
+	m.loads++
+	if m.err != nil {
+		return acme.CertificateResource{}, m.err
+	}
+	res, ok := m.resources[domain]
+	if !ok {
+		return acme.CertificateResource{}, ErrNotFound
+	}
+	return res, nil
+}
+
+func (m *memoryStorage) List() ([]string, error) {
+	var domains []string
+	for domain := range m.resources {
+		domains = append(domains, domain)
+	}
+	return domains, nil
+}
+
+func (m *memoryStorage) Delete(domain string) error {
+	delete(m.resources, domain)
+	return nil
+}
+
+func TestCachingStorage(t *testing.T) {
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return now }
+
+	backend := &memoryStorage{resources: map[string]acme.CertificateResource{}}
+	storage := NewCachingStorage(backend, time.Minute)
+
+	_, err := storage.Load("example.com")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = storage.Load("example.com")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, 1, backend.loads, "a missing certificate is cached")
+
+	first := acme.CertificateResource{Domain: "example.com", Certificate: []byte("first")}
+	require.NoError(t, storage.Save(first))
+	res, err := storage.Load("example.com")
+	require.NoError(t, err)
+	assert.Equal(t, first, res)
+	assert.Equal(t, 2, backend.loads, "Save invalidates the entry")
+
+	// Changed behind the back of the cache.
+	backend.resources["example.com"] = acme.CertificateResource{Domain: "example.com", Certificate: []byte("second")}
+	now = now.Add(59 * time.Second)
+	res, err = storage.Load("example.com")
+	require.NoError(t, err)
+	assert.Equal(t, first, res)
+	assert.Equal(t, 2, backend.loads)
+
+	now = now.Add(time.Second)
+	res, err = storage.Load("example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("second"), res.Certificate)
+	assert.Equal(t, 3, backend.loads, "an expired entry is loaded again")
+
+	storage.Invalidate("example.com")
+	_, err = storage.Load("example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 4, backend.loads)
+
+	require.NoError(t, storage.Delete("example.com"))
+	_, err = storage.Load("example.com")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, 5, backend.loads, "Delete invalidates the entry")
+}
+
+func TestCachingStorageErrorsNotCached(t *testing.T) {
+	backend := &memoryStorage{resources: map[string]acme.CertificateResource{}, err: errors.New("backend down")}
+	storage := NewCachingStorage(backend, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		_, err := storage.Load("example.com")
+		assert.EqualError(t, err, "backend down")
+	}
+	assert.Equal(t, 2, backend.loads)
+}
+
+func TestCachingStorageZeroTTL(t *testing.T) {
+	backend := &memoryStorage{resources: map[string]acme.CertificateResource{}}
+	storage := NewCachingStorage(backend, 0)
+
+	require.NoError(t, storage.Save(acme.CertificateResource{Domain: "example.com"}))
+	for i := 0; i < 2; i++ {
+		_, err := storage.Load("example.com")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, backend.loads)
+}
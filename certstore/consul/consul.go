@@ -0,0 +1,216 @@
+//go:build lego_consul
+// +build lego_consul
+
+// Package consul implements a certstore.Storage keeping certificates in the
+// Consul KV store, e.g. for services scheduled by Nomad.
+//
+// It is only built with the lego_consul tag, see package certstore.
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/certstore"
+)
+
+// The keys below <prefix>/<domain>/ holding a certificate. They are separate
+// so templates, e.g. of consul-template or Nomad, can render the PEM files
+// directly.
+const (
+	certificateKey = "certificate"
+	privateKeyKey  = "privateKey"
+	metaKey        = "meta"
+)
+
+// Storage is an implementation of the certstore.Storage interface that
+// keeps the certificates below a prefix of the Consul KV store.
+type Storage struct {
+	kv     *api.KV
+	prefix string
+}
+
+// NewStorage returns a Storage keeping the certificates below prefix. The
+// Consul client is configured from the environment, like the consul
+// command: CONSUL_HTTP_ADDR names the agent and CONSUL_HTTP_TOKEN holds the
+// ACL token, which needs write access to the prefix.
+func NewStorage(prefix string) (*Storage, error) {
+	return NewStorageWithConfig(prefix, api.DefaultConfig())
+}
+
+// NewStorageWithConfig is like NewStorage but uses the given Consul client
+// configuration.
+func NewStorageWithConfig(prefix string, config *api.Config) (*Storage, error) {
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Consul client could not be created: %v", err)
+	}
+
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &Storage{kv: client.KV(), prefix: prefix}, nil
+}
+
+// Save writes the keys of res in one transaction, so readers never see the
+// certificate of one and the private key of another.
+func (s *Storage) Save(res acme.CertificateResource) error {
+	meta, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	dir := s.prefix + res.Domain + "/"
+	ops := api.KVTxnOps{
+		{Verb: api.KVSet, Key: dir + certificateKey, Value: res.Certificate},
+		{Verb: api.KVSet, Key: dir + metaKey, Value: meta},
+	}
+	if res.PrivateKey != nil {
+		ops = append(ops, &api.KVTxnOp{Verb: api.KVSet, Key: dir + privateKeyKey, Value: res.PrivateKey})
+	} else {
+		ops = append(ops, &api.KVTxnOp{Verb: api.KVDelete, Key: dir + privateKeyKey})
+	}
+
+	ok, resp, _, err := s.kv.Txn(ops, nil)
+	if err != nil {
+		return fmt.Errorf("Consul could not save the certificate of %s: %v", res.Domain, err)
+	}
+	if !ok {
+		return fmt.Errorf("Consul rolled back saving the certificate of %s: %v", res.Domain, resp.Errors)
+	}
+	return nil
+}
+
+// Load reads the keys of the certificate of domain.
+func (s *Storage) Load(domain string) (acme.CertificateResource, error) {
+	pairs, _, err := s.kv.List(s.prefix+domain+"/", nil)
+	if err != nil {
+		return acme.CertificateResource{}, fmt.Errorf("Consul could not load the certificate of %s: %v", domain, err)
+	}
+	return s.parse(domain, pairs)
+}
+
+// parse assembles the certificate of domain from the pairs below its key.
+func (s *Storage) parse(domain string, pairs api.KVPairs) (acme.CertificateResource, error) {
+	var res acme.CertificateResource
+	found := false
+	for _, pair := range pairs {
+		switch pair.Key {
+		case s.prefix + domain + "/" + certificateKey:
+			res.Certificate = pair.Value
+			found = true
+		case s.prefix + domain + "/" + privateKeyKey:
+			res.PrivateKey = pair.Value
+		}
+	}
+	if !found {
+		return acme.CertificateResource{}, certstore.ErrNotFound
+	}
+
+	for _, pair := range pairs {
+		if pair.Key != s.prefix+domain+"/"+metaKey {
+			continue
+		}
+		if err := json.Unmarshal(pair.Value, &res); err != nil {
+			return acme.CertificateResource{}, fmt.Errorf("Consul holds invalid metadata for %s: %v", domain, err)
+		}
+	}
+	res.Domain = domain
+	return res, nil
+}
+
+// List returns the domains of the keys right below the prefix.
+func (s *Storage) List() ([]string, error) {
+	keys, _, err := s.kv.Keys(s.prefix, "/", nil)
+	if err != nil {
+		return nil, fmt.Errorf("Consul could not list the certificates: %v", err)
+	}
+
+	var domains []string
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") {
+			domains = append(domains, strings.TrimSuffix(strings.TrimPrefix(key, s.prefix), "/"))
+		}
+	}
+	return domains, nil
+}
+
+// Delete removes all keys of the certificate of domain.
+func (s *Storage) Delete(domain string) error {
+	if _, err := s.kv.DeleteTree(s.prefix+domain+"/", nil); err != nil {
+		return fmt.Errorf("Consul could not delete the certificate of %s: %v", domain, err)
+	}
+	return nil
+}
+
+// Watch calls renew with the domain of every stored certificate expiring
+// within renewBefore. It checks the certificates whenever a key below the
+// prefix changes, using a blocking query, and at the latest when the query
+// times out after Consul's default wait time of five minutes. renew is
+// called on every check until the certificate was replaced, so it should
+// only start a renewal that is not already running.
+//
+// Watch returns nil once stop is closed, or the first error of a query.
+func (s *Storage) Watch(renewBefore time.Duration, renew func(domain string), stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var index uint64
+	for {
+		opts := &api.QueryOptions{WaitIndex: index}
+		pairs, meta, err := s.kv.List(s.prefix, opts.WithContext(ctx))
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Consul could not watch the certificates: %v", err)
+		}
+
+		// The index may go backwards, e.g. after a restore of a snapshot.
+		index = meta.LastIndex
+		if index < opts.WaitIndex {
+			index = 0
+		}
+
+		for _, domain := range s.expiring(pairs, renewBefore) {
+			renew(domain)
+		}
+	}
+}
+
+// expiring returns the domains of the certificates in pairs expiring within
+// renewBefore. Certificates which do not parse are skipped.
+func (s *Storage) expiring(pairs api.KVPairs, renewBefore time.Duration) []string {
+	var domains []string
+	for _, pair := range pairs {
+		if !strings.HasSuffix(pair.Key, "/"+certificateKey) {
+			continue
+		}
+		domain := strings.TrimSuffix(strings.TrimPrefix(pair.Key, s.prefix), "/"+certificateKey)
+		if strings.Contains(domain, "/") {
+			continue
+		}
+
+		notAfter, err := acme.GetPEMCertExpiration(pair.Value)
+		if err != nil {
+			continue
+		}
+		if notAfter.Sub(time.Now()) < renewBefore {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
@@ -0,0 +1,225 @@
+//go:build lego_consul
+// +build lego_consul
+
+package consul
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/certstore/storagetest"
+)
+
+// fakeConsul serves the parts of the Consul KV and transaction API used by
+// Storage, requiring the ACL token token.
+type fakeConsul struct {
+	token string
+
+	mu      sync.Mutex
+	kv      map[string][]byte
+	index   uint64
+	changed chan struct{}
+}
+
+func newFakeConsul(token string) *httptest.Server {
+	f := &fakeConsul{token: token, kv: map[string][]byte{}, index: 1, changed: make(chan struct{})}
+	return httptest.NewServer(f)
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != f.token {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v1/txn" && r.Method == "PUT":
+		f.txn(w, r)
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/") && r.Method == "GET":
+		f.get(w, r, strings.TrimPrefix(r.URL.Path, "/v1/kv/"))
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/") && r.Method == "DELETE":
+		f.update(func() {
+			for key := range f.kv {
+				if strings.HasPrefix(key, strings.TrimPrefix(r.URL.Path, "/v1/kv/")) {
+					delete(f.kv, key)
+				}
+			}
+		})
+		w.Write([]byte("true"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeConsul) txn(w http.ResponseWriter, r *http.Request) {
+	var ops []struct {
+		KV api.KVTxnOp
+	}
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.update(func() {
+		for _, op := range ops {
+			switch op.KV.Verb {
+			case api.KVSet:
+				f.kv[op.KV.Key] = op.KV.Value
+			case api.KVDelete:
+				delete(f.kv, op.KV.Key)
+			}
+		}
+	})
+	w.Write([]byte(`{"Results":[],"Errors":null}`))
+}
+
+// update runs change and wakes up the blocking queries.
+func (f *fakeConsul) update(change func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	change()
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) get(w http.ResponseWriter, r *http.Request, prefix string) {
+	query := r.URL.Query()
+
+	f.mu.Lock()
+	if waitIndex, _ := strconv.ParseUint(query.Get("index"), 10, 64); waitIndex >= f.index {
+		changed := f.changed
+		f.mu.Unlock()
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		f.mu.Lock()
+	}
+	defer f.mu.Unlock()
+
+	var keys []string
+	seen := map[string]bool{}
+	for key := range f.kv {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if _, ok := query["keys"]; ok {
+			rest := key[len(prefix):]
+			if i := strings.Index(rest, query.Get("separator")); query.Get("separator") != "" && i >= 0 {
+				key = prefix + rest[:i+1]
+			}
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if _, ok := query["keys"]; ok {
+		json.NewEncoder(w).Encode(keys)
+		return
+	}
+	var pairs api.KVPairs
+	for _, key := range keys {
+		pairs = append(pairs, &api.KVPair{Key: key, Value: f.kv[key], ModifyIndex: f.index})
+	}
+	json.NewEncoder(w).Encode(pairs)
+}
+
+func TestStorage(t *testing.T) {
+	ts := newFakeConsul("secret")
+	defer ts.Close()
+
+	defer os.Setenv("CONSUL_HTTP_ADDR", os.Getenv("CONSUL_HTTP_ADDR"))
+	defer os.Setenv("CONSUL_HTTP_TOKEN", os.Getenv("CONSUL_HTTP_TOKEN"))
+	os.Setenv("CONSUL_HTTP_ADDR", ts.URL)
+	os.Setenv("CONSUL_HTTP_TOKEN", "secret")
+
+	storage, err := NewStorage("/lego/certificates/")
+	require.NoError(t, err)
+
+	storagetest.Run(t, storage)
+}
+
+func TestStorageWithoutToken(t *testing.T) {
+	ts := newFakeConsul("secret")
+	defer ts.Close()
+
+	storage, err := NewStorageWithConfig("lego", &api.Config{Address: ts.URL})
+	require.NoError(t, err)
+
+	_, err = storage.List()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "403")
+}
+
+func TestWatch(t *testing.T) {
+	ts := newFakeConsul("")
+	defer ts.Close()
+
+	storage, err := NewStorageWithConfig("lego", &api.Config{Address: ts.URL})
+	require.NoError(t, err)
+	require.NoError(t, storage.Save(storagetest.CertificateResource(t, "soon.example.com", time.Now().Add(24*time.Hour))))
+	require.NoError(t, storage.Save(storagetest.CertificateResource(t, "later.example.com", time.Now().Add(60*24*time.Hour))))
+
+	renewals := make(chan string, 10)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- storage.Watch(30*24*time.Hour, func(domain string) { renewals <- domain }, stop)
+	}()
+
+	expectRenewal := func(expected string) {
+		select {
+		case domain := <-renewals:
+			assert.Equal(t, expected, domain)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %s to be renewed", expected)
+		}
+	}
+	expectRenewal("soon.example.com")
+
+	// Replacing the certificate wakes up the watch, which finds the new one.
+	require.NoError(t, storage.Save(storagetest.CertificateResource(t, "soon.example.com", time.Now().Add(60*24*time.Hour))))
+	require.NoError(t, storage.Save(storagetest.CertificateResource(t, "new.example.com", time.Now().Add(time.Hour))))
+	for {
+		select {
+		case domain := <-renewals:
+			if domain == "soon.example.com" {
+				continue
+			}
+			assert.Equal(t, "new.example.com", domain)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected new.example.com to be renewed")
+		}
+		break
+	}
+
+	close(stop)
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Watch to return after stop was closed")
+	}
+}
@@ -0,0 +1,267 @@
+//go:build lego_gcpsecretmanager
+// +build lego_gcpsecretmanager
+
+// Package gcpsecretmanager implements a certstore.Storage keeping
+// certificates in Google Cloud Secret Manager.
+//
+// It is only built with the lego_gcpsecretmanager tag, see package certstore.
+package gcpsecretmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/certstore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// retainedVersions is the number of versions of a secret kept by Save.
+// Older versions are destroyed.
+const retainedVersions = 3
+
+const (
+	// managedByLabel marks the secrets written by a Storage. List selects
+	// them.
+	managedByLabel = "managed-by"
+	managedByLego  = "lego"
+
+	// domainAnnotation holds the domain of a secret, as secret IDs cannot
+	// hold dots.
+	domainAnnotation = "lego-domain"
+)
+
+// The types of the secrets of a certificate, the last part of their IDs.
+const (
+	certificateType = "crt"
+	privateKeyType  = "key"
+	metaType        = "json"
+)
+
+// Storage is an implementation of the certstore.Storage interface that
+// keeps the certificate, private key and metadata of a domain in the
+// secrets projects/<project>/secrets/lego-<domain>-crt, -key and -json. The
+// dots of the domain become underscores, a wildcard is spelled out.
+type Storage struct {
+	client  *secretmanager.Client
+	project string
+}
+
+// NewStorage returns a Storage keeping the secrets in the project named by
+// GCP_PROJECT. It authenticates with the application default credentials.
+func NewStorage() (*Storage, error) {
+	project := os.Getenv("GCP_PROJECT")
+	if project == "" {
+		return nil, fmt.Errorf("GCP Secret Manager credentials missing: GCP_PROJECT")
+	}
+
+	client, err := secretmanager.NewClient(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("GCP Secret Manager client could not be created: %v", err)
+	}
+	return NewStorageWithClient(client, project), nil
+}
+
+// NewStorageWithClient returns a Storage keeping the secrets in project
+// through client.
+func NewStorageWithClient(client *secretmanager.Client, project string) *Storage {
+	return &Storage{client: client, project: project}
+}
+
+// secretID returns the ID of the secret of the given type for domain.
+func secretID(domain, secretType string) string {
+	domain = strings.Replace(strings.ToLower(domain), "*", "wildcard", -1)
+	return "lego-" + strings.Replace(domain, ".", "_", -1) + "-" + secretType
+}
+
+// secretName returns the resource name of the secret of the given type for
+// domain.
+func (s *Storage) secretName(domain, secretType string) string {
+	return "projects/" + s.project + "/secrets/" + secretID(domain, secretType)
+}
+
+// Save adds a version to each secret of res.Domain, creating the secrets
+// which do not exist yet, and destroys the versions beyond the last
+// retainedVersions. The secret of the private key is deleted for a
+// certificate without one.
+func (s *Storage) Save(res acme.CertificateResource) error {
+	meta, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	for _, secret := range []struct {
+		secretType string
+		data       []byte
+	}{
+		{certificateType, res.Certificate},
+		{privateKeyType, res.PrivateKey},
+		{metaType, meta},
+	} {
+		name := s.secretName(res.Domain, secret.secretType)
+		if secret.data == nil {
+			err := s.client.DeleteSecret(ctx, &secretmanagerpb.DeleteSecretRequest{Name: name})
+			if err != nil && status.Code(err) != codes.NotFound {
+				return fmt.Errorf("GCP Secret Manager could not delete %s: %v", name, err)
+			}
+			continue
+		}
+
+		if err := s.createSecret(ctx, res.Domain, secret.secretType); err != nil {
+			return err
+		}
+		_, err := s.client.AddSecretVersion(ctx, &secretmanagerpb.AddSecretVersionRequest{
+			Parent:  name,
+			Payload: &secretmanagerpb.SecretPayload{Data: secret.data},
+		})
+		if err != nil {
+			return fmt.Errorf("GCP Secret Manager could not add a version to %s: %v", name, err)
+		}
+		if err := s.destroyOldVersions(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSecret creates the secret of the given type for domain unless it
+// exists.
+func (s *Storage) createSecret(ctx context.Context, domain, secretType string) error {
+	_, err := s.client.CreateSecret(ctx, &secretmanagerpb.CreateSecretRequest{
+		Parent:   "projects/" + s.project,
+		SecretId: secretID(domain, secretType),
+		Secret: &secretmanagerpb.Secret{
+			Replication: &secretmanagerpb.Replication{
+				Replication: &secretmanagerpb.Replication_Automatic_{Automatic: &secretmanagerpb.Replication_Automatic{}},
+			},
+			Labels:      map[string]string{managedByLabel: managedByLego},
+			Annotations: map[string]string{domainAnnotation: domain},
+		},
+	})
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return fmt.Errorf("GCP Secret Manager could not create %s: %v", s.secretName(domain, secretType), err)
+	}
+	return nil
+}
+
+// destroyOldVersions destroys the versions of the secret name except for
+// the newest retainedVersions ones.
+func (s *Storage) destroyOldVersions(ctx context.Context, name string) error {
+	versions := s.client.ListSecretVersions(ctx, &secretmanagerpb.ListSecretVersionsRequest{
+		Parent: name,
+		Filter: "NOT state:DESTROYED",
+	})
+
+	// Versions are listed newest first.
+	for kept := 0; ; {
+		version, err := versions.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("GCP Secret Manager could not list the versions of %s: %v", name, err)
+		}
+		if version.State == secretmanagerpb.SecretVersion_DESTROYED {
+			continue
+		}
+		if kept < retainedVersions {
+			kept++
+			continue
+		}
+
+		_, err = s.client.DestroySecretVersion(ctx, &secretmanagerpb.DestroySecretVersionRequest{Name: version.Name})
+		if err != nil {
+			return fmt.Errorf("GCP Secret Manager could not destroy %s: %v", version.Name, err)
+		}
+	}
+}
+
+// Load reads the latest versions of the secrets of domain.
+func (s *Storage) Load(domain string) (acme.CertificateResource, error) {
+	ctx := context.Background()
+
+	certificate, err := s.access(ctx, domain, certificateType)
+	if err != nil {
+		return acme.CertificateResource{}, err
+	}
+	if certificate == nil {
+		return acme.CertificateResource{}, certstore.ErrNotFound
+	}
+
+	var res acme.CertificateResource
+	meta, err := s.access(ctx, domain, metaType)
+	if err != nil {
+		return acme.CertificateResource{}, err
+	}
+	if meta != nil {
+		if err := json.Unmarshal(meta, &res); err != nil {
+			return acme.CertificateResource{}, fmt.Errorf("GCP Secret Manager holds invalid metadata for %s: %v", domain, err)
+		}
+	}
+
+	res.Domain = domain
+	res.Certificate = certificate
+	if res.PrivateKey, err = s.access(ctx, domain, privateKeyType); err != nil {
+		return acme.CertificateResource{}, err
+	}
+	return res, nil
+}
+
+// access returns the data of the latest version of the secret of the given
+// type for domain, or nil if it does not exist.
+func (s *Storage) access(ctx context.Context, domain, secretType string) ([]byte, error) {
+	name := s.secretName(domain, secretType)
+	resp, err := s.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name + "/versions/latest"})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GCP Secret Manager could not access %s: %v", name, err)
+	}
+	return resp.Payload.Data, nil
+}
+
+// List returns the domains of the certificate secrets labelled as managed
+// by lego.
+func (s *Storage) List() ([]string, error) {
+	secrets := s.client.ListSecrets(context.Background(), &secretmanagerpb.ListSecretsRequest{
+		Parent: "projects/" + s.project,
+		Filter: "labels." + managedByLabel + "=" + managedByLego,
+	})
+
+	var domains []string
+	for {
+		secret, err := secrets.Next()
+		if err == iterator.Done {
+			return domains, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("GCP Secret Manager could not list the secrets: %v", err)
+		}
+
+		domain, ok := secret.Annotations[domainAnnotation]
+		if ok && secret.Name == s.secretName(domain, certificateType) {
+			domains = append(domains, domain)
+		}
+	}
+}
+
+// Delete deletes the secrets of domain with all their versions.
+func (s *Storage) Delete(domain string) error {
+	for _, secretType := range []string{certificateType, privateKeyType, metaType} {
+		name := s.secretName(domain, secretType)
+		err := s.client.DeleteSecret(context.Background(), &secretmanagerpb.DeleteSecretRequest{Name: name})
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("GCP Secret Manager could not delete %s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+//go:build lego_gcpsecretmanager
+// +build lego_gcpsecretmanager
+
+package gcpsecretmanager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/certstore/storagetest"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// fakeSecretManager keeps secrets and their versions in memory.
+type fakeSecretManager struct {
+	secretmanagerpb.UnimplementedSecretManagerServiceServer
+
+	mu       sync.Mutex
+	secrets  map[string]*secretmanagerpb.Secret
+	versions map[string][]*secretmanagerpb.SecretVersion
+	payloads map[string][]byte
+}
+
+func (f *fakeSecretManager) CreateSecret(ctx context.Context, req *secretmanagerpb.CreateSecretRequest) (*secretmanagerpb.Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := req.Parent + "/secrets/" + req.SecretId
+	if _, ok := f.secrets[name]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "Secret [%s] already exists.", name)
+	}
+	secret := &secretmanagerpb.Secret{Name: name, Labels: req.Secret.Labels, Annotations: req.Secret.Annotations}
+	f.secrets[name] = secret
+	return secret, nil
+}
+
+func (f *fakeSecretManager) DeleteSecret(ctx context.Context, req *secretmanagerpb.DeleteSecretRequest) (*emptypb.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.secrets[req.Name]; !ok {
+		return nil, status.Errorf(codes.NotFound, "Secret [%s] not found.", req.Name)
+	}
+	delete(f.secrets, req.Name)
+	delete(f.versions, req.Name)
+	return &emptypb.Empty{}, nil
+}
+
+func (f *fakeSecretManager) ListSecrets(ctx context.Context, req *secretmanagerpb.ListSecretsRequest) (*secretmanagerpb.ListSecretsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := &secretmanagerpb.ListSecretsResponse{}
+	for name, secret := range f.secrets {
+		label := strings.SplitN(strings.TrimPrefix(req.Filter, "labels."), "=", 2)
+		if strings.HasPrefix(name, req.Parent+"/") && len(label) == 2 && secret.Labels[label[0]] == label[1] {
+			resp.Secrets = append(resp.Secrets, secret)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeSecretManager) AddSecretVersion(ctx context.Context, req *secretmanagerpb.AddSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.secrets[req.Parent]; !ok {
+		return nil, status.Errorf(codes.NotFound, "Secret [%s] not found.", req.Parent)
+	}
+	version := &secretmanagerpb.SecretVersion{
+		Name:  fmt.Sprintf("%s/versions/%d", req.Parent, len(f.versions[req.Parent])+1),
+		State: secretmanagerpb.SecretVersion_ENABLED,
+	}
+	f.versions[req.Parent] = append(f.versions[req.Parent], version)
+	f.payloads[version.Name] = req.Payload.Data
+	return version, nil
+}
+
+func (f *fakeSecretManager) ListSecretVersions(ctx context.Context, req *secretmanagerpb.ListSecretVersionsRequest) (*secretmanagerpb.ListSecretVersionsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := &secretmanagerpb.ListSecretVersionsResponse{}
+	versions := f.versions[req.Parent]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].State != secretmanagerpb.SecretVersion_DESTROYED {
+			resp.Versions = append(resp.Versions, versions[i])
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeSecretManager) DestroySecretVersion(ctx context.Context, req *secretmanagerpb.DestroySecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, version := range f.versions[req.Name[:strings.Index(req.Name, "/versions/")]] {
+		if version.Name == req.Name {
+			version.State = secretmanagerpb.SecretVersion_DESTROYED
+			delete(f.payloads, version.Name)
+			return version, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "Secret Version [%s] not found.", req.Name)
+}
+
+func (f *fakeSecretManager) AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	secretName := strings.TrimSuffix(req.Name, "/versions/latest")
+	versions := f.versions[secretName]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].State == secretmanagerpb.SecretVersion_ENABLED {
+			return &secretmanagerpb.AccessSecretVersionResponse{
+				Name:    versions[i].Name,
+				Payload: &secretmanagerpb.SecretPayload{Data: f.payloads[versions[i].Name]},
+			}, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "Secret [%s] not found or has no versions.", secretName)
+}
+
+// newTestStorage returns a Storage for the project lego-test talking to a
+// fakeSecretManager.
+func newTestStorage(t *testing.T) (*Storage, *fakeSecretManager, func()) {
+	fake := &fakeSecretManager{
+		secrets:  map[string]*secretmanagerpb.Secret{},
+		versions: map[string][]*secretmanagerpb.SecretVersion{},
+		payloads: map[string][]byte{},
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	secretmanagerpb.RegisterSecretManagerServiceServer(server, fake)
+	go server.Serve(lis)
+
+	client, err := secretmanager.NewClient(context.Background(),
+		option.WithEndpoint(lis.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	require.NoError(t, err)
+
+	return NewStorageWithClient(client, "lego-test"), fake, func() {
+		client.Close()
+		server.Stop()
+	}
+}
+
+func TestNewStorageMissingProject(t *testing.T) {
+	defer os.Setenv("GCP_PROJECT", os.Getenv("GCP_PROJECT"))
+	os.Setenv("GCP_PROJECT", "")
+
+	_, err := NewStorage()
+	assert.EqualError(t, err, "GCP Secret Manager credentials missing: GCP_PROJECT")
+}
+
+func TestStorage(t *testing.T) {
+	storage, _, stop := newTestStorage(t)
+	defer stop()
+
+	storagetest.Run(t, storage)
+}
+
+func TestSaveRetainsThreeVersions(t *testing.T) {
+	storage, fake, stop := newTestStorage(t)
+	defer stop()
+
+	var last []byte
+	for i := 0; i < 5; i++ {
+		res := storagetest.CertificateResource(t, "*.example.com", time.Now().Add(24*time.Hour))
+		require.NoError(t, storage.Save(res))
+		last = res.Certificate
+	}
+
+	name := "projects/lego-test/secrets/lego-wildcard_example_com-crt"
+	require.Contains(t, fake.secrets, name)
+	assert.Equal(t, "*.example.com", fake.secrets[name].Annotations["lego-domain"])
+
+	var states []secretmanagerpb.SecretVersion_State
+	for _, version := range fake.versions[name] {
+		states = append(states, version.State)
+	}
+	destroyed, enabled := secretmanagerpb.SecretVersion_DESTROYED, secretmanagerpb.SecretVersion_ENABLED
+	assert.Equal(t, []secretmanagerpb.SecretVersion_State{destroyed, destroyed, enabled, enabled, enabled}, states)
+
+	res, err := storage.Load("*.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, last, res.Certificate)
+}
@@ -0,0 +1,225 @@
+//go:build lego_kubernetes
+// +build lego_kubernetes
+
+// Package kubernetes implements a certstore.Storage keeping certificates in
+// Kubernetes Secrets of type kubernetes.io/tls, the format Ingress
+// controllers and cert-manager use. Secrets written by cert-manager can be
+// loaded as well, which eases migrating from it.
+//
+// It is only built with the lego_kubernetes tag, see package certstore.
+//
+// The service account or user lego runs as needs the following permissions
+// in the namespace of the Secrets:
+//
+//	apiVersion: rbac.authorization.k8s.io/v1
+//	kind: Role
+//	metadata:
+//	  name: lego
+//	  namespace: <namespace>
+//	rules:
+//	- apiGroups: [""]
+//	  resources: ["secrets"]
+//	  verbs: ["get", "list", "create", "update", "delete"]
+//
+// bound to it with a RoleBinding.
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/certstore"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// managedByLabel marks the Secrets written by a Storage. List selects
+	// them by default.
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByLego  = "lego"
+
+	// domainAnnotation holds the domain of a Secret, as Secret names cannot
+	// hold every domain name, e.g. wildcards.
+	domainAnnotation = "lego.acme/domain"
+
+	// metaKey is the key of the Secret data holding the metadata lego
+	// writes to the .json file.
+	metaKey = "lego.json"
+)
+
+// Storage is an implementation of the certstore.Storage interface that
+// keeps every certificate in a Secret of one namespace.
+type Storage struct {
+	client    kubernetes.Interface
+	namespace string
+	selector  string
+}
+
+// NewStorage returns a Storage keeping the Secrets in namespace, "default"
+// if empty. The cluster is reached through the kubeconfig file named by
+// KUBECONFIG or, if that is not set, the service account of the pod lego
+// runs in.
+func NewStorage(namespace string) (*Storage, error) {
+	var config *rest.Config
+	var err error
+	if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Kubernetes client configuration could not be loaded: %v", err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("Kubernetes client could not be created: %v", err)
+	}
+	return NewStorageWithClient(client, namespace), nil
+}
+
+// NewStorageWithClient is like NewStorage but talks to the cluster through
+// client.
+func NewStorageWithClient(client kubernetes.Interface, namespace string) *Storage {
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	return &Storage{
+		client:    client,
+		namespace: namespace,
+		selector:  managedByLabel + "=" + managedByLego,
+	}
+}
+
+// SetLabelSelector replaces the label selector of the Secrets returned by
+// List, which selects the Secrets written by a Storage by default. E.g. the
+// selector controller.cert-manager.io/fao=true lists the Secrets of
+// cert-manager.
+func (s *Storage) SetLabelSelector(selector string) {
+	s.selector = selector
+}
+
+// secretName returns the name of the Secret of domain. Wildcards are
+// spelled out, as Secret names have to be DNS subdomains.
+func secretName(domain string) string {
+	return strings.Replace(strings.ToLower(domain), "*", "wildcard", -1)
+}
+
+// Save creates the Secret of res.Domain, or updates it if it exists.
+func (s *Storage) Save(res acme.CertificateResource) error {
+	meta, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	secrets := s.client.CoreV1().Secrets(s.namespace)
+	secret, err := secrets.Get(context.Background(), secretName(res.Domain), metav1.GetOptions{})
+	exists := err == nil
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Kubernetes could not get the Secret of %s: %v", res.Domain, err)
+	}
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: secretName(res.Domain), Namespace: s.namespace},
+			Type:       corev1.SecretTypeTLS,
+		}
+	}
+
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	secret.Labels[managedByLabel] = managedByLego
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[domainAnnotation] = res.Domain
+
+	// kubernetes.io/tls Secrets need both keys, a certificate obtained for a
+	// CSR gets an empty private key.
+	secret.Data = map[string][]byte{
+		corev1.TLSCertKey:       res.Certificate,
+		corev1.TLSPrivateKeyKey: res.PrivateKey,
+		metaKey:                 meta,
+	}
+	if secret.Data[corev1.TLSPrivateKeyKey] == nil {
+		secret.Data[corev1.TLSPrivateKeyKey] = []byte{}
+	}
+
+	if exists {
+		_, err = secrets.Update(context.Background(), secret, metav1.UpdateOptions{})
+	} else {
+		_, err = secrets.Create(context.Background(), secret, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("Kubernetes could not save the Secret of %s: %v", res.Domain, err)
+	}
+	return nil
+}
+
+// Load reads the Secret of domain. Secrets without lego metadata, e.g. the
+// ones of cert-manager, only fill the certificate and private key.
+func (s *Storage) Load(domain string) (acme.CertificateResource, error) {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(context.Background(), secretName(domain), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return acme.CertificateResource{}, certstore.ErrNotFound
+	}
+	if err != nil {
+		return acme.CertificateResource{}, fmt.Errorf("Kubernetes could not get the Secret of %s: %v", domain, err)
+	}
+	if len(secret.Data[corev1.TLSCertKey]) == 0 {
+		return acme.CertificateResource{}, fmt.Errorf("Kubernetes Secret %s/%s holds no certificate", s.namespace, secret.Name)
+	}
+
+	var res acme.CertificateResource
+	if meta, ok := secret.Data[metaKey]; ok {
+		if err := json.Unmarshal(meta, &res); err != nil {
+			return acme.CertificateResource{}, fmt.Errorf("Kubernetes Secret %s/%s holds invalid metadata: %v", s.namespace, secret.Name, err)
+		}
+	}
+	res.Domain = domain
+	res.Certificate = secret.Data[corev1.TLSCertKey]
+	if key := secret.Data[corev1.TLSPrivateKeyKey]; len(key) > 0 {
+		res.PrivateKey = key
+	}
+	return res, nil
+}
+
+// List returns the domains of the kubernetes.io/tls Secrets matching the
+// label selector. Secrets without the domain annotation are listed by name.
+func (s *Storage) List() ([]string, error) {
+	secrets, err := s.client.CoreV1().Secrets(s.namespace).List(context.Background(), metav1.ListOptions{LabelSelector: s.selector})
+	if err != nil {
+		return nil, fmt.Errorf("Kubernetes could not list the Secrets: %v", err)
+	}
+
+	var domains []string
+	for _, secret := range secrets.Items {
+		if secret.Type != corev1.SecretTypeTLS {
+			continue
+		}
+		if domain, ok := secret.Annotations[domainAnnotation]; ok {
+			domains = append(domains, domain)
+		} else {
+			domains = append(domains, secret.Name)
+		}
+	}
+	return domains, nil
+}
+
+// Delete removes the Secret of domain.
+func (s *Storage) Delete(domain string) error {
+	err := s.client.CoreV1().Secrets(s.namespace).Delete(context.Background(), secretName(domain), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Kubernetes could not delete the Secret of %s: %v", domain, err)
+	}
+	return nil
+}
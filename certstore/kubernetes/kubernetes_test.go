@@ -0,0 +1,74 @@
+//go:build lego_kubernetes
+// +build lego_kubernetes
+
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/certstore/storagetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, NewStorageWithClient(fake.NewSimpleClientset(), "lego"))
+}
+
+func TestSaveWritesTLSSecret(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	storage := NewStorageWithClient(client, "")
+
+	res := storagetest.CertificateResource(t, "*.example.com", time.Now().Add(24*time.Hour))
+	require.NoError(t, storage.Save(res))
+
+	secret, err := client.CoreV1().Secrets("default").Get(context.Background(), "wildcard.example.com", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, corev1.SecretTypeTLS, secret.Type)
+	assert.Equal(t, "lego", secret.Labels["app.kubernetes.io/managed-by"])
+	assert.Equal(t, "*.example.com", secret.Annotations["lego.acme/domain"])
+	assert.Equal(t, res.Certificate, secret.Data["tls.crt"])
+	assert.Equal(t, res.PrivateKey, secret.Data["tls.key"])
+
+	domains, err := storage.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*.example.com"}, domains)
+
+	loaded, err := storage.Load("*.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "*.example.com", loaded.Domain)
+}
+
+func TestLoadCertManagerSecret(t *testing.T) {
+	res := storagetest.CertificateResource(t, "example.com", time.Now().Add(24*time.Hour))
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example.com",
+			Namespace: "web",
+			Labels:    map[string]string{"controller.cert-manager.io/fao": "true"},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{"tls.crt": res.Certificate, "tls.key": res.PrivateKey, "ca.crt": res.Certificate},
+	})
+	storage := NewStorageWithClient(client, "web")
+
+	loaded, err := storage.Load("example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", loaded.Domain)
+	assert.Equal(t, res.Certificate, loaded.Certificate)
+	assert.Equal(t, res.PrivateKey, loaded.PrivateKey)
+
+	domains, err := storage.List()
+	require.NoError(t, err)
+	assert.Empty(t, domains)
+
+	storage.SetLabelSelector("controller.cert-manager.io/fao=true")
+	domains, err = storage.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com"}, domains)
+}
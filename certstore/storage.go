@@ -0,0 +1,36 @@
+// Package certstore defines the interface of backends keeping the
+// certificates obtained by lego somewhere else than in files on the machine
+// running it, e.g. in a secrets manager shared by several machines.
+//
+// The consul, kubernetes, gcpsecretmanager and azurekeyvault backends are
+// only built with the tag named after them, e.g. lego_consul. Their client
+// libraries need context and a far newer Go than the 1.6 and 1.7 lego is
+// tested with, and the tags keep go get and go vet of ./... working there.
+package certstore
+
+import (
+	"errors"
+
+	"github.com/xenolf/lego/acme"
+)
+
+// ErrNotFound is returned by Storage.Load if no certificate is stored for
+// the domain.
+var ErrNotFound = errors.New("certstore: certificate not found")
+
+// Storage keeps certificate resources by their domain. A stored resource
+// holds the certificate, the private key if there is one, and the metadata
+// lego writes to the .json file, i.e. the fields of acme.CertificateResource
+// which are marshalled to JSON.
+type Storage interface {
+	// Save stores res under res.Domain, replacing the certificate stored
+	// for it before.
+	Save(res acme.CertificateResource) error
+	// Load returns the certificate stored for domain, or ErrNotFound.
+	Load(domain string) (acme.CertificateResource, error)
+	// List returns the domains of all stored certificates.
+	List() ([]string, error)
+	// Delete removes the certificate stored for domain. Deleting a domain
+	// without a certificate is not an error.
+	Delete(domain string) error
+}
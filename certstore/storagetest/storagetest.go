@@ -0,0 +1,127 @@
+// Package storagetest checks that a certstore.Storage behaves as the
+// interface documents. It is meant to be called from the tests of the
+// backends.
+package storagetest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/certstore"
+)
+
+// CertificateResource returns a resource for domain with a self-signed
+// certificate expiring at notAfter and its private key.
+func CertificateResource(t *testing.T, domain string, notAfter time.Time) acme.CertificateResource {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Could not create test certificate:", err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return acme.CertificateResource{
+		Domain:        domain,
+		CertURL:       "https://ca.example/cert/" + domain,
+		CertStableURL: "https://ca.example/cert/" + domain,
+		AccountRef:    "https://ca.example/reg/1",
+		Certificate:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		PrivateKey:    pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}),
+	}
+}
+
+// Run saves, loads, lists and deletes certificates with s, which has to be
+// empty, and reports every deviation from the certstore.Storage contract.
+func Run(t *testing.T, s certstore.Storage) {
+	if _, err := s.Load("example.com"); err != certstore.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a missing certificate, got %v", err)
+	}
+
+	first := CertificateResource(t, "example.com", time.Now().Add(24*time.Hour))
+	second := CertificateResource(t, "www.example.org", time.Now().Add(48*time.Hour))
+	// Certificates obtained for a CSR come without a private key.
+	second.PrivateKey = nil
+	for _, res := range []acme.CertificateResource{first, second} {
+		if err := s.Save(res); err != nil {
+			t.Fatalf("Could not save the certificate of %s: %v", res.Domain, err)
+		}
+	}
+
+	for _, expected := range []acme.CertificateResource{first, second} {
+		res, err := s.Load(expected.Domain)
+		if err != nil {
+			t.Errorf("Could not load the certificate of %s: %v", expected.Domain, err)
+			continue
+		}
+		checkEqual(t, expected, res)
+	}
+
+	replaced := CertificateResource(t, "example.com", time.Now().Add(72*time.Hour))
+	if err := s.Save(replaced); err != nil {
+		t.Fatalf("Could not replace the certificate of example.com: %v", err)
+	}
+	if res, err := s.Load("example.com"); err != nil {
+		t.Errorf("Could not load the replaced certificate: %v", err)
+	} else {
+		checkEqual(t, replaced, res)
+	}
+
+	domains, err := s.List()
+	if err != nil {
+		t.Fatalf("Could not list the certificates: %v", err)
+	}
+	sort.Strings(domains)
+	if len(domains) != 2 || domains[0] != "example.com" || domains[1] != "www.example.org" {
+		t.Errorf("Expected example.com and www.example.org to be listed, got %v", domains)
+	}
+
+	if err := s.Delete("example.com"); err != nil {
+		t.Fatalf("Could not delete the certificate of example.com: %v", err)
+	}
+	if _, err := s.Load("example.com"); err != certstore.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a deleted certificate, got %v", err)
+	}
+	if err := s.Delete("example.com"); err != nil {
+		t.Errorf("Expected no error deleting a missing certificate, got %v", err)
+	}
+	if domains, err := s.List(); err != nil || len(domains) != 1 || domains[0] != "www.example.org" {
+		t.Errorf("Expected only www.example.org to be listed, got %v (%v)", domains, err)
+	}
+}
+
+func checkEqual(t *testing.T, expected, actual acme.CertificateResource) {
+	if actual.Domain != expected.Domain || actual.CertURL != expected.CertURL ||
+		actual.CertStableURL != expected.CertStableURL || actual.AccountRef != expected.AccountRef {
+		t.Errorf("Expected the metadata of %s to be loaded unchanged, got domain %q, URLs %q and %q, account %q",
+			expected.Domain, actual.Domain, actual.CertURL, actual.CertStableURL, actual.AccountRef)
+	}
+	if !bytes.Equal(actual.Certificate, expected.Certificate) {
+		t.Errorf("Expected the certificate of %s to be loaded unchanged", expected.Domain)
+	}
+	if !bytes.Equal(actual.PrivateKey, expected.PrivateKey) {
+		t.Errorf("Expected the private key of %s to be loaded unchanged, got %q", expected.Domain, actual.PrivateKey)
+	}
+}
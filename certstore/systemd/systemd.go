@@ -0,0 +1,209 @@
+// Package systemd implements a certstore.Storage keeping certificates as
+// systemd credentials encrypted with systemd-creds, which systemd decrypts
+// into the credentials directory of a service when it starts. The
+// certificates are protected by the host key or TPM2 of the machine, without
+// a separate secrets manager.
+package systemd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/certstore"
+)
+
+// systemdCreds is the name of the systemd credentials utility. It is
+// overridden during tests.
+var systemdCreds = "systemd-creds"
+
+const (
+	// DefaultCredstoreDir is the directory systemd searches for encrypted
+	// credentials.
+	DefaultCredstoreDir = "/etc/credstore.encrypted"
+	// DefaultUnitDir is the directory of the unit drop-ins of the system
+	// administrator.
+	DefaultUnitDir = "/etc/systemd/system"
+)
+
+// credentialTypes are the suffixes of the credential names of a
+// certificate, in the order Save writes them.
+var credentialTypes = []string{".crt", ".key", ".json"}
+
+// Storage is an implementation of the certstore.Storage interface that
+// keeps the certificate, private key and metadata of a domain as the
+// encrypted credentials <prefix><domain>.crt, .key and .json.
+//
+// If a unit is set, Save also writes the drop-in
+// <unit>.d/<prefix><domain>.conf loading the credentials into the service,
+// which finds them in $CREDENTIALS_DIRECTORY once systemd reloaded its
+// configuration (systemctl daemon-reload) and restarted it, e.g. from a
+// deploy hook.
+type Storage struct {
+	unit         string
+	prefix       string
+	credstoreDir string
+	unitDir      string
+}
+
+// NewStorage returns a Storage keeping the credentials in
+// DefaultCredstoreDir and the drop-ins of unit in DefaultUnitDir. A unit
+// name without a type suffix is a service. An empty unit writes no
+// drop-ins.
+func NewStorage(unit, prefix string) *Storage {
+	return NewStorageWithDirs(unit, prefix, DefaultCredstoreDir, DefaultUnitDir)
+}
+
+// NewStorageWithDirs is like NewStorage but keeps the credentials in
+// credstoreDir and the drop-ins in unitDir.
+func NewStorageWithDirs(unit, prefix, credstoreDir, unitDir string) *Storage {
+	if unit != "" && !strings.Contains(unit, ".") {
+		unit += ".service"
+	}
+	return &Storage{unit: unit, prefix: prefix, credstoreDir: credstoreDir, unitDir: unitDir}
+}
+
+// credentialPath returns the file of the credential name.
+func (s *Storage) credentialPath(name string) string {
+	return filepath.Join(s.credstoreDir, name)
+}
+
+// dropInPath returns the drop-in of the unit loading the credentials of
+// domain.
+func (s *Storage) dropInPath(domain string) string {
+	return filepath.Join(s.unitDir, s.unit+".d", s.prefix+domain+".conf")
+}
+
+// Save encrypts the credentials of res, replacing the previous ones, and
+// writes the drop-in of the unit.
+func (s *Storage) Save(res acme.CertificateResource) error {
+	meta, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.credstoreDir, 0700); err != nil {
+		return err
+	}
+
+	var dropIn bytes.Buffer
+	dropIn.WriteString("# Written by lego, do not edit.\n[Service]\n")
+	for i, data := range [][]byte{res.Certificate, res.PrivateKey, meta} {
+		name := s.prefix + res.Domain + credentialTypes[i]
+		if data == nil {
+			if err := os.Remove(s.credentialPath(name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+
+		if err := encrypt(name, data, s.credentialPath(name)); err != nil {
+			return err
+		}
+		fmt.Fprintf(&dropIn, "LoadCredentialEncrypted=%s:%s\n", name, s.credentialPath(name))
+	}
+
+	if s.unit == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.dropInPath(res.Domain)), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.dropInPath(res.Domain), dropIn.Bytes(), 0644)
+}
+
+// encrypt writes the credential name holding data to file. The credential
+// is encrypted into a temporary file first, so a failure leaves the old one
+// in place.
+func encrypt(name string, data []byte, file string) error {
+	tmpFile := file + ".tmp"
+	cmd := exec.Command(systemdCreds, "encrypt", "--name="+name, "-", tmpFile)
+	cmd.Stdin = bytes.NewReader(data)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("systemd-creds encrypt %s failed: %v: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return os.Rename(tmpFile, file)
+}
+
+// decrypt returns the data of the credential name stored in file.
+func decrypt(name, file string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(systemdCreds, "decrypt", "--name="+name, file, "-")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("systemd-creds decrypt %s failed: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Load decrypts the credentials of domain.
+func (s *Storage) Load(domain string) (acme.CertificateResource, error) {
+	var data [3][]byte
+	for i, suffix := range credentialTypes {
+		name := s.prefix + domain + suffix
+		if _, err := os.Stat(s.credentialPath(name)); os.IsNotExist(err) {
+			if i == 0 {
+				return acme.CertificateResource{}, certstore.ErrNotFound
+			}
+			continue
+		}
+
+		var err error
+		if data[i], err = decrypt(name, s.credentialPath(name)); err != nil {
+			return acme.CertificateResource{}, err
+		}
+	}
+
+	var res acme.CertificateResource
+	if data[2] != nil {
+		if err := json.Unmarshal(data[2], &res); err != nil {
+			return acme.CertificateResource{}, fmt.Errorf("Credential %s%s.json holds invalid metadata: %v", s.prefix, domain, err)
+		}
+	}
+	res.Domain = domain
+	res.Certificate = data[0]
+	res.PrivateKey = data[1]
+	return res, nil
+}
+
+// List returns the domains of the certificate credentials with the prefix.
+func (s *Storage) List() ([]string, error) {
+	files, err := ioutil.ReadDir(s.credstoreDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var domains []string
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasPrefix(name, s.prefix) && strings.HasSuffix(name, credentialTypes[0]) {
+			domains = append(domains, strings.TrimSuffix(strings.TrimPrefix(name, s.prefix), credentialTypes[0]))
+		}
+	}
+	return domains, nil
+}
+
+// Delete removes the credentials of domain and the drop-in loading them.
+func (s *Storage) Delete(domain string) error {
+	var files []string
+	for _, suffix := range credentialTypes {
+		files = append(files, s.credentialPath(s.prefix+domain+suffix))
+	}
+	if s.unit != "" {
+		files = append(files, s.dropInPath(domain))
+	}
+
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
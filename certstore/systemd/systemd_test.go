@@ -0,0 +1,80 @@
+package systemd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/certstore/storagetest"
+)
+
+// fakeSystemdCreds installs a systemd-creds script which "encrypts" by
+// prefixing the data with a header naming the credential, and checks that
+// header when decrypting.
+func fakeSystemdCreds(t *testing.T, dir string) {
+	script := `#!/bin/sh
+name=${2#--name=}
+case "$1" in
+encrypt)
+	{ echo "ENCRYPTED $name"; cat; } > "$4";;
+decrypt)
+	if [ "$(head -n 1 "$3")" != "ENCRYPTED $name" ]; then
+		echo "Embedded credential name does not match $name" >&2
+		exit 1
+	fi
+	tail -n +2 "$3";;
+esac
+`
+	path := filepath.Join(dir, "systemd-creds")
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+	systemdCreds = path
+}
+
+func TestStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(saved string) { systemdCreds = saved }(systemdCreds)
+	fakeSystemdCreds(t, dir)
+
+	storagetest.Run(t, NewStorageWithDirs("", "lego-", filepath.Join(dir, "credstore"), filepath.Join(dir, "system")))
+}
+
+func TestSaveWritesDropIn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(saved string) { systemdCreds = saved }(systemdCreds)
+	fakeSystemdCreds(t, dir)
+
+	credstore := filepath.Join(dir, "credstore")
+	storage := NewStorageWithDirs("nginx", "tls-", credstore, filepath.Join(dir, "system"))
+
+	res := storagetest.CertificateResource(t, "example.com", time.Now().Add(24*time.Hour))
+	require.NoError(t, storage.Save(res))
+
+	encrypted, err := ioutil.ReadFile(filepath.Join(credstore, "tls-example.com.key"))
+	require.NoError(t, err)
+	assert.Equal(t, "ENCRYPTED tls-example.com.key\n"+string(res.PrivateKey), string(encrypted))
+
+	dropIn, err := ioutil.ReadFile(filepath.Join(dir, "system", "nginx.service.d", "tls-example.com.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "# Written by lego, do not edit.\n[Service]\n"+
+		"LoadCredentialEncrypted=tls-example.com.crt:"+filepath.Join(credstore, "tls-example.com.crt")+"\n"+
+		"LoadCredentialEncrypted=tls-example.com.key:"+filepath.Join(credstore, "tls-example.com.key")+"\n"+
+		"LoadCredentialEncrypted=tls-example.com.json:"+filepath.Join(credstore, "tls-example.com.json")+"\n", string(dropIn))
+
+	// A credential renamed by hand does not decrypt under another name.
+	require.NoError(t, os.Rename(filepath.Join(credstore, "tls-example.com.crt"), filepath.Join(credstore, "tls-example.org.crt")))
+	_, err = storage.Load("example.org")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "systemd-creds decrypt tls-example.org.crt failed")
+
+	require.NoError(t, storage.Delete("example.com"))
+	_, err = os.Stat(filepath.Join(dir, "system", "nginx.service.d", "tls-example.com.conf"))
+	assert.True(t, os.IsNotExist(err), "Expected the drop-in to be removed")
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/urfave/cli"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns"
 )
 
 // Logger is used to log errors; if nil, the default log.Logger is used.
@@ -64,12 +65,36 @@ func main() {
 					Name:  "no-bundle",
 					Usage: "Do not create a certificate bundle by adding the issuers certificate to the new certificate.",
 				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print a JSON description of the new certificates and their files to stdout, an array like the one of list --json for --domains and a single object for --csr.",
+				},
+				cli.IntFlag{
+					Name:  "max-names",
+					Value: acme.DefaultMaxNamesPerCertificate,
+					Usage: "The number of names the CA accepts in one certificate. More --domains are split into several certificates, each saved under its first domain.",
+				},
 			},
 		},
 		{
 			Name:   "revoke",
 			Usage:  "Revoke a certificate",
 			Action: revoke,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "reason",
+					Value: "unspecified",
+					Usage: "The RFC 5280 revocation reason, by name or code, e.g. keyCompromise (1) or superseded (4).",
+				},
+				cli.BoolFlag{
+					Name:  "keep",
+					Usage: "Keep the certificate files after revoking the certificate.",
+				},
+				cli.BoolFlag{
+					Name:  "yes",
+					Usage: "Confirm the revocation. Revoking cannot be undone, so revoke refuses to run without it.",
+				},
+			},
 		},
 		{
 			Name:   "renew",
@@ -78,13 +103,21 @@ func main() {
 			Flags: []cli.Flag{
 				cli.IntFlag{
 					Name:  "days",
-					Value: 0,
+					Value: 30,
 					Usage: "The number of days left on a certificate to renew it.",
 				},
+				cli.BoolFlag{
+					Name:  "force",
+					Usage: "Renew the certificate regardless of the days left, e.g. after a key compromise.",
+				},
 				cli.BoolFlag{
 					Name:  "reuse-key",
 					Usage: "Used to indicate you want to reuse your current private key for the new certificate.",
 				},
+				cli.BoolFlag{
+					Name:  "reuse-subject",
+					Usage: "Request the new certificate with the organization, country, province and locality of the current one.",
+				},
 				cli.BoolFlag{
 					Name:  "no-bundle",
 					Usage: "Do not create a certificate bundle by adding the issuers certificate to the new certificate.",
@@ -92,9 +125,97 @@ func main() {
 			},
 		},
 		{
-			Name:   "dnshelp",
-			Usage:  "Shows additional help for the --dns global option",
-			Action: dnshelp,
+			Name:   "rollover-key",
+			Usage:  "Replace the account key with a newly generated one and print the SHA-256 fingerprint of its public key",
+			Action: rolloverKey,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "key-type",
+					Usage: "Key type of the new account key. Supported: rsa2048, rsa4096, rsa8192, ec256, ec384. Defaults to the type of the current key.",
+				},
+			},
+		},
+		{
+			Name:   "check",
+			Usage:  "Check the DNS provider, nameservers and CA for the first domain before running lego. Needs --domains and --dns",
+			Action: check,
+		},
+		{
+			Name:   "list",
+			Usage:  "List the stored certificates, soonest to expire first. Exits with status 1 if one expires within 7 days",
+			Action: list,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the certificates as a JSON array instead of a table.",
+				},
+			},
+		},
+		{
+			Name:   "pins",
+			Usage:  "Print a Public-Key-Pins (HPKP) header value pinning the keys of a stored certificate, its issuers and backup keys",
+			Action: pins,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "domain",
+					Usage: "Domain of the certificate. Defaults to the first of --domains.",
+				},
+				cli.StringSliceFlag{
+					Name:  "backup-key",
+					Usage: "PEM file with a backup key to pin: a public or private key, a CSR or a certificate. Can be repeated.",
+				},
+				cli.IntFlag{
+					Name:  "max-age",
+					Value: 5184000,
+					Usage: "Number of seconds browsers remember the pins.",
+				},
+				cli.BoolFlag{
+					Name:  "include-subdomains",
+					Usage: "Apply the pins to the subdomains as well.",
+				},
+			},
+		},
+		{
+			Name:   "tlsa",
+			Usage:  "Print a DANE TLSA record for a stored certificate, ready to paste into a zone file",
+			Action: tlsa,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "domain",
+					Usage: "Domain of the certificate. Defaults to the first of --domains.",
+				},
+				cli.IntFlag{
+					Name:  "port",
+					Value: 25,
+					Usage: "Port of the service the record is for.",
+				},
+				cli.StringFlag{
+					Name:  "protocol",
+					Value: "tcp",
+					Usage: "Transport protocol of the service the record is for.",
+				},
+				cli.IntFlag{
+					Name:  "usage",
+					Value: 3,
+					Usage: "Certificate usage: 0 (PKIX-TA), 1 (PKIX-EE), 2 (DANE-TA) or 3 (DANE-EE). 0 and 2 match the issuer of the certificate.",
+				},
+				cli.IntFlag{
+					Name:  "selector",
+					Value: 1,
+					Usage: "Selector: 0 (full certificate) or 1 (SubjectPublicKeyInfo).",
+				},
+				cli.IntFlag{
+					Name:  "matching-type",
+					Value: 1,
+					Usage: "Matching type: 0 (exact), 1 (SHA-256) or 2 (SHA-512).",
+				},
+			},
+		},
+		{
+			Name:      "dnshelp",
+			Usage:     "Shows additional help for the --dns global option",
+			ArgsUsage: "[provider...]",
+			Action:    dnshelp,
 		},
 	}
 
@@ -109,13 +230,29 @@ func main() {
 		},
 		cli.StringFlag{
 			Name:  "server, s",
-			Value: "https://acme-v01.api.letsencrypt.org/directory",
+			Value: acme.LEDirectoryProduction,
 			Usage: "CA hostname (and optionally :port). The server certificate must be trusted in order to avoid further modifications to the client.",
 		},
+		cli.BoolFlag{
+			Name:  "staging",
+			Usage: "Use the Let's Encrypt staging server. Staging certificates are not trusted and are stored separately in the 'staging' subdirectory of --path.",
+		},
+		cli.StringFlag{
+			Name:  "ca-bundle",
+			Usage: "PEM file with the root certificate(s) used to verify the TLS certificate of the CA, if it is not signed by a public root.",
+		},
 		cli.StringFlag{
 			Name:  "email, m",
 			Usage: "Email used for registration and recovery contact.",
 		},
+		cli.BoolFlag{
+			Name:  "account-email-env",
+			Usage: "Read the account email address from the LEGO_ACCOUNT_EMAIL environment variable instead of --email.",
+		},
+		cli.BoolFlag{
+			Name:  "account-key-env",
+			Usage: "Read the PEM encoded account key from the LEGO_ACCOUNT_KEY environment variable instead of the account's key file. No key file is written.",
+		},
 		cli.BoolFlag{
 			Name:  "accept-tos, a",
 			Usage: "By setting this flag to true you indicate that you accept the current Let's Encrypt terms of service.",
@@ -135,8 +272,14 @@ func main() {
 			Usage: "Explicitly disallow solvers by name from being used. Solvers: \"http-01\", \"tls-sni-01\".",
 		},
 		cli.StringFlag{
-			Name:  "webroot",
-			Usage: "Set the webroot folder to use for HTTP based challenges to write directly in a file in .well-known/acme-challenge",
+			Name:   "webroot",
+			Usage:  "Set the webroot folder to use for HTTP based challenges to write directly in a file in .well-known/acme-challenge",
+			EnvVar: "LEGO_HTTP_WEBROOT",
+		},
+		cli.StringFlag{
+			Name:   "redis-url",
+			Usage:  "Set the Redis server to store HTTP based challenges in, e.g. redis://localhost:6379/0. Challenges expire after five minutes.",
+			EnvVar: "LEGO_HTTP_REDIS_URL",
 		},
 		cli.StringSliceFlag{
 			Name:  "memcached-host",
@@ -146,14 +289,43 @@ func main() {
 			Name:  "http",
 			Usage: "Set the port and interface to use for HTTP based challenges to listen on. Supported: interface:port or :port",
 		},
+		cli.StringFlag{
+			Name:   "http-port",
+			Value:  "80",
+			Usage:  "Set the port to use for HTTP based challenges to listen on. Any port but 80 needs traffic to port 80 forwarded to it. Ignored if --http is set.",
+			EnvVar: "LEGO_HTTP_PORT",
+		},
+		cli.StringFlag{
+			Name:   "http-bind",
+			Usage:  "Set the interface to use for HTTP based challenges to listen on. Defaults to all interfaces. Ignored if --http is set.",
+			EnvVar: "LEGO_HTTP_BIND",
+		},
 		cli.StringFlag{
 			Name:  "tls",
-			Usage: "Set the port and interface to use for TLS based challenges to listen on. Supported: interface:port or :port",
+			Usage: "Set the port and interface to use for TLS based challenges to listen on. Supported: interface:port or :port. Implies --tls-sni.",
+		},
+		cli.BoolFlag{
+			Name:  "tls-sni",
+			Usage: "Allow solving the deprecated TLS-SNI-01 challenge, for ACME servers which still offer it.",
 		},
 		cli.StringFlag{
 			Name:  "dns",
 			Usage: "Solve a DNS challenge using the specified provider. Disables all other challenges. Run 'lego dnshelp' for help on usage.",
 		},
+		cli.BoolFlag{
+			Name:  "detect-provider",
+			Usage: "Choose the DNS provider for --dns from the NS records of the first domain. Only works for DNS hosts with well-known nameservers.",
+		},
+		cli.StringSliceFlag{
+			Name:  "dns-delegate",
+			Usage: "Solve the DNS challenge of a domain whose _acme-challenge record is a CNAME into another zone with the provider of that zone, as domain:provider. Can be specified multiple times.",
+		},
+		cli.IntFlag{
+			Name:   "parallel-challenges",
+			Value:  1,
+			Usage:  "Number of domains to solve challenges for at the same time. Only use values above 1 with DNS providers.",
+			EnvVar: "LEGO_PARALLEL_CHALLENGES",
+		},
 		cli.IntFlag{
 			Name:  "http-timeout",
 			Usage: "Set the HTTP timeout value to a specific value in seconds. The default is 10 seconds.",
@@ -166,10 +338,64 @@ func main() {
 			Name:  "dns-resolvers",
 			Usage: "Set the resolvers to use for performing recursive DNS queries. Supported: host:port. The default is to use Google's DNS resolvers.",
 		},
+		cli.StringFlag{
+			Name:   "dns-resolver-mode",
+			Usage:  "How DNS propagation is checked. \"raw\" queries the resolvers and authoritative nameservers directly, \"system\" uses the resolver of the operating system, \"doh:<url>\" and \"dot:<host:port>\" send all queries to a DNS-over-HTTPS or DNS-over-TLS resolver.",
+			Value:  "raw",
+			EnvVar: "LEGO_DNS_RESOLVER",
+		},
+		cli.StringFlag{
+			Name:   "dns-dot-pin",
+			Usage:  "Base64 encoded SHA-256 hash of the SubjectPublicKeyInfo of the DNS-over-TLS resolver. If set, the resolver certificate is checked against it instead of the system roots.",
+			EnvVar: "LEGO_DNS_DOT_PIN",
+		},
+		cli.BoolFlag{
+			Name:   "dns-follow-cname",
+			Usage:  "Follow CNAME records on _acme-challenge.<domain> and create the TXT record at the end of the chain.",
+			EnvVar: "LEGO_DNS_FOLLOW_CNAME",
+		},
+		cli.StringFlag{
+			Name:  "preferred-chain",
+			Usage: "If the CA offers several certificate chains, use the one leading to the root with this common name or containing a certificate with this SHA-256 fingerprint.",
+		},
+		cli.StringSliceFlag{
+			Name:  "ct-log",
+			Usage: "Submit issued certificates to this Certificate Transparency log, given by its base URL. The SCTs are saved in the <domain>.sct directory for web servers to serve them.",
+		},
+		cli.BoolFlag{
+			Name:  "strict-linting",
+			Usage: "Fail if zlint finds an error in an issued certificate instead of only logging it. Certificates are linted against RFC 5280, the CA/Browser Forum Baseline Requirements and the Mozilla and Apple root store policies. Needs lego built with the lego_zlint tag.",
+		},
+		cli.StringSliceFlag{
+			Name:  "ct-log-key",
+			Usage: "Verify the SCTs embedded into issued certificates against the PEM encoded ECDSA public key of a Certificate Transparency log in this file. Fails unless one of the SCTs was issued by one of the logs.",
+		},
+		cli.StringFlag{
+			Name:   "deploy-hook",
+			Usage:  "Shell command to run after a certificate was issued or renewed. The certificate is described in the LEGO_CERT_DOMAIN, LEGO_CERT_DOMAINS, LEGO_CERT_SERIAL and LEGO_CERT_NOT_AFTER environment variables.",
+			EnvVar: "LEGO_DEPLOY_HOOK",
+		},
+		cli.StringFlag{
+			Name:   "webhook-url",
+			Usage:  "URL to POST a JSON description of the certificate to after it was issued or renewed.",
+			EnvVar: "LEGO_WEBHOOK_URL",
+		},
 		cli.BoolFlag{
 			Name:  "pem",
 			Usage: "Generate a .pem file by concatanating the .key and .crt files together.",
 		},
+		cli.BoolFlag{
+			Name:  "pfx",
+			Usage: "Generate a .pfx file (PKCS#12) containing the certificate, its issuer and the private key.",
+		},
+		cli.StringFlag{
+			Name:  "pfx-password",
+			Usage: "Password used to protect the .pfx file. Defaults to an empty password.",
+		},
+		cli.IntFlag{
+			Name:  "dhparam",
+			Usage: "Generate a .dhparam.pem file with DH parameters of this many bits, e.g. 2048, for TLS servers using DHE ciphers. Renewals keep an existing file.",
+		},
 	}
 
 	err = app.Run(os.Args)
@@ -179,6 +405,16 @@ func main() {
 }
 
 func dnshelp(c *cli.Context) error {
+	names := dns.Names()
+	if c.NArg() > 0 {
+		names = c.Args()
+	}
+	for _, name := range names {
+		if _, ok := dns.ProviderInfo(name); !ok {
+			return fmt.Errorf("Unrecognised DNS provider: %s", name)
+		}
+	}
+
 	fmt.Printf(
 		`Credentials for DNS providers must be passed through environment variables.
 
@@ -193,22 +429,18 @@ Here is an example bash command using the CloudFlare DNS provider:
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
 	fmt.Fprintln(w, "Valid providers and their associated credential environment variables:")
 	fmt.Fprintln(w)
-	fmt.Fprintln(w, "\tauroradns:\tAURORA_USER_ID, AURORA_KEY, AURORA_ENDPOINT")
-	fmt.Fprintln(w, "\tcloudflare:\tCLOUDFLARE_EMAIL, CLOUDFLARE_API_KEY")
-	fmt.Fprintln(w, "\tdigitalocean:\tDO_AUTH_TOKEN")
-	fmt.Fprintln(w, "\tdnsimple:\tDNSIMPLE_EMAIL, DNSIMPLE_API_KEY")
-	fmt.Fprintln(w, "\tdnsmadeeasy:\tDNSMADEEASY_API_KEY, DNSMADEEASY_API_SECRET")
-	fmt.Fprintln(w, "\tgandi:\tGANDI_API_KEY")
-	fmt.Fprintln(w, "\tgcloud:\tGCE_PROJECT")
-	fmt.Fprintln(w, "\tlinode:\tLINODE_API_KEY")
-	fmt.Fprintln(w, "\tmanual:\tnone")
-	fmt.Fprintln(w, "\tnamecheap:\tNAMECHEAP_API_USER, NAMECHEAP_API_KEY")
-	fmt.Fprintln(w, "\trfc2136:\tRFC2136_TSIG_KEY, RFC2136_TSIG_SECRET,\n\t\tRFC2136_TSIG_ALGORITHM, RFC2136_NAMESERVER")
-	fmt.Fprintln(w, "\troute53:\tAWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_REGION")
-	fmt.Fprintln(w, "\tdyn:\tDYN_CUSTOMER_NAME, DYN_USER_NAME, DYN_PASSWORD")
-	fmt.Fprintln(w, "\tvultr:\tVULTR_API_KEY")
-	fmt.Fprintln(w, "\tovh:\tOVH_ENDPOINT, OVH_APPLICATION_KEY, OVH_APPLICATION_SECRET, OVH_CONSUMER_KEY")
-	fmt.Fprintln(w, "\tpdns:\tPDNS_API_KEY, PDNS_API_URL")
+	for _, name := range names {
+		info, _ := dns.ProviderInfo(name)
+		required := "none"
+		if len(info.Required) > 0 {
+			required = strings.Join(info.Required, ", ")
+		}
+		fmt.Fprintf(w, "\t%s:\t%s\n", name, info.Description)
+		fmt.Fprintf(w, "\t\trequired: %s\n", required)
+		if len(info.Optional) > 0 {
+			fmt.Fprintf(w, "\t\toptional: %s\n", strings.Join(info.Optional, ", "))
+		}
+	}
 	w.Flush()
 
 	fmt.Println(`
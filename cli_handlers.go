@@ -3,35 +3,29 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"path"
+	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/urfave/cli"
 	"github.com/xenolf/lego/acme"
-	"github.com/xenolf/lego/providers/dns/auroradns"
-	"github.com/xenolf/lego/providers/dns/cloudflare"
-	"github.com/xenolf/lego/providers/dns/digitalocean"
-	"github.com/xenolf/lego/providers/dns/dnsimple"
-	"github.com/xenolf/lego/providers/dns/dnsmadeeasy"
-	"github.com/xenolf/lego/providers/dns/dyn"
-	"github.com/xenolf/lego/providers/dns/gandi"
-	"github.com/xenolf/lego/providers/dns/googlecloud"
-	"github.com/xenolf/lego/providers/dns/linode"
-	"github.com/xenolf/lego/providers/dns/namecheap"
-	"github.com/xenolf/lego/providers/dns/ns1"
-	"github.com/xenolf/lego/providers/dns/ovh"
-	"github.com/xenolf/lego/providers/dns/pdns"
-	"github.com/xenolf/lego/providers/dns/rfc2136"
-	"github.com/xenolf/lego/providers/dns/route53"
-	"github.com/xenolf/lego/providers/dns/vultr"
+	"github.com/xenolf/lego/providers/dns"
 	"github.com/xenolf/lego/providers/http/memcached"
+	"github.com/xenolf/lego/providers/http/redis"
 	"github.com/xenolf/lego/providers/http/webroot"
 )
 
@@ -44,24 +38,7 @@ func checkFolder(path string) error {
 
 func setup(c *cli.Context) (*Configuration, *Account, *acme.Client) {
 
-	if c.GlobalIsSet("http-timeout") {
-		acme.HTTPClient = http.Client{Timeout: time.Duration(c.GlobalInt("http-timeout")) * time.Second}
-	}
-
-	if c.GlobalIsSet("dns-timeout") {
-		acme.DNSTimeout = time.Duration(c.GlobalInt("dns-timeout")) * time.Second
-	}
-
-	if len(c.GlobalStringSlice("dns-resolvers")) > 0 {
-		resolvers := []string{}
-		for _, resolver := range c.GlobalStringSlice("dns-resolvers") {
-			if !strings.Contains(resolver, ":") {
-				resolver += ":53"
-			}
-			resolvers = append(resolvers, resolver)
-		}
-		acme.RecursiveNameservers = resolvers
-	}
+	setupNetwork(c)
 
 	err := checkFolder(c.GlobalString("path"))
 	if err != nil {
@@ -69,28 +46,81 @@ func setup(c *cli.Context) (*Configuration, *Account, *acme.Client) {
 	}
 
 	conf := NewConfiguration(c)
-	if len(c.GlobalString("email")) == 0 {
+	if c.GlobalBool("staging") {
+		if c.GlobalIsSet("server") {
+			logger().Fatal("The --staging and --server switches are mutually exclusive.")
+		}
+		logger().Printf("WARNING: Using the Let's Encrypt staging server. Certificates issued by it are NOT trusted and are stored in %s", conf.DataPath())
+	}
+
+	email := c.GlobalString("email")
+	if c.GlobalBool("account-email-env") {
+		if c.GlobalIsSet("email") {
+			logger().Fatal("The --email and --account-email-env switches are mutually exclusive.")
+		}
+		email = os.Getenv("LEGO_ACCOUNT_EMAIL")
+		if len(email) == 0 {
+			logger().Fatal("--account-email-env is set, but LEGO_ACCOUNT_EMAIL is empty.")
+		}
+	}
+	if len(email) == 0 {
 		logger().Fatal("You have to pass an account (email address) to the program using --email or -m")
 	}
 
 	//TODO: move to account struct? Currently MUST pass email.
-	acc := NewAccount(c.GlobalString("email"), conf)
+	var acc *Account
+	if c.GlobalBool("account-key-env") {
+		acc = NewAccountFromEnv(email, conf)
+	} else {
+		acc = NewAccount(email, conf)
+	}
 
 	keyType, err := conf.KeyType()
 	if err != nil {
 		logger().Fatal(err.Error())
 	}
 
-	client, err := acme.NewClient(c.GlobalString("server"), acc, keyType)
+	// The directory rarely changes, so it is fetched at most once an hour.
+	acme.DirectoryCacheTTL = time.Hour
+	if ttl := os.Getenv("LEGO_DIRECTORY_CACHE_TTL"); ttl != "" {
+		acme.DirectoryCacheTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			logger().Fatalf("Invalid LEGO_DIRECTORY_CACHE_TTL %q, expected a duration like 30m", ttl)
+		}
+	}
+	acme.DirectoryCacheFile = path.Join(c.GlobalString("path"), "directories.json")
+
+	client, err := acme.NewClient(conf.Server(), acc, keyType)
 	if err != nil {
 		logger().Fatalf("Could not create client: %s", err.Error())
 	}
 
+	// Without a persistent account.json, the registration of a key from the
+	// environment is looked up again on every run.
+	if acc.keyFromEnv && acc.Registration == nil {
+		logger().Printf("No registration saved for account %s, looking it up by the key from LEGO_ACCOUNT_KEY.", email)
+		reg, err := client.Register()
+		if err != nil {
+			logger().Fatalf("Could not complete registration\n\t%s", err.Error())
+		}
+		acc.Registration = reg
+		acc.Save()
+	}
+
+	client.SetParallelChallenges(c.GlobalInt("parallel-challenges"))
+
 	if len(c.GlobalStringSlice("exclude")) > 0 {
 		client.ExcludeChallenges(conf.ExcludedSolvers())
 	}
 
-	if c.GlobalIsSet("webroot") {
+	// TLS-SNI-01 is deprecated, only solve it when asked to.
+	if !c.GlobalBool("tls-sni") && !c.GlobalIsSet("tls") {
+		client.ExcludeChallenges([]acme.Challenge{acme.TLSSNI01})
+	} else {
+		logger().Print("TLS-SNI-01 is deprecated and will only work with ACME servers still offering it.")
+	}
+
+	if c.GlobalString("webroot") != "" {
 		provider, err := webroot.NewHTTPProvider(c.GlobalString("webroot"))
 		if err != nil {
 			logger().Fatal(err)
@@ -114,11 +144,28 @@ func setup(c *cli.Context) (*Configuration, *Account, *acme.Client) {
 		// infer that the user also wants to exclude all other challenges
 		client.ExcludeChallenges([]acme.Challenge{acme.DNS01, acme.TLSSNI01})
 	}
+	if c.GlobalString("redis-url") != "" {
+		provider, err := redis.NewHTTPProvider(c.GlobalString("redis-url"))
+		if err != nil {
+			logger().Fatal(err)
+		}
+
+		client.SetChallengeProvider(acme.HTTP01, provider)
+
+		// --redis-url=foo indicates that the user specifically want to do a HTTP challenge
+		// infer that the user also wants to exclude all other challenges
+		client.ExcludeChallenges([]acme.Challenge{acme.DNS01, acme.TLSSNI01})
+	}
 	if c.GlobalIsSet("http") {
 		if strings.Index(c.GlobalString("http"), ":") == -1 {
 			logger().Fatalf("The --http switch only accepts interface:port or :port for its argument.")
 		}
 		client.SetHTTPAddress(c.GlobalString("http"))
+	} else if port, bind := c.GlobalString("http-port"), c.GlobalString("http-bind"); port != "80" || bind != "" {
+		if port != "80" {
+			logger().Printf("Listening for HTTP challenges on port %s; make sure port 80 is forwarded to it.", port)
+		}
+		client.SetHTTPAddress(net.JoinHostPort(bind, port))
 	}
 
 	if c.GlobalIsSet("tls") {
@@ -128,66 +175,170 @@ func setup(c *cli.Context) (*Configuration, *Account, *acme.Client) {
 		client.SetTLSAddress(c.GlobalString("tls"))
 	}
 
-	if c.GlobalIsSet("dns") {
-		var err error
-		var provider acme.ChallengeProvider
-		switch c.GlobalString("dns") {
-		case "auroradns":
-			provider, err = auroradns.NewDNSProvider()
-		case "cloudflare":
-			provider, err = cloudflare.NewDNSProvider()
-		case "digitalocean":
-			provider, err = digitalocean.NewDNSProvider()
-		case "dnsimple":
-			provider, err = dnsimple.NewDNSProvider()
-		case "dnsmadeeasy":
-			provider, err = dnsmadeeasy.NewDNSProvider()
-		case "dyn":
-			provider, err = dyn.NewDNSProvider()
-		case "gandi":
-			provider, err = gandi.NewDNSProvider()
-		case "gcloud":
-			provider, err = googlecloud.NewDNSProvider()
-		case "linode":
-			provider, err = linode.NewDNSProvider()
-		case "manual":
-			provider, err = acme.NewDNSProviderManual()
-		case "namecheap":
-			provider, err = namecheap.NewDNSProvider()
-		case "route53":
-			provider, err = route53.NewDNSProvider()
-		case "rfc2136":
-			provider, err = rfc2136.NewDNSProvider()
-		case "vultr":
-			provider, err = vultr.NewDNSProvider()
-		case "ovh":
-			provider, err = ovh.NewDNSProvider()
-		case "pdns":
-			provider, err = pdns.NewDNSProvider()
-		case "ns1":
-			provider, err = ns1.NewDNSProvider()
+	providerName := c.GlobalString("dns")
+	if c.GlobalBool("detect-provider") {
+		if providerName != "" {
+			logger().Fatal("The --dns and --detect-provider switches are mutually exclusive.")
+		}
+		if len(c.GlobalStringSlice("domains")) == 0 {
+			logger().Fatal("The --detect-provider switch needs at least one domain passed with --domains/-d.")
+		}
+
+		domain := c.GlobalStringSlice("domains")[0]
+		providerName, err = acme.DetectProvider(domain)
+		if err != nil {
+			logger().Fatalf("Could not detect the DNS provider of %s: %s", domain, err.Error())
 		}
+		logger().Printf("Detected DNS provider %s for %s", providerName, domain)
+	}
 
+	if providerName != "" {
+		provider, err := dns.NewDNSProvider(providerName)
 		if err != nil {
 			logger().Fatal(err)
 		}
 
 		client.SetChallengeProvider(acme.DNS01, provider)
+		loadPropagationDelays(conf)
 
 		// --dns=foo indicates that the user specifically want to do a DNS challenge
 		// infer that the user also wants to exclude all other challenges
 		client.ExcludeChallenges([]acme.Challenge{acme.HTTP01, acme.TLSSNI01})
 	}
 
+	if c.GlobalIsSet("preferred-chain") {
+		client.SetPreferredChain(c.GlobalString("preferred-chain"))
+	}
+
+	if len(c.GlobalStringSlice("ct-log")) > 0 {
+		var logs []acme.CTLog
+		for _, url := range c.GlobalStringSlice("ct-log") {
+			logs = append(logs, acme.CTLog{URL: url})
+		}
+		client.SetCTLogs(logs)
+	}
+
+	if len(c.GlobalStringSlice("ct-log-key")) > 0 {
+		var keys []*ecdsa.PublicKey
+		for _, file := range c.GlobalStringSlice("ct-log-key") {
+			key, err := loadPublicKey(file)
+			if err != nil {
+				logger().Fatalf("Could not load the CT log key %s: %s", file, err.Error())
+			}
+			ecKey, ok := key.(*ecdsa.PublicKey)
+			if !ok {
+				logger().Fatalf("The CT log key %s is not an ECDSA key.", file)
+			}
+			keys = append(keys, ecKey)
+		}
+		client.VerifyCertificateSCTs(keys)
+	}
+
+	if c.GlobalBool("strict-linting") && !acme.LintingSupported() {
+		logger().Fatal("The --strict-linting switch needs lego built with the lego_zlint tag.")
+	}
+	client.SetStrictLinting(c.GlobalBool("strict-linting"))
+	client.SetDNS01FollowCNAME(c.GlobalBool("dns-follow-cname"))
+
+	for _, delegation := range c.GlobalStringSlice("dns-delegate") {
+		parts := strings.SplitN(delegation, ":", 2)
+		if len(parts) != 2 {
+			logger().Fatalf("Invalid DNS delegation %q, expected domain:provider", delegation)
+		}
+
+		provider, err := dns.NewDNSProvider(parts[1])
+		if err != nil {
+			logger().Fatal(err)
+		}
+		if err := client.SetDNSChallengeDomain(parts[0], provider); err != nil {
+			logger().Fatal(err)
+		}
+	}
+
 	return conf, acc, client
 }
 
+// setupNetwork applies the global options for HTTP requests and DNS queries.
+func setupNetwork(c *cli.Context) {
+	if c.GlobalIsSet("http-timeout") {
+		acme.HTTPClient.Timeout = time.Duration(c.GlobalInt("http-timeout")) * time.Second
+	}
+
+	if c.GlobalIsSet("ca-bundle") {
+		if err := acme.SetCABundle(c.GlobalString("ca-bundle")); err != nil {
+			logger().Fatalf("Could not load CA bundle: %s", err.Error())
+		}
+	}
+
+	if c.GlobalIsSet("dns-timeout") {
+		acme.DNSTimeout = time.Duration(c.GlobalInt("dns-timeout")) * time.Second
+	}
+
+	if len(c.GlobalStringSlice("dns-resolvers")) > 0 {
+		resolvers := []string{}
+		for _, resolver := range c.GlobalStringSlice("dns-resolvers") {
+			if !strings.Contains(resolver, ":") {
+				resolver += ":53"
+			}
+			resolvers = append(resolvers, resolver)
+		}
+		acme.RecursiveNameservers = resolvers
+	}
+	setDomainResolvers(os.Environ())
+
+	if err := setDNSResolver(c.GlobalString("dns-resolver-mode"), c.GlobalString("dns-dot-pin")); err != nil {
+		logger().Fatal(err)
+	}
+}
+
+// setDNSResolver configures how DNS propagation is checked from a mode name
+// or a "doh:<url>" or "dot:<host:port>" resolver specification.
+func setDNSResolver(spec, dotPin string) error {
+	switch {
+	case strings.HasPrefix(spec, "doh:"):
+		return acme.SetDoHResolver(strings.TrimPrefix(spec, "doh:"))
+	case strings.HasPrefix(spec, "dot:"):
+		return acme.SetDoTResolver(strings.TrimPrefix(spec, "dot:"), dotPin)
+	}
+	return acme.SetDNSResolverMode(acme.DNSResolverMode(spec))
+}
+
+// setDomainResolvers overrides the recursive resolvers per domain from
+// LEGO_DNS_RESOLVERS_<domain>=host:port[,host:port] environment variables.
+func setDomainResolvers(environ []string) {
+	const prefix = "LEGO_DNS_RESOLVERS_"
+
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, prefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(kv, prefix), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+
+		var resolvers []string
+		for _, resolver := range strings.Split(parts[1], ",") {
+			resolver = strings.TrimSpace(resolver)
+			if resolver == "" {
+				continue
+			}
+			if !strings.Contains(resolver, ":") {
+				resolver += ":53"
+			}
+			resolvers = append(resolvers, resolver)
+		}
+		acme.SetDomainNameservers(parts[0], resolvers)
+	}
+}
+
 func saveCertRes(certRes acme.CertificateResource, conf *Configuration) {
 	// We store the certificate, private key and metadata in different files
 	// as web servers would not be able to work with a combined file.
 	certOut := path.Join(conf.CertPath(), certRes.Domain+".crt")
 	privOut := path.Join(conf.CertPath(), certRes.Domain+".key")
 	pemOut := path.Join(conf.CertPath(), certRes.Domain+".pem")
+	pfxOut := path.Join(conf.CertPath(), certRes.Domain+".pfx")
 	metaOut := path.Join(conf.CertPath(), certRes.Domain+".json")
 
 	err := ioutil.WriteFile(certOut, certRes.Certificate, 0600)
@@ -209,9 +360,32 @@ func saveCertRes(certRes acme.CertificateResource, conf *Configuration) {
 			}
 		}
 
-	} else if conf.context.GlobalBool("pem") {
+		if conf.context.GlobalBool("pfx") {
+			privKey, err := parsePrivateKey(certRes.PrivateKey)
+			if err != nil {
+				logger().Fatalf("Unable to parse PrivateKey for domain %s\n\t%s", certRes.Domain, err.Error())
+			}
+
+			pfxBytes, err := acme.ToPKCS12(certRes.Certificate, privKey, conf.context.GlobalString("pfx-password"))
+			if err != nil {
+				logger().Fatalf("Unable to encode Certificate and PrivateKey as PKCS#12 for domain %s\n\t%s", certRes.Domain, err.Error())
+			}
+
+			err = ioutil.WriteFile(pfxOut, pfxBytes, 0600)
+			if err != nil {
+				logger().Fatalf("Unable to save Certificate and PrivateKey in .pfx for domain %s\n\t%s", certRes.Domain, err.Error())
+			}
+		}
+
+	} else if conf.context.GlobalBool("pem") || conf.context.GlobalBool("pfx") {
 		// we don't have the private key; can't write the .pem file
-		logger().Fatalf("Unable to save pem without private key for domain %s\n\t%s; are you using a CSR?", certRes.Domain, err.Error())
+		logger().Fatalf("Unable to save pem or pfx without private key for domain %s; are you using a CSR?", certRes.Domain)
+	}
+
+	saveSCTs(certRes, path.Join(conf.CertPath(), certRes.Domain+".sct"))
+
+	if bits := conf.context.GlobalInt("dhparam"); bits > 0 {
+		saveDHParams(certRes.Domain, bits, path.Join(conf.CertPath(), certRes.Domain+".dhparam.pem"))
 	}
 
 	jsonBytes, err := json.MarshalIndent(certRes, "", "\t")
@@ -223,6 +397,129 @@ func saveCertRes(certRes acme.CertificateResource, conf *Configuration) {
 	if err != nil {
 		logger().Fatalf("Unable to save CertResource for domain %s\n\t%s", certRes.Domain, err.Error())
 	}
+
+	savePropagationDelays(conf)
+}
+
+// removeCertRes deletes the files saveCertRes wrote for domain.
+func removeCertRes(domain string, conf *Configuration) {
+	for _, ext := range []string{".crt", ".key", ".pem", ".pfx", ".json", ".dhparam.pem"} {
+		err := os.Remove(path.Join(conf.CertPath(), domain+ext))
+		if err != nil && !os.IsNotExist(err) {
+			logger().Printf("Unable to remove %s%s\n\t%s", domain, ext, err.Error())
+		}
+	}
+	if err := os.RemoveAll(path.Join(conf.CertPath(), domain+".sct")); err != nil {
+		logger().Printf("Unable to remove %s.sct\n\t%s", domain, err.Error())
+	}
+}
+
+// saveDHParams writes DH parameters of bits bits to file unless it exists.
+// They need not change with the certificate, so renewals keep them.
+func saveDHParams(domain string, bits int, file string) {
+	if _, err := os.Stat(file); err == nil {
+		return
+	}
+
+	logger().Printf("Generating %d bit DH parameters for domain %s, this may take a while", bits, domain)
+	params, err := acme.GenerateDHParams(bits)
+	if err != nil {
+		logger().Fatalf("Unable to generate DH parameters for domain %s\n\t%s", domain, err.Error())
+	}
+	if err := ioutil.WriteFile(file, params, 0600); err != nil {
+		logger().Fatalf("Unable to save DH parameters for domain %s\n\t%s", domain, err.Error())
+	}
+}
+
+// saveSCTs writes one file per SCT into dir, the layout expected by the
+// nginx-ct and Apache mod_ssl_ct modules. SCTs of a previous certificate
+// are removed, together with dir if the certificate has none, so web
+// servers do not serve SCTs of another certificate.
+func saveSCTs(certRes acme.CertificateResource, dir string) {
+	if err := os.RemoveAll(dir); err != nil {
+		logger().Fatalf("Unable to remove old SCTs for domain %s\n\t%s", certRes.Domain, err.Error())
+	}
+	if len(certRes.SCTs) == 0 {
+		return
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		logger().Fatalf("Unable to create SCT directory for domain %s\n\t%s", certRes.Domain, err.Error())
+	}
+
+	for i, sct := range certRes.SCTs {
+		err := ioutil.WriteFile(path.Join(dir, fmt.Sprintf("%d.sct", i)), sct, 0600)
+		if err != nil {
+			logger().Fatalf("Unable to save SCT for domain %s\n\t%s", certRes.Domain, err.Error())
+		}
+	}
+}
+
+// runDeployHooks runs the deploy command and webhook once the certificate
+// files are saved. A failing hook is logged; the certificate is kept.
+func runDeployHooks(c *cli.Context, certRes acme.CertificateResource) {
+	var hooks []acme.DeployHook
+	if command := c.GlobalString("deploy-hook"); command != "" {
+		hooks = append(hooks, acme.CommandDeployHook(command))
+	}
+	if url := c.GlobalString("webhook-url"); url != "" {
+		hooks = append(hooks, acme.WebhookDeployHook(url))
+	}
+
+	for _, hook := range hooks {
+		if err := hook(certRes.Domain, &certRes); err != nil {
+			logger().Printf("Deploy hook failed for domain %s\n\t%s", certRes.Domain, err.Error())
+		}
+	}
+}
+
+// loadPropagationDelays seeds the DNS propagation delays observed on
+// previous runs so fast zones are not polled needlessly and slow zones
+// are not checked too early.
+func loadPropagationDelays(conf *Configuration) {
+	jsonBytes, err := ioutil.ReadFile(conf.PropagationPath())
+	if err != nil {
+		return
+	}
+
+	var stored map[string]string
+	if err := json.Unmarshal(jsonBytes, &stored); err != nil {
+		logger().Printf("Ignoring invalid propagation delays in %s: %v", conf.PropagationPath(), err)
+		return
+	}
+
+	delays := make(map[string]time.Duration, len(stored))
+	for zone, delay := range stored {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			continue
+		}
+		delays[zone] = d
+	}
+	acme.SetPropagationDelays(delays)
+}
+
+// savePropagationDelays stores the DNS propagation delays observed so far
+// next to the certificates.
+func savePropagationDelays(conf *Configuration) {
+	delays := acme.PropagationDelays()
+	if len(delays) == 0 {
+		return
+	}
+
+	stored := make(map[string]string, len(delays))
+	for zone, delay := range delays {
+		stored[zone] = delay.String()
+	}
+
+	jsonBytes, err := json.MarshalIndent(stored, "", "\t")
+	if err != nil {
+		logger().Printf("Unable to marshal propagation delays: %v", err)
+		return
+	}
+
+	if err := ioutil.WriteFile(conf.PropagationPath(), jsonBytes, 0600); err != nil {
+		logger().Printf("Unable to save propagation delays: %v", err)
+	}
 }
 
 func handleTOS(c *cli.Context, client *acme.Client, acc *Account) {
@@ -315,7 +612,7 @@ func run(c *cli.Context) error {
 		You should make a secure backup	of this folder now. This
 		configuration directory will also contain certificates and
 		private keys obtained from Let's Encrypt so making regular
-		backups of this folder is ideal.`, conf.AccountPath(c.GlobalString("email")))
+		backups of this folder is ideal.`, conf.AccountPath(acc.Email))
 
 	}
 
@@ -334,12 +631,13 @@ func run(c *cli.Context) error {
 		logger().Fatal("Please specify --domains/-d (or --csr/-c if you already have a CSR)")
 	}
 
-	var cert acme.CertificateResource
+	var certs []acme.CertificateResource
 	var failures map[string]error
 
 	if hasDomains {
-		// obtain a certificate, generating a new private key
-		cert, failures = client.ObtainCertificate(c.GlobalStringSlice("domains"), !c.Bool("no-bundle"), nil)
+		// obtain the certificates, generating a new private key
+		client.SetMaxNamesPerCertificate(c.Int("max-names"))
+		certs, failures = client.ObtainCertificates(c.GlobalStringSlice("domains"), !c.Bool("no-bundle"), nil)
 	} else {
 		// read the CSR
 		csr, err := readCSRFile(c.GlobalString("csr"))
@@ -348,52 +646,97 @@ func run(c *cli.Context) error {
 			failures = map[string]error{"csr": err}
 		} else {
 			// obtain a certificate for this CSR
+			var cert acme.CertificateResource
 			cert, failures = client.ObtainCertificateForCSR(*csr, !c.Bool("no-bundle"))
+			if len(failures) == 0 {
+				certs = append(certs, cert)
+			}
 		}
 	}
 
-	if len(failures) > 0 {
-		for k, v := range failures {
-			logger().Printf("[%s] Could not obtain certificates\n\t%s", k, v.Error())
+	for k, v := range failures {
+		logger().Printf("[%s] Could not obtain certificates\n\t%s", k, v.Error())
+	}
+
+	if len(certs) > 0 {
+		err := checkFolder(conf.CertPath())
+		if err != nil {
+			logger().Fatalf("Could not check/create path: %s", err.Error())
 		}
+	}
 
-		// Make sure to return a non-zero exit code if ObtainSANCertificate
-		// returned at least one error. Due to us not returning partial
-		// certificate we can just exit here instead of at the end.
-		os.Exit(1)
+	// With more domains than fit into one certificate, the certificates
+	// obtained are saved even if others failed.
+	infos := []*certInfo{}
+	for _, cert := range certs {
+		saveCertRes(cert, conf)
+		runDeployHooks(c, cert)
+
+		if c.Bool("json") {
+			info, err := newCertInfo(cert.Domain, conf.CertPath())
+			if err != nil {
+				logger().Fatalf("Could not describe the certificate for domain %s\n\t%s", cert.Domain, err.Error())
+			}
+			infos = append(infos, info)
+		}
 	}
 
-	err := checkFolder(conf.CertPath())
-	if err != nil {
-		logger().Fatalf("Could not check/create path: %s", err.Error())
+	// --domains may be split into several certificates, so they are always
+	// described by an array like the one of list --json. A CSR yields one
+	// certificate.
+	if c.Bool("json") {
+		if hasDomains {
+			printJSON(infos)
+		} else if len(infos) == 1 {
+			printJSON(infos[0])
+		}
 	}
 
-	saveCertRes(cert, conf)
+	// Make sure to return a non-zero exit code if obtaining a certificate
+	// returned at least one error.
+	if len(failures) > 0 {
+		os.Exit(1)
+	}
 
 	return nil
 }
 
 func revoke(c *cli.Context) error {
+	if !c.Bool("yes") {
+		logger().Fatal("Revoking a certificate cannot be undone. Pass --yes to confirm the revocation.")
+	}
+	reason, err := acme.ParseRevocationReason(c.String("reason"))
+	if err != nil {
+		logger().Fatal(err)
+	}
 
 	conf, _, client := setup(c)
 
-	err := checkFolder(conf.CertPath())
+	err = checkFolder(conf.CertPath())
 	if err != nil {
 		logger().Fatalf("Could not check/create path: %s", err.Error())
 	}
 
 	for _, domain := range c.GlobalStringSlice("domains") {
+		domain = acme.NormalizeDomain(domain)
 		logger().Printf("Trying to revoke certificate for domain %s", domain)
 
 		certPath := path.Join(conf.CertPath(), domain+".crt")
 		certBytes, err := ioutil.ReadFile(certPath)
+		if err != nil {
+			logger().Fatalf("Error while loading the certificate for domain %s\n\t%s", domain, err.Error())
+		}
 
-		err = client.RevokeCertificate(certBytes)
+		err = client.RevokeCertificateWithReason(certBytes, reason)
 		if err != nil {
 			logger().Fatalf("Error while revoking the certificate for domain %s\n\t%s", domain, err.Error())
 		} else {
 			logger().Print("Certificate was revoked.")
 		}
+
+		if !c.Bool("keep") {
+			removeCertRes(domain, conf)
+		}
 	}
 
 	return nil
@@ -406,7 +749,7 @@ func renew(c *cli.Context) error {
 		logger().Fatal("Please specify at least one domain.")
 	}
 
-	domain := c.GlobalStringSlice("domains")[0]
+	domain := acme.NormalizeDomain(c.GlobalStringSlice("domains")[0])
 
 	// load the cert resource from files.
 	// We store the certificate, private key and metadata in different files
@@ -420,13 +763,14 @@ func renew(c *cli.Context) error {
 		logger().Fatalf("Error while loading the certificate for domain %s\n\t%s", domain, err.Error())
 	}
 
-	if c.IsSet("days") {
+	if !c.Bool("force") {
 		expTime, err := acme.GetPEMCertExpiration(certBytes)
 		if err != nil {
 			logger().Printf("Could not get Certification expiration for domain %s", domain)
 		}
 
-		if int(expTime.Sub(time.Now()).Hours()/24.0) > c.Int("days") {
+		if daysLeft := int(expTime.Sub(time.Now()).Hours() / 24.0); daysLeft > c.Int("days") {
+			logger().Printf("The certificate for domain %s expires in %d days, not renewing it. Use --force to renew it anyway.", domain, daysLeft)
 			return nil
 		}
 	}
@@ -452,12 +796,331 @@ func renew(c *cli.Context) error {
 
 	certRes.Certificate = certBytes
 
-	newCert, err := client.RenewCertificate(certRes, !c.Bool("no-bundle"))
+	var newCert acme.CertificateResource
+	if c.Bool("reuse-subject") {
+		newCert, err = client.RenewWithExistingSubject(certRes, !c.Bool("no-bundle"))
+	} else {
+		newCert, err = client.RenewCertificate(certRes, !c.Bool("no-bundle"))
+	}
 	if err != nil {
 		logger().Fatalf("%s", err.Error())
 	}
 
 	saveCertRes(newCert, conf)
+	runDeployHooks(c, newCert)
+
+	return nil
+}
+
+func rolloverKey(c *cli.Context) error {
+	if c.GlobalBool("account-key-env") {
+		logger().Fatal("The new account key cannot be stored in LEGO_ACCOUNT_KEY. Roll over the key without --account-key-env, then update LEGO_ACCOUNT_KEY with the new key file.")
+	}
+
+	conf, acc, client := setup(c)
+	if acc.Registration == nil {
+		logger().Fatalf("Account %s is not registered yet, there is no key to roll over.", acc.Email)
+	}
+
+	keyTypeName := c.String("key-type")
+	if keyTypeName == "" {
+		keyTypeName = keyTypeNameOf(acc.key)
+	}
+	keyType, err := parseKeyType(keyTypeName)
+	if err != nil {
+		logger().Fatal(err.Error())
+	}
+
+	newKey, err := generateAccountKey(keyType)
+	if err != nil {
+		logger().Fatalf("Could not generate the new account key: %s", err.Error())
+	}
+	keyBlock, err := pemEncodePrivateKey(newKey)
+	if err != nil {
+		logger().Fatalf("Could not encode the new account key: %s", err.Error())
+	}
+
+	// The new key is on disk before the CA learns about it, so it is not
+	// lost if lego dies halfway. It replaces the old key only once the CA
+	// accepted it.
+	accKeysPath := conf.AccountKeysPath(acc.Email)
+	accKeyPath := path.Join(accKeysPath, acc.Email+".key")
+	tmpFile, err := ioutil.TempFile(accKeysPath, acc.Email+".key.")
+	if err != nil {
+		logger().Fatalf("Could not create a file for the new account key: %s", err.Error())
+	}
+	err = pem.Encode(tmpFile, keyBlock)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		logger().Fatalf("Could not save the new account key: %s", err.Error())
+	}
+
+	if err := client.RolloverKey(newKey); err != nil {
+		// Only a problem document proves that the CA rejected the new key.
+		// After any other error it may have switched the account to it.
+		switch err.(type) {
+		case acme.ProblemDetails, acme.TOSError, acme.RateLimitError:
+			os.Remove(tmpFile.Name())
+			logger().Fatalf("Could not roll over the account key, the old key is still in use\n\t%s", err.Error())
+		}
+		logger().Fatalf("Could not roll over the account key. The new key is kept in %s; if the CA no longer accepts the old key, move it to %s by hand.\n\t%s", tmpFile.Name(), accKeyPath, err.Error())
+	}
+
+	if err := os.Rename(tmpFile.Name(), accKeyPath); err != nil {
+		logger().Fatalf("The CA accepted the new account key, but it could not replace %s. Move %s there by hand.\n\t%s", accKeyPath, tmpFile.Name(), err.Error())
+	}
+
+	fingerprint, err := keyFingerprint(newKey.Public())
+	if err != nil {
+		logger().Fatalf("Could not compute the fingerprint of the new account key: %s", err.Error())
+	}
+	logger().Printf("Rolled over the key of account %s to a new %s key, saved to %s", acc.Email, keyTypeName, accKeyPath)
+	fmt.Println(fingerprint)
+
+	return nil
+}
+
+// keyTypeNameOf returns the --key-type name of a private key.
+func keyTypeNameOf(key crypto.PrivateKey) string {
+	if signer, ok := key.(crypto.Signer); ok {
+		return keyTypeName(signer.Public())
+	}
+	return "unknown"
+}
+
+// listExpiryWarningDays is the number of days left below which lego list
+// exits with a non-zero status.
+const listExpiryWarningDays = 7
+
+func list(c *cli.Context) error {
+	conf := NewConfiguration(c)
+
+	files, err := ioutil.ReadDir(conf.CertPath())
+	if err != nil && !os.IsNotExist(err) {
+		logger().Fatalf("Could not read the certificates directory\n\t%s", err.Error())
+	}
+
+	var certs []*certInfo
+	for _, file := range files {
+		if file.IsDir() || path.Ext(file.Name()) != ".crt" {
+			continue
+		}
+
+		domain := strings.TrimSuffix(file.Name(), ".crt")
+		info, err := newCertInfo(domain, conf.CertPath())
+		if err != nil {
+			logger().Printf("Skipping the certificate for domain %s\n\t%s", domain, err.Error())
+			continue
+		}
+		certs = append(certs, info)
+	}
+	sort.Sort(byExpiry(certs))
+
+	if c.Bool("json") {
+		if certs == nil {
+			certs = []*certInfo{}
+		}
+		printJSON(certs)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "DOMAIN\tSANS\tISSUER\tNOT BEFORE\tNOT AFTER\tDAYS LEFT\tKEY TYPE")
+		for _, info := range certs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", info.Domain, strings.Join(info.SANs, ","), info.Issuer,
+				info.NotBefore.Format("2006-01-02"), info.NotAfter.Format("2006-01-02"), info.daysLeft(), info.KeyType)
+		}
+		w.Flush()
+	}
+
+	for _, info := range certs {
+		if info.daysLeft() < listExpiryWarningDays {
+			logger().Printf("The certificate for domain %s expires in less than %d days.", info.Domain, listExpiryWarningDays)
+			os.Exit(1)
+		}
+	}
+	return nil
+}
+
+// checkResult prints the outcome of one lego check step and records
+// failures.
+type checkResult struct {
+	failed bool
+}
+
+func (r *checkResult) report(name string, err error) bool {
+	if err != nil {
+		r.failed = true
+		fmt.Printf("[FAIL] %s: %s\n", name, err.Error())
+		return false
+	}
+	fmt.Printf("[PASS] %s\n", name)
+	return true
+}
+
+func (r *checkResult) skip(name, reason string) {
+	fmt.Printf("[SKIP] %s: %s\n", name, reason)
+}
+
+func check(c *cli.Context) error {
+	setupNetwork(c)
+	conf := NewConfiguration(c)
+
+	if len(c.GlobalStringSlice("domains")) == 0 || c.GlobalString("dns") == "" {
+		logger().Fatal("Please specify the domain to check with --domains/-d and its DNS provider with --dns.")
+	}
+	domain := c.GlobalStringSlice("domains")[0]
+
+	var result checkResult
+
+	provider, err := dns.NewDNSProvider(c.GlobalString("dns"))
+	result.report(fmt.Sprintf("DNS provider %s is configured", c.GlobalString("dns")), err)
+
+	nameservers, err := acme.CheckNameservers(domain)
+	if result.report(fmt.Sprintf("Nameservers of %s answer", domain), err) {
+		fmt.Printf("       %s\n", strings.Join(nameservers, ", "))
+	}
+
+	const recordName = "Test TXT record can be created and deleted"
+	if provider == nil {
+		result.skip(recordName, "the DNS provider is not configured")
+	} else {
+		result.report(recordName, checkTXTRecord(provider, domain))
+	}
+
+	result.report(fmt.Sprintf("ACME directory %s is reachable", conf.Server()), checkDirectory(conf.Server()))
+
+	if result.failed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// checkTXTRecord presents and cleans up the challenge record of domain with
+// a random key authorization.
+func checkTXTRecord(provider acme.ChallengeProvider, domain string) error {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	keyAuth := "lego-check." + hex.EncodeToString(random)
+
+	if err := provider.Present(domain, "lego-check", keyAuth); err != nil {
+		return fmt.Errorf("creating the record failed: %v", err)
+	}
+	if err := provider.CleanUp(domain, "lego-check", keyAuth); err != nil {
+		return fmt.Errorf("deleting the record failed: %v", err)
+	}
+	return nil
+}
+
+// checkDirectory fetches the ACME directory at url.
+func checkDirectory(url string) error {
+	resp, err := acme.HTTPClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var directory struct {
+		NewReg string `json:"new-reg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&directory); err != nil || directory.NewReg == "" {
+		return fmt.Errorf("the response is no ACME directory")
+	}
+	return nil
+}
+
+// certificateDomain returns the domain passed with --domain, or the first
+// one passed with --domains.
+func certificateDomain(c *cli.Context) string {
+	if domain := c.String("domain"); domain != "" {
+		return acme.NormalizeDomain(domain)
+	}
+	if domains := c.GlobalStringSlice("domains"); len(domains) > 0 {
+		return acme.NormalizeDomain(domains[0])
+	}
+	logger().Fatal("Please specify the domain of the certificate with --domain.")
+	return ""
+}
+
+// loadCertificateChain returns the certificates of the stored bundle of
+// domain, the issued certificate first.
+func loadCertificateChain(conf *Configuration, domain string) []*x509.Certificate {
+	certPath := path.Join(conf.CertPath(), domain+".crt")
+	certBytes, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		logger().Fatalf("Error while loading the certificate for domain %s\n\t%s", domain, err.Error())
+	}
+	certificates, err := acme.SplitChain(certBytes)
+	if err != nil {
+		logger().Fatalf("Could not parse the certificate %s\n\t%s", certPath, err.Error())
+	}
+	return certificates
+}
+
+func pins(c *cli.Context) error {
+	conf := NewConfiguration(c)
+	certificates := loadCertificateChain(conf, certificateDomain(c))
+
+	var backupKeys []crypto.PublicKey
+	for _, file := range c.StringSlice("backup-key") {
+		key, err := loadPublicKey(file)
+		if err != nil {
+			logger().Fatalf("Could not load the backup key %s\n\t%s", file, err.Error())
+		}
+		backupKeys = append(backupKeys, key)
+	}
+	if len(backupKeys) == 0 {
+		logger().Print("WARNING: Browsers ignore a Public-Key-Pins header without a backup pin. Pass a key kept offline with --backup-key.")
+	}
+
+	// The issuer certificates are pinned as well, so a renewal with a new
+	// key does not lock clients out.
+	var values []string
+	for i, cert := range certificates {
+		keys := backupKeys
+		if i > 0 {
+			keys = nil
+		}
+		for _, pin := range acme.CertificatePublicKeyPins(cert, keys...) {
+			values = append(values, fmt.Sprintf("pin-sha256=%q", pin))
+		}
+	}
+	values = append(values, fmt.Sprintf("max-age=%d", c.Int("max-age")))
+	if c.Bool("include-subdomains") {
+		values = append(values, "includeSubDomains")
+	}
+
+	fmt.Println(strings.Join(values, "; "))
+	return nil
+}
+
+func tlsa(c *cli.Context) error {
+	conf := NewConfiguration(c)
+	domain := certificateDomain(c)
+	certificates := loadCertificateChain(conf, domain)
+
+	// The trust anchor usages match the issuer of the certificate.
+	cert := certificates[0]
+	usage := c.Int("usage")
+	if usage == 0 || usage == 2 {
+		if len(certificates) < 2 {
+			logger().Fatalf("The certificate for domain %s is not bundled with its issuer, which TLSA usage %d matches.", domain, usage)
+		}
+		cert = certificates[1]
+	}
+
+	record, err := acme.GenerateTLSA(cert, usage, c.Int("selector"), c.Int("matching-type"))
+	if err != nil {
+		logger().Fatal(err.Error())
+	}
 
+	fmt.Printf("_%d._%s.%s. IN TLSA %s\n", c.Int("port"), c.String("protocol"), strings.TrimSuffix(domain, "."), record)
 	return nil
 }
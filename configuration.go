@@ -23,7 +23,12 @@ func NewConfiguration(c *cli.Context) *Configuration {
 
 // KeyType the type from which private keys should be generated
 func (c *Configuration) KeyType() (acme.KeyType, error) {
-	switch strings.ToUpper(c.context.GlobalString("key-type")) {
+	return parseKeyType(c.context.GlobalString("key-type"))
+}
+
+// parseKeyType returns the acme.KeyType of a --key-type name like rsa2048.
+func parseKeyType(name string) (acme.KeyType, error) {
+	switch strings.ToUpper(name) {
 	case "RSA2048":
 		return acme.RSA2048, nil
 	case "RSA4096":
@@ -36,7 +41,7 @@ func (c *Configuration) KeyType() (acme.KeyType, error) {
 		return acme.EC384, nil
 	}
 
-	return "", fmt.Errorf("Unsupported KeyType: %s", c.context.GlobalString("key-type"))
+	return "", fmt.Errorf("Unsupported KeyType: %s", name)
 }
 
 // ExcludedSolvers is a list of solvers that are to be excluded.
@@ -47,22 +52,45 @@ func (c *Configuration) ExcludedSolvers() (cc []acme.Challenge) {
 	return
 }
 
+// Server returns the directory URL of the CA to use.
+func (c *Configuration) Server() string {
+	if c.context.GlobalBool("staging") {
+		return acme.LEDirectoryStaging
+	}
+	return c.context.GlobalString("server")
+}
+
 // ServerPath returns the OS dependent path to the data for a specific CA
 func (c *Configuration) ServerPath() string {
-	srv, _ := url.Parse(c.context.GlobalString("server"))
+	srv, _ := url.Parse(c.Server())
 	srvStr := strings.Replace(srv.Host, ":", "_", -1)
 	return strings.Replace(srvStr, "/", string(os.PathSeparator), -1)
 }
 
+// DataPath returns the directory all data is stored in. Staging data is kept
+// in a separate subdirectory so it never mixes with production certificates.
+func (c *Configuration) DataPath() string {
+	if c.context.GlobalBool("staging") {
+		return path.Join(c.context.GlobalString("path"), "staging")
+	}
+	return c.context.GlobalString("path")
+}
+
 // CertPath gets the path for certificates.
 func (c *Configuration) CertPath() string {
-	return path.Join(c.context.GlobalString("path"), "certificates")
+	return path.Join(c.DataPath(), "certificates")
+}
+
+// PropagationPath gets the path of the file holding the observed DNS
+// propagation delays per zone.
+func (c *Configuration) PropagationPath() string {
+	return path.Join(c.CertPath(), "propagation.json")
 }
 
 // AccountsPath returns the OS dependent path to the
 // local accounts for a specific CA
 func (c *Configuration) AccountsPath() string {
-	return path.Join(c.context.GlobalString("path"), "accounts", c.ServerPath())
+	return path.Join(c.DataPath(), "accounts", c.ServerPath())
 }
 
 // AccountPath returns the OS dependent path to a particular account
@@ -5,11 +5,17 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+
+	"github.com/xenolf/lego/acme"
 )
 
 func generatePrivateKey(file string) (crypto.PrivateKey, error) {
@@ -43,7 +49,14 @@ func loadPrivateKey(file string) (crypto.PrivateKey, error) {
 		return nil, err
 	}
 
+	return parsePrivateKey(keyBytes)
+}
+
+func parsePrivateKey(keyBytes []byte) (crypto.PrivateKey, error) {
 	keyBlock, _ := pem.Decode(keyBytes)
+	if keyBlock == nil {
+		return nil, errors.New("Could not decode PEM private key.")
+	}
 
 	switch keyBlock.Type {
 	case "RSA PRIVATE KEY":
@@ -54,3 +67,101 @@ func loadPrivateKey(file string) (crypto.PrivateKey, error) {
 
 	return nil, errors.New("Unknown private key type.")
 }
+
+// generateAccountKey generates a new account key of keyType.
+func generateAccountKey(keyType acme.KeyType) (crypto.Signer, error) {
+	switch keyType {
+	case acme.EC256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case acme.EC384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case acme.RSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case acme.RSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case acme.RSA8192:
+		return rsa.GenerateKey(rand.Reader, 8192)
+	}
+
+	return nil, fmt.Errorf("Invalid KeyType: %s", keyType)
+}
+
+// pemEncodePrivateKey returns the PEM block of an RSA or EC private key as
+// read by parsePrivateKey.
+func pemEncodePrivateKey(key crypto.PrivateKey) (*pem.Block, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}, nil
+	case *ecdsa.PrivateKey:
+		keyBytes, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}, nil
+	}
+
+	return nil, errors.New("Unknown private key type.")
+}
+
+// keyFingerprint returns the hex encoded SHA-256 digest of the DER encoded
+// public key, as printed by
+// openssl pkey -pubout -outform DER | sha256sum.
+func keyFingerprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// loadPublicKey returns the public key in the first PEM block of file,
+// which may hold a public key, a private key, a CSR or a certificate.
+func loadPublicKey(file string) (crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("Could not decode PEM data.")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		privKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := privKey.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("Unknown private key type.")
+		}
+		return signer.Public(), nil
+	case "CERTIFICATE REQUEST":
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return csr.PublicKey, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+
+	privKey, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("Unknown private key type.")
+	}
+	return signer.Public(), nil
+}
@@ -6,21 +6,32 @@ import (
 	"github.com/edeckers/auroradnsclient/records"
 	"github.com/edeckers/auroradnsclient/zones"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 	"os"
 	"sync"
 )
 
 // DNSProvider describes a provider for AuroraDNS
 type DNSProvider struct {
-	recordIDs   map[string]string
+	recordIDs   map[string]string // by fqdn and value of the record
 	recordIDsMu sync.Mutex
 	client      *auroradnsclient.AuroraDNSClient
 }
 
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("AuroraDNS", "AURORA_USER_ID", "AURORA_KEY")
+}
+
 // NewDNSProvider returns a DNSProvider instance configured for AuroraDNS.
 // Credentials must be passed in the environment variables: AURORA_USER_ID
 // and AURORA_KEY.
 func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
 	userID := os.Getenv("AURORA_USER_ID")
 	key := os.Getenv("AURORA_KEY")
 
@@ -66,7 +77,7 @@ func (provider *DNSProvider) getZoneInformationByName(name string) (zones.ZoneRe
 func (provider *DNSProvider) Present(domain, token, keyAuth string) error {
 	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
 
-	authZone, err := acme.FindZoneByFqdn(acme.ToFqdn(domain), acme.RecursiveNameservers)
+	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
 		return fmt.Errorf("Could not determine zone for domain: '%s'. %s", domain, err)
 	}
@@ -98,7 +109,7 @@ func (provider *DNSProvider) Present(domain, token, keyAuth string) error {
 	}
 
 	provider.recordIDsMu.Lock()
-	provider.recordIDs[fqdn] = respData.ID
+	provider.recordIDs[fqdn+" "+value] = respData.ID
 	provider.recordIDsMu.Unlock()
 
 	return nil
@@ -106,17 +117,17 @@ func (provider *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes a given record that was generated by Present
 func (provider *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
 
 	provider.recordIDsMu.Lock()
-	recordID, ok := provider.recordIDs[fqdn]
+	recordID, ok := provider.recordIDs[fqdn+" "+value]
 	provider.recordIDsMu.Unlock()
 
 	if !ok {
 		return fmt.Errorf("Unknown recordID for '%s'", fqdn)
 	}
 
-	authZone, err := acme.FindZoneByFqdn(acme.ToFqdn(domain), acme.RecursiveNameservers)
+	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
 		return fmt.Errorf("Could not determine zone for domain: '%s'. %s", domain, err)
 	}
@@ -134,7 +145,7 @@ func (provider *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 	}
 
 	provider.recordIDsMu.Lock()
-	delete(provider.recordIDs, fqdn)
+	delete(provider.recordIDs, fqdn+" "+value)
 	provider.recordIDsMu.Unlock()
 
 	return nil
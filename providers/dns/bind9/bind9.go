@@ -0,0 +1,87 @@
+// Package bind9 implements a DNS provider for solving the DNS-01 challenge
+// using TSIG signed dynamic updates to a BIND9 nameserver.
+package bind9
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+	"github.com/xenolf/lego/providers/dns/rfc2136"
+)
+
+// DefaultKeyAlgorithm is the TSIG algorithm used when BIND9_KEY_ALGORITHM is
+// not set. It is the default of tsig-keygen and ddns-confgen.
+const DefaultKeyAlgorithm = dns.HmacSHA256
+
+// keyAlgorithms maps the algorithm names of named.conf to the TSIG
+// algorithm names sent on the wire.
+var keyAlgorithms = map[string]string{
+	"hmac-md5":                 dns.HmacMD5,
+	"hmac-md5.sig-alg.reg.int": dns.HmacMD5,
+	"hmac-sha1":                dns.HmacSHA1,
+	"hmac-sha256":              dns.HmacSHA256,
+	"hmac-sha512":              dns.HmacSHA512,
+}
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that sends the same dynamic updates as nsupdate to a BIND9 nameserver.
+// Unlike the rfc2136 provider, it requires a TSIG key, as BIND9 rejects
+// unsigned updates unless allow-update is opened up to IP addresses.
+type DNSProvider struct {
+	*rfc2136.DNSProvider
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("BIND9", "BIND9_HOST", "BIND9_KEY_NAME", "BIND9_KEY_SECRET")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured from the
+// environment variables BIND9_HOST, BIND9_PORT (defaults to 53),
+// BIND9_KEY_NAME, BIND9_KEY_SECRET and BIND9_KEY_ALGORITHM (defaults to
+// hmac-sha256). The key is the one named in the allow-update or
+// update-policy statement of the zone.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
+	return NewDNSProviderCredentials(os.Getenv("BIND9_HOST"), os.Getenv("BIND9_PORT"),
+		os.Getenv("BIND9_KEY_NAME"), os.Getenv("BIND9_KEY_SECRET"), os.Getenv("BIND9_KEY_ALGORITHM"))
+}
+
+// NewDNSProviderCredentials uses the supplied credentials to return a
+// DNSProvider instance. An empty port defaults to 53 and an empty algorithm
+// to DefaultKeyAlgorithm. The algorithm may be given as in named.conf, e.g.
+// "hmac-sha512".
+func NewDNSProviderCredentials(host, port, keyName, keySecret, keyAlgorithm string) (*DNSProvider, error) {
+	if host == "" {
+		return nil, fmt.Errorf("BIND9 host missing")
+	}
+	if keyName == "" || keySecret == "" {
+		return nil, fmt.Errorf("BIND9 TSIG key missing")
+	}
+	if port == "" {
+		port = "53"
+	}
+
+	algorithm := DefaultKeyAlgorithm
+	if keyAlgorithm != "" {
+		var ok bool
+		algorithm, ok = keyAlgorithms[strings.TrimSuffix(strings.ToLower(keyAlgorithm), ".")]
+		if !ok {
+			return nil, fmt.Errorf("BIND9 TSIG algorithm %s not supported", keyAlgorithm)
+		}
+	}
+
+	provider, err := rfc2136.NewDNSProviderCredentials(net.JoinHostPort(host, port), algorithm, keyName, keySecret)
+	if err != nil {
+		return nil, err
+	}
+	return &DNSProvider{provider}, nil
+}
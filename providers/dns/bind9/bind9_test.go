@@ -0,0 +1,94 @@
+package bind9
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+const (
+	bind9TestZone      = "example.com."
+	bind9TestKeyName   = "lego."
+	bind9TestKeySecret = "IwBTJx9wrDp4Y1RyC3H0gA=="
+)
+
+func TestNewDNSProviderCredentialsValidation(t *testing.T) {
+	_, err := NewDNSProviderCredentials("", "", bind9TestKeyName, bind9TestKeySecret, "")
+	assert.EqualError(t, err, "BIND9 host missing")
+
+	_, err = NewDNSProviderCredentials("127.0.0.1", "", bind9TestKeyName, "", "")
+	assert.EqualError(t, err, "BIND9 TSIG key missing")
+
+	_, err = NewDNSProviderCredentials("127.0.0.1", "", bind9TestKeyName, bind9TestKeySecret, "hmac-gost")
+	assert.EqualError(t, err, "BIND9 TSIG algorithm hmac-gost not supported")
+}
+
+func TestBind9SignedUpdate(t *testing.T) {
+	for _, test := range []struct {
+		algorithm string
+		expected  string
+	}{
+		{"", dns.HmacSHA256},
+		{"HMAC-SHA512", dns.HmacSHA512},
+		{"hmac-md5", dns.HmacMD5},
+	} {
+		acme.ClearZoneCache()
+
+		updates := make(chan *dns.Msg, 1)
+		dns.HandleFunc(bind9TestZone, func(w dns.ResponseWriter, req *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(req)
+			if req.Opcode == dns.OpcodeQuery {
+				soa, _ := dns.NewRR(fmt.Sprintf("%s 120 IN SOA ns1.%s admin.%s 2016022801 28800 7200 2419200 1200", bind9TestZone, bind9TestZone, bind9TestZone))
+				m.Answer = []dns.RR{soa}
+			} else {
+				if req.IsTsig() == nil || w.TsigStatus() != nil {
+					m.Rcode = dns.RcodeRefused
+				} else {
+					updates <- req
+				}
+			}
+			if req.IsTsig() != nil && w.TsigStatus() == nil {
+				m.SetTsig(bind9TestKeyName, req.IsTsig().Algorithm, 300, time.Now().Unix())
+			}
+			w.WriteMsg(m)
+		})
+
+		server, host, port := runLocalDNSTestServer(t)
+
+		provider, err := NewDNSProviderCredentials(host, port, bind9TestKeyName, bind9TestKeySecret, test.algorithm)
+		require.NoError(t, err)
+		require.NoError(t, provider.Present("www.example.com", "", "123d=="))
+
+		update := <-updates
+		assert.Equal(t, test.expected, update.IsTsig().Algorithm)
+		require.Len(t, update.Ns, 1)
+		assert.Equal(t, "_acme-challenge.www.example.com.", update.Ns[0].Header().Name)
+
+		server.Shutdown()
+		dns.HandleRemove(bind9TestZone)
+	}
+}
+
+func runLocalDNSTestServer(t *testing.T) (*dns.Server, string, string) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &dns.Server{PacketConn: pc, TsigSecret: map[string]string{bind9TestKeyName: bind9TestKeySecret}}
+	waitLock := sync.Mutex{}
+	waitLock.Lock()
+	server.NotifyStartedFunc = waitLock.Unlock
+	go server.ActivateAndServe()
+	waitLock.Lock()
+
+	host, port, err := net.SplitHostPort(pc.LocalAddr().String())
+	require.NoError(t, err)
+	return server, host, port
+}
@@ -9,9 +9,11 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 )
 
 // CloudFlareAPIURL represents the API endpoint to call.
@@ -22,12 +24,28 @@ const CloudFlareAPIURL = "https://api.cloudflare.com/client/v4"
 type DNSProvider struct {
 	authEmail string
 	authKey   string
+	baseURL   string
+
+	// zones caches the IDs of zones by their fqdn for the lifetime of
+	// the provider.
+	zones     map[string]string
+	zonesLock sync.Mutex
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("CloudFlare", "CLOUDFLARE_EMAIL", "CLOUDFLARE_API_KEY")
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for cloudflare.
 // Credentials must be passed in the environment variables: CLOUDFLARE_EMAIL
 // and CLOUDFLARE_API_KEY.
 func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
 	email := os.Getenv("CLOUDFLARE_EMAIL")
 	key := os.Getenv("CLOUDFLARE_API_KEY")
 	return NewDNSProviderCredentials(email, key)
@@ -43,9 +61,43 @@ func NewDNSProviderCredentials(email, key string) (*DNSProvider, error) {
 	return &DNSProvider{
 		authEmail: email,
 		authKey:   key,
+		baseURL:   CloudFlareAPIURL,
+		zones:     map[string]string{},
 	}, nil
 }
 
+// PreloadZones fetches all zones of the account and caches their IDs, so
+// issuing certificates for many zones does not look up each of them.
+func (c *DNSProvider) PreloadZones() error {
+	const perPage = 50
+
+	var zones []hostedZone
+	for page := 1; ; page++ {
+		result, err := c.makeRequest("GET", fmt.Sprintf("/zones?per_page=%d&page=%d", perPage, page), nil)
+		if err != nil {
+			return err
+		}
+
+		var batch []hostedZone
+		if err := json.Unmarshal(result, &batch); err != nil {
+			return err
+		}
+		zones = append(zones, batch...)
+
+		if len(batch) < perPage {
+			break
+		}
+	}
+
+	c.zonesLock.Lock()
+	defer c.zonesLock.Unlock()
+
+	for _, zone := range zones {
+		c.zones[acme.ToFqdn(zone.Name)] = zone.ID
+	}
+	return nil
+}
+
 // Timeout returns the timeout and interval to use when checking for DNS
 // propagation. Adjusting here to cope with spikes in propagation times.
 func (c *DNSProvider) Timeout() (timeout, interval time.Duration) {
@@ -74,6 +126,7 @@ func (c *DNSProvider) Present(domain, token, keyAuth string) error {
 
 	_, err = c.makeRequest("POST", fmt.Sprintf("/zones/%s/dns_records", zoneID), bytes.NewReader(body))
 	if err != nil {
+		c.forgetZoneOnNotFound(zoneID, err)
 		return err
 	}
 
@@ -82,15 +135,16 @@ func (c *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (c *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
 
-	record, err := c.findTxtRecord(fqdn)
+	record, err := c.findTxtRecord(fqdn, value)
 	if err != nil {
 		return err
 	}
 
 	_, err = c.makeRequest("DELETE", fmt.Sprintf("/zones/%s/dns_records/%s", record.ZoneID, record.ID), nil)
 	if err != nil {
+		c.forgetZoneOnNotFound(record.ZoneID, err)
 		return err
 	}
 
@@ -98,36 +152,63 @@ func (c *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 }
 
 func (c *DNSProvider) getHostedZoneID(fqdn string) (string, error) {
-	// HostedZone represents a CloudFlare DNS zone
-	type HostedZone struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-	}
-
 	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
 		return "", err
 	}
 
+	return c.zoneID(authZone, fqdn)
+}
+
+// zoneID returns the ID of authZone from the cache, looking it up on a miss.
+func (c *DNSProvider) zoneID(authZone, fqdn string) (string, error) {
+	c.zonesLock.Lock()
+	id, ok := c.zones[authZone]
+	c.zonesLock.Unlock()
+	if ok {
+		return id, nil
+	}
+
 	result, err := c.makeRequest("GET", "/zones?name="+acme.UnFqdn(authZone), nil)
 	if err != nil {
 		return "", err
 	}
 
-	var hostedZone []HostedZone
-	err = json.Unmarshal(result, &hostedZone)
+	var hostedZones []hostedZone
+	err = json.Unmarshal(result, &hostedZones)
 	if err != nil {
 		return "", err
 	}
 
-	if len(hostedZone) != 1 {
+	if len(hostedZones) != 1 {
 		return "", fmt.Errorf("Zone %s not found in CloudFlare for domain %s", authZone, fqdn)
 	}
 
-	return hostedZone[0].ID, nil
+	c.zonesLock.Lock()
+	c.zones[authZone] = hostedZones[0].ID
+	c.zonesLock.Unlock()
+
+	return hostedZones[0].ID, nil
+}
+
+// forgetZoneOnNotFound drops zoneID from the cache if err says the API
+// could not find it, e.g. because the zone was deleted and added again.
+func (c *DNSProvider) forgetZoneOnNotFound(zoneID string, err error) {
+	if _, ok := err.(notFoundError); !ok {
+		return
+	}
+
+	c.zonesLock.Lock()
+	defer c.zonesLock.Unlock()
+
+	for zone, id := range c.zones {
+		if id == zoneID {
+			delete(c.zones, zone)
+		}
+	}
 }
 
-func (c *DNSProvider) findTxtRecord(fqdn string) (*cloudFlareRecord, error) {
+func (c *DNSProvider) findTxtRecord(fqdn, value string) (*cloudFlareRecord, error) {
 	zoneID, err := c.getHostedZoneID(fqdn)
 	if err != nil {
 		return nil, err
@@ -139,6 +220,7 @@ func (c *DNSProvider) findTxtRecord(fqdn string) (*cloudFlareRecord, error) {
 		nil,
 	)
 	if err != nil {
+		c.forgetZoneOnNotFound(zoneID, err)
 		return nil, err
 	}
 
@@ -149,7 +231,7 @@ func (c *DNSProvider) findTxtRecord(fqdn string) (*cloudFlareRecord, error) {
 	}
 
 	for _, rec := range records {
-		if rec.Name == acme.UnFqdn(fqdn) {
+		if rec.Name == acme.UnFqdn(fqdn) && rec.Content == value {
 			return &rec, nil
 		}
 	}
@@ -172,7 +254,7 @@ func (c *DNSProvider) makeRequest(method, uri string, body io.Reader) (json.RawM
 		Result  json.RawMessage `json:"result"`
 	}
 
-	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", CloudFlareAPIURL, uri), body)
+	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", c.baseURL, uri), body)
 	if err != nil {
 		return nil, err
 	}
@@ -204,14 +286,30 @@ func (c *DNSProvider) makeRequest(method, uri string, body io.Reader) (json.RawM
 					errStr += fmt.Sprintf("<- %d: %s", chainErr.Code, chainErr.Message)
 				}
 			}
-			return nil, fmt.Errorf("Cloudflare API Error \n%s", errStr)
+			err = fmt.Errorf("Cloudflare API Error \n%s", errStr)
+		} else {
+			err = fmt.Errorf("Cloudflare API error")
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, notFoundError{err}
 		}
-		return nil, fmt.Errorf("Cloudflare API error")
+		return nil, err
 	}
 
 	return r.Result, nil
 }
 
+// notFoundError is returned by makeRequest for API errors with status 404.
+type notFoundError struct {
+	error
+}
+
+// hostedZone represents a CloudFlare DNS zone
+type hostedZone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
 // cloudFlareRecord represents a CloudFlare DNS record
 type cloudFlareRecord struct {
 	Name    string `json:"name"`
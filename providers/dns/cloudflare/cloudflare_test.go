@@ -1,11 +1,17 @@
 package cloudflare
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -49,10 +55,68 @@ func TestNewDNSProviderMissingCredErr(t *testing.T) {
 	os.Setenv("CLOUDFLARE_EMAIL", "")
 	os.Setenv("CLOUDFLARE_API_KEY", "")
 	_, err := NewDNSProvider()
-	assert.EqualError(t, err, "CloudFlare credentials missing")
+	assert.EqualError(t, err, "CloudFlare credentials missing: CLOUDFLARE_EMAIL, CLOUDFLARE_API_KEY")
 	restoreCloudFlareEnv()
 }
 
+func TestCloudFlareZoneCache(t *testing.T) {
+	var requests []string
+	var requestsLock sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsLock.Lock()
+		requests = append(requests, r.URL.Path+"?"+r.URL.RawQuery)
+		requestsLock.Unlock()
+
+		switch {
+		case r.URL.Path == "/zones" && r.URL.Query().Get("page") != "":
+			// two pages of zones, the first one full
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			count := 50
+			if page > 1 {
+				count = 1
+			}
+			zones := ""
+			for i := 0; i < count; i++ {
+				if i > 0 {
+					zones += ","
+				}
+				zones += fmt.Sprintf(`{"id": "id-%d-%d", "name": "zone%d-%d.com"}`, page, i, page, i)
+			}
+			fmt.Fprintf(w, `{"success": true, "result": [%s]}`, zones)
+		case r.URL.Path == "/zones":
+			fmt.Fprintf(w, `{"success": true, "result": [{"id": "id-%s", "name": "%s"}]}`, r.URL.Query().Get("name"), r.URL.Query().Get("name"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"success": false, "errors": [{"code": 7003, "message": "Could not route"}]}`)
+		}
+	}))
+	defer ts.Close()
+
+	provider, err := NewDNSProviderCredentials("test@example.com", "123")
+	require.NoError(t, err)
+	provider.baseURL = ts.URL
+
+	require.NoError(t, provider.PreloadZones())
+	assert.Len(t, provider.zones, 51)
+
+	id, err := provider.zoneID("zone2-0.com.", "_acme-challenge.zone2-0.com.")
+	require.NoError(t, err)
+	assert.Equal(t, "id-2-0", id)
+	assert.Len(t, requests, 2, "Preloaded zones should not be looked up")
+
+	id, err = provider.zoneID("other.com.", "_acme-challenge.other.com.")
+	require.NoError(t, err)
+	assert.Equal(t, "id-other.com", id)
+	_, err = provider.zoneID("other.com.", "_acme-challenge.other.com.")
+	require.NoError(t, err)
+	assert.Len(t, requests, 3, "Looked up zones should be cached")
+
+	_, err = provider.makeRequest("GET", "/zones/id-other.com/dns_records", nil)
+	provider.forgetZoneOnNotFound("id-other.com", err)
+	assert.NotContains(t, provider.zones, "other.com.")
+	assert.Contains(t, provider.zones, "zone2-0.com.")
+}
+
 func TestCloudFlarePresent(t *testing.T) {
 	if !cflareLiveTest {
 		t.Skip("skipping live test")
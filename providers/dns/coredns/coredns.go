@@ -0,0 +1,214 @@
+// Package coredns implements a DNS provider for solving the DNS-01
+// challenge by writing TXT records into the etcd keys served by the etcd
+// plugin of CoreDNS.
+//
+// The provider talks to the JSON gateway of the etcd v3 API (etcd 3.4 or
+// later), so it needs no etcd client library.
+package coredns
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+)
+
+// DefaultPath is the etcd prefix the CoreDNS etcd plugin reads by default.
+const DefaultPath = "/skydns"
+
+// Config configures the connection to etcd.
+type Config struct {
+	// Endpoints are the etcd client URLs, tried in order.
+	Endpoints []string
+	// Zone is the zone served by the CoreDNS etcd plugin.
+	Zone string
+	// Path is the etcd prefix of the plugin, DefaultPath when empty.
+	Path string
+	// TLS is used for https endpoints, e.g. with client certificates.
+	TLS *tls.Config
+}
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that stores TXT records in etcd for CoreDNS.
+type DNSProvider struct {
+	config Config
+	client *http.Client
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("CoreDNS", "COREDNS_ETCD_ENDPOINTS", "COREDNS_ZONE")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured from the
+// environment: COREDNS_ETCD_ENDPOINTS (comma separated) and COREDNS_ZONE.
+// COREDNS_ETCD_PATH, and COREDNS_ETCD_CA_FILE, COREDNS_ETCD_CERT_FILE and
+// COREDNS_ETCD_KEY_FILE for TLS, are optional.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
+	config := Config{
+		Endpoints: strings.Split(os.Getenv("COREDNS_ETCD_ENDPOINTS"), ","),
+		Zone:      os.Getenv("COREDNS_ZONE"),
+		Path:      os.Getenv("COREDNS_ETCD_PATH"),
+	}
+
+	tlsConfig, err := loadTLSConfig(os.Getenv("COREDNS_ETCD_CA_FILE"), os.Getenv("COREDNS_ETCD_CERT_FILE"), os.Getenv("COREDNS_ETCD_KEY_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	config.TLS = tlsConfig
+
+	return NewDNSProviderConfig(config)
+}
+
+// NewDNSProviderConfig returns a DNSProvider instance using config.
+func NewDNSProviderConfig(config Config) (*DNSProvider, error) {
+	var endpoints []string
+	for _, endpoint := range config.Endpoints {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints = append(endpoints, strings.TrimSuffix(endpoint, "/"))
+		}
+	}
+	if len(endpoints) == 0 || config.Zone == "" {
+		return nil, fmt.Errorf("CoreDNS: etcd endpoints and zone are required")
+	}
+	config.Endpoints = endpoints
+	config.Zone = acme.ToFqdn(strings.ToLower(config.Zone))
+	if config.Path == "" {
+		config.Path = DefaultPath
+	}
+
+	return &DNSProvider{
+		config: config,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: config.TLS},
+		},
+	}, nil
+}
+
+// Present stores the TXT record in etcd. Every value gets a key of its own
+// below the name, so concurrent challenges for the same name coexist.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+
+	key, err := d.key(fqdn, value)
+	if err != nil {
+		return err
+	}
+
+	record, err := json.Marshal(struct {
+		Text string `json:"text"`
+		TTL  int    `json:"ttl"`
+	}{value, ttl})
+	if err != nil {
+		return err
+	}
+
+	return d.call("/v3/kv/put", map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(key)),
+		"value": base64.StdEncoding.EncodeToString(record),
+	})
+}
+
+// CleanUp deletes the etcd key of the TXT record.
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+
+	key, err := d.key(fqdn, value)
+	if err != nil {
+		return err
+	}
+
+	return d.call("/v3/kv/deleterange", map[string]string{
+		"key": base64.StdEncoding.EncodeToString([]byte(key)),
+	})
+}
+
+// key returns the etcd key of value at fqdn. CoreDNS expects the labels of
+// the name in reverse order below the path, e.g. /skydns/com/example/www
+// for www.example.com; the last element is a hash of the value.
+func (d *DNSProvider) key(fqdn, value string) (string, error) {
+	fqdn = strings.ToLower(fqdn)
+	if fqdn != d.config.Zone && !strings.HasSuffix(fqdn, "."+d.config.Zone) {
+		return "", fmt.Errorf("CoreDNS: %s is not in zone %s", fqdn, d.config.Zone)
+	}
+
+	labels := strings.Split(acme.UnFqdn(fqdn), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	return strings.TrimSuffix(d.config.Path, "/") + "/" + strings.Join(labels, "/") + "/lego-" + hex.EncodeToString(sum[:8]), nil
+}
+
+// call posts body to method of the etcd JSON gateway, trying the endpoints
+// in order until one answers.
+func (d *DNSProvider) call(method string, body interface{}) error {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, endpoint := range d.config.Endpoints {
+		resp, err := d.client.Post(endpoint+method, "application/json", bytes.NewReader(reqBody))
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("CoreDNS: etcd %s failed: HTTP %d: %s", method, resp.StatusCode, strings.TrimSpace(string(respBody)))
+		}
+		return nil
+	}
+	return fmt.Errorf("CoreDNS: no etcd endpoint reachable: %s", strings.Join(errs, "; "))
+}
+
+// loadTLSConfig builds the TLS configuration for etcd from PEM files. It
+// returns nil if none are given.
+func loadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("CoreDNS: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CoreDNS: no certificates found in %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("CoreDNS: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,67 @@
+package coredns
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+func TestCoreDNSPresentAndCleanUp(t *testing.T) {
+	kv := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		key, err := base64.StdEncoding.DecodeString(req.Key)
+		require.NoError(t, err)
+
+		switch r.URL.Path {
+		case "/v3/kv/put":
+			value, err := base64.StdEncoding.DecodeString(req.Value)
+			require.NoError(t, err)
+			kv[string(key)] = string(value)
+		case "/v3/kv/deleterange":
+			delete(kv, string(key))
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"header": {}}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewDNSProviderConfig(Config{
+		// the first endpoint is down
+		Endpoints: []string{"http://127.0.0.1:1", server.URL + "/"},
+		Zone:      "Example.com",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Present("internal.example.com", "", "foo"))
+	require.NoError(t, provider.Present("internal.example.com", "", "bar"))
+	require.Len(t, kv, 2)
+
+	_, value, _ := acme.DNS01Record("internal.example.com", "foo")
+	for key, record := range kv {
+		assert.True(t, strings.HasPrefix(key, "/skydns/com/example/internal/_acme-challenge/lego-"), key)
+		if strings.Contains(record, value) {
+			assert.JSONEq(t, `{"text": "`+value+`", "ttl": 120}`, record)
+		}
+	}
+
+	require.NoError(t, provider.CleanUp("internal.example.com", "", "foo"))
+	require.NoError(t, provider.CleanUp("internal.example.com", "", "bar"))
+	assert.Empty(t, kv)
+
+	err = provider.Present("example.org", "", "foo")
+	assert.EqualError(t, err, "CoreDNS: _acme-challenge.example.org. is not in zone example.com.")
+}
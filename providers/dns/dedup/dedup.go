@@ -0,0 +1,164 @@
+// Package dedup implements a wrapper for DNS providers which shares a
+// challenge record name between concurrent challenges, e.g. of domains whose
+// challenge records are CNAMEs to the same target, or of certificates for
+// the same domain requested at the same time.
+package dedup
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+)
+
+// DeduplicatingProvider is an implementation of the acme.ChallengeProvider
+// interface that presents one value at a time at each record name and
+// passes a value presented by concurrent challenges only once to the wrapped
+// provider. The values at a name are cleaned up once the last challenge
+// using the name called CleanUp, so providers whose CleanUp removes the
+// whole TXT record set do not remove the value of another challenge.
+type DeduplicatingProvider struct {
+	provider acme.ChallengeProvider
+
+	mu    sync.Mutex
+	names map[string]*name
+}
+
+// name holds the values presented at a record name.
+type name struct {
+	// presenting is closed when the Present call in flight for the name
+	// returned. It is nil if there is none.
+	presenting chan struct{}
+	values     map[string]*value
+}
+
+// value is a challenge record value presented by the wrapped provider.
+type value struct {
+	domain, token, keyAuth string
+
+	// done is closed when Present of the wrapped provider returned, err
+	// holds its result.
+	done chan struct{}
+	err  error
+	// refs counts the Present calls sharing the value which were not
+	// cleaned up yet.
+	refs int
+}
+
+// NewDeduplicatingProvider returns a DeduplicatingProvider wrapping
+// provider.
+func NewDeduplicatingProvider(provider acme.ChallengeProvider) *DeduplicatingProvider {
+	return &DeduplicatingProvider{
+		provider: provider,
+		names:    map[string]*name{},
+	}
+}
+
+// Present creates the TXT record with the wrapped provider, unless another
+// call presents or already presented the same value. It waits for a Present
+// call in flight for another value at the same name first.
+func (d *DeduplicatingProvider) Present(domain, token, keyAuth string) error {
+	fqdn, txt, _ := acme.DNS01Record(domain, keyAuth)
+
+	var n *name
+	d.mu.Lock()
+	for {
+		// The name is looked up again after waiting, it may have been
+		// released in the meantime.
+		n = d.names[fqdn]
+		if n == nil {
+			n = &name{values: map[string]*value{}}
+			d.names[fqdn] = n
+		}
+		if v, ok := n.values[txt]; ok {
+			v.refs++
+			d.mu.Unlock()
+
+			<-v.done
+			return v.err
+		}
+		if n.presenting == nil {
+			break
+		}
+		presenting := n.presenting
+		d.mu.Unlock()
+		<-presenting
+		d.mu.Lock()
+	}
+	v := &value{domain: domain, token: token, keyAuth: keyAuth, done: make(chan struct{}), refs: 1}
+	n.values[txt] = v
+	n.presenting = v.done
+	d.mu.Unlock()
+
+	v.err = d.provider.Present(domain, token, keyAuth)
+
+	var released []*value
+	d.mu.Lock()
+	n.presenting = nil
+	if v.err != nil {
+		// Forget the failed value, so later calls try again.
+		delete(n.values, txt)
+		released = d.release(fqdn, n)
+	}
+	d.mu.Unlock()
+	close(v.done)
+
+	// The challenges which waited for the failed call may be done already.
+	d.cleanUp(released)
+	return v.err
+}
+
+// CleanUp removes the values at the record name with the wrapped provider
+// once no other challenge uses the name any more.
+func (d *DeduplicatingProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, txt, _ := acme.DNS01Record(domain, keyAuth)
+
+	d.mu.Lock()
+	n := d.names[fqdn]
+	if n == nil || n.values[txt] == nil {
+		d.mu.Unlock()
+		return d.provider.CleanUp(domain, token, keyAuth)
+	}
+	n.values[txt].refs--
+	released := d.release(fqdn, n)
+	d.mu.Unlock()
+
+	return d.cleanUp(released)
+}
+
+// release forgets the name fqdn and returns its values if no challenge uses
+// it any more. d.mu has to be held.
+func (d *DeduplicatingProvider) release(fqdn string, n *name) []*value {
+	if n.presenting != nil {
+		return nil
+	}
+	var released []*value
+	for _, v := range n.values {
+		if v.refs > 0 {
+			return nil
+		}
+		released = append(released, v)
+	}
+	delete(d.names, fqdn)
+	return released
+}
+
+// cleanUp removes values with the wrapped provider and returns the first
+// error.
+func (d *DeduplicatingProvider) cleanUp(values []*value) error {
+	var err error
+	for _, v := range values {
+		if cleanUpErr := d.provider.CleanUp(v.domain, v.token, v.keyAuth); cleanUpErr != nil && err == nil {
+			err = cleanUpErr
+		}
+	}
+	return err
+}
+
+// Timeout returns the timeout and interval of the wrapped provider.
+func (d *DeduplicatingProvider) Timeout() (timeout, interval time.Duration) {
+	if provider, ok := d.provider.(acme.ChallengeProviderTimeout); ok {
+		return provider.Timeout()
+	}
+	return acme.DefaultPropagationTimeout, acme.DefaultPollingInterval
+}
@@ -0,0 +1,129 @@
+package dedup
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/mock"
+)
+
+// countingProvider counts the calls and blocks Present until release is
+// closed.
+type countingProvider struct {
+	*mock.Provider
+	release chan struct{}
+
+	mu       sync.Mutex
+	presents int
+	cleanUps int
+}
+
+func (p *countingProvider) Present(domain, token, keyAuth string) error {
+	p.mu.Lock()
+	p.presents++
+	p.mu.Unlock()
+
+	<-p.release
+	return p.Provider.Present(domain, token, keyAuth)
+}
+
+func (p *countingProvider) CleanUp(domain, token, keyAuth string) error {
+	p.mu.Lock()
+	p.cleanUps++
+	p.mu.Unlock()
+
+	return p.Provider.CleanUp(domain, token, keyAuth)
+}
+
+func TestDeduplicatingProviderConcurrentPresent(t *testing.T) {
+	wrapped := &countingProvider{Provider: mock.NewProvider(), release: make(chan struct{})}
+	provider := NewDeduplicatingProvider(wrapped)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- provider.Present("example.com", "token", "keyAuth")
+		}()
+	}
+
+	// Wait until all calls are in flight before releasing the first one.
+	fqdn, value, _ := acme.DNS01Record("example.com", "keyAuth")
+	for {
+		provider.mu.Lock()
+		n := provider.names[fqdn]
+		inFlight := n != nil && n.values[value] != nil && n.values[value].refs == 3
+		provider.mu.Unlock()
+		if inFlight {
+			break
+		}
+	}
+	close(wrapped.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, wrapped.presents)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, provider.CleanUp("example.com", "token", "keyAuth"))
+		assert.Equal(t, map[string]string{fqdn: value}, wrapped.Records())
+	}
+	require.NoError(t, provider.CleanUp("example.com", "token", "keyAuth"))
+	assert.Empty(t, wrapped.Records())
+	assert.Equal(t, 1, wrapped.cleanUps)
+}
+
+func TestDeduplicatingProviderDifferentValues(t *testing.T) {
+	wrapped := &countingProvider{Provider: mock.NewProvider(), release: make(chan struct{})}
+	provider := NewDeduplicatingProvider(wrapped)
+
+	errs := make(chan error, 2)
+	go func() { errs <- provider.Present("example.com", "token1", "keyAuth1") }()
+	go func() { errs <- provider.Present("example.com", "token2", "keyAuth2") }()
+
+	// The second value is only presented once the first call returned.
+	for {
+		wrapped.mu.Lock()
+		presents := wrapped.presents
+		wrapped.mu.Unlock()
+		if presents == 1 {
+			break
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	wrapped.mu.Lock()
+	assert.Equal(t, 1, wrapped.presents, "values at the same name must be presented one at a time")
+	wrapped.mu.Unlock()
+
+	close(wrapped.release)
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+	assert.Equal(t, 2, wrapped.presents)
+
+	// The name is cleaned up once no challenge uses it any more.
+	require.NoError(t, provider.CleanUp("example.com", "token1", "keyAuth1"))
+	assert.Equal(t, 0, wrapped.cleanUps)
+	assert.Len(t, wrapped.Records(), 1, "the record of the other challenge must stay")
+	require.NoError(t, provider.CleanUp("example.com", "token2", "keyAuth2"))
+	assert.Equal(t, 2, wrapped.cleanUps)
+	assert.Empty(t, wrapped.Records())
+	assert.Empty(t, provider.names)
+}
+
+func TestDeduplicatingProviderRetriesFailure(t *testing.T) {
+	wrapped := mock.NewFailingProvider(errors.New("boom"))
+	provider := NewDeduplicatingProvider(wrapped)
+
+	assert.EqualError(t, provider.Present("example.com", "token", "keyAuth"), "boom")
+	assert.Empty(t, provider.names)
+}
@@ -0,0 +1,414 @@
+// Package designate implements a DNS provider for solving the DNS-01
+// challenge using the OpenStack DNS service, Designate.
+package designate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+)
+
+// Designate API reference: https://developer.openstack.org/api-ref/dns/
+
+// findZoneByFqdn determines the DNS zone of an fqdn. It is overridden during
+// tests.
+var findZoneByFqdn = acme.FindZoneByFqdn
+
+// Config holds the Keystone credentials and the endpoint to use.
+type Config struct {
+	AuthURL    string
+	Username   string
+	Password   string
+	TenantName string
+	// Region selects the DNS endpoint in the service catalog; the first
+	// one is used when empty.
+	Region string
+	// EndpointType is public (the default) or internal.
+	EndpointType string
+	// DomainName is the Keystone v3 domain of the user and project,
+	// "Default" when empty. It is ignored by the v2.0 identity API.
+	DomainName string
+}
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that uses the Designate v2 API to manage TXT records for a domain.
+type DNSProvider struct {
+	config Config
+	client *http.Client
+
+	mu       sync.Mutex
+	token    string
+	endpoint string
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("Designate", "OS_AUTH_URL", "OS_USERNAME", "OS_PASSWORD", "OS_TENANT_NAME")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured for Designate.
+// The Keystone credentials must be passed in the environment variables:
+// OS_AUTH_URL, OS_USERNAME, OS_PASSWORD and OS_TENANT_NAME. OS_REGION_NAME,
+// OS_ENDPOINT_TYPE (public or internal) and OS_USER_DOMAIN_NAME are
+// optional.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
+	return NewDNSProviderConfig(Config{
+		AuthURL:      os.Getenv("OS_AUTH_URL"),
+		Username:     os.Getenv("OS_USERNAME"),
+		Password:     os.Getenv("OS_PASSWORD"),
+		TenantName:   os.Getenv("OS_TENANT_NAME"),
+		Region:       os.Getenv("OS_REGION_NAME"),
+		EndpointType: os.Getenv("OS_ENDPOINT_TYPE"),
+		DomainName:   os.Getenv("OS_USER_DOMAIN_NAME"),
+	})
+}
+
+// NewDNSProviderConfig returns a DNSProvider instance authenticating with
+// the credentials in config. The token is fetched with the first request.
+func NewDNSProviderConfig(config Config) (*DNSProvider, error) {
+	if config.AuthURL == "" || config.Username == "" || config.Password == "" || config.TenantName == "" {
+		return nil, fmt.Errorf("Designate credentials missing")
+	}
+
+	switch strings.TrimSuffix(config.EndpointType, "URL") {
+	case "", "public":
+		config.EndpointType = "public"
+	case "internal":
+		config.EndpointType = "internal"
+	default:
+		return nil, fmt.Errorf("Designate: unsupported endpoint type %q, use public or internal", config.EndpointType)
+	}
+	if config.DomainName == "" {
+		config.DomainName = "Default"
+	}
+
+	return &DNSProvider{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// recordSet is a recordset of the Designate v2 API.
+type recordSet struct {
+	ID      string   `json:"id,omitempty"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl,omitempty"`
+	Records []string `json:"records"`
+}
+
+// Present adds the value to the TXT recordset of fqdn, creating it if
+// needed.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	value = `"` + value + `"`
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	zoneID, err := d.zoneID(fqdn)
+	if err != nil {
+		return err
+	}
+
+	set, err := d.recordSet(zoneID, fqdn)
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		body := recordSet{Name: fqdn, Type: "TXT", TTL: ttl, Records: []string{value}}
+		return d.do("POST", "/v2/zones/"+zoneID+"/recordsets", body, nil)
+	}
+
+	for _, v := range set.Records {
+		if v == value {
+			return nil
+		}
+	}
+	return d.updateRecords(zoneID, set, append(set.Records, value))
+}
+
+// CleanUp removes the value from the TXT recordset of fqdn, deleting the
+// recordset if no other values remain.
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	value = `"` + value + `"`
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	zoneID, err := d.zoneID(fqdn)
+	if err != nil {
+		return err
+	}
+
+	set, err := d.recordSet(zoneID, fqdn)
+	if err != nil || set == nil {
+		return err
+	}
+
+	var remaining []string
+	for _, v := range set.Records {
+		if v != value {
+			remaining = append(remaining, v)
+		}
+	}
+	if len(remaining) == len(set.Records) {
+		return nil
+	}
+	if len(remaining) == 0 {
+		return d.do("DELETE", "/v2/zones/"+zoneID+"/recordsets/"+set.ID, nil, nil)
+	}
+	return d.updateRecords(zoneID, set, remaining)
+}
+
+func (d *DNSProvider) updateRecords(zoneID string, set *recordSet, records []string) error {
+	body := struct {
+		Records []string `json:"records"`
+	}{records}
+	return d.do("PUT", "/v2/zones/"+zoneID+"/recordsets/"+set.ID, body, nil)
+}
+
+// zoneID returns the ID of the Designate zone holding fqdn.
+func (d *DNSProvider) zoneID(fqdn string) (string, error) {
+	authZone, err := findZoneByFqdn(fqdn, acme.RecursiveNameservers)
+	if err != nil {
+		return "", fmt.Errorf("Designate: could not determine zone for %s: %v", fqdn, err)
+	}
+
+	var resp struct {
+		Zones []struct {
+			ID string `json:"id"`
+		} `json:"zones"`
+	}
+	if err := d.do("GET", "/v2/zones?name="+url.QueryEscape(authZone), nil, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Zones) == 0 {
+		return "", fmt.Errorf("Designate: zone %s not found", authZone)
+	}
+	return resp.Zones[0].ID, nil
+}
+
+// recordSet returns the TXT recordset of fqdn or nil if there is none.
+func (d *DNSProvider) recordSet(zoneID, fqdn string) (*recordSet, error) {
+	var resp struct {
+		RecordSets []recordSet `json:"recordsets"`
+	}
+	path := fmt.Sprintf("/v2/zones/%s/recordsets?type=TXT&name=%s", zoneID, url.QueryEscape(fqdn))
+	if err := d.do("GET", path, nil, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.RecordSets) == 0 {
+		return nil, nil
+	}
+	return &resp.RecordSets[0], nil
+}
+
+// do sends a request to the DNS endpoint, logging in to Keystone first if
+// there is no token yet. An expired token is renewed once.
+func (d *DNSProvider) do(method, path string, body, result interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	for retried := false; ; retried = true {
+		if d.token == "" {
+			if err := d.login(); err != nil {
+				return err
+			}
+		}
+
+		req, err := http.NewRequest(method, d.endpoint+path, bytes.NewReader(reqBody))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Auth-Token", d.token)
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("Designate: %s %s failed: %v", method, path, err)
+		}
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("Designate: %s %s failed: %v", method, path, err)
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && !retried {
+			d.token = ""
+			continue
+		}
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("Designate: %s %s failed: HTTP %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(respBody)))
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(respBody, result)
+	}
+}
+
+// login authenticates with Keystone and picks the DNS endpoint from the
+// service catalog. Auth URLs ending in /v3 use the v3 identity API, all
+// others v2.0.
+func (d *DNSProvider) login() error {
+	authURL := strings.TrimSuffix(d.config.AuthURL, "/")
+	if strings.HasSuffix(authURL, "/v3") {
+		return d.loginV3(authURL)
+	}
+	return d.loginV2(authURL)
+}
+
+func (d *DNSProvider) loginV2(authURL string) error {
+	var req struct {
+		Auth struct {
+			PasswordCredentials struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+			} `json:"passwordCredentials"`
+			TenantName string `json:"tenantName"`
+		} `json:"auth"`
+	}
+	req.Auth.PasswordCredentials.Username = d.config.Username
+	req.Auth.PasswordCredentials.Password = d.config.Password
+	req.Auth.TenantName = d.config.TenantName
+
+	var resp struct {
+		Access struct {
+			Token struct {
+				ID string `json:"id"`
+			} `json:"token"`
+			ServiceCatalog []struct {
+				Type      string              `json:"type"`
+				Endpoints []map[string]string `json:"endpoints"`
+			} `json:"serviceCatalog"`
+		} `json:"access"`
+	}
+	if _, err := d.postAuth(authURL+"/tokens", req, &resp); err != nil {
+		return err
+	}
+
+	for _, service := range resp.Access.ServiceCatalog {
+		if service.Type != "dns" {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if d.config.Region == "" || endpoint["region"] == d.config.Region {
+				return d.setSession(resp.Access.Token.ID, endpoint[d.config.EndpointType+"URL"])
+			}
+		}
+	}
+	return d.setSession(resp.Access.Token.ID, "")
+}
+
+func (d *DNSProvider) loginV3(authURL string) error {
+	domain := map[string]string{"name": d.config.DomainName}
+	req := map[string]interface{}{
+		"auth": map[string]interface{}{
+			"identity": map[string]interface{}{
+				"methods": []string{"password"},
+				"password": map[string]interface{}{
+					"user": map[string]interface{}{
+						"name":     d.config.Username,
+						"password": d.config.Password,
+						"domain":   domain,
+					},
+				},
+			},
+			"scope": map[string]interface{}{
+				"project": map[string]interface{}{
+					"name":   d.config.TenantName,
+					"domain": domain,
+				},
+			},
+		},
+	}
+
+	var resp struct {
+		Token struct {
+			Catalog []struct {
+				Type      string `json:"type"`
+				Endpoints []struct {
+					Interface string `json:"interface"`
+					Region    string `json:"region"`
+					URL       string `json:"url"`
+				} `json:"endpoints"`
+			} `json:"catalog"`
+		} `json:"token"`
+	}
+	header, err := d.postAuth(authURL+"/auth/tokens", req, &resp)
+	if err != nil {
+		return err
+	}
+	token := header.Get("X-Subject-Token")
+
+	for _, service := range resp.Token.Catalog {
+		if service.Type != "dns" {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint.Interface == d.config.EndpointType && (d.config.Region == "" || endpoint.Region == d.config.Region) {
+				return d.setSession(token, endpoint.URL)
+			}
+		}
+	}
+	return d.setSession(token, "")
+}
+
+func (d *DNSProvider) setSession(token, endpoint string) error {
+	if token == "" {
+		return fmt.Errorf("Designate: Keystone did not return a token")
+	}
+	if endpoint == "" {
+		return fmt.Errorf("Designate: no %s DNS endpoint in the service catalog", d.config.EndpointType)
+	}
+
+	d.token = token
+	d.endpoint = strings.TrimSuffix(endpoint, "/")
+	return nil
+}
+
+func (d *DNSProvider) postAuth(url string, body, result interface{}) (http.Header, error) {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.client.Post(url, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("Designate: Keystone login failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("Designate: Keystone login failed: HTTP %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("Designate: could not decode the Keystone token: %v", err)
+	}
+	return resp.Header, nil
+}
@@ -0,0 +1,109 @@
+package designate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+// fakeOpenStack serves Keystone v2.0 and v3 and a Designate API keeping the
+// TXT recordset of _acme-challenge.example.com. in memory.
+func fakeOpenStack(t *testing.T) (*httptest.Server, *[]string) {
+	var server *httptest.Server
+	var records []string
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2.0/tokens":
+			w.Write([]byte(`{"access": {"token": {"id": "v2token"}, "serviceCatalog": [
+				{"type": "compute", "endpoints": [{"region": "RegionOne", "publicURL": "http://compute"}]},
+				{"type": "dns", "endpoints": [{"region": "RegionOne", "publicURL": "http://public", "internalURL": "` + server.URL + `/dns"}]}
+			]}}`))
+			return
+		case "/v3/auth/tokens":
+			w.Header().Set("X-Subject-Token", "v3token")
+			w.Write([]byte(`{"token": {"catalog": [{"type": "dns", "endpoints": [
+				{"interface": "internal", "region": "RegionOne", "url": "http://internal"},
+				{"interface": "public", "region": "RegionOne", "url": "` + server.URL + `/dns"}
+			]}]}}`))
+			return
+		}
+
+		if token := r.Header.Get("X-Auth-Token"); token != "v2token" && token != "v3token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/dns/v2/zones":
+			assert.Equal(t, "example.com.", r.URL.Query().Get("name"))
+			w.Write([]byte(`{"zones": [{"id": "zone1", "name": "example.com."}]}`))
+		case r.Method == "GET" && r.URL.Path == "/dns/v2/zones/zone1/recordsets":
+			assert.Equal(t, "_acme-challenge.example.com.", r.URL.Query().Get("name"))
+			var sets []recordSet
+			if records != nil {
+				sets = append(sets, recordSet{ID: "rs1", Name: "_acme-challenge.example.com.", Type: "TXT", Records: records})
+			}
+			json.NewEncoder(w).Encode(map[string][]recordSet{"recordsets": sets})
+		case r.Method == "POST" && r.URL.Path == "/dns/v2/zones/zone1/recordsets":
+			var set recordSet
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&set))
+			assert.Equal(t, "_acme-challenge.example.com.", set.Name)
+			assert.Equal(t, "TXT", set.Type)
+			records = set.Records
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == "PUT" && r.URL.Path == "/dns/v2/zones/zone1/recordsets/rs1":
+			var set recordSet
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&set))
+			records = set.Records
+		case r.Method == "DELETE" && r.URL.Path == "/dns/v2/zones/zone1/recordsets/rs1":
+			records = nil
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server, &records
+}
+
+func TestDesignatePresentAndCleanUp(t *testing.T) {
+	server, records := fakeOpenStack(t)
+	defer server.Close()
+
+	savedFindZoneByFqdn := findZoneByFqdn
+	defer func() { findZoneByFqdn = savedFindZoneByFqdn }()
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	_, foo, _ := acme.DNS01Record("example.com", "foo")
+	_, bar, _ := acme.DNS01Record("example.com", "bar")
+
+	for _, config := range []Config{
+		{AuthURL: server.URL + "/v2.0", EndpointType: "internalURL"},
+		{AuthURL: server.URL + "/v3/", Region: "RegionOne"},
+	} {
+		config.Username, config.Password, config.TenantName = "user", "secret", "tenant"
+		provider, err := NewDNSProviderConfig(config)
+		require.NoError(t, err)
+
+		require.NoError(t, provider.Present("example.com", "", "foo"))
+		require.NoError(t, provider.Present("example.com", "", "bar"))
+		assert.Equal(t, []string{`"` + foo + `"`, `"` + bar + `"`}, *records)
+
+		require.NoError(t, provider.CleanUp("example.com", "", "foo"))
+		assert.Equal(t, []string{`"` + bar + `"`}, *records)
+		require.NoError(t, provider.CleanUp("example.com", "", "bar"))
+		assert.Nil(t, *records)
+	}
+}
+
+func TestDesignateEndpointType(t *testing.T) {
+	_, err := NewDNSProviderConfig(Config{AuthURL: "http://keystone", Username: "u", Password: "p", TenantName: "t", EndpointType: "admin"})
+	assert.EqualError(t, err, `Designate: unsupported endpoint type "admin", use public or internal`)
+}
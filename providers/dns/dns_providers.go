@@ -0,0 +1,152 @@
+// Package dns looks up the DNS providers shipped with lego by name.
+//
+// Every provider is created through its NewDNSProvider function and thus
+// reads its credentials from the environment. Programs embedding lego can
+// add their own providers with Register.
+package dns
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/auroradns"
+	"github.com/xenolf/lego/providers/dns/bind9"
+	"github.com/xenolf/lego/providers/dns/cloudflare"
+	"github.com/xenolf/lego/providers/dns/coredns"
+	"github.com/xenolf/lego/providers/dns/designate"
+	"github.com/xenolf/lego/providers/dns/digitalocean"
+	"github.com/xenolf/lego/providers/dns/dnsimple"
+	"github.com/xenolf/lego/providers/dns/dnsmadeeasy"
+	"github.com/xenolf/lego/providers/dns/dreamhost"
+	"github.com/xenolf/lego/providers/dns/dyn"
+	"github.com/xenolf/lego/providers/dns/dynadot"
+	"github.com/xenolf/lego/providers/dns/filezone"
+	"github.com/xenolf/lego/providers/dns/gandi"
+	"github.com/xenolf/lego/providers/dns/godaddy"
+	"github.com/xenolf/lego/providers/dns/googlecloud"
+	"github.com/xenolf/lego/providers/dns/hedns"
+	"github.com/xenolf/lego/providers/dns/hover"
+	"github.com/xenolf/lego/providers/dns/knot"
+	"github.com/xenolf/lego/providers/dns/lightsail"
+	"github.com/xenolf/lego/providers/dns/linode"
+	"github.com/xenolf/lego/providers/dns/mythicbeasts"
+	"github.com/xenolf/lego/providers/dns/mythicbeastsv1"
+	"github.com/xenolf/lego/providers/dns/namebright"
+	"github.com/xenolf/lego/providers/dns/namecheap"
+	"github.com/xenolf/lego/providers/dns/ns1"
+	"github.com/xenolf/lego/providers/dns/nsd"
+	"github.com/xenolf/lego/providers/dns/ovh"
+	"github.com/xenolf/lego/providers/dns/pdns"
+	"github.com/xenolf/lego/providers/dns/rfc2136"
+	"github.com/xenolf/lego/providers/dns/route53"
+	"github.com/xenolf/lego/providers/dns/sshzone"
+	"github.com/xenolf/lego/providers/dns/vultr"
+)
+
+// Factory creates a DNS provider configured from the environment.
+type Factory func() (acme.ChallengeProvider, error)
+
+var (
+	factories = map[string]Factory{
+		"auroradns":      func() (acme.ChallengeProvider, error) { return auroradns.NewDNSProvider() },
+		"bind9":          func() (acme.ChallengeProvider, error) { return bind9.NewDNSProvider() },
+		"cloudflare":     func() (acme.ChallengeProvider, error) { return cloudflare.NewDNSProvider() },
+		"coredns":        func() (acme.ChallengeProvider, error) { return coredns.NewDNSProvider() },
+		"designate":      func() (acme.ChallengeProvider, error) { return designate.NewDNSProvider() },
+		"digitalocean":   func() (acme.ChallengeProvider, error) { return digitalocean.NewDNSProvider() },
+		"dnsimple":       func() (acme.ChallengeProvider, error) { return dnsimple.NewDNSProvider() },
+		"dnsmadeeasy":    func() (acme.ChallengeProvider, error) { return dnsmadeeasy.NewDNSProvider() },
+		"dreamhost":      func() (acme.ChallengeProvider, error) { return dreamhost.NewDNSProvider() },
+		"dyn":            func() (acme.ChallengeProvider, error) { return dyn.NewDNSProvider() },
+		"dynadot":        func() (acme.ChallengeProvider, error) { return dynadot.NewDNSProvider() },
+		"filezone":       func() (acme.ChallengeProvider, error) { return filezone.NewDNSProvider() },
+		"gandi":          func() (acme.ChallengeProvider, error) { return gandi.NewDNSProvider() },
+		"gcloud":         func() (acme.ChallengeProvider, error) { return googlecloud.NewDNSProvider() },
+		"godaddy":        func() (acme.ChallengeProvider, error) { return godaddy.NewDNSProvider() },
+		"hedns":          func() (acme.ChallengeProvider, error) { return hedns.NewDNSProvider() },
+		"hover":          func() (acme.ChallengeProvider, error) { return hover.NewDNSProvider() },
+		"knot":           func() (acme.ChallengeProvider, error) { return knot.NewDNSProvider() },
+		"lightsail":      func() (acme.ChallengeProvider, error) { return lightsail.NewDNSProvider() },
+		"linode":         func() (acme.ChallengeProvider, error) { return linode.NewDNSProvider() },
+		"manual":         func() (acme.ChallengeProvider, error) { return acme.NewDNSProviderManual() },
+		"mythicbeasts":   func() (acme.ChallengeProvider, error) { return mythicbeasts.NewDNSProvider() },
+		"mythicbeastsv1": func() (acme.ChallengeProvider, error) { return mythicbeastsv1.NewDNSProvider() },
+		"namebright":     func() (acme.ChallengeProvider, error) { return namebright.NewDNSProvider() },
+		"namecheap":      func() (acme.ChallengeProvider, error) { return namecheap.NewDNSProvider() },
+		"ns1":            func() (acme.ChallengeProvider, error) { return ns1.NewDNSProvider() },
+		"nsd":            func() (acme.ChallengeProvider, error) { return nsd.NewDNSProvider() },
+		"ovh":            func() (acme.ChallengeProvider, error) { return ovh.NewDNSProvider() },
+		"pdns":           func() (acme.ChallengeProvider, error) { return pdns.NewDNSProvider() },
+		"rfc2136":        func() (acme.ChallengeProvider, error) { return rfc2136.NewDNSProvider() },
+		"route53":        func() (acme.ChallengeProvider, error) { return route53.NewDNSProvider() },
+		"sshzone":        func() (acme.ChallengeProvider, error) { return sshzone.NewDNSProvider() },
+		"vultr":          func() (acme.ChallengeProvider, error) { return vultr.NewDNSProvider() },
+	}
+	factoriesLock sync.Mutex
+)
+
+// Register makes a DNS provider available under name, replacing any
+// provider previously registered with it. The Info of a provider replaced
+// is kept.
+func Register(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	factories[name] = factory
+	if _, ok := infos[name]; !ok {
+		infos[name] = Info{}
+	}
+}
+
+// RegisterWithInfo is like Register, and shows info for the provider in
+// lego dnshelp.
+func RegisterWithInfo(name string, factory Factory, info Info) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	factories[name] = factory
+	infos[name] = info
+}
+
+// ProviderInfo returns the Info of the DNS provider registered under name.
+func ProviderInfo(name string) (Info, bool) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	if _, ok := factories[name]; !ok {
+		return Info{}, false
+	}
+	return infos[name], true
+}
+
+// NewDNSProvider creates the DNS provider registered under name.
+func NewDNSProvider(name string) (acme.ChallengeProvider, error) {
+	factoriesLock.Lock()
+	factory, ok := factories[name]
+	factoriesLock.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Unrecognised DNS provider: %s", name)
+	}
+
+	provider, err := factory()
+	if err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+// Names returns the sorted names of all registered DNS providers.
+func Names() []string {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,157 @@
+package dns
+
+// Info describes a DNS provider and the environment variables configuring
+// it, as shown by lego dnshelp.
+type Info struct {
+	Description string
+	// Required lists the environment variables which must be set.
+	Required []string
+	// Optional lists the environment variables which may be set.
+	Optional []string
+}
+
+// infos holds the Info of the registered DNS providers. Every provider in
+// factories has an entry, which is checked by the tests.
+var infos = map[string]Info{
+	"auroradns": {
+		Description: "AuroraDNS by PCextreme",
+		Required:    []string{"AURORA_USER_ID", "AURORA_KEY"},
+		Optional:    []string{"AURORA_ENDPOINT"},
+	},
+	"bind9": {
+		Description: "BIND9 dynamic updates signed with TSIG",
+		Required:    []string{"BIND9_HOST", "BIND9_KEY_NAME", "BIND9_KEY_SECRET"},
+		Optional:    []string{"BIND9_PORT", "BIND9_KEY_ALGORITHM"},
+	},
+	"cloudflare": {
+		Description: "CloudFlare",
+		Required:    []string{"CLOUDFLARE_EMAIL", "CLOUDFLARE_API_KEY"},
+	},
+	"coredns": {
+		Description: "CoreDNS etcd plugin, through the etcd v3 JSON gateway",
+		Required:    []string{"COREDNS_ETCD_ENDPOINTS", "COREDNS_ZONE"},
+		Optional:    []string{"COREDNS_ETCD_PATH", "COREDNS_ETCD_CA_FILE", "COREDNS_ETCD_CERT_FILE", "COREDNS_ETCD_KEY_FILE"},
+	},
+	"designate": {
+		Description: "OpenStack Designate",
+		Required:    []string{"OS_AUTH_URL", "OS_USERNAME", "OS_PASSWORD", "OS_TENANT_NAME"},
+		Optional:    []string{"OS_REGION_NAME", "OS_ENDPOINT_TYPE", "OS_USER_DOMAIN_NAME"},
+	},
+	"digitalocean": {
+		Description: "DigitalOcean",
+		Required:    []string{"DO_AUTH_TOKEN"},
+	},
+	"dnsimple": {
+		Description: "DNSimple",
+		Required:    []string{"DNSIMPLE_EMAIL", "DNSIMPLE_API_KEY"},
+	},
+	"dnsmadeeasy": {
+		Description: "DNS Made Easy",
+		Required:    []string{"DNSMADEEASY_API_KEY", "DNSMADEEASY_API_SECRET"},
+		Optional:    []string{"DNSMADEEASY_SANDBOX"},
+	},
+	"dreamhost": {
+		Description: "DreamHost",
+		Required:    []string{"DREAMHOST_API_KEY"},
+	},
+	"dyn": {
+		Description: "Dyn Managed DNS",
+		Required:    []string{"DYN_CUSTOMER_NAME", "DYN_USER_NAME", "DYN_PASSWORD"},
+	},
+	"dynadot": {
+		Description: "Dynadot",
+		Required:    []string{"DYNADOT_API_KEY"},
+	},
+	"filezone": {
+		Description: "JSON file read by a test nameserver",
+		Required:    []string{"DNS_FILEZONE_PATH"},
+	},
+	"gandi": {
+		Description: "Gandi",
+		Required:    []string{"GANDI_API_KEY"},
+	},
+	"gcloud": {
+		Description: "Google Cloud DNS",
+		Required:    []string{"GCE_PROJECT"},
+	},
+	"godaddy": {
+		Description: "GoDaddy",
+		Required:    []string{"GODADDY_API_KEY", "GODADDY_API_SECRET"},
+	},
+	"hedns": {
+		Description: "Hurricane Electric Free DNS, dynamic TXT records",
+		Required:    []string{"HEDNS_ZONE", "HEDNS_TOKEN"},
+	},
+	"hover": {
+		Description: "Hover",
+		Required:    []string{"HOVER_USERNAME", "HOVER_PASSWORD"},
+		Optional:    []string{"HOVER_LOGIN_TIMEOUT"},
+	},
+	"knot": {
+		Description: "Knot DNS, through knotc",
+		Required:    []string{"KNOT_ZONE"},
+		Optional:    []string{"KNOT_SOCKET_PATH"},
+	},
+	"lightsail": {
+		Description: "AWS Lightsail DNS zones",
+		Optional:    []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"},
+	},
+	"linode": {
+		Description: "Linode",
+		Required:    []string{"LINODE_API_KEY"},
+	},
+	"manual": {
+		Description: "Prints the record and waits for it to be created by hand",
+	},
+	"mythicbeasts": {
+		Description: "Mythic Beasts DNS API v2, falling back to v1",
+		Required:    []string{"MYTHICBEASTS_USERNAME", "MYTHICBEASTS_PASSWORD"},
+	},
+	"mythicbeastsv1": {
+		Description: "Mythic Beasts legacy DNS API v1",
+		Required:    []string{"MYTHICBEASTS_PASSWORD"},
+	},
+	"namebright": {
+		Description: "NameBright",
+		Required:    []string{"NAMEBRIGHT_APP_NAME", "NAMEBRIGHT_APP_PASSWORD"},
+	},
+	"namecheap": {
+		Description: "Namecheap",
+		Required:    []string{"NAMECHEAP_API_USER", "NAMECHEAP_API_KEY"},
+	},
+	"ns1": {
+		Description: "NS1",
+		Required:    []string{"NS1_API_KEY"},
+	},
+	"nsd": {
+		Description: "NSD zone files, reloaded with nsd-control",
+		Required:    []string{"NSD_ZONEFILE_DIR"},
+		Optional:    []string{"NSD_CONTROL_PATH", "NSD_SERVER"},
+	},
+	"ovh": {
+		Description: "OVH",
+		Required:    []string{"OVH_ENDPOINT", "OVH_APPLICATION_KEY", "OVH_APPLICATION_SECRET", "OVH_CONSUMER_KEY"},
+	},
+	"pdns": {
+		Description: "PowerDNS HTTP API",
+		Required:    []string{"PDNS_API_URL", "PDNS_API_KEY"},
+	},
+	"rfc2136": {
+		Description: "RFC 2136 dynamic updates",
+		Required:    []string{"RFC2136_NAMESERVER"},
+		Optional:    []string{"RFC2136_TSIG_KEY", "RFC2136_TSIG_SECRET", "RFC2136_TSIG_ALGORITHM"},
+	},
+	"route53": {
+		Description: "AWS Route 53",
+		Optional:    []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_REGION", "AWS_SESSION_TOKEN"},
+	},
+	"sshzone": {
+		Description: "BIND zone file edited over SSH",
+		Required:    []string{"SSHZONE_HOST", "SSHZONE_USER", "SSHZONE_PRIVATE_KEY", "SSHZONE_ZONE_FILE"},
+		Optional:    []string{"SSHZONE_RELOAD_CMD", "SSHZONE_KNOWN_HOSTS"},
+	},
+	"vultr": {
+		Description: "Vultr",
+		Required:    []string{"VULTR_API_KEY"},
+	},
+}
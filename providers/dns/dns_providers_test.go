@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/mock"
+)
+
+func TestNewDNSProviderKnown(t *testing.T) {
+	provider, err := NewDNSProvider("manual")
+	assert.NoError(t, err)
+	assert.IsType(t, &acme.DNSProviderManual{}, provider)
+}
+
+func TestNewDNSProviderUnknown(t *testing.T) {
+	provider, err := NewDNSProvider("foobar")
+	assert.EqualError(t, err, "Unrecognised DNS provider: foobar")
+	assert.Nil(t, provider)
+}
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		factoriesLock.Lock()
+		delete(factories, "mock")
+		delete(factories, "failing")
+		delete(infos, "mock")
+		delete(infos, "failing")
+		factoriesLock.Unlock()
+	}()
+
+	Register("mock", func() (acme.ChallengeProvider, error) { return mock.NewProvider(), nil })
+	Register("failing", func() (acme.ChallengeProvider, error) { return nil, errors.New("boom") })
+	assert.Contains(t, Names(), "mock")
+
+	provider, err := NewDNSProvider("mock")
+	assert.NoError(t, err)
+	assert.IsType(t, &mock.Provider{}, provider)
+
+	provider, err = NewDNSProvider("failing")
+	assert.EqualError(t, err, "boom")
+	assert.Nil(t, provider)
+}
+
+func TestProviderInfo(t *testing.T) {
+	for _, name := range Names() {
+		_, ok := infos[name]
+		assert.True(t, ok, "no Info for DNS provider %s", name)
+	}
+
+	info, ok := ProviderInfo("cloudflare")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"CLOUDFLARE_EMAIL", "CLOUDFLARE_API_KEY"}, info.Required)
+
+	_, ok = ProviderInfo("foobar")
+	assert.False(t, ok)
+}
+
+func TestRegisterWithInfo(t *testing.T) {
+	defer func() {
+		factoriesLock.Lock()
+		delete(factories, "mock")
+		delete(infos, "mock")
+		factoriesLock.Unlock()
+	}()
+
+	RegisterWithInfo("mock", func() (acme.ChallengeProvider, error) { return mock.NewProvider(), nil },
+		Info{Description: "In-memory records", Optional: []string{"MOCK_VAR"}})
+
+	info, ok := ProviderInfo("mock")
+	assert.True(t, ok)
+	assert.Equal(t, Info{Description: "In-memory records", Optional: []string{"MOCK_VAR"}}, info)
+}
+
+func TestRegisterKeepsInfo(t *testing.T) {
+	factoriesLock.Lock()
+	saved := factories["cloudflare"]
+	factoriesLock.Unlock()
+	defer Register("cloudflare", saved)
+
+	Register("cloudflare", func() (acme.ChallengeProvider, error) { return mock.NewProvider(), nil })
+
+	info, ok := ProviderInfo("cloudflare")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"CLOUDFLARE_EMAIL", "CLOUDFLARE_API_KEY"}, info.Required)
+}
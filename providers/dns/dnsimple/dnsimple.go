@@ -9,6 +9,7 @@ import (
 
 	"github.com/weppos/dnsimple-go/dnsimple"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 )
 
 // DNSProvider is an implementation of the acme.ChallengeProvider interface.
@@ -16,10 +17,20 @@ type DNSProvider struct {
 	client *dnsimple.Client
 }
 
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("DNSimple", "DNSIMPLE_EMAIL", "DNSIMPLE_API_KEY")
+}
+
 // NewDNSProvider returns a DNSProvider instance configured for dnsimple.
 // Credentials must be passed in the environment variables: DNSIMPLE_EMAIL
 // and DNSIMPLE_API_KEY.
 func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
 	email := os.Getenv("DNSIMPLE_EMAIL")
 	key := os.Getenv("DNSIMPLE_API_KEY")
 	return NewDNSProviderCredentials(email, key)
@@ -41,7 +52,7 @@ func NewDNSProviderCredentials(email, key string) (*DNSProvider, error) {
 func (c *DNSProvider) Present(domain, token, keyAuth string) error {
 	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
 
-	zoneID, zoneName, err := c.getHostedZone(domain)
+	zoneID, zoneName, err := c.getHostedZone(fqdn)
 	if err != nil {
 		return err
 	}
@@ -57,7 +68,7 @@ func (c *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (c *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
 
 	records, err := c.findTxtRecords(domain, fqdn)
 	if err != nil {
@@ -65,6 +76,10 @@ func (c *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 	}
 
 	for _, rec := range records {
+		if rec.Content != value {
+			// keep the records of other challenges for the same name
+			continue
+		}
 		_, err := c.client.Domains.DeleteRecord(rec.DomainId, rec.Id)
 		if err != nil {
 			return err
@@ -73,13 +88,13 @@ func (c *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 	return nil
 }
 
-func (c *DNSProvider) getHostedZone(domain string) (string, string, error) {
+func (c *DNSProvider) getHostedZone(fqdn string) (string, string, error) {
 	zones, _, err := c.client.Domains.List()
 	if err != nil {
 		return "", "", fmt.Errorf("DNSimple API call failed: %v", err)
 	}
 
-	authZone, err := acme.FindZoneByFqdn(acme.ToFqdn(domain), acme.RecursiveNameservers)
+	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
 		return "", "", err
 	}
@@ -92,7 +107,7 @@ func (c *DNSProvider) getHostedZone(domain string) (string, string, error) {
 	}
 
 	if hostedZone.Id == 0 {
-		return "", "", fmt.Errorf("Zone %s not found in DNSimple for domain %s", authZone, domain)
+		return "", "", fmt.Errorf("Zone %s not found in DNSimple for domain %s", authZone, acme.UnFqdn(fqdn))
 
 	}
 
@@ -100,7 +115,7 @@ func (c *DNSProvider) getHostedZone(domain string) (string, string, error) {
 }
 
 func (c *DNSProvider) findTxtRecords(domain, fqdn string) ([]dnsimple.Record, error) {
-	zoneID, zoneName, err := c.getHostedZone(domain)
+	zoneID, zoneName, err := c.getHostedZone(fqdn)
 	if err != nil {
 		return nil, err
 	}
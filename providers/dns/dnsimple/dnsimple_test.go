@@ -48,7 +48,7 @@ func TestNewDNSProviderMissingCredErr(t *testing.T) {
 	os.Setenv("DNSIMPLE_EMAIL", "")
 	os.Setenv("DNSIMPLE_API_KEY", "")
 	_, err := NewDNSProvider()
-	assert.EqualError(t, err, "DNSimple credentials missing")
+	assert.EqualError(t, err, "DNSimple credentials missing: DNSIMPLE_EMAIL, DNSIMPLE_API_KEY")
 	restoreDNSimpleEnv()
 }
 
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 )
 
 // DNSProvider is an implementation of the acme.ChallengeProvider interface that uses
@@ -41,10 +42,20 @@ type Record struct {
 	SourceID int    `json:"sourceId"`
 }
 
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("DNS Made Easy", "DNSMADEEASY_API_KEY", "DNSMADEEASY_API_SECRET")
+}
+
 // NewDNSProvider returns a DNSProvider instance configured for DNSMadeEasy DNS.
 // Credentials must be passed in the environment variables: DNSMADEEASY_API_KEY
 // and DNSMADEEASY_API_SECRET.
 func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
 	dnsmadeeasyAPIKey := os.Getenv("DNSMADEEASY_API_KEY")
 	dnsmadeeasyAPISecret := os.Getenv("DNSMADEEASY_API_SECRET")
 	dnsmadeeasySandbox := os.Getenv("DNSMADEEASY_SANDBOX")
@@ -104,7 +115,7 @@ func (d *DNSProvider) Present(domainName, token, keyAuth string) error {
 
 // CleanUp removes the TXT records matching the specified parameters
 func (d *DNSProvider) CleanUp(domainName, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domainName, keyAuth)
+	fqdn, value, _ := acme.DNS01Record(domainName, keyAuth)
 
 	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
@@ -124,8 +135,11 @@ func (d *DNSProvider) CleanUp(domainName, token, keyAuth string) error {
 		return err
 	}
 
-	// delete records
+	// delete our records, other challenges may use the same name
 	for _, record := range *records {
+		if record.Value != value && record.Value != `"`+value+`"` {
+			continue
+		}
 		err = d.deleteRecord(record)
 		if err != nil {
 			return err
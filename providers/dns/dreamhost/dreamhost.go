@@ -0,0 +1,120 @@
+// Package dreamhost implements a DNS provider for solving the DNS-01
+// challenge using the DreamHost API.
+package dreamhost
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+)
+
+// DreamHost API reference: https://help.dreamhost.com/hc/en-us/articles/217560167-API-overview
+
+// rateLimited is the error DreamHost answers with when too many requests
+// were made.
+const rateLimited = "slow_down_bucko"
+
+var (
+	// baseURL is the DreamHost API endpoint. It is overridden during tests.
+	baseURL = "https://api.dreamhost.com/"
+	// rateLimitRetries is how often a rate limited command is retried.
+	rateLimitRetries = 3
+	// rateLimitWait is the time to wait before retrying a rate limited
+	// command, doubled for every retry. It is overridden during tests.
+	rateLimitWait = 10 * time.Second
+)
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that uses the DreamHost API to manage TXT records for a domain.
+type DNSProvider struct {
+	apiKey string
+	client *http.Client
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("DreamHost", "DREAMHOST_API_KEY")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured for DreamHost.
+// Credentials must be passed in the environment variable: DREAMHOST_API_KEY.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
+	return NewDNSProviderCredentials(os.Getenv("DREAMHOST_API_KEY"))
+}
+
+// NewDNSProviderCredentials uses the supplied credentials to return a
+// DNSProvider instance configured for DreamHost.
+func NewDNSProviderCredentials(apiKey string) (*DNSProvider, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("DreamHost credentials missing")
+	}
+
+	return &DNSProvider{
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Present creates a TXT record using the specified parameters
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	return d.call("dns-add_record", acme.UnFqdn(fqdn), value)
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	return d.call("dns-remove_record", acme.UnFqdn(fqdn), value)
+}
+
+// call runs cmd for the TXT record of name with value. Commands rejected
+// because of the rate limit are retried after a while.
+func (d *DNSProvider) call(cmd, name, value string) error {
+	params := url.Values{
+		"key":    {d.apiKey},
+		"cmd":    {cmd},
+		"format": {"json"},
+		"record": {name},
+		"type":   {"TXT"},
+		"value":  {value},
+	}
+
+	wait := rateLimitWait
+	for retries := 0; ; retries++ {
+		resp, err := d.client.Get(baseURL + "?" + params.Encode())
+		if err != nil {
+			return fmt.Errorf("DreamHost: %s failed: %v", cmd, err)
+		}
+
+		var body struct {
+			Result string `json:"result"`
+			Data   string `json:"data"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("DreamHost: could not decode the response to %s: %v", cmd, err)
+		}
+
+		if body.Result == "success" {
+			return nil
+		}
+		if body.Data != rateLimited || retries == rateLimitRetries {
+			return fmt.Errorf("DreamHost: %s failed: %s", cmd, body.Data)
+		}
+
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
@@ -0,0 +1,62 @@
+package dreamhost
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+func TestDreamHostPresentAndCleanUp(t *testing.T) {
+	_, value, _ := acme.DNS01Record("example.com", "foo")
+
+	var commands []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "secret", q.Get("key"))
+		assert.Equal(t, "json", q.Get("format"))
+		assert.Equal(t, "_acme-challenge.example.com", q.Get("record"))
+		assert.Equal(t, "TXT", q.Get("type"))
+		assert.Equal(t, value, q.Get("value"))
+
+		commands = append(commands, q.Get("cmd"))
+		if len(commands) == 1 {
+			w.Write([]byte(`{"result": "error", "data": "slow_down_bucko"}`))
+			return
+		}
+		w.Write([]byte(`{"result": "success", "data": "record_added"}`))
+	}))
+	defer server.Close()
+
+	savedURL, savedWait := baseURL, rateLimitWait
+	defer func() { baseURL, rateLimitWait = savedURL, savedWait }()
+	baseURL, rateLimitWait = server.URL+"/", time.Millisecond
+
+	provider, err := NewDNSProviderCredentials("secret")
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Present("example.com", "", "foo"))
+	require.NoError(t, provider.CleanUp("example.com", "", "foo"))
+	assert.Equal(t, []string{"dns-add_record", "dns-add_record", "dns-remove_record"}, commands)
+}
+
+func TestDreamHostError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result": "error", "data": "no_such_zone"}`))
+	}))
+	defer server.Close()
+
+	savedURL := baseURL
+	defer func() { baseURL = savedURL }()
+	baseURL = server.URL + "/"
+
+	provider, err := NewDNSProviderCredentials("secret")
+	require.NoError(t, err)
+
+	err = provider.Present("example.com", "", "foo")
+	assert.EqualError(t, err, "DreamHost: dns-add_record failed: no_such_zone")
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 )
 
 var dynBaseURL = "https://api.dynect.net/REST"
@@ -39,10 +40,20 @@ type DNSProvider struct {
 	token        string
 }
 
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("DynDNS", "DYN_CUSTOMER_NAME", "DYN_USER_NAME", "DYN_PASSWORD")
+}
+
 // NewDNSProvider returns a DNSProvider instance configured for Dyn DNS.
 // Credentials must be passed in the environment variables: DYN_CUSTOMER_NAME,
 // DYN_USER_NAME and DYN_PASSWORD.
 func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
 	customerName := os.Getenv("DYN_CUSTOMER_NAME")
 	userName := os.Getenv("DYN_USER_NAME")
 	password := os.Getenv("DYN_PASSWORD")
@@ -0,0 +1,205 @@
+// Package dynadot implements a DNS provider for solving the DNS-01
+// challenge using the Dynadot API.
+package dynadot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+)
+
+// Dynadot API reference: https://www.dynadot.com/domain/api3.html
+
+// maxRecords is the number of records Dynadot keeps per domain.
+const maxRecords = 10
+
+var (
+	// apiURL is the Dynadot API endpoint. It is overridden during tests.
+	apiURL = "https://api.dynadot.com/api3.json"
+	// findZoneByFqdn determines the DNS zone of an fqdn. It is overridden
+	// during tests.
+	findZoneByFqdn = acme.FindZoneByFqdn
+)
+
+// record is a DNS record of a domain as returned by getdns.
+type record struct {
+	Host  string `json:"Host"`
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+}
+
+// apiResponse is the body of every answer of the API, wrapped in an object
+// named after the command, e.g. {"GetDnsResponse": {...}}.
+type apiResponse struct {
+	ResponseCode int      `json:"ResponseCode"`
+	Status       string   `json:"Status"`
+	Error        string   `json:"Error"`
+	Records      []record `json:"Records"`
+}
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that uses Dynadot's API to manage TXT records for a domain.
+//
+// The API can only replace all records of a domain at once, so Present and
+// CleanUp read the records, change them and write them back. The mutex
+// keeps concurrent challenges from overwriting each other.
+type DNSProvider struct {
+	apiKey string
+	client *http.Client
+	mu     sync.Mutex
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("Dynadot", "DYNADOT_API_KEY")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured for Dynadot.
+// Credentials must be passed in the environment variable: DYNADOT_API_KEY.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
+	return NewDNSProviderCredentials(os.Getenv("DYNADOT_API_KEY"))
+}
+
+// NewDNSProviderCredentials uses the supplied credentials to return a
+// DNSProvider instance configured for Dynadot.
+func NewDNSProviderCredentials(apiKey string) (*DNSProvider, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("Dynadot credentials missing")
+	}
+
+	return &DNSProvider{
+		apiKey: apiKey,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Present adds the TXT record to the records of the domain.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+
+	zone, host, err := splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	records, err := d.getRecords(zone)
+	if err != nil {
+		return err
+	}
+	if len(records) >= maxRecords {
+		return fmt.Errorf("Dynadot: %s already has %d records, the maximum Dynadot allows; no room for the challenge record", zone, len(records))
+	}
+
+	return d.setRecords(zone, append(records, record{Host: host, Type: "TXT", Value: value}))
+}
+
+// CleanUp removes the TXT record from the records of the domain.
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+
+	zone, host, err := splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	records, err := d.getRecords(zone)
+	if err != nil {
+		return err
+	}
+
+	var kept []record
+	for _, rec := range records {
+		if strings.EqualFold(rec.Type, "TXT") && strings.EqualFold(rec.Host, host) && rec.Value == value {
+			continue
+		}
+		kept = append(kept, rec)
+	}
+	if len(kept) == len(records) {
+		return nil
+	}
+
+	return d.setRecords(zone, kept)
+}
+
+// splitFqdn returns the zone of fqdn and the host name of the record
+// relative to it.
+func splitFqdn(fqdn string) (zone, host string, err error) {
+	authZone, err := findZoneByFqdn(fqdn, acme.RecursiveNameservers)
+	if err != nil {
+		return "", "", fmt.Errorf("Dynadot: could not determine zone for %s: %v", fqdn, err)
+	}
+
+	zone = acme.UnFqdn(authZone)
+	host = strings.TrimSuffix(acme.UnFqdn(fqdn), "."+zone)
+	return zone, host, nil
+}
+
+func (d *DNSProvider) getRecords(zone string) ([]record, error) {
+	resp, err := d.call("getdns", url.Values{"domain": {zone}})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Records, nil
+}
+
+// setRecords replaces all records of zone with records.
+func (d *DNSProvider) setRecords(zone string, records []record) error {
+	params := url.Values{"domain": {zone}}
+	for i, rec := range records {
+		n := strconv.Itoa(i)
+		params.Set("newhost"+n, rec.Host)
+		params.Set("newtype"+n, rec.Type)
+		params.Set("newvalue"+n, rec.Value)
+	}
+
+	_, err := d.call("setdnsrecords", params)
+	return err
+}
+
+// call runs command with params, which are passed in the query string.
+func (d *DNSProvider) call(command string, params url.Values) (*apiResponse, error) {
+	params.Set("key", d.apiKey)
+	params.Set("command", command)
+
+	resp, err := d.client.Get(apiURL + "?" + params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("Dynadot: %s failed: %v", command, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Dynadot: %s failed: HTTP %d", command, resp.StatusCode)
+	}
+
+	var body map[string]apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("Dynadot: could not decode the response to %s: %v", command, err)
+	}
+	for _, r := range body {
+		if r.ResponseCode != 0 || strings.EqualFold(r.Status, "error") {
+			return nil, fmt.Errorf("Dynadot: %s failed: %s", command, r.Error)
+		}
+		return &r, nil
+	}
+	return nil, fmt.Errorf("Dynadot: empty response to %s", command)
+}
@@ -0,0 +1,106 @@
+package dynadot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+// fakeAPI keeps the records of example.com like the Dynadot API does.
+func fakeAPI(t *testing.T, records *[]record) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "secret", q.Get("key"))
+		assert.Equal(t, "example.com", q.Get("domain"))
+
+		switch q.Get("command") {
+		case "getdns":
+			json.NewEncoder(w).Encode(map[string]apiResponse{"GetDnsResponse": {Status: "success", Records: *records}})
+		case "setdnsrecords":
+			*records = nil
+			for i := 0; q.Get("newtype"+strconv.Itoa(i)) != ""; i++ {
+				n := strconv.Itoa(i)
+				*records = append(*records, record{Host: q.Get("newhost" + n), Type: q.Get("newtype" + n), Value: q.Get("newvalue" + n)})
+			}
+			json.NewEncoder(w).Encode(map[string]apiResponse{"SetDnsResponse": {Status: "success"}})
+		default:
+			json.NewEncoder(w).Encode(map[string]apiResponse{"Response": {ResponseCode: -1, Status: "error", Error: "invalid command"}})
+		}
+	}))
+}
+
+func setup(t *testing.T, records *[]record) (*DNSProvider, func()) {
+	server := fakeAPI(t, records)
+	savedURL, savedFindZoneByFqdn := apiURL, findZoneByFqdn
+	apiURL = server.URL
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	provider, err := NewDNSProviderCredentials("secret")
+	require.NoError(t, err)
+
+	return provider, func() {
+		apiURL, findZoneByFqdn = savedURL, savedFindZoneByFqdn
+		server.Close()
+	}
+}
+
+func TestDynadotPresentAndCleanUp(t *testing.T) {
+	records := []record{{Host: "www", Type: "A", Value: "192.0.2.1"}}
+	provider, teardown := setup(t, &records)
+	defer teardown()
+
+	require.NoError(t, provider.Present("example.com", "", "foo"))
+	require.NoError(t, provider.Present("example.com", "", "bar"))
+	require.Len(t, records, 3)
+	assert.Equal(t, record{Host: "www", Type: "A", Value: "192.0.2.1"}, records[0])
+	assert.Equal(t, "_acme-challenge", records[1].Host)
+	assert.Equal(t, "TXT", records[1].Type)
+
+	require.NoError(t, provider.CleanUp("example.com", "", "foo"))
+	require.Len(t, records, 2)
+	assert.Equal(t, "www", records[0].Host)
+	_, barValue, _ := acme.DNS01Record("example.com", "bar")
+	assert.Equal(t, barValue, records[1].Value, "the other challenge record must be kept")
+
+	require.NoError(t, provider.CleanUp("example.com", "", "bar"))
+	assert.Equal(t, []record{{Host: "www", Type: "A", Value: "192.0.2.1"}}, records)
+}
+
+func TestDynadotRecordLimit(t *testing.T) {
+	var records []record
+	for i := 0; i < maxRecords; i++ {
+		records = append(records, record{Host: "host" + strconv.Itoa(i), Type: "A", Value: "192.0.2.1"})
+	}
+	provider, teardown := setup(t, &records)
+	defer teardown()
+
+	err := provider.Present("example.com", "", "foo")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already has 10 records")
+	assert.Len(t, records, maxRecords)
+}
+
+func TestDynadotAPIError(t *testing.T) {
+	savedURL := apiURL
+	defer func() { apiURL = savedURL }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"GetDnsResponse": {"ResponseCode": -1, "Status": "error", "Error": "invalid key"}}`))
+	}))
+	defer server.Close()
+	apiURL = server.URL
+
+	provider, err := NewDNSProviderCredentials("secret")
+	require.NoError(t, err)
+
+	_, err = provider.getRecords("example.com")
+	assert.EqualError(t, err, "Dynadot: getdns failed: invalid key")
+}
@@ -0,0 +1,140 @@
+// Package filezone implements a DNS provider for solving the DNS-01
+// challenge by writing the TXT records into a JSON file, for test
+// environments where another process serves the records from that file.
+package filezone
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/gofrs/flock"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+)
+
+// Record is a TXT record as stored in the zone file.
+type Record struct {
+	Fqdn  string `json:"fqdn"`
+	Value string `json:"value"`
+	TTL   int    `json:"ttl"`
+}
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that keeps the challenge records in a JSON array of Records.
+type DNSProvider struct {
+	path string
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("File zone", "DNS_FILEZONE_PATH")
+}
+
+// NewDNSProvider returns a DNSProvider instance writing to the file at
+// DNS_FILEZONE_PATH.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+	return NewDNSProviderPath(os.Getenv("DNS_FILEZONE_PATH"))
+}
+
+// NewDNSProviderPath returns a DNSProvider instance writing to the file at
+// path. Writers hold a lock on path + ".lock" while updating it.
+func NewDNSProviderPath(path string) (*DNSProvider, error) {
+	if path == "" {
+		return nil, fmt.Errorf("File zone path missing")
+	}
+	return &DNSProvider{path: path}, nil
+}
+
+// Present adds the TXT record to the file.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+
+	return d.update(func(records []Record) []Record {
+		return append(records, Record{Fqdn: fqdn, Value: value, TTL: ttl})
+	})
+}
+
+// CleanUp removes the TXT record added by Present from the file.
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+
+	return d.update(func(records []Record) []Record {
+		var kept []Record
+		for _, record := range records {
+			if record.Fqdn != fqdn || record.Value != value {
+				kept = append(kept, record)
+			}
+		}
+		return kept
+	})
+}
+
+// Records returns the records currently stored in the file.
+func (d *DNSProvider) Records() ([]Record, error) {
+	data, err := ioutil.ReadFile(d.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, fmt.Errorf("Could not parse %s: %v", d.path, err)
+		}
+	}
+	return records, nil
+}
+
+// update applies fn to the records under the file lock. The new content is
+// written to a temporary file first and renamed over the old one, so readers
+// never see a partially written file.
+func (d *DNSProvider) update(fn func([]Record) []Record) error {
+	lock := flock.New(d.path + ".lock")
+	if err := lock.Lock(); err != nil {
+		return fmt.Errorf("Could not lock %s: %v", d.path, err)
+	}
+	defer lock.Unlock()
+
+	records, err := d.Records()
+	if err != nil {
+		return err
+	}
+
+	records = fn(records)
+	if records == nil {
+		records = []Record{}
+	}
+	data, err := json.MarshalIndent(records, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(d.path), filepath.Base(d.path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path)
+}
@@ -0,0 +1,64 @@
+package filezone
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+func TestNewDNSProviderMissingCredErr(t *testing.T) {
+	defer os.Setenv("DNS_FILEZONE_PATH", os.Getenv("DNS_FILEZONE_PATH"))
+	os.Setenv("DNS_FILEZONE_PATH", "")
+
+	_, err := NewDNSProvider()
+	assert.EqualError(t, err, "File zone credentials missing: DNS_FILEZONE_PATH")
+}
+
+func TestPresentCleanUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filezone")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	provider, err := NewDNSProviderPath(filepath.Join(dir, "zone.json"))
+	require.NoError(t, err)
+
+	records, err := provider.Records()
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	domains := []string{"example.com", "www.example.com", "example.org", "mail.example.org"}
+	var wg sync.WaitGroup
+	for _, domain := range domains {
+		wg.Add(1)
+		go func(domain string) {
+			defer wg.Done()
+			assert.NoError(t, provider.Present(domain, "", "123d=="))
+		}(domain)
+	}
+	wg.Wait()
+
+	records, err = provider.Records()
+	require.NoError(t, err)
+	assert.Len(t, records, len(domains))
+
+	require.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+
+	fqdn, value, ttl := acme.DNS01Record("www.example.com", "123d==")
+	records, err = provider.Records()
+	require.NoError(t, err)
+	assert.Len(t, records, len(domains)-1)
+	assert.NotContains(t, records, Record{Fqdn: fqdn, Value: value, TTL: ttl})
+
+	for _, domain := range domains {
+		require.NoError(t, provider.CleanUp(domain, "", "123d=="))
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "zone.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "[]", string(data))
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 )
 
 // Gandi API reference:       http://doc.rpc.gandi.net/index.html
@@ -36,6 +37,14 @@ type inProgressInfo struct {
 	authZone  string // the domain name registered at gandi with trailing "."
 }
 
+// liveDNSDocs documents the Gandi LiveDNS (v5) REST API, which replaces
+// the XML-RPC API for accounts migrated to LiveDNS.
+const liveDNSDocs = "https://doc.livedns.gandi.net/"
+
+// liveDNSFaultCode is the XML-RPC fault, "Invalid API key", returned for
+// the API keys of accounts migrated to LiveDNS.
+const liveDNSFaultCode = 510150
+
 // DNSProvider is an implementation of the
 // acme.ChallengeProviderTimeout interface that uses Gandi's XML-RPC
 // API to manage TXT records for a domain.
@@ -44,11 +53,22 @@ type DNSProvider struct {
 	inProgressFQDNs     map[string]inProgressInfo
 	inProgressAuthZones map[string]struct{}
 	inProgressMu        sync.Mutex
+	apiChecked          bool
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("Gandi", "GANDI_API_KEY")
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for Gandi.
 // Credentials must be passed in the environment variable: GANDI_API_KEY.
 func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
 	apiKey := os.Getenv("GANDI_API_KEY")
 	return NewDNSProviderCredentials(apiKey)
 }
@@ -74,6 +94,9 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 	if ttl < 300 {
 		ttl = 300 // 300 is gandi minimum value for ttl
 	}
+	if err := d.checkAPIOnce(); err != nil {
+		return err
+	}
 	// find authZone and Gandi zone_id for fqdn
 	authZone, err := findZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
@@ -163,6 +186,51 @@ func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 	return nil
 }
 
+// CheckAPI makes sure the account uses the v4 XML-RPC API by listing
+// its zones. Accounts which were migrated to LiveDNS cannot manage
+// their records through this API; the error then points to the v5 API
+// documentation. Present calls it before the first challenge.
+func (d *DNSProvider) CheckAPI() error {
+	resp := &responseArray{}
+	err := rpcCall(&methodCall{
+		MethodName: "domain.zone.list",
+		Params: []param{
+			paramString{Value: d.apiKey},
+		},
+	}, resp)
+	if rpcErr, ok := err.(rpcError); ok && rpcErr.faultCode == liveDNSFaultCode {
+		return fmt.Errorf("%v; the account does not seem to use the v4 API. "+
+			"Zones on Gandi LiveDNS need the v5 REST API, see %s", err, liveDNSDocs)
+	}
+	if err != nil {
+		return err
+	}
+	if resp.Array == nil {
+		return fmt.Errorf("Gandi DNS: domain.zone.list did not return a zone list")
+	}
+	return nil
+}
+
+// checkAPIOnce runs CheckAPI until it succeeded once. Concurrent first
+// challenges may each run it, the lock is not held during the call.
+func (d *DNSProvider) checkAPIOnce() error {
+	d.inProgressMu.Lock()
+	checked := d.apiChecked
+	d.inProgressMu.Unlock()
+	if checked {
+		return nil
+	}
+
+	if err := d.CheckAPI(); err != nil {
+		return err
+	}
+
+	d.inProgressMu.Lock()
+	d.apiChecked = true
+	d.inProgressMu.Unlock()
+	return nil
+}
+
 // Timeout returns the values (40*time.Minute, 60*time.Second) which
 // are used by the acme package as timeout and check interval values
 // when checking for DNS record propagation with Gandi.
@@ -240,6 +308,11 @@ type responseInt struct {
 	Value int `xml:"params>param>value>int"`
 }
 
+type responseArray struct {
+	responseFault
+	Array *struct{} `xml:"params>param>value>array"`
+}
+
 type responseBool struct {
 	responseFault
 	Value bool `xml:"params>param>value>boolean"`
@@ -92,6 +92,89 @@ func TestDNSProvider(t *testing.T) {
 	}
 }
 
+// TestCheckAPILiveDNS makes sure accounts on LiveDNS, which the
+// XML-RPC API rejects, are told about the v5 API.
+func TestCheckAPILiveDNS(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<?xml version='1.0'?>
+<methodResponse>
+<fault>
+<value><struct>
+<member>
+<name>faultCode</name>
+<value><int>510150</int></value>
+</member>
+<member>
+<name>faultString</name>
+<value><string>Invalid API key</string></value>
+</member>
+</struct></value>
+</fault>
+</methodResponse>
+`)
+	}))
+	defer fakeServer.Close()
+
+	savedEndpoint, savedFindZoneByFqdn := endpoint, findZoneByFqdn
+	defer func() {
+		endpoint, findZoneByFqdn = savedEndpoint, savedFindZoneByFqdn
+	}()
+	endpoint = fakeServer.URL + "/"
+	findZoneByFqdn = func(fqdn string, nameserver []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	provider, err := NewDNSProviderCredentials("123412341234123412341234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = provider.CheckAPI()
+	if err == nil || !strings.Contains(err.Error(), liveDNSDocs) {
+		t.Fatalf("Expected an error pointing to the LiveDNS API, got %v", err)
+	}
+	err = provider.Present("abc.def.example.com", "", "XXXX")
+	if err == nil || !strings.Contains(err.Error(), liveDNSDocs) {
+		t.Fatalf("Expected Present to fail for a LiveDNS account, got %v", err)
+	}
+}
+
+// TestCheckAPIOtherFault makes sure other errors are passed on without
+// the LiveDNS hint.
+func TestCheckAPIOtherFault(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<?xml version='1.0'?>
+<methodResponse>
+<fault>
+<value><struct>
+<member>
+<name>faultCode</name>
+<value><int>500000</int></value>
+</member>
+<member>
+<name>faultString</name>
+<value><string>Internal error</string></value>
+</member>
+</struct></value>
+</fault>
+</methodResponse>
+`)
+	}))
+	defer fakeServer.Close()
+
+	savedEndpoint := endpoint
+	defer func() { endpoint = savedEndpoint }()
+	endpoint = fakeServer.URL + "/"
+
+	provider, err := NewDNSProviderCredentials("123412341234123412341234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = provider.CheckAPI()
+	if err == nil || err.Error() != "Gandi DNS: RPC Error: (500000) Internal error" {
+		t.Fatalf("Expected the RPC error as is, got %v", err)
+	}
+}
+
 // TestDNSProviderLive performs a live test to obtain a certificate
 // using the Let's Encrypt staging server. It runs provided that both
 // the environment variables GANDI_API_KEY and GANDI_TEST_DOMAIN are
@@ -152,6 +235,35 @@ func TestDNSProviderLive(t *testing.T) {
 // which resulted in the successful issue of a cert, and then
 // anonymizing the RPC data.
 var serverResponses = map[string]string{
+	// Present Request->Response 0 (CheckAPI)
+	`<?xml version="1.0"?>
+<methodCall>
+  <methodName>domain.zone.list</methodName>
+  <param>
+    <value>
+      <string>123412341234123412341234</string>
+    </value>
+  </param>
+</methodCall>`: `<?xml version='1.0'?>
+<methodResponse>
+<params>
+<param>
+<value><array><data>
+<value><struct>
+<member>
+<name>id</name>
+<value><int>1234567</int></value>
+</member>
+<member>
+<name>name</name>
+<value><string>example.com</string></value>
+</member>
+</struct></value>
+</data></array></value>
+</param>
+</params>
+</methodResponse>
+`,
 	// Present Request->Response 1 (getZoneID)
 	`<?xml version="1.0"?>
 <methodCall>
@@ -0,0 +1,223 @@
+// Package godaddy implements a DNS provider for solving the DNS-01
+// challenge using GoDaddy DNS.
+package godaddy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+)
+
+// GoDaddy API reference: https://developer.godaddy.com/doc/endpoint/domains
+
+// minTTL is the lowest TTL GoDaddy accepts.
+const minTTL = 600
+
+var (
+	// baseURL is the root of the GoDaddy API. It is overridden during
+	// tests.
+	baseURL = "https://api.godaddy.com"
+	// findZoneByFqdn determines the DNS zone of an fqdn. It is overridden
+	// during tests.
+	findZoneByFqdn = acme.FindZoneByFqdn
+)
+
+// DNSRecord is a record of the GoDaddy API.
+type DNSRecord struct {
+	Data string `json:"data"`
+	TTL  int    `json:"ttl,omitempty"`
+}
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that uses GoDaddy's REST API to manage TXT records for a domain.
+//
+// The API replaces all TXT records of a name at once. Present and CleanUp
+// read the records, change them and write them back under a mutex, so
+// concurrent challenges for the same name keep each other's records.
+type DNSProvider struct {
+	apiKey    string
+	apiSecret string
+	client    *http.Client
+	mu        sync.Mutex
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("GoDaddy", "GODADDY_API_KEY", "GODADDY_API_SECRET")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured for GoDaddy.
+// Credentials must be passed in the environment variables: GODADDY_API_KEY
+// and GODADDY_API_SECRET.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
+	return NewDNSProviderCredentials(os.Getenv("GODADDY_API_KEY"), os.Getenv("GODADDY_API_SECRET"))
+}
+
+// NewDNSProviderCredentials uses the supplied credentials to return a
+// DNSProvider instance configured for GoDaddy.
+func NewDNSProviderCredentials(apiKey, apiSecret string) (*DNSProvider, error) {
+	if apiKey == "" || apiSecret == "" {
+		return nil, fmt.Errorf("GoDaddy credentials missing")
+	}
+
+	return &DNSProvider{
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Timeout returns the timeout and interval to use when checking for DNS
+// propagation. GoDaddy takes a few minutes to publish changes.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return 10 * time.Minute, 10 * time.Second
+}
+
+// Present adds the TXT record to the records of its name.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	if ttl < minTTL {
+		ttl = minTTL
+	}
+
+	zone, name, err := splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	records, err := d.getRecords(zone, name)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if rec.Data == value {
+			return nil
+		}
+	}
+
+	return d.putRecords(zone, name, append(records, DNSRecord{Data: value, TTL: ttl}))
+}
+
+// CleanUp removes the TXT record from the records of its name.
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+
+	zone, name, err := splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	records, err := d.getRecords(zone, name)
+	if err != nil {
+		return err
+	}
+
+	var kept []DNSRecord
+	for _, rec := range records {
+		if rec.Data != value {
+			kept = append(kept, rec)
+		}
+	}
+	if len(kept) == len(records) {
+		return nil
+	}
+	if len(kept) == 0 {
+		_, err := d.do("DELETE", recordsPath(zone, name), nil)
+		return err
+	}
+	return d.putRecords(zone, name, kept)
+}
+
+// splitFqdn returns the zone of fqdn and the name of the record relative
+// to it.
+func splitFqdn(fqdn string) (zone, name string, err error) {
+	authZone, err := findZoneByFqdn(fqdn, acme.RecursiveNameservers)
+	if err != nil {
+		return "", "", fmt.Errorf("GoDaddy: could not determine zone for %s: %v", fqdn, err)
+	}
+
+	zone = acme.UnFqdn(authZone)
+	name = strings.TrimSuffix(acme.UnFqdn(fqdn), "."+zone)
+	return zone, name, nil
+}
+
+func recordsPath(zone, name string) string {
+	return fmt.Sprintf("/v1/domains/%s/records/TXT/%s", zone, name)
+}
+
+func (d *DNSProvider) getRecords(zone, name string) ([]DNSRecord, error) {
+	body, err := d.do("GET", recordsPath(zone, name), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []DNSRecord
+	if err := json.Unmarshal(body, &records); err != nil {
+		return nil, fmt.Errorf("GoDaddy: could not decode the TXT records of %s: %v", name, err)
+	}
+	return records, nil
+}
+
+// putRecords replaces the TXT records of name with records.
+func (d *DNSProvider) putRecords(zone, name string, records []DNSRecord) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.do("PUT", recordsPath(zone, name), body)
+	return err
+}
+
+func (d *DNSProvider) do(method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("sso-key %s:%s", d.apiKey, d.apiSecret))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GoDaddy: %s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("GoDaddy: %s %s failed: %v", method, path, err)
+	}
+
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(respBody, &apiErr)
+		return nil, fmt.Errorf("GoDaddy: %s %s failed: HTTP %d: %s: %s", method, path, resp.StatusCode, apiErr.Code, apiErr.Message)
+	}
+	return respBody, nil
+}
@@ -0,0 +1,60 @@
+package godaddy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+func TestGoDaddyPresentAndCleanUp(t *testing.T) {
+	records := []DNSRecord{}
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "sso-key key:secret", r.Header.Get("Authorization"))
+		if r.URL.Path != "/v1/domains/example.com/records/TXT/_acme-challenge" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code": "NOT_FOUND", "message": "Not found"}`))
+			return
+		}
+
+		methods = append(methods, r.Method)
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(records)
+		case "PUT":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&records))
+		case "DELETE":
+			records = []DNSRecord{}
+		}
+	}))
+	defer server.Close()
+
+	savedURL, savedFindZoneByFqdn := baseURL, findZoneByFqdn
+	defer func() { baseURL, findZoneByFqdn = savedURL, savedFindZoneByFqdn }()
+	baseURL = server.URL
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	provider, err := NewDNSProviderCredentials("key", "secret")
+	require.NoError(t, err)
+
+	_, foo, _ := acme.DNS01Record("example.com", "foo")
+	_, bar, _ := acme.DNS01Record("example.com", "bar")
+
+	require.NoError(t, provider.Present("example.com", "", "foo"))
+	require.NoError(t, provider.Present("example.com", "", "bar"))
+	assert.Equal(t, []DNSRecord{{Data: foo, TTL: minTTL}, {Data: bar, TTL: minTTL}}, records)
+
+	require.NoError(t, provider.CleanUp("example.com", "", "foo"))
+	assert.Equal(t, []DNSRecord{{Data: bar, TTL: minTTL}}, records)
+
+	require.NoError(t, provider.CleanUp("example.com", "", "bar"))
+	assert.Empty(t, records)
+	assert.Equal(t, []string{"GET", "PUT", "GET", "PUT", "GET", "PUT", "GET", "DELETE"}, methods)
+}
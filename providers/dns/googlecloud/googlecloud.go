@@ -5,9 +5,11 @@ package googlecloud
 import (
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2/google"
@@ -16,14 +18,29 @@ import (
 )
 
 // DNSProvider is an implementation of the DNSProvider interface.
+//
+// Cloud DNS changes whole RRsets, so Present and CleanUp read the TXT values,
+// change them and write them back. The mutex keeps concurrent challenges
+// from overwriting each other.
 type DNSProvider struct {
 	project string
 	client  *dns.Service
+	mu      sync.Mutex
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("Google Cloud", "GCE_PROJECT")
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for Google Cloud
 // DNS. Credentials must be passed in the environment variable: GCE_PROJECT.
 func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
 	project := os.Getenv("GCE_PROJECT")
 	return NewDNSProviderCredentials(project)
 }
@@ -53,19 +70,38 @@ func NewDNSProviderCredentials(project string) (*DNSProvider, error) {
 func (c *DNSProvider) Present(domain, token, keyAuth string) error {
 	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
 
-	zone, err := c.getHostedZone(domain)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	zone, err := c.getHostedZone(fqdn)
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.findTxtRecords(zone, fqdn)
 	if err != nil {
 		return err
 	}
 
+	// An RRset can only be added once, so replace an existing one with the
+	// union of its values and the new one.
 	rec := &dns.ResourceRecordSet{
 		Name:    fqdn,
 		Rrdatas: []string{value},
 		Ttl:     int64(ttl),
 		Type:    "TXT",
 	}
+	for _, set := range existing {
+		for _, data := range set.Rrdatas {
+			if data == value || data == `"`+value+`"` {
+				return nil
+			}
+			rec.Rrdatas = append(rec.Rrdatas, data)
+		}
+	}
 	change := &dns.Change{
 		Additions: []*dns.ResourceRecordSet{rec},
+		Deletions: existing,
 	}
 
 	chg, err := c.client.Changes.Create(c.project, zone, change).Do()
@@ -88,9 +124,12 @@ func (c *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (c *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
 
-	zone, err := c.getHostedZone(domain)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	zone, err := c.getHostedZone(fqdn)
 	if err != nil {
 		return err
 	}
@@ -104,6 +143,21 @@ func (c *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 		change := &dns.Change{
 			Deletions: []*dns.ResourceRecordSet{rec},
 		}
+
+		// keep the values of other challenges for the same name
+		remaining := &dns.ResourceRecordSet{Name: rec.Name, Ttl: rec.Ttl, Type: rec.Type}
+		for _, data := range rec.Rrdatas {
+			if data != value && data != `"`+value+`"` {
+				remaining.Rrdatas = append(remaining.Rrdatas, data)
+			}
+		}
+		if len(remaining.Rrdatas) == len(rec.Rrdatas) {
+			continue
+		}
+		if len(remaining.Rrdatas) > 0 {
+			change.Additions = []*dns.ResourceRecordSet{remaining}
+		}
+
 		_, err = c.client.Changes.Create(c.project, zone, change).Do()
 		if err != nil {
 			return err
@@ -119,8 +173,8 @@ func (c *DNSProvider) Timeout() (timeout, interval time.Duration) {
 }
 
 // getHostedZone returns the managed-zone
-func (c *DNSProvider) getHostedZone(domain string) (string, error) {
-	authZone, err := acme.FindZoneByFqdn(acme.ToFqdn(domain), acme.RecursiveNameservers)
+func (c *DNSProvider) getHostedZone(fqdn string) (string, error) {
+	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
 		return "", err
 	}
@@ -54,7 +54,7 @@ func TestNewDNSProviderValidEnv(t *testing.T) {
 func TestNewDNSProviderMissingCredErr(t *testing.T) {
 	os.Setenv("GCE_PROJECT", "")
 	_, err := NewDNSProvider()
-	assert.EqualError(t, err, "Google Cloud project name missing")
+	assert.EqualError(t, err, "Google Cloud credentials missing: GCE_PROJECT")
 	restoreGCloudEnv()
 }
 
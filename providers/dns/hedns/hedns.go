@@ -0,0 +1,118 @@
+// Package hedns implements a DNS provider for solving the DNS-01 challenge
+// using the dynamic DNS endpoint of Hurricane Electric Free DNS.
+//
+// This provider does not log in to dns.he.net. It only uses the DDNS update
+// URL, dyn.dns.he.net, authenticated with the DDNS key of a single record,
+// so the account password is never needed. The _acme-challenge TXT record
+// has to be created once in the dns.he.net web interface with "Enable entry
+// for dynamic dns" checked, and its DDNS key passed as HEDNS_TOKEN.
+package hedns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+)
+
+// placeholder is the value the TXT record gets in CleanUp. Deleting the
+// record would also delete its DDNS key, so it is kept with a dummy value.
+const placeholder = "lego-cleaned-up"
+
+// updateURL is the DDNS endpoint of Hurricane Electric. It is overridden
+// during tests.
+var updateURL = "https://dyn.dns.he.net/nic/update"
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that updates a TXT record through the Hurricane Electric DDNS endpoint.
+// One DDNS key updates one record holding one value, so challenges for
+// several names in the zone need a provider each.
+type DNSProvider struct {
+	zone   string
+	token  string
+	client *http.Client
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("Hurricane Electric", "HEDNS_ZONE", "HEDNS_TOKEN")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured for Hurricane
+// Electric. The zone and the DDNS key of the challenge record must be
+// passed in the environment variables: HEDNS_ZONE and HEDNS_TOKEN.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
+	return NewDNSProviderCredentials(os.Getenv("HEDNS_ZONE"), os.Getenv("HEDNS_TOKEN"))
+}
+
+// NewDNSProviderCredentials uses the supplied credentials to return a
+// DNSProvider instance configured for Hurricane Electric.
+func NewDNSProviderCredentials(zone, token string) (*DNSProvider, error) {
+	if zone == "" || token == "" {
+		return nil, fmt.Errorf("Hurricane Electric credentials missing")
+	}
+
+	return &DNSProvider{
+		zone:   acme.ToFqdn(strings.ToLower(zone)),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Present sets the TXT record to the challenge value.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	return d.update(fqdn, value)
+}
+
+// CleanUp resets the TXT record to a placeholder value.
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	return d.update(fqdn, placeholder)
+}
+
+func (d *DNSProvider) update(fqdn, value string) error {
+	if fqdn = strings.ToLower(fqdn); !strings.HasSuffix(fqdn, "."+d.zone) {
+		return fmt.Errorf("Hurricane Electric: %s is not in zone %s", fqdn, d.zone)
+	}
+
+	resp, err := d.client.PostForm(updateURL, url.Values{
+		"hostname": {acme.UnFqdn(fqdn)},
+		"password": {d.token},
+		"txt":      {value},
+	})
+	if err != nil {
+		return fmt.Errorf("Hurricane Electric: update of %s failed: %v", fqdn, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Hurricane Electric: update of %s failed: %v", fqdn, err)
+	}
+
+	// The answer follows the dyndns protocol: "good <value>" or "nochg
+	// <value>" on success, otherwise a code like badauth or nohost.
+	answer := strings.TrimSpace(string(body))
+	if strings.HasPrefix(answer, "good") || strings.HasPrefix(answer, "nochg") {
+		return nil
+	}
+	switch answer {
+	case "badauth":
+		return fmt.Errorf("Hurricane Electric: the DDNS key was not accepted for %s; is dynamic DNS enabled for the record?", fqdn)
+	case "nohost":
+		return fmt.Errorf("Hurricane Electric: %s has no TXT record yet; create it in the web interface with dynamic DNS enabled", fqdn)
+	}
+	return fmt.Errorf("Hurricane Electric: update of %s failed: HTTP %d: %s", fqdn, resp.StatusCode, answer)
+}
@@ -0,0 +1,46 @@
+package hedns
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+func TestHEDNSPresentAndCleanUp(t *testing.T) {
+	var values []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("password") != "ddns-key" {
+			w.Write([]byte("badauth"))
+			return
+		}
+		assert.Equal(t, "_acme-challenge.example.com", r.FormValue("hostname"))
+		values = append(values, r.FormValue("txt"))
+		w.Write([]byte("good " + r.FormValue("txt")))
+	}))
+	defer server.Close()
+
+	savedURL := updateURL
+	defer func() { updateURL = savedURL }()
+	updateURL = server.URL
+
+	provider, err := NewDNSProviderCredentials("Example.com", "ddns-key")
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Present("example.com", "", "foo"))
+	require.NoError(t, provider.CleanUp("example.com", "", "foo"))
+
+	_, value, _ := acme.DNS01Record("example.com", "foo")
+	assert.Equal(t, []string{value, placeholder}, values)
+
+	err = provider.Present("example.org", "", "foo")
+	assert.EqualError(t, err, "Hurricane Electric: _acme-challenge.example.org. is not in zone example.com.")
+
+	provider, err = NewDNSProviderCredentials("example.com", "wrong")
+	require.NoError(t, err)
+	err = provider.Present("example.com", "", "foo")
+	assert.EqualError(t, err, "Hurricane Electric: the DDNS key was not accepted for _acme-challenge.example.com.; is dynamic DNS enabled for the record?")
+}
@@ -0,0 +1,213 @@
+// Package hover implements a DNS provider for solving the DNS-01
+// challenge using Hover DNS.
+//
+// Hover has no public API. This provider uses the API behind the Hover
+// control panel, which is undocumented and may change without notice. Use
+// it at your own risk and expect it to break when Hover changes their
+// website.
+package hover
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+)
+
+// DefaultLoginTimeout is the time the login may take unless
+// HOVER_LOGIN_TIMEOUT says otherwise.
+const DefaultLoginTimeout = 30 * time.Second
+
+var (
+	// baseURL is the root of the Hover API. It is overridden during tests.
+	baseURL = "https://www.hover.com/api"
+	// findZoneByFqdn determines the DNS zone of an fqdn. It is overridden
+	// during tests.
+	findZoneByFqdn = acme.FindZoneByFqdn
+)
+
+// apiResponse is the answer of the Hover API to every call.
+type apiResponse struct {
+	Succeeded bool   `json:"succeeded"`
+	Error     string `json:"error"`
+	ID        string `json:"id"`
+}
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that uses the Hover control panel API to manage TXT records for a domain.
+type DNSProvider struct {
+	username     string
+	password     string
+	loginTimeout time.Duration
+	client       *http.Client
+
+	mu          sync.Mutex
+	loggedIn    bool
+	recordIDs   map[string]string // by fqdn and value of the record
+	recordIDsMu sync.Mutex
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("Hover", "HOVER_USERNAME", "HOVER_PASSWORD")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured for Hover.
+// Credentials must be passed in the environment variables: HOVER_USERNAME
+// and HOVER_PASSWORD. HOVER_LOGIN_TIMEOUT optionally sets the time in
+// seconds the login may take.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
+	var loginTimeout time.Duration
+	if s := os.Getenv("HOVER_LOGIN_TIMEOUT"); s != "" {
+		seconds, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("Hover: invalid HOVER_LOGIN_TIMEOUT %q: %v", s, err)
+		}
+		loginTimeout = time.Duration(seconds) * time.Second
+	}
+
+	return NewDNSProviderCredentials(os.Getenv("HOVER_USERNAME"), os.Getenv("HOVER_PASSWORD"), loginTimeout)
+}
+
+// NewDNSProviderCredentials uses the supplied credentials to return a
+// DNSProvider instance configured for Hover. A zero loginTimeout means
+// DefaultLoginTimeout.
+func NewDNSProviderCredentials(username, password string, loginTimeout time.Duration) (*DNSProvider, error) {
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("Hover credentials missing")
+	}
+	if loginTimeout <= 0 {
+		loginTimeout = DefaultLoginTimeout
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DNSProvider{
+		username:     username,
+		password:     password,
+		loginTimeout: loginTimeout,
+		client:       &http.Client{Jar: jar, Timeout: 30 * time.Second},
+		recordIDs:    make(map[string]string),
+	}, nil
+}
+
+// Present creates a TXT record using the specified parameters
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+
+	authZone, err := findZoneByFqdn(fqdn, acme.RecursiveNameservers)
+	if err != nil {
+		return fmt.Errorf("Hover: could not determine zone for %s: %v", domain, err)
+	}
+	zone := acme.UnFqdn(authZone)
+
+	if err := d.login(); err != nil {
+		return err
+	}
+
+	resp, err := d.call("POST", "/dns", url.Values{
+		"domain":  {zone},
+		"name":    {strings.TrimSuffix(acme.UnFqdn(fqdn), "."+zone)},
+		"type":    {"TXT"},
+		"content": {value},
+		"ttl":     {strconv.Itoa(ttl)},
+	}, d.client)
+	if err != nil {
+		return err
+	}
+
+	d.recordIDsMu.Lock()
+	d.recordIDs[fqdn+" "+value] = resp.ID
+	d.recordIDsMu.Unlock()
+	return nil
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+
+	d.recordIDsMu.Lock()
+	id, ok := d.recordIDs[fqdn+" "+value]
+	d.recordIDsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("Hover: unknown record ID for '%s'", fqdn)
+	}
+
+	if err := d.login(); err != nil {
+		return err
+	}
+
+	if _, err := d.call("DELETE", "/dns/"+id, nil, d.client); err != nil {
+		return err
+	}
+
+	d.recordIDsMu.Lock()
+	delete(d.recordIDs, fqdn+" "+value)
+	d.recordIDsMu.Unlock()
+	return nil
+}
+
+// login signs in with the form used by the Hover website once. The session
+// cookie is kept in the cookie jar of the client.
+func (d *DNSProvider) login() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.loggedIn {
+		return nil
+	}
+
+	client := &http.Client{Jar: d.client.Jar, Timeout: d.loginTimeout}
+	_, err := d.call("POST", "/login", url.Values{
+		"username": {d.username},
+		"password": {d.password},
+	}, client)
+	if err != nil {
+		return fmt.Errorf("Hover: login failed: %v", err)
+	}
+
+	d.loggedIn = true
+	return nil
+}
+
+func (d *DNSProvider) call(method, path string, form url.Values, client *http.Client) (*apiResponse, error) {
+	req, err := http.NewRequest(method, baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Hover: %s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var body apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("Hover: %s %s failed: HTTP %d", method, path, resp.StatusCode)
+	}
+	if resp.StatusCode >= 400 || !body.Succeeded {
+		return nil, fmt.Errorf("Hover: %s %s failed: HTTP %d: %s", method, path, resp.StatusCode, body.Error)
+	}
+	return &body, nil
+}
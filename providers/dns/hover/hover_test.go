@@ -0,0 +1,65 @@
+package hover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHoverPresentAndCleanUp(t *testing.T) {
+	var logins, deleted int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/login":
+			logins++
+			if r.FormValue("username") != "user" || r.FormValue("password") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"succeeded": false, "error": "Invalid username or password"}`))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "hoverauth", Value: "session", Path: "/"})
+			w.Write([]byte(`{"succeeded": true}`))
+		case r.Method == "POST" && r.URL.Path == "/api/dns":
+			if c, err := r.Cookie("hoverauth"); err != nil || c.Value != "session" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"succeeded": false, "error": "login required"}`))
+				return
+			}
+			assert.Equal(t, "example.com", r.FormValue("domain"))
+			assert.Equal(t, "_acme-challenge", r.FormValue("name"))
+			assert.Equal(t, "TXT", r.FormValue("type"))
+			w.Write([]byte(`{"succeeded": true, "id": "dns1234"}`))
+		case r.Method == "DELETE" && r.URL.Path == "/api/dns/dns1234":
+			deleted++
+			w.Write([]byte(`{"succeeded": true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	savedURL, savedFindZoneByFqdn := baseURL, findZoneByFqdn
+	defer func() { baseURL, findZoneByFqdn = savedURL, savedFindZoneByFqdn }()
+	baseURL = server.URL + "/api"
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	provider, err := NewDNSProviderCredentials("user", "secret", 0)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultLoginTimeout, provider.loginTimeout)
+
+	require.NoError(t, provider.Present("example.com", "", "foo"))
+	require.NoError(t, provider.CleanUp("example.com", "", "foo"))
+	assert.Equal(t, 1, logins)
+	assert.Equal(t, 1, deleted)
+
+	provider, err = NewDNSProviderCredentials("user", "wrong", time.Second)
+	require.NoError(t, err)
+	err = provider.Present("example.com", "", "foo")
+	assert.EqualError(t, err, "Hover: login failed: Hover: POST /login failed: HTTP 401: Invalid username or password")
+}
@@ -0,0 +1,31 @@
+// Package env checks the environment variables the DNS providers read their
+// configuration from.
+package env
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Missing returns the names of those environment variables which are unset
+// or empty.
+func Missing(names ...string) []string {
+	var missing []string
+	for _, name := range names {
+		if os.Getenv(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// Check returns an error listing every missing environment variable of
+// the named provider, or nil if all of them are set.
+func Check(provider string, names ...string) error {
+	missing := Missing(names...)
+	if len(missing) > 0 {
+		return fmt.Errorf("%s credentials missing: %s", provider, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package env
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	os.Setenv("LEGO_ENV_TEST_SET", "value")
+	os.Setenv("LEGO_ENV_TEST_EMPTY", "")
+	defer os.Unsetenv("LEGO_ENV_TEST_SET")
+	defer os.Unsetenv("LEGO_ENV_TEST_EMPTY")
+
+	assert.NoError(t, Check("Test", "LEGO_ENV_TEST_SET"))
+	assert.EqualError(t, Check("Test", "LEGO_ENV_TEST_EMPTY", "LEGO_ENV_TEST_SET", "LEGO_ENV_TEST_UNSET"),
+		"Test credentials missing: LEGO_ENV_TEST_EMPTY, LEGO_ENV_TEST_UNSET")
+}
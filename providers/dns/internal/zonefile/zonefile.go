@@ -0,0 +1,54 @@
+// Package zonefile edits the BIND style zone files of the DNS providers which
+// manage a nameserver's zones directly.
+package zonefile
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// soaRecord matches the type of the SOA record in a zone file.
+var soaRecord = regexp.MustCompile(`(?i)\sSOA\s`)
+
+// IncrementSerial returns content with the serial of the SOA record
+// incremented by one. The SOA record may span several lines in parentheses
+// and contain comments.
+func IncrementSerial(content string) (string, error) {
+	loc := soaRecord.FindStringIndex(content)
+	if loc == nil {
+		return "", fmt.Errorf("no SOA record")
+	}
+
+	// The serial is the third field after the type: MNAME RNAME SERIAL.
+	field := 0
+	for i := loc[1]; i < len(content); {
+		switch c := content[i]; {
+		case c == ';':
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+		case c == '(' || c == ')' || unicode.IsSpace(rune(c)):
+			i++
+		default:
+			start := i
+			for i < len(content) && !unicode.IsSpace(rune(content[i])) && !strings.ContainsRune("();", rune(content[i])) {
+				i++
+			}
+			if field == 2 {
+				serial, err := strconv.ParseUint(content[start:i], 10, 32)
+				if err != nil {
+					return "", fmt.Errorf("invalid SOA serial %q", content[start:i])
+				}
+				// Serials are compared in sequence space arithmetic, so
+				// wrapping around at 2^32 is fine.
+				next := uint32(serial) + 1
+				return content[:start] + strconv.FormatUint(uint64(next), 10) + content[i:], nil
+			}
+			field++
+		}
+	}
+	return "", fmt.Errorf("incomplete SOA record")
+}
@@ -0,0 +1,26 @@
+package zonefile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncrementSerial(t *testing.T) {
+	content, err := IncrementSerial(`$ORIGIN example.com.
+@ 3600 IN SOA ns1 hostmaster ( ; primary, contact
+	2018010101 ; serial
+	7200 3600 1209600 3600 )
+@ 3600 IN NS ns1
+`)
+	require.NoError(t, err)
+	assert.Contains(t, content, "\t2018010102 ; serial\n")
+
+	content, err = IncrementSerial("example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 4294967295 7200 3600 1209600 3600\n")
+	require.NoError(t, err)
+	assert.Contains(t, content, " hostmaster.example.com. 0 7200")
+
+	_, err = IncrementSerial("@ 3600 IN NS ns1\n")
+	assert.EqualError(t, err, "no SOA record")
+}
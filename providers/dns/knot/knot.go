@@ -0,0 +1,119 @@
+// Package knot implements a DNS provider for solving the DNS-01 challenge
+// with zone transactions on a local Knot DNS server through knotc.
+package knot
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+)
+
+// knotc is the name of the Knot DNS control utility. It is overridden during
+// tests.
+var knotc = "knotc"
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that changes the TXT records of a zone in a knotc zone transaction.
+type DNSProvider struct {
+	zone       string
+	socketPath string
+
+	// mu serializes the zone transactions, knotc allows only one at a time
+	// per zone.
+	mu sync.Mutex
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("Knot", "KNOT_ZONE")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured from the
+// environment variables KNOT_ZONE, the zone the challenge records are
+// created in, and KNOT_SOCKET_PATH, the control socket. An empty socket path
+// uses the default of knotc.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+	return NewDNSProviderCredentials(os.Getenv("KNOT_ZONE"), os.Getenv("KNOT_SOCKET_PATH"))
+}
+
+// NewDNSProviderCredentials returns a DNSProvider instance changing zone
+// through the control socket at socketPath. An empty socketPath uses the
+// default of knotc.
+func NewDNSProviderCredentials(zone, socketPath string) (*DNSProvider, error) {
+	if zone == "" {
+		return nil, fmt.Errorf("Knot zone missing")
+	}
+	return &DNSProvider{zone: dns.Fqdn(strings.ToLower(zone)), socketPath: socketPath}, nil
+}
+
+// Present adds the TXT record to the zone.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	if err := d.checkZone(fqdn); err != nil {
+		return err
+	}
+	return d.transaction("zone-set", fqdn, strconv.Itoa(ttl), "TXT", strconv.Quote(value))
+}
+
+// CleanUp removes the TXT record added by Present from the zone.
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	if err := d.checkZone(fqdn); err != nil {
+		return err
+	}
+	return d.transaction("zone-unset", fqdn, "TXT", strconv.Quote(value))
+}
+
+// checkZone returns an error if fqdn is not part of the zone.
+func (d *DNSProvider) checkZone(fqdn string) error {
+	if !dns.IsSubDomain(d.zone, strings.ToLower(fqdn)) {
+		return fmt.Errorf("Knot zone %s does not contain %s", d.zone, fqdn)
+	}
+	return nil
+}
+
+// transaction runs the knotc command with args in a zone transaction. The
+// transaction is aborted if the command fails, so the zone is not left
+// locked.
+func (d *DNSProvider) transaction(command string, args ...string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.run("zone-begin", d.zone); err != nil {
+		return err
+	}
+	if err := d.run(command, append([]string{d.zone}, args...)...); err != nil {
+		if abortErr := d.run("zone-abort", d.zone); abortErr != nil {
+			return fmt.Errorf("%v; %v", err, abortErr)
+		}
+		return err
+	}
+	return d.run("zone-commit", d.zone)
+}
+
+// run executes a knotc command.
+func (d *DNSProvider) run(command string, args ...string) error {
+	var cmdArgs []string
+	if d.socketPath != "" {
+		cmdArgs = append(cmdArgs, "-s", d.socketPath)
+	}
+	cmdArgs = append(cmdArgs, command)
+	cmdArgs = append(cmdArgs, args...)
+
+	output, err := exec.Command(knotc, cmdArgs...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("knotc %s failed: %v: %s", command, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
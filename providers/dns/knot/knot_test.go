@@ -0,0 +1,143 @@
+package knot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+// fakeKnotc installs a knotc script logging its arguments to the returned
+// file and failing for the command fail.
+func fakeKnotc(t *testing.T, dir, fail string) string {
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$@\" >> " + calls + "\n"
+	if fail != "" {
+		script += "case \"$*\" in *" + fail + "*) echo 'error: (no such record in zone found)'; exit 1;; esac\n"
+	}
+	path := filepath.Join(dir, "knotc")
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+	knotc = path
+	return calls
+}
+
+// fakeTransactionKnotc installs a knotc script which, like Knot, fails
+// zone-begin while another transaction of the zone is open, and logs the
+// commands of committed transactions to the returned file.
+func fakeTransactionKnotc(t *testing.T, dir string) string {
+	calls := filepath.Join(dir, "calls")
+	lock := filepath.Join(dir, "transaction")
+	script := "#!/bin/sh\n" +
+		"case \"$*\" in\n" +
+		"*zone-begin*) mkdir " + lock + " 2>/dev/null || { echo 'error: (zone is busy)'; exit 1; };;\n" +
+		"*zone-commit*) cat " + lock + "/commands >> " + calls + "; rm -rf " + lock + ";;\n" +
+		"*zone-abort*) rm -rf " + lock + ";;\n" +
+		"*) sleep 0.05; echo \"$@\" >> " + lock + "/commands;;\n" +
+		"esac\n"
+	path := filepath.Join(dir, "knotc")
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+	knotc = path
+	return calls
+}
+
+func TestNewDNSProviderMissingCredErr(t *testing.T) {
+	defer os.Setenv("KNOT_ZONE", os.Getenv("KNOT_ZONE"))
+	os.Setenv("KNOT_ZONE", "")
+
+	_, err := NewDNSProvider()
+	assert.EqualError(t, err, "Knot credentials missing: KNOT_ZONE")
+}
+
+func TestPresentCleanUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(saved string) { knotc = saved }(knotc)
+	calls := fakeKnotc(t, dir, "")
+
+	provider, err := NewDNSProviderCredentials("Example.com", "/run/knot/knot.sock")
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	require.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+
+	log, err := ioutil.ReadFile(calls)
+	require.NoError(t, err)
+	_, value, _ := acme.DNS01Record("www.example.com", "123d==")
+	value = strconv.Quote(value)
+	assert.Equal(t, "-s /run/knot/knot.sock zone-begin example.com.\n"+
+		"-s /run/knot/knot.sock zone-set example.com. _acme-challenge.www.example.com. 120 TXT "+value+"\n"+
+		"-s /run/knot/knot.sock zone-commit example.com.\n"+
+		"-s /run/knot/knot.sock zone-begin example.com.\n"+
+		"-s /run/knot/knot.sock zone-unset example.com. _acme-challenge.www.example.com. TXT "+value+"\n"+
+		"-s /run/knot/knot.sock zone-commit example.com.\n", string(log))
+}
+
+func TestFailedCommandAbortsTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(saved string) { knotc = saved }(knotc)
+	calls := fakeKnotc(t, dir, "zone-unset")
+
+	provider, err := NewDNSProviderCredentials("example.com", "")
+	require.NoError(t, err)
+
+	err = provider.CleanUp("example.com", "", "123d==")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "knotc zone-unset failed")
+
+	log, err := ioutil.ReadFile(calls)
+	require.NoError(t, err)
+	assert.Contains(t, string(log), "zone-abort example.com.\n")
+	assert.NotContains(t, string(log), "zone-commit")
+}
+
+func TestRecordOutsideZone(t *testing.T) {
+	provider, err := NewDNSProviderCredentials("example.com", "")
+	require.NoError(t, err)
+
+	err = provider.Present("example.org", "", "123d==")
+	assert.EqualError(t, err, "Knot zone example.com. does not contain _acme-challenge.example.org.")
+}
+
+func TestConcurrentPresentCleanUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(saved string) { knotc = saved }(knotc)
+	calls := fakeTransactionKnotc(t, dir)
+
+	provider, err := NewDNSProviderCredentials("example.com", "")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 6)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keyAuth := strconv.Itoa(i / 2)
+			if i%2 == 0 {
+				errs[i] = provider.Present("www.example.com", "", keyAuth)
+			} else {
+				errs[i] = provider.CleanUp("www.example.com", "", keyAuth)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	log, err := ioutil.ReadFile(calls)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(log)), "\n"), len(errs), "every transaction must commit its own command")
+}
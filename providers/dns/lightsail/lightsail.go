@@ -0,0 +1,133 @@
+// Package lightsail implements a DNS provider for solving the DNS-01
+// challenge using the DNS zones of AWS Lightsail, which are separate from
+// Route 53 hosted zones.
+package lightsail
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lightsail"
+	"github.com/xenolf/lego/acme"
+)
+
+// Lightsail manages DNS zones in us-east-1 only, whatever region is
+// configured otherwise.
+const region = "us-east-1"
+
+var (
+	// findZoneByFqdn determines the DNS zone of an fqdn. It is overridden
+	// during tests.
+	findZoneByFqdn = acme.FindZoneByFqdn
+	// pollInterval is the time between two looks at the domain entries
+	// while waiting for a change to become visible. It is overridden
+	// during tests.
+	pollInterval = 2 * time.Second
+)
+
+// consistencyTimeout is how long Present waits for a new entry to show up
+// in the entries of the domain.
+const consistencyTimeout = time.Minute
+
+// DNSProvider implements the acme.ChallengeProvider interface
+type DNSProvider struct {
+	client *lightsail.Lightsail
+}
+
+// NewDNSProvider returns a DNSProvider instance configured for AWS
+// Lightsail DNS.
+//
+// AWS Credentials are detected like for the route53 provider, from the
+// environment (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// [AWS_SESSION_TOKEN]), the shared credentials file or an EC2 IAM role.
+// The region is always us-east-1.
+func NewDNSProvider() (*DNSProvider, error) {
+	sess, err := session.NewSession(aws.NewConfig().WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DNSProvider{client: lightsail.New(sess)}, nil
+}
+
+// Present creates a TXT record using the specified parameters and waits
+// until Lightsail lists it.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+
+	zone, err := lightsailDomain(fqdn)
+	if err != nil {
+		return err
+	}
+
+	entry := txtEntry(fqdn, value)
+	_, err = d.client.CreateDomainEntry(&lightsail.CreateDomainEntryInput{
+		DomainName:  aws.String(zone),
+		DomainEntry: entry,
+	})
+	if err != nil {
+		return fmt.Errorf("Lightsail: could not create the TXT record: %v", err)
+	}
+
+	// Lightsail is eventually consistent; a new entry is not always listed
+	// (or served) right away.
+	return acme.WaitFor(consistencyTimeout, pollInterval, func() (bool, error) {
+		return d.hasEntry(zone, entry)
+	})
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+
+	zone, err := lightsailDomain(fqdn)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.client.DeleteDomainEntry(&lightsail.DeleteDomainEntryInput{
+		DomainName:  aws.String(zone),
+		DomainEntry: txtEntry(fqdn, value),
+	})
+	if err != nil {
+		return fmt.Errorf("Lightsail: could not delete the TXT record: %v", err)
+	}
+	return nil
+}
+
+// hasEntry reports whether the entries of zone contain entry.
+func (d *DNSProvider) hasEntry(zone string, entry *lightsail.DomainEntry) (bool, error) {
+	resp, err := d.client.GetDomain(&lightsail.GetDomainInput{DomainName: aws.String(zone)})
+	if err != nil {
+		return false, fmt.Errorf("Lightsail: could not list the entries of %s: %v", zone, err)
+	}
+
+	for _, e := range resp.Domain.DomainEntries {
+		if strings.EqualFold(aws.StringValue(e.Type), "TXT") &&
+			strings.EqualFold(strings.TrimSuffix(aws.StringValue(e.Name), "."), aws.StringValue(entry.Name)) &&
+			aws.StringValue(e.Target) == aws.StringValue(entry.Target) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// lightsailDomain returns the name of the Lightsail domain holding fqdn.
+func lightsailDomain(fqdn string) (string, error) {
+	authZone, err := findZoneByFqdn(fqdn, acme.RecursiveNameservers)
+	if err != nil {
+		return "", fmt.Errorf("Lightsail: could not determine zone for %s: %v", fqdn, err)
+	}
+	return acme.UnFqdn(authZone), nil
+}
+
+func txtEntry(fqdn, value string) *lightsail.DomainEntry {
+	return &lightsail.DomainEntry{
+		Name:   aws.String(acme.UnFqdn(fqdn)),
+		Type:   aws.String("TXT"),
+		Target: aws.String(`"` + value + `"`),
+	}
+}
@@ -0,0 +1,98 @@
+package lightsail
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lightsail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+type domainEntry struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+// fakeLightsail lists a new entry only after it was asked for the entries
+// once, like an eventually consistent API.
+func fakeLightsail(t *testing.T) (*httptest.Server, *[]string) {
+	var calls []string
+	var entries, pending []domainEntry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			DomainName  string      `json:"domainName"`
+			DomainEntry domainEntry `json:"domainEntry"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "example.com", req.DomainName)
+
+		target := r.Header.Get("X-Amz-Target")
+		calls = append(calls, target)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch target {
+		case "Lightsail_20161128.CreateDomainEntry":
+			pending = append(pending, req.DomainEntry)
+			w.Write([]byte(`{"operation": {"status": "Succeeded"}}`))
+		case "Lightsail_20161128.DeleteDomainEntry":
+			assert.Equal(t, entries[0], req.DomainEntry)
+			entries = nil
+			w.Write([]byte(`{"operation": {"status": "Succeeded"}}`))
+		case "Lightsail_20161128.GetDomain":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"domain": map[string]interface{}{"name": "example.com", "domainEntries": entries},
+			})
+			entries, pending = append(entries, pending...), nil
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	return server, &calls
+}
+
+func TestLightsailPresentAndCleanUp(t *testing.T) {
+	server, calls := fakeLightsail(t)
+	defer server.Close()
+
+	savedFindZoneByFqdn, savedInterval := findZoneByFqdn, pollInterval
+	defer func() { findZoneByFqdn, pollInterval = savedFindZoneByFqdn, savedInterval }()
+	pollInterval = time.Millisecond
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	config := &aws.Config{
+		Credentials: credentials.NewStaticCredentials("abc", "123", " "),
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String(region),
+		MaxRetries:  aws.Int(0),
+	}
+	provider := &DNSProvider{client: lightsail.New(session.New(config))}
+
+	require.NoError(t, provider.Present("example.com", "", "foo"))
+	require.NoError(t, provider.CleanUp("example.com", "", "foo"))
+
+	assert.Equal(t, []string{
+		"Lightsail_20161128.CreateDomainEntry",
+		"Lightsail_20161128.GetDomain",
+		"Lightsail_20161128.GetDomain",
+		"Lightsail_20161128.DeleteDomainEntry",
+	}, *calls)
+}
+
+func TestTxtEntry(t *testing.T) {
+	_, value, _ := acme.DNS01Record("example.com", "foo")
+	entry := txtEntry("_acme-challenge.example.com.", value)
+
+	assert.Equal(t, "_acme-challenge.example.com", aws.StringValue(entry.Name))
+	assert.Equal(t, "TXT", aws.StringValue(entry.Type))
+	assert.Equal(t, `"`+value+`"`, aws.StringValue(entry.Target))
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/timewasted/linode/dns"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 )
 
 const (
@@ -28,9 +29,19 @@ type DNSProvider struct {
 	linode *dns.DNS
 }
 
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("Linode", "LINODE_API_KEY")
+}
+
 // NewDNSProvider returns a DNSProvider instance configured for Linode.
 // Credentials must be passed in the environment variable: LINODE_API_KEY.
 func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
 	apiKey := os.Getenv("LINODE_API_KEY")
 	return NewDNSProviderCredentials(apiKey)
 }
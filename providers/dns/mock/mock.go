@@ -0,0 +1,72 @@
+// Package mock implements an in-memory DNS provider for testing code which
+// uses lego without talking to a real DNS API.
+//
+// The records are never published, so tests driving a full DNS-01 challenge
+// have to replace acme.PreCheckDNS as well.
+package mock
+
+import (
+	"sync"
+
+	"github.com/xenolf/lego/acme"
+)
+
+// Provider is an implementation of the acme.ChallengeProvider interface
+// which keeps the TXT records in memory.
+type Provider struct {
+	mu      sync.Mutex
+	records map[string]string
+	err     error
+}
+
+// NewProvider returns an empty Provider.
+func NewProvider() *Provider {
+	return &Provider{records: map[string]string{}}
+}
+
+// NewFailingProvider returns a Provider on which Present and CleanUp always
+// fail with err.
+func NewFailingProvider(err error) *Provider {
+	return &Provider{records: map[string]string{}, err: err}
+}
+
+// Present stores the TXT record which fulfils the DNS-01 challenge.
+func (p *Provider) Present(domain, token, keyAuth string) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+
+	p.mu.Lock()
+	p.records[fqdn] = value
+	p.mu.Unlock()
+	return nil
+}
+
+// CleanUp removes the TXT record matching the specified parameters.
+func (p *Provider) CleanUp(domain, token, keyAuth string) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+
+	p.mu.Lock()
+	delete(p.records, fqdn)
+	p.mu.Unlock()
+	return nil
+}
+
+// Records returns a copy of the TXT records currently presented, keyed by
+// their fully qualified name.
+func (p *Provider) Records() map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	records := make(map[string]string, len(p.records))
+	for fqdn, value := range p.records {
+		records[fqdn] = value
+	}
+	return records
+}
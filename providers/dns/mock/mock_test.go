@@ -0,0 +1,31 @@
+package mock
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xenolf/lego/acme"
+)
+
+func TestProviderPresentCleanUp(t *testing.T) {
+	p := NewProvider()
+
+	err := p.Present("example.com", "token", "keyAuth")
+	assert.NoError(t, err)
+
+	fqdn, value, _ := acme.DNS01Record("example.com", "keyAuth")
+	assert.Equal(t, map[string]string{fqdn: value}, p.Records())
+
+	err = p.CleanUp("example.com", "token", "keyAuth")
+	assert.NoError(t, err)
+	assert.Empty(t, p.Records())
+}
+
+func TestFailingProvider(t *testing.T) {
+	p := NewFailingProvider(errors.New("boom"))
+
+	assert.EqualError(t, p.Present("example.com", "token", "keyAuth"), "boom")
+	assert.EqualError(t, p.CleanUp("example.com", "token", "keyAuth"), "boom")
+	assert.Empty(t, p.Records())
+}
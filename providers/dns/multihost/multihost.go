@@ -0,0 +1,92 @@
+// Package multihost implements a DNS provider for solving the DNS-01
+// challenge with the first of several DNS providers able to create the
+// record, for domains spread over several DNS hosts.
+package multihost
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+)
+
+// MultiProvider is an implementation of the acme.ChallengeProvider interface
+// that tries its providers in order until one of them presents the record.
+// The record is cleaned up by the provider which presented it.
+type MultiProvider struct {
+	providers []acme.ChallengeProvider
+
+	mu        sync.Mutex
+	presented map[string]acme.ChallengeProvider
+}
+
+// NewMultiProvider returns a MultiProvider trying providers in the given
+// order.
+func NewMultiProvider(providers ...acme.ChallengeProvider) (*MultiProvider, error) {
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("multihost: no DNS providers")
+	}
+	return &MultiProvider{
+		providers: providers,
+		presented: map[string]acme.ChallengeProvider{},
+	}, nil
+}
+
+// Present creates the TXT record with the first provider which succeeds. A
+// provider not managing the zone of domain is expected to fail fast, e.g.
+// because the zone is not found in the account.
+func (m *MultiProvider) Present(domain, token, keyAuth string) error {
+	var errs []string
+	for _, provider := range m.providers {
+		err := provider.Present(domain, token, keyAuth)
+		if err == nil {
+			m.mu.Lock()
+			m.presented[challengeKey(domain, token)] = provider
+			m.mu.Unlock()
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%T: %v", provider, err))
+	}
+	return fmt.Errorf("multihost: no DNS provider could present the record for %s: %s", domain, strings.Join(errs, "; "))
+}
+
+// CleanUp removes the TXT record with the provider which presented it.
+func (m *MultiProvider) CleanUp(domain, token, keyAuth string) error {
+	key := challengeKey(domain, token)
+
+	m.mu.Lock()
+	provider, ok := m.presented[key]
+	delete(m.presented, key)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("multihost: no record was presented for %s", domain)
+	}
+	return provider.CleanUp(domain, token, keyAuth)
+}
+
+// Timeout returns the longest timeout and interval of the providers, as the
+// provider which will present the record is not known in advance.
+func (m *MultiProvider) Timeout() (timeout, interval time.Duration) {
+	for _, provider := range m.providers {
+		t, i := acme.DefaultPropagationTimeout, acme.DefaultPollingInterval
+		if provider, ok := provider.(acme.ChallengeProviderTimeout); ok {
+			t, i = provider.Timeout()
+		}
+		if t > timeout {
+			timeout = t
+		}
+		if i > interval {
+			interval = i
+		}
+	}
+	return timeout, interval
+}
+
+// challengeKey identifies a challenge, the domain alone is ambiguous when
+// several certificates for it are requested at the same time.
+func challengeKey(domain, token string) string {
+	return domain + "\x00" + token
+}
@@ -0,0 +1,66 @@
+package multihost
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/mock"
+)
+
+type timeoutProvider struct {
+	*mock.Provider
+	timeout, interval time.Duration
+}
+
+func (p timeoutProvider) Timeout() (time.Duration, time.Duration) {
+	return p.timeout, p.interval
+}
+
+func TestNewMultiProviderWithoutProviders(t *testing.T) {
+	_, err := NewMultiProvider()
+	assert.EqualError(t, err, "multihost: no DNS providers")
+}
+
+func TestMultiProviderFirstSuccess(t *testing.T) {
+	failing := mock.NewFailingProvider(errors.New("zone not found"))
+	first := mock.NewProvider()
+	second := mock.NewProvider()
+
+	provider, err := NewMultiProvider(failing, first, second)
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Present("example.com", "token", "keyAuth"))
+	fqdn, value, _ := acme.DNS01Record("example.com", "keyAuth")
+	assert.Equal(t, map[string]string{fqdn: value}, first.Records())
+	assert.Empty(t, second.Records())
+
+	require.NoError(t, provider.CleanUp("example.com", "token", "keyAuth"))
+	assert.Empty(t, first.Records())
+
+	assert.Error(t, provider.CleanUp("example.com", "token", "keyAuth"))
+}
+
+func TestMultiProviderAllFail(t *testing.T) {
+	provider, err := NewMultiProvider(mock.NewFailingProvider(errors.New("zone not found")),
+		mock.NewFailingProvider(errors.New("unauthorized")))
+	require.NoError(t, err)
+
+	err = provider.Present("example.com", "token", "keyAuth")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "zone not found")
+	assert.Contains(t, err.Error(), "unauthorized")
+}
+
+func TestMultiProviderTimeout(t *testing.T) {
+	provider, err := NewMultiProvider(mock.NewProvider(),
+		timeoutProvider{mock.NewProvider(), 10 * time.Minute, time.Second})
+	require.NoError(t, err)
+
+	timeout, interval := provider.Timeout()
+	assert.Equal(t, 10*time.Minute, timeout)
+	assert.Equal(t, acme.DefaultPollingInterval, interval)
+}
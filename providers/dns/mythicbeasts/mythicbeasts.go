@@ -0,0 +1,233 @@
+// Package mythicbeasts implements a DNS provider for solving the DNS-01
+// challenge using the Mythic Beasts DNS API v2.
+package mythicbeasts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+	"github.com/xenolf/lego/providers/dns/mythicbeastsv1"
+)
+
+// Mythic Beasts API reference: https://www.mythic-beasts.com/support/api/dnsv2
+
+var (
+	// authURL issues the OAuth tokens of the v2 API. It is overridden
+	// during tests.
+	authURL = "https://auth.mythic-beasts.com/login"
+	// apiURL is the root of the v2 DNS API. It is overridden during tests.
+	apiURL = "https://api.mythic-beasts.com/dns/v2"
+	// findZoneByFqdn determines the DNS zone of an fqdn. It is overridden
+	// during tests.
+	findZoneByFqdn = acme.FindZoneByFqdn
+	// newV1Provider creates the provider used for v1 accounts. It is
+	// overridden during tests.
+	newV1Provider = func(password string) (acme.ChallengeProvider, error) {
+		return mythicbeastsv1.NewDNSProviderCredentials(password)
+	}
+)
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that uses the Mythic Beasts v2 API to manage TXT records for a domain.
+//
+// When the OAuth login rejects the credentials, they are assumed to be a v1
+// DNS API password and all challenges go through the mythicbeastsv1
+// provider instead.
+type DNSProvider struct {
+	username string
+	password string
+	client   *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	v1      acme.ChallengeProvider
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("Mythic Beasts", "MYTHICBEASTS_USERNAME", "MYTHICBEASTS_PASSWORD")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured for Mythic
+// Beasts. The API key ID and secret must be passed in the environment
+// variables: MYTHICBEASTS_USERNAME and MYTHICBEASTS_PASSWORD. For accounts
+// on the v1 API MYTHICBEASTS_PASSWORD is the DNS API password of the domain.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
+	return NewDNSProviderCredentials(os.Getenv("MYTHICBEASTS_USERNAME"), os.Getenv("MYTHICBEASTS_PASSWORD"))
+}
+
+// NewDNSProviderCredentials uses the supplied credentials to return a
+// DNSProvider instance configured for Mythic Beasts.
+func NewDNSProviderCredentials(username, password string) (*DNSProvider, error) {
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("Mythic Beasts credentials missing")
+	}
+
+	return &DNSProvider{
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Present creates a TXT record using the specified parameters
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	v1, err := d.login()
+	if err != nil {
+		return err
+	}
+	if v1 != nil {
+		return v1.Present(domain, token, keyAuth)
+	}
+
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	zone, host, err := splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	type record struct {
+		Host string `json:"host"`
+		TTL  int    `json:"ttl"`
+		Type string `json:"type"`
+		Data string `json:"data"`
+	}
+	body, err := json.Marshal(struct {
+		Records []record `json:"records"`
+	}{[]record{{host, ttl, "TXT", value}}})
+	if err != nil {
+		return err
+	}
+
+	return d.do("POST", recordsPath(zone, host), body)
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	v1, err := d.login()
+	if err != nil {
+		return err
+	}
+	if v1 != nil {
+		return v1.CleanUp(domain, token, keyAuth)
+	}
+
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	zone, host, err := splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	return d.do("DELETE", recordsPath(zone, host)+"?data="+url.QueryEscape(value), nil)
+}
+
+// login fetches an OAuth token unless the current one is still valid. It
+// returns the v1 provider if the account turned out to be a v1 account.
+func (d *DNSProvider) login() (acme.ChallengeProvider, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.v1 != nil || (d.token != "" && time.Now().Before(d.expires)) {
+		return d.v1, nil
+	}
+
+	req, err := http.NewRequest("POST", authURL, strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(d.username, d.password)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Mythic Beasts: login failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		v1, err := newV1Provider(d.password)
+		if err != nil {
+			return nil, err
+		}
+		d.v1 = v1
+		return v1, nil
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Mythic Beasts: login failed: HTTP %d %s", resp.StatusCode, token.Error)
+	}
+
+	d.token = token.AccessToken
+	// renew a bit early so a request never goes out with an expired token
+	d.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - 30*time.Second)
+	return nil, nil
+}
+
+// splitFqdn returns the zone of fqdn and the host name of the record
+// relative to it.
+func splitFqdn(fqdn string) (zone, host string, err error) {
+	authZone, err := findZoneByFqdn(fqdn, acme.RecursiveNameservers)
+	if err != nil {
+		return "", "", fmt.Errorf("Mythic Beasts: could not determine zone for %s: %v", fqdn, err)
+	}
+
+	zone = acme.UnFqdn(authZone)
+	host = strings.TrimSuffix(acme.UnFqdn(fqdn), "."+zone)
+	return zone, host, nil
+}
+
+func recordsPath(zone, host string) string {
+	return fmt.Sprintf("/zones/%s/records/%s/TXT", zone, host)
+}
+
+func (d *DNSProvider) do(method, path string, body []byte) error {
+	req, err := http.NewRequest(method, apiURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	req.Header.Set("Authorization", "Bearer "+d.token)
+	d.mu.Unlock()
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Mythic Beasts: %s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = strings.TrimSpace(string(respBody))
+		}
+		return fmt.Errorf("Mythic Beasts: %s %s failed: HTTP %d: %s", method, path, resp.StatusCode, apiErr.Error)
+	}
+	return nil
+}
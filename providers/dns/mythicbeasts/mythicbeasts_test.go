@@ -0,0 +1,100 @@
+package mythicbeasts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/mock"
+)
+
+func setup(t *testing.T, handler http.HandlerFunc) func() {
+	server := httptest.NewServer(handler)
+	savedAuthURL, savedAPIURL, savedFindZoneByFqdn := authURL, apiURL, findZoneByFqdn
+	authURL, apiURL = server.URL+"/login", server.URL+"/dns/v2"
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	return func() {
+		authURL, apiURL, findZoneByFqdn = savedAuthURL, savedAPIURL, savedFindZoneByFqdn
+		server.Close()
+	}
+}
+
+func TestMythicBeastsPresentAndCleanUp(t *testing.T) {
+	_, value, _ := acme.DNS01Record("example.com", "foo")
+
+	var requests []string
+	defer setup(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.URL.Path == "/login" {
+			user, password, _ := r.BasicAuth()
+			assert.Equal(t, "key", user)
+			assert.Equal(t, "secret", password)
+			assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+			w.Write([]byte(`{"access_token": "token", "expires_in": 300, "token_type": "bearer"}`))
+			return
+		}
+
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch r.Method {
+		case "POST":
+			var body struct {
+				Records []map[string]interface{} `json:"records"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Len(t, body.Records, 1)
+			assert.Equal(t, value, body.Records[0]["data"])
+			assert.Equal(t, "_acme-challenge", body.Records[0]["host"])
+		case "DELETE":
+			assert.Equal(t, value, r.URL.Query().Get("data"))
+		}
+		w.Write([]byte(`{"records_added": 1}`))
+	})()
+
+	provider, err := NewDNSProviderCredentials("key", "secret")
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Present("example.com", "", "foo"))
+	require.NoError(t, provider.CleanUp("example.com", "", "foo"))
+	assert.Equal(t, []string{
+		"POST /login",
+		"POST /dns/v2/zones/example.com/records/_acme-challenge/TXT",
+		"DELETE /dns/v2/zones/example.com/records/_acme-challenge/TXT",
+	}, requests)
+}
+
+func TestMythicBeastsFallsBackToV1(t *testing.T) {
+	var logins int
+	defer setup(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/login" {
+			t.Errorf("Unexpected request to the v2 API: %s %s", r.Method, r.URL.Path)
+			return
+		}
+		logins++
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "invalid_client"}`))
+	})()
+
+	v1 := mock.NewProvider()
+	savedNewV1Provider := newV1Provider
+	defer func() { newV1Provider = savedNewV1Provider }()
+	newV1Provider = func(password string) (acme.ChallengeProvider, error) {
+		assert.Equal(t, "domain-password", password)
+		return v1, nil
+	}
+
+	provider, err := NewDNSProviderCredentials("example.com", "domain-password")
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Present("example.com", "", "foo"))
+	assert.Len(t, v1.Records(), 1)
+	require.NoError(t, provider.CleanUp("example.com", "", "foo"))
+	assert.Empty(t, v1.Records())
+	assert.Equal(t, 1, logins)
+}
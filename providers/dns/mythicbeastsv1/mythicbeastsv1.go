@@ -0,0 +1,115 @@
+// Package mythicbeastsv1 implements a DNS provider for solving the DNS-01
+// challenge using the legacy (v1) Mythic Beasts Primary DNS API, which
+// authenticates with a password set per domain in the control panel.
+//
+// Accounts with API keys use the v2 API of the mythicbeasts provider, which
+// falls back to this one when the OAuth login rejects the credentials.
+package mythicbeastsv1
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+)
+
+// Mythic Beasts v1 API reference: https://www.mythic-beasts.com/support/api/primary
+
+var (
+	// apiURL is the v1 DNS API endpoint. It is overridden during tests.
+	apiURL = "https://dnsapi.mythic-beasts.com/"
+	// findZoneByFqdn determines the DNS zone of an fqdn. It is overridden
+	// during tests.
+	findZoneByFqdn = acme.FindZoneByFqdn
+)
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that uses the Mythic Beasts v1 API to manage TXT records for a domain.
+type DNSProvider struct {
+	password string
+	client   *http.Client
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("Mythic Beasts v1", "MYTHICBEASTS_PASSWORD")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured for the Mythic
+// Beasts v1 API. The DNS API password of the domain must be passed in the
+// environment variable: MYTHICBEASTS_PASSWORD.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
+	return NewDNSProviderCredentials(os.Getenv("MYTHICBEASTS_PASSWORD"))
+}
+
+// NewDNSProviderCredentials uses the supplied credentials to return a
+// DNSProvider instance configured for the Mythic Beasts v1 API.
+func NewDNSProviderCredentials(password string) (*DNSProvider, error) {
+	if password == "" {
+		return nil, fmt.Errorf("Mythic Beasts v1 credentials missing")
+	}
+
+	return &DNSProvider{
+		password: password,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Present creates a TXT record using the specified parameters
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	return d.command(fqdn, "ADD", value, ttl)
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	return d.command(fqdn, "DELETE", value, ttl)
+}
+
+// command sends "<cmd> <host> <ttl> TXT <value>" for the zone of fqdn. A
+// DELETE has to repeat the TTL of the record.
+func (d *DNSProvider) command(fqdn, cmd, value string, ttl int) error {
+	authZone, err := findZoneByFqdn(fqdn, acme.RecursiveNameservers)
+	if err != nil {
+		return fmt.Errorf("Mythic Beasts v1: could not determine zone for %s: %v", fqdn, err)
+	}
+	zone := acme.UnFqdn(authZone)
+	host := strings.TrimSuffix(acme.UnFqdn(fqdn), "."+zone)
+
+	resp, err := d.client.PostForm(apiURL, url.Values{
+		"domain":   {zone},
+		"password": {d.password},
+		"command":  {fmt.Sprintf("%s %s %d TXT %s", cmd, host, ttl, value)},
+	})
+	if err != nil {
+		return fmt.Errorf("Mythic Beasts v1: %s failed: %v", cmd, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Mythic Beasts v1: %s failed: HTTP %d", cmd, resp.StatusCode)
+	}
+
+	// Every command is answered by a line echoing it, prefixed with N if it
+	// failed; errors of the request itself start with ERR.
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "ERR") || strings.HasPrefix(line, "N"+cmd) {
+			return fmt.Errorf("Mythic Beasts v1: %s failed: %s", cmd, line)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,58 @@
+package mythicbeastsv1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+func TestMythicBeastsV1PresentAndCleanUp(t *testing.T) {
+	var commands []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "example.com", r.FormValue("domain"))
+		if r.FormValue("password") != "secret" {
+			w.Write([]byte("ERR Not authenticated\n"))
+			return
+		}
+		command := r.FormValue("command")
+		commands = append(commands, command)
+		if strings.HasPrefix(command, "DELETE") && len(commands) > 2 {
+			w.Write([]byte("N" + command + "; record not found\n"))
+			return
+		}
+		w.Write([]byte(command + "\n"))
+	}))
+	defer server.Close()
+
+	savedURL, savedFindZoneByFqdn := apiURL, findZoneByFqdn
+	defer func() { apiURL, findZoneByFqdn = savedURL, savedFindZoneByFqdn }()
+	apiURL = server.URL
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	provider, err := NewDNSProviderCredentials("secret")
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Present("example.com", "", "foo"))
+	require.NoError(t, provider.CleanUp("example.com", "", "foo"))
+
+	_, value, _ := acme.DNS01Record("example.com", "foo")
+	assert.Equal(t, []string{
+		"ADD _acme-challenge 120 TXT " + value,
+		"DELETE _acme-challenge 120 TXT " + value,
+	}, commands)
+
+	err = provider.CleanUp("example.com", "", "foo")
+	assert.EqualError(t, err, "Mythic Beasts v1: DELETE failed: NDELETE _acme-challenge 120 TXT "+value+"; record not found")
+
+	provider, err = NewDNSProviderCredentials("wrong")
+	require.NoError(t, err)
+	err = provider.Present("example.com", "", "foo")
+	assert.EqualError(t, err, "Mythic Beasts v1: ADD failed: ERR Not authenticated")
+}
@@ -0,0 +1,152 @@
+// Package namebright implements a DNS provider for solving the DNS-01
+// challenge using NameBright DNS.
+package namebright
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+)
+
+var (
+	// baseURL is the root of the NameBright REST API. It is overridden
+	// during tests.
+	baseURL = "https://api.namebright.com/rest"
+	// findZoneByFqdn determines the DNS zone of an fqdn. It is overridden
+	// during tests.
+	findZoneByFqdn = acme.FindZoneByFqdn
+	// unavailableRetries is how often a request answered with 503 Service
+	// Unavailable is retried.
+	unavailableRetries = 3
+	// unavailableWait is the time to wait before retrying, doubled for
+	// every retry. It is overridden during tests.
+	unavailableWait = 5 * time.Second
+)
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that uses NameBright's REST API to manage TXT records for a domain.
+type DNSProvider struct {
+	appName     string
+	appPassword string
+	client      *http.Client
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("NameBright", "NAMEBRIGHT_APP_NAME", "NAMEBRIGHT_APP_PASSWORD")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured for NameBright.
+// Credentials must be passed in the environment variables:
+// NAMEBRIGHT_APP_NAME and NAMEBRIGHT_APP_PASSWORD.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
+	return NewDNSProviderCredentials(os.Getenv("NAMEBRIGHT_APP_NAME"), os.Getenv("NAMEBRIGHT_APP_PASSWORD"))
+}
+
+// NewDNSProviderCredentials uses the supplied credentials to return a
+// DNSProvider instance configured for NameBright.
+func NewDNSProviderCredentials(appName, appPassword string) (*DNSProvider, error) {
+	if appName == "" || appPassword == "" {
+		return nil, fmt.Errorf("NameBright credentials missing")
+	}
+
+	return &DNSProvider{
+		appName:     appName,
+		appPassword: appPassword,
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Present creates a TXT record using the specified parameters
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+
+	zone, name, err := splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(struct {
+		Name string `json:"name"`
+		Data string `json:"data"`
+		TTL  int    `json:"ttl"`
+	}{name, value, ttl})
+	if err != nil {
+		return err
+	}
+
+	return d.do("POST", fmt.Sprintf("/dns/%s/TXT", zone), body)
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+
+	zone, name, err := splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/dns/%s/TXT/%s?name=%s", zone, value, url.QueryEscape(name))
+	return d.do("DELETE", path, nil)
+}
+
+// splitFqdn returns the zone of fqdn and the name of the record relative
+// to it.
+func splitFqdn(fqdn string) (zone, name string, err error) {
+	authZone, err := findZoneByFqdn(fqdn, acme.RecursiveNameservers)
+	if err != nil {
+		return "", "", fmt.Errorf("NameBright: could not determine zone for %s: %v", fqdn, err)
+	}
+
+	zone = acme.UnFqdn(authZone)
+	name = strings.TrimSuffix(acme.UnFqdn(fqdn), "."+zone)
+	return zone, name, nil
+}
+
+// do sends the request and retries it while the API is unavailable, which
+// happens regularly with NameBright.
+func (d *DNSProvider) do(method, path string, body []byte) error {
+	wait := unavailableWait
+	for retries := 0; ; retries++ {
+		req, err := http.NewRequest(method, baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(d.appName, d.appPassword)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("NameBright: %s %s failed: %v", method, path, err)
+		}
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusServiceUnavailable && retries < unavailableRetries {
+			time.Sleep(wait)
+			wait *= 2
+			continue
+		}
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("NameBright: %s %s failed: HTTP %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(respBody)))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package namebright
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+)
+
+func TestNameBrightPresentAndCleanUp(t *testing.T) {
+	_, value, _ := acme.DNS01Record("example.com", "foo")
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "app", user)
+		assert.Equal(t, "secret", password)
+
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if len(requests) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		switch r.Method {
+		case "POST":
+			var record struct {
+				Name string `json:"name"`
+				Data string `json:"data"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&record))
+			assert.Equal(t, "_acme-challenge", record.Name)
+			assert.Equal(t, value, record.Data)
+		case "DELETE":
+			assert.Equal(t, "_acme-challenge", r.URL.Query().Get("name"))
+		}
+	}))
+	defer server.Close()
+
+	savedURL, savedFindZoneByFqdn, savedWait := baseURL, findZoneByFqdn, unavailableWait
+	defer func() { baseURL, findZoneByFqdn, unavailableWait = savedURL, savedFindZoneByFqdn, savedWait }()
+	baseURL, unavailableWait = server.URL+"/rest", time.Millisecond
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	provider, err := NewDNSProviderCredentials("app", "secret")
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Present("example.com", "", "foo"))
+	require.NoError(t, provider.CleanUp("example.com", "", "foo"))
+	assert.Equal(t, []string{
+		"POST /rest/dns/example.com/TXT",
+		"POST /rest/dns/example.com/TXT",
+		"DELETE /rest/dns/example.com/TXT/" + value,
+	}, requests)
+}
+
+func TestNameBrightUnavailable(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	savedURL, savedWait := baseURL, unavailableWait
+	defer func() { baseURL, unavailableWait = savedURL, savedWait }()
+	baseURL, unavailableWait = server.URL, time.Millisecond
+
+	provider, err := NewDNSProviderCredentials("app", "secret")
+	require.NoError(t, err)
+
+	err = provider.do("POST", "/dns/example.com/TXT", []byte("{}"))
+	assert.EqualError(t, err, "NameBright: POST /dns/example.com/TXT failed: HTTP 503: ")
+	assert.Equal(t, unavailableRetries+1, requests)
+}
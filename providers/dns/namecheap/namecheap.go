@@ -10,9 +10,11 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 )
 
 // Notes about namecheap's tool API:
@@ -37,17 +39,32 @@ var (
 
 // DNSProvider is an implementation of the ChallengeProviderTimeout interface
 // that uses Namecheap's tool API to manage TXT records for a domain.
+//
+// Present and CleanUp read the host records, change them and write them all
+// back, see note 2 above. The mutex keeps concurrent challenges from
+// overwriting each other.
 type DNSProvider struct {
 	baseURL  string
 	apiUser  string
 	apiKey   string
 	clientIP string
+	mu       sync.Mutex
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("Namecheap", "NAMECHEAP_API_USER", "NAMECHEAP_API_KEY")
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for namecheap.
 // Credentials must be passed in the environment variables: NAMECHEAP_API_USER
 // and NAMECHEAP_API_KEY.
 func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
 	apiUser := os.Getenv("NAMECHEAP_API_USER")
 	apiKey := os.Getenv("NAMECHEAP_API_KEY")
 	return NewDNSProviderCredentials(apiUser, apiKey)
@@ -132,7 +149,39 @@ type challenge struct {
 // newChallenge builds a challenge record from a domain name, a challenge
 // authentication key, and a map of available TLDs.
 func newChallenge(domain, keyAuth string, tlds map[string]string) (*challenge, error) {
+	key, keyValue, _ := acme.DNS01Record(domain, keyAuth)
 	domain = acme.UnFqdn(domain)
+
+	tld, sld, host, err := splitDomain(domain, tlds)
+	if err != nil {
+		return nil, err
+	}
+
+	recordKey := "_acme-challenge." + host
+
+	// When the challenge record is a CNAME, the TXT record has to be created
+	// at its target, which may live in another namecheap domain.
+	if target := acme.UnFqdn(key); target != "_acme-challenge."+domain {
+		tld, sld, recordKey, err = splitDomain(target, tlds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &challenge{
+		domain:   domain,
+		key:      recordKey,
+		keyFqdn:  key,
+		keyValue: keyValue,
+		tld:      tld,
+		sld:      sld,
+		host:     host,
+	}, nil
+}
+
+// splitDomain splits a domain name into its TLD, its second-level domain and
+// the host part in front of them, using the longest matching TLD.
+func splitDomain(domain string, tlds map[string]string) (tld, sld, host string, err error) {
 	parts := strings.Split(domain, ".")
 
 	// Find the longest matching TLD.
@@ -144,28 +193,16 @@ func newChallenge(domain, keyAuth string, tlds map[string]string) (*challenge, e
 		}
 	}
 	if longest < 1 {
-		return nil, fmt.Errorf("Invalid domain name '%s'", domain)
+		return "", "", "", fmt.Errorf("Invalid domain name '%s'", domain)
 	}
 
-	tld := strings.Join(parts[longest:], ".")
-	sld := parts[longest-1]
+	tld = strings.Join(parts[longest:], ".")
+	sld = parts[longest-1]
 
-	var host string
 	if longest >= 1 {
 		host = strings.Join(parts[:longest-1], ".")
 	}
-
-	key, keyValue, _ := acme.DNS01Record(domain, keyAuth)
-
-	return &challenge{
-		domain:   domain,
-		key:      "_acme-challenge." + host,
-		keyFqdn:  key,
-		keyValue: keyValue,
-		tld:      tld,
-		sld:      sld,
-		host:     host,
-	}, nil
+	return tld, sld, host, nil
 }
 
 // setGlobalParams adds the namecheap global parameters to the provided url
@@ -335,15 +372,14 @@ func (d *DNSProvider) addChallengeRecord(ch *challenge, hosts *[]host) {
 		TTL:     "120",
 	}
 
-	// If there's already a TXT record with the same name, replace it.
-	for i, h := range *hosts {
-		if h.Name == ch.key && h.Type == "TXT" {
-			(*hosts)[i] = host
+	// Keep TXT records with the same name, other challenges may be using
+	// them; only skip adding an identical one.
+	for _, h := range *hosts {
+		if h.Name == ch.key && h.Type == "TXT" && h.Address == ch.keyValue {
 			return
 		}
 	}
 
-	// No record was replaced, so add a new one.
 	*hosts = append(*hosts, host)
 }
 
@@ -352,7 +388,7 @@ func (d *DNSProvider) addChallengeRecord(ch *challenge, hosts *[]host) {
 func (d *DNSProvider) removeChallengeRecord(ch *challenge, hosts *[]host) bool {
 	// Find the challenge TXT record and remove it if found.
 	for i, h := range *hosts {
-		if h.Name == ch.key && h.Type == "TXT" {
+		if h.Name == ch.key && h.Type == "TXT" && h.Address == ch.keyValue {
 			*hosts = append((*hosts)[:i], (*hosts)[i+1:]...)
 			return true
 		}
@@ -373,6 +409,9 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 		return err
 	}
 
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	hosts, err := d.getHosts(ch)
 	if err != nil {
 		return err
@@ -403,6 +442,9 @@ func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 		return err
 	}
 
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	hosts, err := d.getHosts(ch)
 	if err != nil {
 		return err
@@ -262,6 +262,17 @@ func TestNamecheapDomainSplit(t *testing.T) {
 	}
 }
 
+func TestNamecheapDelegatedRecord(t *testing.T) {
+	ch, err := newChallenge("_acme-challenge.example.com.acme.test.co.uk.", "", tlds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEq(t, "tld", ch.tld, "co.uk")
+	assertEq(t, "sld", ch.sld, "test")
+	assertEq(t, "key", ch.key, "_acme-challenge.example.com.acme")
+	assertEq(t, "keyFqdn", ch.keyFqdn, "_acme-challenge.example.com.acme.test.co.uk.")
+}
+
 type testcase struct {
 	name             string
 	domain           string
@@ -6,25 +6,39 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 	"gopkg.in/ns1/ns1-go.v2/rest"
 	"gopkg.in/ns1/ns1-go.v2/rest/model/dns"
 )
 
 // DNSProvider is an implementation of the acme.ChallengeProvider interface.
+//
+// Present and CleanUp read the TXT record of a name, change its answers and
+// write it back. The mutex keeps concurrent challenges from overwriting each
+// other.
 type DNSProvider struct {
 	client *rest.Client
+	mu     sync.Mutex
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("NS1", "NS1_API_KEY")
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for NS1.
 // Credentials must be passed in the environment variables: NS1_API_KEY.
 func NewDNSProvider() (*DNSProvider, error) {
-	key := os.Getenv("NS1_API_KEY")
-	if key == "" {
-		return nil, fmt.Errorf("NS1 credentials missing")
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
 	}
+
+	key := os.Getenv("NS1_API_KEY")
 	return NewDNSProviderCredentials(key)
 }
 
@@ -38,43 +52,84 @@ func NewDNSProviderCredentials(key string) (*DNSProvider, error) {
 	httpClient := &http.Client{Timeout: time.Second * 10}
 	client := rest.NewClient(httpClient, rest.SetAPIKey(key))
 
-	return &DNSProvider{client}, nil
+	return &DNSProvider{client: client}, nil
 }
 
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (c *DNSProvider) Present(domain, token, keyAuth string) error {
 	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
 
-	zone, err := c.getHostedZone(domain)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	zone, err := c.getHostedZone(fqdn)
 	if err != nil {
 		return err
 	}
 
 	record := c.newTxtRecord(zone, fqdn, value, ttl)
 	_, err = c.client.Records.Create(record)
-	if err != nil && err != rest.ErrRecordExists {
+	if err != rest.ErrRecordExists {
 		return err
 	}
 
-	return nil
+	// Another challenge uses the same name, add our value to its record.
+	existing, _, err := c.client.Records.Get(zone.Zone, record.Domain, "TXT")
+	if err != nil {
+		return err
+	}
+	for _, answer := range existing.Answers {
+		if len(answer.Rdata) == 1 && answer.Rdata[0] == value {
+			return nil
+		}
+	}
+	existing.Answers = append(existing.Answers, record.Answers...)
+	_, err = c.client.Records.Update(existing)
+	return err
 }
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (c *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
 
-	zone, err := c.getHostedZone(domain)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	zone, err := c.getHostedZone(fqdn)
 	if err != nil {
 		return err
 	}
 
 	name := acme.UnFqdn(fqdn)
+	record, _, err := c.client.Records.Get(zone.Zone, name, "TXT")
+	if err != nil {
+		return err
+	}
+
+	// Only remove our answer if other challenges use the same name.
+	var answers []*dns.Answer
+	for _, answer := range record.Answers {
+		if len(answer.Rdata) != 1 || answer.Rdata[0] != value {
+			answers = append(answers, answer)
+		}
+	}
+	if len(answers) > 0 {
+		record.Answers = answers
+		_, err = c.client.Records.Update(record)
+		return err
+	}
+
 	_, err = c.client.Records.Delete(zone.Zone, name, "TXT")
 	return err
 }
 
-func (c *DNSProvider) getHostedZone(domain string) (*dns.Zone, error) {
-	zone, _, err := c.client.Zones.Get(domain)
+func (c *DNSProvider) getHostedZone(fqdn string) (*dns.Zone, error) {
+	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
+	if err != nil {
+		return nil, err
+	}
+
+	zone, _, err := c.client.Zones.Get(acme.UnFqdn(authZone))
 	if err != nil {
 		return nil, err
 	}
@@ -36,7 +36,7 @@ func TestNewDNSProviderValid(t *testing.T) {
 func TestNewDNSProviderMissingCredErr(t *testing.T) {
 	os.Setenv("NS1_API_KEY", "")
 	_, err := NewDNSProvider()
-	assert.EqualError(t, err, "NS1 credentials missing")
+	assert.EqualError(t, err, "NS1 credentials missing: NS1_API_KEY")
 	restoreNS1Env()
 }
 
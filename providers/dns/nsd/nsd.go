@@ -0,0 +1,159 @@
+// Package nsd implements a DNS provider for solving the DNS-01 challenge by
+// editing the zone files of a local NSD nameserver and reloading them with
+// nsd-control.
+package nsd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+	"github.com/xenolf/lego/providers/dns/internal/zonefile"
+)
+
+// findZoneByFqdn determines the DNS zone of an fqdn. It is overridden during
+// tests.
+var findZoneByFqdn = acme.FindZoneByFqdn
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that appends TXT records to the zone files of NSD, increments the serial
+// so secondaries pick up the change and reloads the zone.
+type DNSProvider struct {
+	zoneFileDir string
+	controlPath string
+	server      string
+
+	// mu serializes the changes to the zone files.
+	mu sync.Mutex
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("NSD", "NSD_ZONEFILE_DIR")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured from the
+// environment variables NSD_ZONEFILE_DIR, NSD_CONTROL_PATH (defaults to
+// nsd-control in the PATH) and NSD_SERVER, the optional address of the
+// remote control interface passed to nsd-control -s.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+	return NewDNSProviderCredentials(os.Getenv("NSD_ZONEFILE_DIR"), os.Getenv("NSD_CONTROL_PATH"), os.Getenv("NSD_SERVER"))
+}
+
+// NewDNSProviderCredentials returns a DNSProvider instance editing the zone
+// files in zoneFileDir. The file of zone example.com is example.com.zone or,
+// if that does not exist, example.com. An empty controlPath defaults to
+// nsd-control, an empty server to the one in nsd.conf.
+func NewDNSProviderCredentials(zoneFileDir, controlPath, server string) (*DNSProvider, error) {
+	if zoneFileDir == "" {
+		return nil, fmt.Errorf("NSD zone file directory missing")
+	}
+	if controlPath == "" {
+		controlPath = "nsd-control"
+	}
+	return &DNSProvider{zoneFileDir: zoneFileDir, controlPath: controlPath, server: server}, nil
+}
+
+// Present appends a TXT record to the zone file and reloads the zone.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	record := txtRecord(fqdn, value, ttl)
+
+	return d.update(fqdn, func(lines []string) []string {
+		return append(lines, record)
+	})
+}
+
+// CleanUp removes the TXT record added by Present and reloads the zone.
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	record := txtRecord(fqdn, value, ttl)
+
+	return d.update(fqdn, func(lines []string) []string {
+		var kept []string
+		for _, line := range lines {
+			if line != record {
+				kept = append(kept, line)
+			}
+		}
+		return kept
+	})
+}
+
+// update applies fn to the lines of the zone file of fqdn, increments the
+// serial and reloads the zone.
+func (d *DNSProvider) update(fqdn string, fn func([]string) []string) error {
+	zone, err := findZoneByFqdn(fqdn, acme.RecursiveNameservers)
+	if err != nil {
+		return err
+	}
+	zone = acme.UnFqdn(zone)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path, err := d.zoneFile(zone)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	lines := fn(strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+	content, err := zonefile.IncrementSerial(strings.Join(lines, "\n") + "\n")
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), info.Mode()); err != nil {
+		return err
+	}
+
+	return d.reload(zone)
+}
+
+// zoneFile returns the path of the zone file of zone.
+func (d *DNSProvider) zoneFile(zone string) (string, error) {
+	for _, name := range []string{zone + ".zone", zone} {
+		path := filepath.Join(d.zoneFileDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("No zone file for %s in %s", zone, d.zoneFileDir)
+}
+
+// reload runs nsd-control reload for zone.
+func (d *DNSProvider) reload(zone string) error {
+	var args []string
+	if d.server != "" {
+		args = append(args, "-s", d.server)
+	}
+	args = append(args, "reload", zone)
+
+	output, err := exec.Command(d.controlPath, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("nsd-control reload %s failed: %v: %s", zone, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// txtRecord formats a TXT record as a zone file line.
+func txtRecord(fqdn, value string, ttl int) string {
+	return fmt.Sprintf("%s %d IN TXT \"%s\"", fqdn, ttl, value)
+}
@@ -0,0 +1,82 @@
+package nsd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/providers/dns/internal/zonefile"
+)
+
+const testZone = `$ORIGIN example.com.
+@ 3600 IN SOA ns1 hostmaster ( ; primary, contact
+	2018010101 ; serial
+	7200 3600 1209600 3600 )
+@ 3600 IN NS ns1
+`
+
+func TestNewDNSProviderMissingCredErr(t *testing.T) {
+	defer os.Setenv("NSD_ZONEFILE_DIR", os.Getenv("NSD_ZONEFILE_DIR"))
+	os.Setenv("NSD_ZONEFILE_DIR", "")
+
+	_, err := NewDNSProvider()
+	assert.EqualError(t, err, "NSD credentials missing: NSD_ZONEFILE_DIR")
+}
+
+func TestPresentCleanUp(t *testing.T) {
+	defer func(saved func(string, []string) (string, error)) { findZoneByFqdn = saved }(findZoneByFqdn)
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	dir, err := ioutil.TempDir("", "nsd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	zoneFile := filepath.Join(dir, "example.com.zone")
+	require.NoError(t, ioutil.WriteFile(zoneFile, []byte(testZone), 0640))
+
+	control := filepath.Join(dir, "nsd-control")
+	calls := filepath.Join(dir, "calls")
+	require.NoError(t, ioutil.WriteFile(control, []byte("#!/bin/sh\necho \"$@\" >> "+calls+"\n"), 0755))
+
+	provider, err := NewDNSProviderCredentials(dir, control, "127.0.0.1@8952")
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	content, err := ioutil.ReadFile(zoneFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "2018010102 ; serial")
+	assert.Contains(t, string(content), "\n_acme-challenge.www.example.com. 120 IN TXT \"")
+
+	require.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	content, err = ioutil.ReadFile(zoneFile)
+	require.NoError(t, err)
+	expected, err := zonefile.IncrementSerial(testZone)
+	require.NoError(t, err)
+	expected, err = zonefile.IncrementSerial(expected)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(content))
+
+	log, err := ioutil.ReadFile(calls)
+	require.NoError(t, err)
+	assert.Equal(t, "-s 127.0.0.1@8952 reload example.com\n-s 127.0.0.1@8952 reload example.com\n", string(log))
+
+	info, err := os.Stat(zoneFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode())
+}
+
+func TestMissingZoneFile(t *testing.T) {
+	defer func(saved func(string, []string) (string, error)) { findZoneByFqdn = saved }(findZoneByFqdn)
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.org.", nil
+	}
+
+	provider, err := NewDNSProviderCredentials("/nonexistent", "", "")
+	require.NoError(t, err)
+	assert.EqualError(t, provider.Present("example.org", "", "123d=="), "No zone file for example.org in /nonexistent")
+}
@@ -49,7 +49,7 @@ func TestNewDNSProviderMissingCredErr(t *testing.T) {
 	os.Setenv("OVH_CONSUMER_KEY", "abcde")
 	defer restoreEnv()
 	_, err := NewDNSProvider()
-	assert.EqualError(t, err, "OVH credentials missing")
+	assert.EqualError(t, err, "OVH credentials missing: OVH_ENDPOINT")
 
 	os.Setenv("OVH_ENDPOINT", "ovh-eu")
 	os.Setenv("OVH_APPLICATION_KEY", "")
@@ -57,7 +57,7 @@ func TestNewDNSProviderMissingCredErr(t *testing.T) {
 	os.Setenv("OVH_CONSUMER_KEY", "abcde")
 	defer restoreEnv()
 	_, err = NewDNSProvider()
-	assert.EqualError(t, err, "OVH credentials missing")
+	assert.EqualError(t, err, "OVH credentials missing: OVH_APPLICATION_KEY")
 
 	os.Setenv("OVH_ENDPOINT", "ovh-eu")
 	os.Setenv("OVH_APPLICATION_KEY", "1234")
@@ -65,7 +65,7 @@ func TestNewDNSProviderMissingCredErr(t *testing.T) {
 	os.Setenv("OVH_CONSUMER_KEY", "abcde")
 	defer restoreEnv()
 	_, err = NewDNSProvider()
-	assert.EqualError(t, err, "OVH credentials missing")
+	assert.EqualError(t, err, "OVH credentials missing: OVH_APPLICATION_SECRET")
 
 	os.Setenv("OVH_ENDPOINT", "ovh-eu")
 	os.Setenv("OVH_APPLICATION_KEY", "1234")
@@ -73,7 +73,7 @@ func TestNewDNSProviderMissingCredErr(t *testing.T) {
 	os.Setenv("OVH_CONSUMER_KEY", "")
 	defer restoreEnv()
 	_, err = NewDNSProvider()
-	assert.EqualError(t, err, "OVH credentials missing")
+	assert.EqualError(t, err, "OVH credentials missing: OVH_CONSUMER_KEY")
 }
 
 func TestLivePresent(t *testing.T) {
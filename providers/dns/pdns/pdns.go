@@ -12,22 +12,43 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 )
 
+// findZoneByFqdn determines the DNS zone of an fqdn. It is overridden during
+// tests.
+var findZoneByFqdn = acme.FindZoneByFqdn
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface
+//
+// REPLACE overwrites the whole RRset, so Present and CleanUp read the TXT
+// records, change them and write them back. The mutex keeps concurrent
+// challenges from overwriting each other.
 type DNSProvider struct {
 	apiKey     string
 	host       *url.URL
 	apiVersion int
+	mu         sync.Mutex
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("PDNS", "PDNS_API_URL", "PDNS_API_KEY")
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for pdns.
 // Credentials must be passed in the environment variable:
 // PDNS_API_URL and PDNS_API_KEY.
 func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
 	key := os.Getenv("PDNS_API_KEY")
 	hostUrl, err := url.Parse(os.Getenv("PDNS_API_URL"))
 	if err != nil {
@@ -66,6 +87,10 @@ func (c *DNSProvider) Timeout() (timeout, interval time.Duration) {
 // Present creates a TXT record to fulfil the dns-01 challenge
 func (c *DNSProvider) Present(domain, token, keyAuth string) error {
 	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	zone, err := c.getHostedZone(fqdn)
 	if err != nil {
 		return err
@@ -88,36 +113,64 @@ func (c *DNSProvider) Present(domain, token, keyAuth string) error {
 		TTL:  120,
 	}
 
-	rrsets := rrSets{
-		RRSets: []rrSet{
-			rrSet{
-				Name:       name,
-				ChangeType: "REPLACE",
-				Type:       "TXT",
-				Kind:       "Master",
-				TTL:        120,
-				Records:    []pdnsRecord{rec},
-			},
-		},
+	// REPLACE overwrites the whole RRset, so keep the values of other
+	// challenges for the same name.
+	records := txtRecords(zone, fqdn)
+	for _, existing := range records {
+		if existing.Content == rec.Content {
+			return nil
+		}
 	}
 
-	body, err := json.Marshal(rrsets)
-	if err != nil {
-		return err
+	return c.replaceTxtRecords(zone, name, append(records, rec))
+}
+
+// replaceTxtRecords sets the TXT RRset at name to records, deleting it if
+// records is empty.
+func (c *DNSProvider) replaceTxtRecords(zone *hostedZone, name string, records []pdnsRecord) error {
+	set := rrSet{
+		Name:       name,
+		ChangeType: "REPLACE",
+		Type:       "TXT",
+		Kind:       "Master",
+		TTL:        120,
+		Records:    records,
+	}
+	if len(records) == 0 {
+		set = rrSet{
+			Name:       name,
+			Type:       "TXT",
+			ChangeType: "DELETE",
+		}
 	}
 
-	_, err = c.makeRequest("PATCH", zone.URL, bytes.NewReader(body))
+	body, err := json.Marshal(rrSets{RRSets: []rrSet{set}})
 	if err != nil {
-		fmt.Println("here")
 		return err
 	}
 
-	return nil
+	_, err = c.makeRequest("PATCH", zone.URL, bytes.NewReader(body))
+	return err
 }
 
-// CleanUp removes the TXT record matching the specified parameters
+// txtRecords returns the TXT records of zone at fqdn.
+func txtRecords(zone *hostedZone, fqdn string) []pdnsRecord {
+	var records []pdnsRecord
+	for _, set := range zone.RRSets {
+		if (set.Name == acme.UnFqdn(fqdn) || set.Name == fqdn) && set.Type == "TXT" {
+			records = append(records, set.Records...)
+		}
+	}
+	return records
+}
+
+// CleanUp removes the TXT record matching the specified parameters. Other
+// values of the RRset are kept.
 func (c *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	zone, err := c.getHostedZone(fqdn)
 	if err != nil {
@@ -129,31 +182,53 @@ func (c *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 		return err
 	}
 
-	rrsets := rrSets{
-		RRSets: []rrSet{
-			rrSet{
-				Name:       set.Name,
-				Type:       set.Type,
-				ChangeType: "DELETE",
-			},
-		},
+	var remaining []pdnsRecord
+	for _, rec := range txtRecords(zone, fqdn) {
+		if rec.Content != "\""+value+"\"" {
+			remaining = append(remaining, rec)
+		}
 	}
-	body, err := json.Marshal(rrsets)
+
+	return c.replaceTxtRecords(zone, set.Name, remaining)
+}
+
+// ResignZone rectifies the zone so PowerDNS signs the records changed by
+// Present when DNSSEC is enabled for it. Rectifying requires the v1 API.
+func (c *DNSProvider) ResignZone(zone string) error {
+	if c.apiVersion == 0 {
+		return fmt.Errorf("PDNS API version does not support rectifying zones")
+	}
+
+	hostedZone, err := c.getHostedZone(zone)
 	if err != nil {
 		return err
 	}
 
-	_, err = c.makeRequest("PATCH", zone.URL, bytes.NewReader(body))
+	_, err = c.makeRequest("PUT", hostedZone.URL+"/rectify", nil)
+	return err
+}
+
+// NotifyDNSSECRollover makes PowerDNS send a NOTIFY for the zone, so its
+// secondaries transfer the newly signed records right away instead of
+// serving the old signatures until the next refresh. Only Master zones have
+// secondaries to notify; PowerDNS rejects the request for Native and Slave
+// zones, so nothing is done for them.
+func (c *DNSProvider) NotifyDNSSECRollover(zone string) error {
+	hostedZone, err := c.getHostedZone(zone)
 	if err != nil {
 		return err
 	}
+	if hostedZone.Kind != "Master" {
+		return nil
+	}
 
-	return nil
+	_, err = c.makeRequest("PUT", hostedZone.URL+"/notify", nil)
+	return err
 }
 
 func (c *DNSProvider) getHostedZone(fqdn string) (*hostedZone, error) {
 	var zone hostedZone
-	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
+	authZone, err := findZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
 		return nil, err
 	}
@@ -322,6 +397,7 @@ type pdnsRecord struct {
 type hostedZone struct {
 	ID     string  `json:"id"`
 	Name   string  `json:"name"`
+	Kind   string  `json:"kind"`
 	URL    string  `json:"url"`
 	RRSets []rrSet `json:"rrsets"`
 
@@ -1,11 +1,17 @@
 package pdns
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -52,15 +58,15 @@ func TestNewDNSProviderMissingHostErr(t *testing.T) {
 	os.Setenv("PDNS_API_URL", "")
 	os.Setenv("PDNS_API_KEY", "123")
 	_, err := NewDNSProvider()
-	assert.EqualError(t, err, "PDNS API URL missing")
+	assert.EqualError(t, err, "PDNS credentials missing: PDNS_API_URL")
 	restorePdnsEnv()
 }
 
 func TestNewDNSProviderMissingKeyErr(t *testing.T) {
-	os.Setenv("PDNS_API_URL", pdnsURLStr)
+	os.Setenv("PDNS_API_URL", "http://localhost:8081")
 	os.Setenv("PDNS_API_KEY", "")
 	_, err := NewDNSProvider()
-	assert.EqualError(t, err, "PDNS API key missing")
+	assert.EqualError(t, err, "PDNS credentials missing: PDNS_API_KEY")
 	restorePdnsEnv()
 }
 
@@ -78,3 +84,112 @@ func TestPdnsPresentAndCleanup(t *testing.T) {
 	err = provider.CleanUp(pdnsDomain, "", "123d==")
 	assert.NoError(t, err)
 }
+
+// fakeAPI keeps the RRsets of example.com like the PowerDNS v1 API does and
+// counts the NOTIFYs sent for it.
+func fakeAPI(t *testing.T, zone *hostedZone, notifies *int) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api":
+			fmt.Fprint(w, `[{"url": "/api/v1", "version": 1}]`)
+		case r.Method == "GET" && r.URL.Path == "/api/v1/servers/localhost/zones":
+			json.NewEncoder(w).Encode([]hostedZone{{Name: zone.Name, URL: zone.URL}})
+		case r.Method == "GET" && r.URL.Path == "/"+zone.URL:
+			json.NewEncoder(w).Encode(zone)
+		case r.Method == "PATCH" && r.URL.Path == "/"+zone.URL:
+			var patch rrSets
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&patch))
+			for _, set := range patch.RRSets {
+				var kept []rrSet
+				for _, existing := range zone.RRSets {
+					if existing.Name != set.Name || existing.Type != set.Type {
+						kept = append(kept, existing)
+					}
+				}
+				if set.ChangeType == "REPLACE" {
+					kept = append(kept, set)
+				}
+				zone.RRSets = kept
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "PUT" && r.URL.Path == "/"+zone.URL+"/notify":
+			if zone.Kind != "Master" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprint(w, `{"error": "Domain is not a master domain"}`)
+				return
+			}
+			*notifies++
+			fmt.Fprint(w, `{"result": "Notification queued"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestPdnsConcurrentPresent(t *testing.T) {
+	zone := &hostedZone{Name: "example.com.", URL: "api/v1/servers/localhost/zones/example.com."}
+	server := fakeAPI(t, zone, new(int))
+	defer server.Close()
+
+	savedFindZoneByFqdn := findZoneByFqdn
+	defer func() { findZoneByFqdn = savedFindZoneByFqdn }()
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	host, _ := url.Parse(server.URL)
+	provider, err := NewDNSProviderCredentials(host, "123")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = provider.Present("example.com", "", fmt.Sprintf("keyAuth%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	require.Len(t, zone.RRSets, 1)
+	assert.Len(t, zone.RRSets[0].Records, len(errs), "every challenge must keep its record")
+
+	require.NoError(t, provider.CleanUp("example.com", "", "keyAuth0"))
+	require.Len(t, zone.RRSets, 1)
+	assert.Len(t, zone.RRSets[0].Records, len(errs)-1)
+}
+
+func TestPdnsNotifyDNSSECRollover(t *testing.T) {
+	zone := &hostedZone{Name: "example.com.", URL: "api/v1/servers/localhost/zones/example.com."}
+	var notifies int
+	server := fakeAPI(t, zone, &notifies)
+	defer server.Close()
+
+	savedFindZoneByFqdn := findZoneByFqdn
+	defer func() { findZoneByFqdn = savedFindZoneByFqdn }()
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	host, _ := url.Parse(server.URL)
+	provider, err := NewDNSProviderCredentials(host, "123")
+	require.NoError(t, err)
+
+	for _, kind := range []string{"Native", "Slave"} {
+		zone.Kind = kind
+		assert.NoError(t, provider.NotifyDNSSECRollover("example.com."), kind)
+	}
+	assert.Equal(t, 0, notifies)
+
+	zone.Kind = "Master"
+	require.NoError(t, provider.NotifyDNSSECRollover("example.com."))
+	assert.Equal(t, 1, notifies)
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/miekg/dns"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 )
 
 // DNSProvider is an implementation of the acme.ChallengeProvider interface that
@@ -22,6 +23,12 @@ type DNSProvider struct {
 	tsigSecret    string
 }
 
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("RFC2136", "RFC2136_NAMESERVER")
+}
+
 // NewDNSProvider returns a DNSProvider instance configured for rfc2136
 // dynamic update. Credentials must be passed in the environment variables:
 // RFC2136_NAMESERVER, RFC2136_TSIG_ALGORITHM, RFC2136_TSIG_KEY and
@@ -29,6 +36,10 @@ type DNSProvider struct {
 // variables unset. RFC2136_NAMESERVER must be a network address in the form
 // "host" or "host:port".
 func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
 	nameserver := os.Getenv("RFC2136_NAMESERVER")
 	tsigAlgorithm := os.Getenv("RFC2136_TSIG_ALGORITHM")
 	tsigKey := os.Getenv("RFC2136_TSIG_KEY")
@@ -98,8 +109,8 @@ func (r *DNSProvider) changeRecord(action, fqdn, value string, ttl int) error {
 	m.SetUpdate(zone)
 	switch action {
 	case "INSERT":
-		// Always remove old challenge left over from who knows what.
-		m.RemoveRRset(rrs)
+		// Add to the RRset rather than replacing it, other challenges may
+		// use the same name at the same time.
 		m.Insert(rrs)
 	case "REMOVE":
 		m.Remove(rrs)
@@ -37,3 +37,21 @@ var GetChangeResponse = `<?xml version="1.0" encoding="UTF-8"?>
       <SubmittedAt>2016-02-10T01:36:41.958Z</SubmittedAt>
    </ChangeInfo>
 </GetChangeResponse>`
+
+var ListResourceRecordSetsResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<ListResourceRecordSetsResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+   <ResourceRecordSets>
+      <ResourceRecordSet>
+         <Name>_acme-challenge.example.com.</Name>
+         <Type>TXT</Type>
+         <TTL>10</TTL>
+         <ResourceRecords>
+            <ResourceRecord>
+               <Value>"other-challenge"</Value>
+            </ResourceRecord>
+         </ResourceRecords>
+      </ResourceRecordSet>
+   </ResourceRecordSets>
+   <IsTruncated>false</IsTruncated>
+   <MaxItems>1</MaxItems>
+</ListResourceRecordSetsResponse>`
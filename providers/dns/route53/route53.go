@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -21,9 +22,26 @@ const (
 	route53TTL = 10
 )
 
+// changeTimeout and changeInterval bound the wait for a change to reach all
+// nameservers. They are overridden during tests.
+var (
+	changeTimeout  = 120 * time.Second
+	changeInterval = 4 * time.Second
+)
+
+// findZoneByFqdn determines the DNS zone of an fqdn. It is overridden during
+// tests.
+var findZoneByFqdn = acme.FindZoneByFqdn
+
 // DNSProvider implements the acme.ChallengeProvider interface
+//
+// Route 53 replaces a whole TXT record set at once, so Present and CleanUp
+// read the values, change them and write them back. The mutex keeps
+// concurrent challenges from overwriting each other; it is released before
+// waiting for the change to reach the nameservers.
 type DNSProvider struct {
 	client *route53.Route53
+	mu     sync.Mutex
 }
 
 // customRetryer implements the client.Retryer interface by composing the
@@ -68,27 +86,122 @@ func NewDNSProvider() (*DNSProvider, error) {
 	return &DNSProvider{client: client}, nil
 }
 
-// Present creates a TXT record using the specified parameters
+// Present creates a TXT record using the specified parameters. Values
+// already present at fqdn, e.g. those of another challenge delegated to the
+// same name, are kept.
 func (r *DNSProvider) Present(domain, token, keyAuth string) error {
 	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
 	value = `"` + value + `"`
-	return r.changeRecord("UPSERT", fqdn, value, route53TTL)
+
+	hostedZoneID, err := getHostedZoneID(fqdn, r.client)
+	if err != nil {
+		return fmt.Errorf("Failed to determine Route 53 hosted zone ID: %v", err)
+	}
+
+	return r.addTXTValue(hostedZoneID, fqdn, value)
 }
 
-// CleanUp removes the TXT record matching the specified parameters
+// CleanUp removes the TXT record matching the specified parameters, leaving
+// other values at fqdn in place.
 func (r *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
 	value = `"` + value + `"`
-	return r.changeRecord("DELETE", fqdn, value, route53TTL)
-}
 
-func (r *DNSProvider) changeRecord(action, fqdn, value string, ttl int) error {
 	hostedZoneID, err := getHostedZoneID(fqdn, r.client)
 	if err != nil {
 		return fmt.Errorf("Failed to determine Route 53 hosted zone ID: %v", err)
 	}
 
-	recordSet := newTXTRecordSet(fqdn, value, ttl)
+	return r.removeTXTValue(hostedZoneID, fqdn, value)
+}
+
+// addTXTValue adds value to the TXT record set at fqdn.
+func (r *DNSProvider) addTXTValue(hostedZoneID, fqdn, value string) error {
+	statusID, err := r.updateTXTValues(hostedZoneID, fqdn, func(values []string) (string, []string) {
+		for _, v := range values {
+			if v == value {
+				return "", nil
+			}
+		}
+		return "UPSERT", append(values, value)
+	})
+	if err != nil || statusID == nil {
+		return err
+	}
+	return r.waitForChange(statusID)
+}
+
+// removeTXTValue removes value from the TXT record set at fqdn, deleting
+// the record set if no other values remain.
+func (r *DNSProvider) removeTXTValue(hostedZoneID, fqdn, value string) error {
+	statusID, err := r.updateTXTValues(hostedZoneID, fqdn, func(values []string) (string, []string) {
+		var remaining []string
+		for _, v := range values {
+			if v != value {
+				remaining = append(remaining, v)
+			}
+		}
+		if len(remaining) == len(values) {
+			return "", nil
+		}
+		if len(remaining) == 0 {
+			// A DELETE has to match the record set exactly.
+			return "DELETE", values
+		}
+		return "UPSERT", remaining
+	})
+	if err != nil || statusID == nil {
+		return err
+	}
+	return r.waitForChange(statusID)
+}
+
+// updateTXTValues reads the values of the TXT record set at fqdn and submits
+// the change fn returns for them, if its action is not empty. It returns the
+// ID of the submitted change, or nil if there was none.
+func (r *DNSProvider) updateTXTValues(hostedZoneID, fqdn string, fn func([]string) (string, []string)) (*string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	values, err := r.getTXTValues(hostedZoneID, fqdn)
+	if err != nil {
+		return nil, err
+	}
+	action, values := fn(values)
+	if action == "" {
+		return nil, nil
+	}
+	return r.changeRecord(hostedZoneID, action, fqdn, values, route53TTL)
+}
+
+// getTXTValues returns the values of the TXT record set at fqdn.
+func (r *DNSProvider) getTXTValues(hostedZoneID, fqdn string) ([]string, error) {
+	resp, err := r.client.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(hostedZoneID),
+		StartRecordName: aws.String(fqdn),
+		StartRecordType: aws.String("TXT"),
+		MaxItems:        aws.String("1"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list Route 53 record sets: %v", err)
+	}
+
+	var values []string
+	for _, recordSet := range resp.ResourceRecordSets {
+		if aws.StringValue(recordSet.Name) != fqdn || aws.StringValue(recordSet.Type) != "TXT" {
+			continue
+		}
+		for _, record := range recordSet.ResourceRecords {
+			values = append(values, aws.StringValue(record.Value))
+		}
+	}
+	return values, nil
+}
+
+// changeRecord submits a change of the TXT record set at fqdn and returns
+// its ID.
+func (r *DNSProvider) changeRecord(hostedZoneID, action, fqdn string, values []string, ttl int) (*string, error) {
+	recordSet := newTXTRecordSet(fqdn, values, ttl)
 	reqParams := &route53.ChangeResourceRecordSetsInput{
 		HostedZoneId: aws.String(hostedZoneID),
 		ChangeBatch: &route53.ChangeBatch{
@@ -104,12 +217,14 @@ func (r *DNSProvider) changeRecord(action, fqdn, value string, ttl int) error {
 
 	resp, err := r.client.ChangeResourceRecordSets(reqParams)
 	if err != nil {
-		return fmt.Errorf("Failed to change Route 53 record set: %v", err)
+		return nil, fmt.Errorf("Failed to change Route 53 record set: %v", err)
 	}
+	return resp.ChangeInfo.Id, nil
+}
 
-	statusID := resp.ChangeInfo.Id
-
-	return acme.WaitFor(120*time.Second, 4*time.Second, func() (bool, error) {
+// waitForChange waits until the change statusID reached all nameservers.
+func (r *DNSProvider) waitForChange(statusID *string) error {
+	return acme.WaitFor(changeTimeout, changeInterval, func() (bool, error) {
 		reqParams := &route53.GetChangeInput{
 			Id: statusID,
 		}
@@ -125,7 +240,7 @@ func (r *DNSProvider) changeRecord(action, fqdn, value string, ttl int) error {
 }
 
 func getHostedZoneID(fqdn string, client *route53.Route53) (string, error) {
-	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
+	authZone, err := findZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
 		return "", err
 	}
@@ -159,13 +274,16 @@ func getHostedZoneID(fqdn string, client *route53.Route53) (string, error) {
 	return hostedZoneID, nil
 }
 
-func newTXTRecordSet(fqdn, value string, ttl int) *route53.ResourceRecordSet {
+func newTXTRecordSet(fqdn string, values []string, ttl int) *route53.ResourceRecordSet {
+	records := make([]*route53.ResourceRecord, len(values))
+	for i, value := range values {
+		records[i] = &route53.ResourceRecord{Value: aws.String(value)}
+	}
+
 	return &route53.ResourceRecordSet{
-		Name: aws.String(fqdn),
-		Type: aws.String("TXT"),
-		TTL:  aws.Int64(int64(ttl)),
-		ResourceRecords: []*route53.ResourceRecord{
-			{Value: aws.String(value)},
-		},
+		Name:            aws.String(fqdn),
+		Type:            aws.String("TXT"),
+		TTL:             aws.Int64(int64(ttl)),
+		ResourceRecords: records,
 	}
 }
@@ -1,15 +1,23 @@
 package route53
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -71,6 +79,7 @@ func TestRoute53Present(t *testing.T) {
 	mockResponses := MockResponseMap{
 		"/2013-04-01/hostedzonesbyname":         MockResponse{StatusCode: 200, Body: ListHostedZonesByNameResponse},
 		"/2013-04-01/hostedzone/ABCDEFG/rrset/": MockResponse{StatusCode: 200, Body: ChangeResourceRecordSetsResponse},
+		"/2013-04-01/hostedzone/ABCDEFG/rrset":  MockResponse{StatusCode: 200, Body: ListResourceRecordSetsResponse},
 		"/2013-04-01/change/123456":             MockResponse{StatusCode: 200, Body: GetChangeResponse},
 	}
 
@@ -85,3 +94,117 @@ func TestRoute53Present(t *testing.T) {
 	err := provider.Present(domain, "", keyAuth)
 	assert.NoError(t, err, "Expected Present to return no error")
 }
+
+func TestRoute53KeepsOtherValues(t *testing.T) {
+	var changes []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		switch r.URL.Path {
+		case "/2013-04-01/hostedzone/ABCDEFG/rrset":
+			w.Write([]byte(ListResourceRecordSetsResponse))
+		case "/2013-04-01/hostedzone/ABCDEFG/rrset/":
+			body, _ := ioutil.ReadAll(r.Body)
+			changes = append(changes, string(body))
+			w.Write([]byte(ChangeResourceRecordSetsResponse))
+		case "/2013-04-01/change/123456":
+			w.Write([]byte(GetChangeResponse))
+		default:
+			require.FailNow(t, "Unexpected request", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	provider := makeRoute53Provider(ts)
+	fqdn := "_acme-challenge.example.com."
+
+	require.NoError(t, provider.addTXTValue("ABCDEFG", fqdn, `"new-challenge"`))
+	require.NoError(t, provider.removeTXTValue("ABCDEFG", fqdn, `"new-challenge"`))
+	require.NoError(t, provider.removeTXTValue("ABCDEFG", fqdn, `"other-challenge"`))
+	require.Len(t, changes, 2)
+
+	// the new value is added next to the existing one
+	assert.Contains(t, changes[0], "<Action>UPSERT</Action>")
+	assert.Contains(t, changes[0], "other-challenge")
+	assert.Contains(t, changes[0], "new-challenge")
+
+	// removing a value which is not in the record set is a no-op, removing
+	// the last one deletes the record set
+	assert.Contains(t, changes[1], "<Action>DELETE</Action>")
+	assert.Contains(t, changes[1], "other-challenge")
+}
+
+func TestRoute53ConcurrentPresent(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		values  []string
+		changes int
+	)
+	valueRegexp := regexp.MustCompile(`<Value>([^<]*)</Value>`)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/xml")
+		switch r.URL.Path {
+		case "/2013-04-01/hostedzonesbyname":
+			w.Write([]byte(ListHostedZonesByNameResponse))
+		case "/2013-04-01/hostedzone/ABCDEFG/rrset":
+			var records string
+			for _, v := range values {
+				records += "<ResourceRecord><Value>" + v + "</Value></ResourceRecord>"
+			}
+			if len(values) > 0 {
+				records = "<ResourceRecordSet><Name>_acme-challenge.example.com.</Name><Type>TXT</Type><TTL>10</TTL><ResourceRecords>" + records + "</ResourceRecords></ResourceRecordSet>"
+			}
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListResourceRecordSetsResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/"><ResourceRecordSets>%s</ResourceRecordSets><IsTruncated>false</IsTruncated><MaxItems>1</MaxItems></ListResourceRecordSetsResponse>`, records)
+		case "/2013-04-01/hostedzone/ABCDEFG/rrset/":
+			body, _ := ioutil.ReadAll(r.Body)
+			values = nil
+			for _, m := range valueRegexp.FindAllStringSubmatch(string(body), -1) {
+				values = append(values, strings.Replace(m[1], "&#34;", `"`, -1))
+			}
+			changes++
+			w.Write([]byte(ChangeResourceRecordSetsResponse))
+		case "/2013-04-01/change/123456":
+			// The changes only get in sync once all of them were
+			// submitted, which needs the lock to be released while
+			// waiting.
+			if changes < 5 {
+				w.Write([]byte(strings.Replace(GetChangeResponse, "INSYNC", "PENDING", 1)))
+			} else {
+				w.Write([]byte(GetChangeResponse))
+			}
+		default:
+			require.FailNow(t, "Unexpected request", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	savedFindZoneByFqdn := findZoneByFqdn
+	defer func() { findZoneByFqdn = savedFindZoneByFqdn }()
+	findZoneByFqdn = func(fqdn string, nameservers []string) (string, error) {
+		return "example.com.", nil
+	}
+
+	defer func(timeout, interval time.Duration) { changeTimeout, changeInterval = timeout, interval }(changeTimeout, changeInterval)
+	changeTimeout, changeInterval = 5*time.Second, 10*time.Millisecond
+
+	provider := makeRoute53Provider(ts)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = provider.Present("example.com", "", fmt.Sprintf("keyAuth%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Len(t, values, len(errs), "every challenge must keep its value")
+}
@@ -0,0 +1,102 @@
+// Package routing implements a DNS provider for solving the DNS-01 challenge
+// with the DNS provider configured for the domain, for certificates whose
+// domains are hosted by different DNS providers.
+package routing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+)
+
+// RoutingProvider is an implementation of the acme.ChallengeProvider
+// interface that passes each challenge to the provider configured for the
+// longest matching domain suffix.
+type RoutingProvider struct {
+	routes map[string]acme.ChallengeProvider
+}
+
+// NewRoutingProvider returns a RoutingProvider for routes, which map domain
+// suffixes to providers. A suffix matches the domain itself and all its
+// subdomains, so "example.com" matches "www.example.com" but not
+// "myexample.com". The empty suffix matches every domain and can be used as
+// the default route.
+func NewRoutingProvider(routes map[string]acme.ChallengeProvider) (*RoutingProvider, error) {
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("routing: no routes")
+	}
+
+	r := &RoutingProvider{routes: make(map[string]acme.ChallengeProvider, len(routes))}
+	for suffix, provider := range routes {
+		if provider == nil {
+			return nil, fmt.Errorf("routing: no DNS provider for %q", suffix)
+		}
+		r.routes[normalize(suffix)] = provider
+	}
+	return r, nil
+}
+
+// Present creates the TXT record with the provider routed to for domain.
+func (r *RoutingProvider) Present(domain, token, keyAuth string) error {
+	provider, err := r.route(domain)
+	if err != nil {
+		return err
+	}
+	return provider.Present(domain, token, keyAuth)
+}
+
+// CleanUp removes the TXT record with the provider routed to for domain.
+func (r *RoutingProvider) CleanUp(domain, token, keyAuth string) error {
+	provider, err := r.route(domain)
+	if err != nil {
+		return err
+	}
+	return provider.CleanUp(domain, token, keyAuth)
+}
+
+// Timeout returns the longest timeout and interval of the providers, as the
+// challenge asks for them without naming the domain.
+func (r *RoutingProvider) Timeout() (timeout, interval time.Duration) {
+	for _, provider := range r.routes {
+		t, i := acme.DefaultPropagationTimeout, acme.DefaultPollingInterval
+		if provider, ok := provider.(acme.ChallengeProviderTimeout); ok {
+			t, i = provider.Timeout()
+		}
+		if t > timeout {
+			timeout = t
+		}
+		if i > interval {
+			interval = i
+		}
+	}
+	return timeout, interval
+}
+
+// route returns the provider of the longest suffix matching domain.
+func (r *RoutingProvider) route(domain string) (acme.ChallengeProvider, error) {
+	name := normalize(domain)
+	for {
+		if provider, ok := r.routes[name]; ok {
+			return provider, nil
+		}
+		if name == "" {
+			return nil, fmt.Errorf("routing: no DNS provider configured for %s", domain)
+		}
+
+		i := strings.Index(name, ".")
+		if i < 0 {
+			name = ""
+		} else {
+			name = name[i+1:]
+		}
+	}
+}
+
+// normalize returns domain in lower case, without a wildcard label and
+// without the trailing dot.
+func normalize(domain string) string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	return strings.TrimPrefix(domain, "*.")
+}
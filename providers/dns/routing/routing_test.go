@@ -0,0 +1,60 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/mock"
+)
+
+func TestNewRoutingProviderValidation(t *testing.T) {
+	_, err := NewRoutingProvider(nil)
+	assert.EqualError(t, err, "routing: no routes")
+
+	_, err = NewRoutingProvider(map[string]acme.ChallengeProvider{"example.com": nil})
+	assert.EqualError(t, err, `routing: no DNS provider for "example.com"`)
+}
+
+func TestRoutingProviderLongestSuffix(t *testing.T) {
+	apex := mock.NewProvider()
+	sub := mock.NewProvider()
+	fallback := mock.NewProvider()
+
+	provider, err := NewRoutingProvider(map[string]acme.ChallengeProvider{
+		"example.com":         apex,
+		"Dev.Example.com.":    sub,
+		"":                    fallback,
+		"unused.example.org.": mock.NewProvider(),
+	})
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		domain   string
+		expected *mock.Provider
+	}{
+		{"example.com", apex},
+		{"www.example.com", apex},
+		{"*.example.com", apex},
+		{"dev.example.com", sub},
+		{"api.dev.example.com", sub},
+		{"myexample.com", fallback},
+		{"example.org", fallback},
+	} {
+		require.NoError(t, provider.Present(test.domain, "token", "keyAuth"))
+		fqdn, _, _ := acme.DNS01Record(test.domain, "keyAuth")
+		assert.Contains(t, test.expected.Records(), fqdn, test.domain)
+
+		require.NoError(t, provider.CleanUp(test.domain, "token", "keyAuth"))
+		assert.NotContains(t, test.expected.Records(), fqdn, test.domain)
+	}
+}
+
+func TestRoutingProviderNoRoute(t *testing.T) {
+	provider, err := NewRoutingProvider(map[string]acme.ChallengeProvider{"example.com": mock.NewProvider()})
+	require.NoError(t, err)
+
+	err = provider.Present("example.org", "token", "keyAuth")
+	assert.EqualError(t, err, "routing: no DNS provider configured for example.org")
+}
@@ -0,0 +1,207 @@
+// Package sshzone implements a DNS provider for solving the DNS-01 challenge
+// by editing a BIND zone file on a remote host over SSH.
+package sshzone
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
+	"github.com/xenolf/lego/providers/dns/internal/zonefile"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DNSProvider is an implementation of the acme.ChallengeProvider interface
+// that appends TXT records to a zone file on a remote host, increments the
+// serial so secondaries pick up the change and reloads the nameserver
+// afterwards.
+type DNSProvider struct {
+	host      string
+	config    *ssh.ClientConfig
+	zoneFile  string
+	reloadCmd string
+
+	// mu serializes the changes to the zone file.
+	mu sync.Mutex
+}
+
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("SSH zone", "SSHZONE_HOST", "SSHZONE_USER", "SSHZONE_PRIVATE_KEY", "SSHZONE_ZONE_FILE")
+}
+
+// NewDNSProvider returns a DNSProvider instance configured from the
+// environment variables SSHZONE_HOST (host or host:port), SSHZONE_USER,
+// SSHZONE_PRIVATE_KEY (path to the key or the PEM encoded key itself) and
+// SSHZONE_ZONE_FILE. SSHZONE_RELOAD_CMD replaces the default "rndc reload".
+// The host key is checked against SSHZONE_KNOWN_HOSTS, which defaults to
+// ~/.ssh/known_hosts.
+func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
+	key := os.Getenv("SSHZONE_PRIVATE_KEY")
+	if !strings.HasPrefix(key, "-----BEGIN") {
+		keyBytes, err := ioutil.ReadFile(key)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read SSH private key: %v", err)
+		}
+		key = string(keyBytes)
+	}
+
+	knownHosts := os.Getenv("SSHZONE_KNOWN_HOSTS")
+	if knownHosts == "" {
+		knownHosts = filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load known hosts: %v", err)
+	}
+
+	return NewDNSProviderCredentials(os.Getenv("SSHZONE_HOST"), os.Getenv("SSHZONE_USER"), []byte(key),
+		os.Getenv("SSHZONE_ZONE_FILE"), os.Getenv("SSHZONE_RELOAD_CMD"), hostKeyCallback)
+}
+
+// NewDNSProviderCredentials uses the supplied credentials to return a
+// DNSProvider instance. privateKey is PEM encoded, hostKeyCallback verifies
+// the key of host. An empty reloadCmd defaults to "rndc reload".
+func NewDNSProviderCredentials(host, user string, privateKey []byte, zoneFile, reloadCmd string, hostKeyCallback ssh.HostKeyCallback) (*DNSProvider, error) {
+	if host == "" || user == "" || zoneFile == "" {
+		return nil, fmt.Errorf("SSH zone credentials missing")
+	}
+	if hostKeyCallback == nil {
+		return nil, fmt.Errorf("SSH zone host key callback missing")
+	}
+
+	signer, err := ssh.ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse SSH private key: %v", err)
+	}
+
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	if reloadCmd == "" {
+		reloadCmd = "rndc reload"
+	}
+
+	return &DNSProvider{
+		host: host,
+		config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         30 * time.Second,
+		},
+		zoneFile:  zoneFile,
+		reloadCmd: reloadCmd,
+	}, nil
+}
+
+// Present appends a TXT record to the zone file and reloads the nameserver.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	record := txtRecord(fqdn, value, ttl)
+
+	return d.update(func(lines []string) []string {
+		return append(lines, record)
+	})
+}
+
+// CleanUp removes the TXT record added by Present and reloads the nameserver.
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	record := txtRecord(fqdn, value, ttl)
+
+	return d.update(func(lines []string) []string {
+		var kept []string
+		for _, line := range lines {
+			if line != record {
+				kept = append(kept, line)
+			}
+		}
+		return kept
+	})
+}
+
+// update reads the zone file, applies fn to its lines, increments the serial,
+// writes the file back and reloads the nameserver.
+func (d *DNSProvider) update(fn func([]string) []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	client, err := ssh.Dial("tcp", d.host, d.config)
+	if err != nil {
+		return fmt.Errorf("Could not connect to %s: %v", d.host, err)
+	}
+	defer client.Close()
+
+	data, err := d.run(client, "cat "+shellQuote(d.zoneFile), "")
+	if err != nil {
+		return err
+	}
+	content, err := editZone(data, fn)
+	if err != nil {
+		return fmt.Errorf("%s: %v", d.zoneFile, err)
+	}
+
+	_, err = d.run(client, writeCommand(d.zoneFile, d.reloadCmd), content)
+	return err
+}
+
+// run executes cmd through the shell of the remote host with stdin as its
+// input and returns its output.
+func (d *DNSProvider) run(client *ssh.Client, cmd, stdin string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdin = strings.NewReader(stdin)
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if err := session.Run(cmd); err != nil {
+		return "", fmt.Errorf("Command on %s failed: %v: %s", d.host, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// txtRecord formats a TXT record as a zone file line.
+func txtRecord(fqdn, value string, ttl int) string {
+	return fmt.Sprintf("%s %d IN TXT \"%s\"", fqdn, ttl, value)
+}
+
+// editZone applies fn to the lines of the zone file content and increments
+// the serial.
+func editZone(content string, fn func([]string) []string) (string, error) {
+	lines := fn(strings.Split(strings.TrimSuffix(content, "\n"), "\n"))
+	return zonefile.IncrementSerial(strings.Join(lines, "\n") + "\n")
+}
+
+// writeCommand returns the shell command replacing the content of zoneFile
+// with its input and reloading the nameserver. The input is received
+// completely before the file is rewritten in place, which keeps its owner
+// and permissions.
+func writeCommand(zoneFile, reloadCmd string) string {
+	tmp := shellQuote(zoneFile + ".lego")
+	zone := shellQuote(zoneFile)
+	return fmt.Sprintf("cat > %s && cat %s > %s && rm -f %s && %s", tmp, tmp, zone, tmp, reloadCmd)
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,99 @@
+package sshzone
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func testPrivateKey(t *testing.T) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func TestNewDNSProviderMissingCredErr(t *testing.T) {
+	for _, name := range []string{"SSHZONE_HOST", "SSHZONE_USER", "SSHZONE_PRIVATE_KEY", "SSHZONE_ZONE_FILE"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, "")
+	}
+	os.Setenv("SSHZONE_HOST", "ns1.example.com")
+
+	_, err := NewDNSProvider()
+	assert.EqualError(t, err, "SSH zone credentials missing: SSHZONE_USER, SSHZONE_PRIVATE_KEY, SSHZONE_ZONE_FILE")
+}
+
+func TestNewDNSProviderCredentials(t *testing.T) {
+	key := testPrivateKey(t)
+
+	provider, err := NewDNSProviderCredentials("ns1.example.com", "lego", key, "/etc/bind/example.com.zone", "", ssh.InsecureIgnoreHostKey())
+	require.NoError(t, err)
+	assert.Equal(t, "ns1.example.com:22", provider.host)
+	assert.Equal(t, "rndc reload", provider.reloadCmd)
+
+	_, err = NewDNSProviderCredentials("ns1.example.com", "lego", []byte("no key"), "/etc/bind/example.com.zone", "", ssh.InsecureIgnoreHostKey())
+	assert.Error(t, err)
+
+	_, err = NewDNSProviderCredentials("ns1.example.com", "lego", key, "/etc/bind/example.com.zone", "", nil)
+	assert.EqualError(t, err, "SSH zone host key callback missing")
+}
+
+func TestEditZone(t *testing.T) {
+	original := "$ORIGIN example.com.\n@ 3600 IN SOA ns1 hostmaster 1 7200 3600 1209600 3600\n"
+	record := txtRecord("_acme-challenge.example.com.", "fe01=", 120)
+	assert.Equal(t, `_acme-challenge.example.com. 120 IN TXT "fe01="`, record)
+
+	content, err := editZone(original, func(lines []string) []string {
+		return append(lines, record)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "$ORIGIN example.com.\n@ 3600 IN SOA ns1 hostmaster 2 7200 3600 1209600 3600\n"+record+"\n", content)
+
+	_, err = editZone("$ORIGIN example.com.\n", func(lines []string) []string { return lines })
+	assert.EqualError(t, err, "no SOA record")
+}
+
+func TestWriteCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshzone")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	zoneFile := filepath.Join(dir, "it's.zone")
+	original := "$ORIGIN example.com.\n@ 3600 IN SOA ns1 hostmaster 1 7200 3600 1209600 3600\n"
+	require.NoError(t, ioutil.WriteFile(zoneFile, []byte(original), 0640))
+
+	updated := "$ORIGIN example.com.\n@ 3600 IN SOA ns1 hostmaster 2 7200 3600 1209600 3600\n"
+	cmd := exec.Command("sh", "-c", writeCommand(zoneFile, "true"))
+	cmd.Stdin = strings.NewReader(updated)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	content, err := ioutil.ReadFile(zoneFile)
+	require.NoError(t, err)
+	assert.Equal(t, updated, string(content))
+	info, err := os.Stat(zoneFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode())
+	_, err = os.Stat(zoneFile + ".lego")
+	assert.True(t, os.IsNotExist(err))
+
+	// The zone file is left alone if the new content cannot be received.
+	require.NoError(t, os.Mkdir(zoneFile+".lego", 0755))
+	cmd = exec.Command("sh", "-c", writeCommand(zoneFile, "true"))
+	cmd.Stdin = strings.NewReader("garbage\n")
+	assert.Error(t, cmd.Run())
+	content, err = ioutil.ReadFile(zoneFile)
+	require.NoError(t, err)
+	assert.Equal(t, updated, string(content))
+}
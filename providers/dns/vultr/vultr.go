@@ -10,6 +10,7 @@ import (
 
 	vultr "github.com/JamesClonk/vultr/lib"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/providers/dns/internal/env"
 )
 
 // DNSProvider is an implementation of the acme.ChallengeProvider interface.
@@ -17,9 +18,19 @@ type DNSProvider struct {
 	client *vultr.Client
 }
 
+// CheckEnvironment returns an error naming every environment variable
+// required by NewDNSProvider which is not set.
+func CheckEnvironment() error {
+	return env.Check("Vultr", "VULTR_API_KEY")
+}
+
 // NewDNSProvider returns a DNSProvider instance with a configured Vultr client.
 // Authentication uses the VULTR_API_KEY environment variable.
 func NewDNSProvider() (*DNSProvider, error) {
+	if err := CheckEnvironment(); err != nil {
+		return nil, err
+	}
+
 	apiKey := os.Getenv("VULTR_API_KEY")
 	return NewDNSProviderCredentials(apiKey)
 }
@@ -42,7 +53,7 @@ func NewDNSProviderCredentials(apiKey string) (*DNSProvider, error) {
 func (c *DNSProvider) Present(domain, token, keyAuth string) error {
 	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
 
-	zoneDomain, err := c.getHostedZone(domain)
+	zoneDomain, err := c.getHostedZone(acme.UnFqdn(fqdn))
 	if err != nil {
 		return err
 	}
@@ -59,7 +70,7 @@ func (c *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (c *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
 
 	zoneDomain, records, err := c.findTxtRecords(domain, fqdn)
 	if err != nil {
@@ -67,6 +78,10 @@ func (c *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 	}
 
 	for _, rec := range records {
+		if rec.Data != `"`+value+`"` {
+			// keep the records of other challenges for the same name
+			continue
+		}
 		err := c.client.DeleteDnsRecord(zoneDomain, rec.RecordID)
 		if err != nil {
 			return err
@@ -97,7 +112,7 @@ func (c *DNSProvider) getHostedZone(domain string) (string, error) {
 }
 
 func (c *DNSProvider) findTxtRecords(domain, fqdn string) (string, []vultr.DnsRecord, error) {
-	zoneDomain, err := c.getHostedZone(domain)
+	zoneDomain, err := c.getHostedZone(acme.UnFqdn(fqdn))
 	if err != nil {
 		return "", nil, err
 	}
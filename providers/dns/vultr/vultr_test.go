@@ -35,7 +35,7 @@ func TestNewDNSProviderMissingCredErr(t *testing.T) {
 	os.Setenv("VULTR_API_KEY", "")
 	defer restoreEnv()
 	_, err := NewDNSProvider()
-	assert.EqualError(t, err, "Vultr credentials missing")
+	assert.EqualError(t, err, "Vultr credentials missing: VULTR_API_KEY")
 }
 
 func TestLivePresent(t *testing.T) {
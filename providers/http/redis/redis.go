@@ -0,0 +1,70 @@
+// Package redis implements a HTTP provider for solving the HTTP-01 challenge
+// by storing the key authorization in Redis, where the web servers of a
+// cluster can read it.
+package redis
+
+import (
+	"fmt"
+	"path"
+
+	redigo "github.com/garyburd/redigo/redis"
+	"github.com/xenolf/lego/acme"
+)
+
+// TTL is the number of seconds Redis keeps a challenge, so it expires even
+// if CleanUp is never called.
+const TTL = 300
+
+// HTTPProvider implements ChallengeProvider for `http-01` challenge
+type HTTPProvider struct {
+	url string
+}
+
+// NewHTTPProvider returns a HTTPProvider instance storing challenges in the
+// Redis server at url, e.g. redis://:password@localhost:6379/0.
+func NewHTTPProvider(url string) (*HTTPProvider, error) {
+	if url == "" {
+		return nil, fmt.Errorf("No Redis URL provided")
+	}
+
+	return &HTTPProvider{url: url}, nil
+}
+
+// Present stores the key authorization under the path of the challenge,
+// `/.well-known/acme-challenge/<token>`, for TTL seconds.
+func (r *HTTPProvider) Present(domain, token, keyAuth string) error {
+	conn, err := redigo.DialURL(r.url)
+	if err != nil {
+		return fmt.Errorf("Could not connect to Redis -> %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("SET", challengeKey(token), keyAuth, "EX", TTL)
+	if err != nil {
+		return fmt.Errorf("Could not store the HTTP challenge in Redis -> %v", err)
+	}
+
+	return nil
+}
+
+// CleanUp removes the challenge from Redis.
+func (r *HTTPProvider) CleanUp(domain, token, keyAuth string) error {
+	conn, err := redigo.DialURL(r.url)
+	if err != nil {
+		return fmt.Errorf("Could not connect to Redis -> %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("DEL", challengeKey(token))
+	if err != nil {
+		return fmt.Errorf("Could not remove the HTTP challenge from Redis -> %v", err)
+	}
+
+	return nil
+}
+
+// challengeKey returns the request path of the challenge, which is used as
+// the Redis key so web servers can look it up by $uri.
+func challengeKey(token string) string {
+	return path.Join("/", acme.HTTP01ChallengePath(token))
+}
@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis answers SET and DEL commands and records every command it gets.
+type fakeRedis struct {
+	listener net.Listener
+
+	sync.Mutex
+	commands [][]string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	f := &fakeRedis{listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		f.Lock()
+		f.commands = append(f.commands, cmd)
+		f.Unlock()
+
+		switch strings.ToUpper(cmd[0]) {
+		case "SET":
+			fmt.Fprint(conn, "+OK\r\n")
+		case "DEL":
+			fmt.Fprint(conn, ":1\r\n")
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", cmd[0])
+		}
+	}
+}
+
+// readCommand reads a RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := make([]string, n)
+	for i := range cmd {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		cmd[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return cmd, nil
+}
+
+func TestNewHTTPProviderEmpty(t *testing.T) {
+	_, err := NewHTTPProvider("")
+	assert.EqualError(t, err, "No Redis URL provided")
+}
+
+func TestPresentCleanUp(t *testing.T) {
+	server := newFakeRedis(t)
+	defer server.listener.Close()
+
+	provider, err := NewHTTPProvider("redis://" + server.listener.Addr().String())
+	require.NoError(t, err)
+
+	require.NoError(t, provider.Present("lego.test", "foo", "bar"))
+	require.NoError(t, provider.CleanUp("lego.test", "foo", "bar"))
+
+	server.Lock()
+	defer server.Unlock()
+	assert.Equal(t, [][]string{
+		{"SET", "/.well-known/acme-challenge/foo", "bar", "EX", "300"},
+		{"DEL", "/.well-known/acme-challenge/foo"},
+	}, server.commands)
+}
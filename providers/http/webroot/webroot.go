@@ -28,17 +28,19 @@ func NewHTTPProvider(path string) (*HTTPProvider, error) {
 	return c, nil
 }
 
-// Present makes the token available at `HTTP01ChallengePath(token)` by creating a file in the given webroot path
+// Present makes the token available at `HTTP01ChallengePath(token)` by creating a file in the given webroot path.
+// The file is written next to its final name and renamed into place, so the web server never serves a partial file.
 func (w *HTTPProvider) Present(domain, token, keyAuth string) error {
 	var err error
 
 	challengeFilePath := path.Join(w.path, acme.HTTP01ChallengePath(token))
+	// MkdirAll succeeds if a concurrent Present created the directories first.
 	err = os.MkdirAll(path.Dir(challengeFilePath), 0755)
 	if err != nil {
 		return fmt.Errorf("Could not create required directories in webroot for HTTP challenge -> %v", err)
 	}
 
-	err = ioutil.WriteFile(challengeFilePath, []byte(keyAuth), 0644)
+	err = writeFileAtomic(challengeFilePath, []byte(keyAuth), 0644)
 	if err != nil {
 		return fmt.Errorf("Could not write file in webroot for HTTP challenge -> %v", err)
 	}
@@ -46,6 +48,30 @@ func (w *HTTPProvider) Present(domain, token, keyAuth string) error {
 	return nil
 }
 
+// writeFileAtomic writes data to a temporary file in the directory of name
+// and renames it to name.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(path.Dir(name), "."+path.Base(name))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
 // CleanUp removes the file created for the challenge
 func (w *HTTPProvider) CleanUp(domain, token, keyAuth string) error {
 	var err error
@@ -1,8 +1,10 @@
 package webroot
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"sync"
 	"testing"
 )
 
@@ -44,3 +46,51 @@ func TestHTTPProvider(t *testing.T) {
 		t.Errorf("Webroot provider CleanUp() error: got %v, want nil", err)
 	}
 }
+
+func TestHTTPProviderWritesAtomically(t *testing.T) {
+	webroot, err := ioutil.TempDir("", "webroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(webroot)
+
+	provider, err := NewHTTPProvider(webroot)
+	if err != nil {
+		t.Fatalf("Webroot provider error: got %v, want nil", err)
+	}
+
+	// the challenge directories do not exist yet and are created concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := provider.Present("domain", fmt.Sprintf("token%d", i), "keyAuth"); err != nil {
+				t.Errorf("Webroot provider present() error: got %v, want nil", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	files, err := ioutil.ReadDir(webroot + "/.well-known/acme-challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 10 {
+		t.Errorf("Expected only the 10 challenge files in the challenge directory, got %d", len(files))
+	}
+	for _, file := range files {
+		if file.Mode().Perm() != 0644 {
+			t.Errorf("Expected %s to be world readable, got %v", file.Name(), file.Mode())
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := provider.CleanUp("domain", fmt.Sprintf("token%d", i), "keyAuth"); err != nil {
+			t.Errorf("Webroot provider CleanUp() error: got %v, want nil", err)
+		}
+	}
+	if files, _ := ioutil.ReadDir(webroot + "/.well-known/acme-challenge"); len(files) != 0 {
+		t.Errorf("Expected CleanUp to remove all challenge files, %d left", len(files))
+	}
+}
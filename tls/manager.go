@@ -0,0 +1,243 @@
+// Package tls manages the certificates of a Go TLS server in process. A
+// Manager obtains a certificate the first time a client asks for one of its
+// domains, keeps it in a certstore.Storage and renews it in the background
+// before it expires:
+//
+//	manager := legotls.NewManager(client, storage, "example.com", "www.example.com")
+//	server := &http.Server{
+//		Addr:      ":443",
+//		TLSConfig: &tls.Config{GetCertificate: manager.GetCertificate},
+//	}
+//	server.ListenAndServeTLS("", "")
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/certstore"
+)
+
+// DefaultRenewBefore is the time before the expiry of a certificate at
+// which a Manager renews it unless RenewBefore is set.
+const DefaultRenewBefore = 30 * 24 * time.Hour
+
+var (
+	// timeNow returns the current time. It is overridden during tests.
+	timeNow = time.Now
+	// retryInterval is the time a Manager waits before it tries again to
+	// obtain or renew a certificate which failed.
+	retryInterval = 10 * time.Minute
+)
+
+// renewal is a running or failed attempt to obtain or renew the certificate
+// of a domain.
+type renewal struct {
+	done     chan struct{}
+	cert     *tls.Certificate
+	err      error
+	finished time.Time
+}
+
+// Manager implements the GetCertificate callback of a tls.Config for a set
+// of domains. Certificates found in the storage are served from memory;
+// missing ones are obtained with the client and expiring ones renewed in the
+// background while the old certificate is still served. It is safe for
+// concurrent use.
+//
+// The client has to be registered and able to solve a challenge for the
+// domains, e.g. with an HTTP-01 provider of the same server.
+type Manager struct {
+	// RenewBefore is the time before the expiry of a certificate at which
+	// it is renewed.
+	RenewBefore time.Duration
+	// Bundle makes the certificates include their issuer.
+	Bundle bool
+
+	client  *acme.Client
+	storage certstore.Storage
+	domains map[string]bool
+
+	mu       sync.Mutex
+	certs    map[string]*tls.Certificate
+	renewals map[string]*renewal
+
+	// obtainMu serializes the calls of the client, which solves one set of
+	// challenges at a time.
+	obtainMu sync.Mutex
+}
+
+// NewManager returns a Manager for domains, obtaining bundled certificates
+// with client and keeping them in storage. A handshake for any other server
+// name fails, so clients cannot make it request arbitrary certificates.
+func NewManager(client *acme.Client, storage certstore.Storage, domains ...string) *Manager {
+	m := &Manager{
+		RenewBefore: DefaultRenewBefore,
+		Bundle:      true,
+		client:      client,
+		storage:     storage,
+		domains:     map[string]bool{},
+		certs:       map[string]*tls.Certificate{},
+		renewals:    map[string]*renewal{},
+	}
+	for _, domain := range domains {
+		m.domains[strings.ToLower(domain)] = true
+	}
+	return m
+}
+
+// GetCertificate returns the certificate for the server name of hello. A
+// certificate which is missing or expired is obtained before it returns.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	domain := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if domain == "" {
+		return nil, fmt.Errorf("tls: missing server name")
+	}
+	if !m.domains[domain] {
+		return nil, fmt.Errorf("tls: no certificate is managed for %s", domain)
+	}
+
+	m.mu.Lock()
+	cert := m.certs[domain]
+	m.mu.Unlock()
+	if cert == nil {
+		var err error
+		if cert, err = m.load(domain); err != nil {
+			return nil, err
+		}
+	}
+
+	now := timeNow()
+	if cert != nil && now.Before(cert.Leaf.NotAfter) {
+		if cert.Leaf.NotAfter.Sub(now) < m.RenewBefore {
+			m.renew(domain)
+		}
+		return cert, nil
+	}
+
+	r := m.renew(domain)
+	<-r.done
+	return r.cert, r.err
+}
+
+// load reads the certificate of domain from the storage and caches it. It
+// returns nil if the storage holds none.
+func (m *Manager) load(domain string) (*tls.Certificate, error) {
+	res, err := m.storage.Load(domain)
+	if err == certstore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tls: could not load the certificate of %s: %v", domain, err)
+	}
+
+	cert, err := keyPair(res)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.certs[domain] = cert
+	m.mu.Unlock()
+	return cert, nil
+}
+
+// renew starts obtaining or renewing the certificate of domain in the
+// background, unless that is already running or failed less than
+// retryInterval ago.
+func (m *Manager) renew(domain string) *renewal {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.renewals[domain]; ok {
+		select {
+		case <-r.done:
+			if timeNow().Sub(r.finished) < retryInterval {
+				return r
+			}
+		default:
+			return r
+		}
+	}
+
+	r := &renewal{done: make(chan struct{})}
+	m.renewals[domain] = r
+	go func() {
+		cert, err := m.obtain(domain)
+		if err != nil {
+			logf("[WARNING][%s] %v", domain, err)
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		r.cert, r.err, r.finished = cert, err, timeNow()
+		if err == nil {
+			m.certs[domain] = cert
+			delete(m.renewals, domain)
+		}
+		close(r.done)
+	}()
+	return r
+}
+
+// obtain renews the certificate of domain in the storage, or obtains it if
+// there is none.
+func (m *Manager) obtain(domain string) (*tls.Certificate, error) {
+	m.obtainMu.Lock()
+	defer m.obtainMu.Unlock()
+
+	// Another process sharing the storage may have renewed it already.
+	res, err := m.storage.Load(domain)
+	switch {
+	case err == certstore.ErrNotFound:
+		var failures map[string]error
+		res, failures = m.client.ObtainCertificate([]string{domain}, m.Bundle, nil)
+		if len(failures) > 0 {
+			return nil, fmt.Errorf("tls: could not obtain the certificate of %s: %v", domain, failures[domain])
+		}
+	case err != nil:
+		return nil, fmt.Errorf("tls: could not load the certificate of %s: %v", domain, err)
+	default:
+		if cert, err := keyPair(res); err == nil && cert.Leaf.NotAfter.Sub(timeNow()) >= m.RenewBefore {
+			return cert, nil
+		}
+		if res, err = m.client.RenewCertificate(res, m.Bundle); err != nil {
+			return nil, fmt.Errorf("tls: could not renew the certificate of %s: %v", domain, err)
+		}
+	}
+
+	if err := m.storage.Save(res); err != nil {
+		return nil, fmt.Errorf("tls: could not save the certificate of %s: %v", domain, err)
+	}
+	return keyPair(res)
+}
+
+// keyPair returns res as a tls.Certificate whose Leaf is set.
+func keyPair(res acme.CertificateResource) (*tls.Certificate, error) {
+	if res.PrivateKey == nil {
+		return nil, fmt.Errorf("tls: the certificate of %s has no private key", res.Domain)
+	}
+	cert, err := tls.X509KeyPair(res.Certificate, res.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("tls: invalid certificate of %s: %v", res.Domain, err)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, fmt.Errorf("tls: invalid certificate of %s: %v", res.Domain, err)
+	}
+	return &cert, nil
+}
+
+// logf writes a log entry to acme.Logger if it is set, otherwise to the
+// default log.Logger.
+func logf(format string, args ...interface{}) {
+	if acme.Logger != nil {
+		acme.Logger.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,195 @@
+package tls
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/acme/testserver"
+	"github.com/xenolf/lego/certstore"
+	"github.com/xenolf/lego/certstore/storagetest"
+)
+
+type testUser struct {
+	key          crypto.PrivateKey
+	registration *acme.RegistrationResource
+}
+
+func (u *testUser) GetEmail() string                            { return "test@example.com" }
+func (u *testUser) GetRegistration() *acme.RegistrationResource { return u.registration }
+func (u *testUser) GetPrivateKey() crypto.PrivateKey            { return u.key }
+
+type noopProvider struct{}
+
+func (noopProvider) Present(domain, token, keyAuth string) error { return nil }
+func (noopProvider) CleanUp(domain, token, keyAuth string) error { return nil }
+
+// memoryStorage keeps certificates in a map and counts the calls of Save.
+type memoryStorage struct {
+	mu        sync.Mutex
+	resources map[string]acme.CertificateResource
+	saves     int
+}
+
+func (m *memoryStorage) Save(res acme.CertificateResource) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resources[res.Domain] = res
+	m.saves++
+	return nil
+}
+
+func (m *memoryStorage) Load(domain string) (acme.CertificateResource, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res, ok := m.resources[domain]
+	if !ok {
+		return acme.CertificateResource{}, certstore.ErrNotFound
+	}
+	return res, nil
+}
+
+func (m *memoryStorage) List() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var domains []string
+	for domain := range m.resources {
+		domains = append(domains, domain)
+	}
+	return domains, nil
+}
+
+func (m *memoryStorage) Delete(domain string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.resources, domain)
+	return nil
+}
+
+func (m *memoryStorage) saveCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.saves
+}
+
+// newTestManager returns a Manager for example.com and www.example.com with
+// a client registered at a test CA.
+func newTestManager(t *testing.T) (*Manager, *memoryStorage, *testserver.TestServer) {
+	ts := testserver.New()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	user := &testUser{key: key}
+	client, err := acme.NewClient(ts.DirectoryURL(), user, acme.RSA2048)
+	require.NoError(t, err)
+	client.SetChallengeProvider(acme.HTTP01, noopProvider{})
+	client.ExcludeChallenges([]acme.Challenge{acme.TLSSNI01, acme.DNS01})
+	user.registration, err = client.Register()
+	require.NoError(t, err)
+
+	storage := &memoryStorage{resources: map[string]acme.CertificateResource{}}
+	return NewManager(client, storage, "example.com", "www.example.com"), storage, ts
+}
+
+func TestGetCertificateObtains(t *testing.T) {
+	manager, storage, ts := newTestManager(t)
+	defer ts.Close()
+
+	var wg sync.WaitGroup
+	certs := make([]*tls.Certificate, 5)
+	for i := range certs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			certs[i], err = manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "Example.com."})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	require.NotNil(t, certs[0])
+	assert.NoError(t, certs[0].Leaf.CheckSignatureFrom(ts.CACertificate()))
+	assert.Equal(t, []string{"example.com"}, certs[0].Leaf.DNSNames)
+	for _, cert := range certs {
+		assert.True(t, cert == certs[0], "Expected all handshakes to get the same certificate")
+	}
+	assert.Equal(t, 1, storage.saveCount())
+
+	cert, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	require.NoError(t, err)
+	assert.True(t, cert == certs[0])
+	assert.Equal(t, 1, storage.saveCount())
+}
+
+func TestGetCertificateUnmanagedDomain(t *testing.T) {
+	manager, storage, ts := newTestManager(t)
+	defer ts.Close()
+
+	_, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.org"})
+	assert.EqualError(t, err, "tls: no certificate is managed for example.org")
+	_, err = manager.GetCertificate(&tls.ClientHelloInfo{})
+	assert.EqualError(t, err, "tls: missing server name")
+	assert.Equal(t, 0, storage.saveCount())
+}
+
+func TestGetCertificateRenewsInBackground(t *testing.T) {
+	manager, storage, ts := newTestManager(t)
+	defer ts.Close()
+
+	expiring := storagetest.CertificateResource(t, "www.example.com", time.Now().Add(10*24*time.Hour))
+	require.NoError(t, storage.Save(expiring))
+
+	cert, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.com"})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(10*24*time.Hour), cert.Leaf.NotAfter, time.Minute,
+		"Expected the expiring certificate to be served while it is renewed")
+
+	deadline := time.Now().Add(10 * time.Second)
+	for storage.saveCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, 2, storage.saveCount(), "Expected the certificate to be renewed")
+
+	deadline = time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		cert, err = manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.com"})
+		require.NoError(t, err)
+		if cert.Leaf.CheckSignatureFrom(ts.CACertificate()) == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NoError(t, cert.Leaf.CheckSignatureFrom(ts.CACertificate()))
+	assert.Equal(t, 2, storage.saveCount())
+}
+
+func TestGetCertificateRetriesAfterFailure(t *testing.T) {
+	manager, storage, ts := newTestManager(t)
+	defer ts.Close()
+
+	now := time.Now()
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return now }
+
+	ts.SetValidDomains([]string{"example.com"})
+	_, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.com"})
+	require.Error(t, err)
+
+	ts.SetValidDomains([]string{"example.com", "www.example.com"})
+	_, err = manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.com"})
+	assert.Error(t, err, "Expected the failure to be reported until retryInterval passed")
+
+	now = now.Add(retryInterval)
+	cert, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"www.example.com"}, cert.Leaf.DNSNames)
+	assert.Equal(t, 1, storage.saveCount())
+}